@@ -8,6 +8,32 @@ import (
 type Node interface {
 	// Accept accepts a visitor
 	Accept(visitor Visitor) interface{}
+
+	// Range returns the range of source text the node was parsed from
+	Range() SourceRange
+}
+
+// SourceRange is a half-open range of byte offsets into the source text
+// A zero range means the node was not created by the parser
+type SourceRange struct {
+	// Start is the offset of the first byte of the node
+	Start int
+
+	// End is the offset just past the last byte of the node
+	End int
+}
+
+// Range implements the Node interface for every node that embeds a SourceRange
+func (r SourceRange) Range() SourceRange {
+	return r
+}
+
+// Text returns the part of the source covered by the range
+func (r SourceRange) Text(source string) string {
+	if r.Start < 0 || r.End > len(source) || r.Start > r.End {
+		return ""
+	}
+	return source[r.Start:r.End]
 }
 
 // Visitor is the interface for visitors
@@ -21,6 +47,9 @@ type Visitor interface {
 	// VisitSelfNode visits a self node
 	VisitSelfNode(node *SelfNode) interface{}
 
+	// VisitThisContextNode visits a thisContext node
+	VisitThisContextNode(node *ThisContextNode) interface{}
+
 	// VisitLiteralNode visits a literal node
 	VisitLiteralNode(node *LiteralNode) interface{}
 
@@ -39,6 +68,8 @@ type Visitor interface {
 
 // MethodNode represents a method definition
 type MethodNode struct {
+	SourceRange
+
 	// Selector is the method selector
 	Selector string
 
@@ -48,11 +79,30 @@ type MethodNode struct {
 	// Temporaries are the method temporaries
 	Temporaries []string
 
-	// Body is the method body
+	// IsPrimitive is true if the method has a <primitive: ...> pragma
+	IsPrimitive bool
+
+	// PrimitiveIndex is the number of a numbered primitive
+	PrimitiveIndex int
+
+	// PrimitiveName and PrimitiveModule name a named primitive
+	PrimitiveName   string
+	PrimitiveModule string
+
+	// PrimitiveErrorName is the temporary that receives the failure code, from <primitive: ... error: name>
+	PrimitiveErrorName string
+
+	// Statements are the statements before the last one, whose values are discarded
+	Statements []Node
+
+	// Body is the last statement, nil for a method with no statements
 	Body Node
 
 	// Class is the method class
 	Class *pile.Object
+
+	// Source is the source text the method was parsed from
+	Source string
 }
 
 // Accept implements the Node interface
@@ -63,6 +113,8 @@ func (n *MethodNode) Accept(visitor Visitor) interface{} {
 
 // ReturnNode represents a return statement
 type ReturnNode struct {
+	SourceRange
+
 	// Expression is the expression to return
 	Expression Node
 }
@@ -74,16 +126,30 @@ func (n *ReturnNode) Accept(visitor Visitor) interface{} {
 
 
 // SelfNode represents the self reference
-type SelfNode struct{}
+type SelfNode struct {
+	SourceRange
+}
 
 // Accept implements the Node interface
 func (n *SelfNode) Accept(visitor Visitor) interface{} {
 	return visitor.VisitSelfNode(n)
 }
 
+// ThisContextNode represents the thisContext reference, the running context
+type ThisContextNode struct {
+	SourceRange
+}
+
+// Accept implements the Node interface
+func (n *ThisContextNode) Accept(visitor Visitor) interface{} {
+	return visitor.VisitThisContextNode(n)
+}
+
 
 // LiteralNode represents a literal value
 type LiteralNode struct {
+	SourceRange
+
 	// Value is the literal value
 	Value *pile.Object
 }
@@ -96,6 +162,8 @@ func (n *LiteralNode) Accept(visitor Visitor) interface{} {
 
 // VariableNode represents a variable reference
 type VariableNode struct {
+	SourceRange
+
 	// Name is the variable name
 	Name string
 }
@@ -108,6 +176,8 @@ func (n *VariableNode) Accept(visitor Visitor) interface{} {
 
 // AssignmentNode represents an assignment
 type AssignmentNode struct {
+	SourceRange
+
 	// Variable is the variable to assign to
 	Variable string
 
@@ -123,6 +193,8 @@ func (n *AssignmentNode) Accept(visitor Visitor) interface{} {
 
 // MessageSendNode represents a message send
 type MessageSendNode struct {
+	SourceRange
+
 	// Receiver is the message receiver
 	Receiver Node
 
@@ -141,13 +213,18 @@ func (n *MessageSendNode) Accept(visitor Visitor) interface{} {
 
 // BlockNode represents a block
 type BlockNode struct {
+	SourceRange
+
 	// Parameters are the block parameters
 	Parameters []string
 
 	// Temporaries are the block temporaries
 	Temporaries []string
 
-	// Body is the block body
+	// Statements are the statements before the last one, whose values are discarded
+	Statements []Node
+
+	// Body is the last statement, whose value the block answers
 	Body Node
 }
 
@@ -1,46 +1,90 @@
 package bytecode
 
 // Bytecode constants
+//
+// Instructions come in long and short forms. A long form is the opcode
+// followed by one byte per operand. Operands that do not fit in a byte are
+// extended by EXTEND_A, EXTEND_B or EXTEND_C prefixes in front of the
+// instruction, each supplying the next higher byte of the first, second or
+// third operand. Jump offsets are signed: the prefix and operand bytes together
+// form a big-endian two's complement number.
+//
+// Short forms are single bytes for the most common instructions, with the
+// operand in the low bits of the opcode. They decode to their long form.
 const (
-	// Bytecodes
-	PUSH_LITERAL             byte = 0  // Push a literal from the literals array (followed by 4-byte index)
-	PUSH_INSTANCE_VARIABLE   byte = 1  // Push an instance variable value (followed by 4-byte offset)
-	PUSH_TEMPORARY_VARIABLE  byte = 2  // Push a temporary variable value (followed by 4-byte offset)
+	// Long form bytecodes
+	PUSH_LITERAL             byte = 0  // Push a literal from the literals array (followed by 1-byte index)
+	PUSH_INSTANCE_VARIABLE   byte = 1  // Push an instance variable value (followed by 1-byte offset)
+	PUSH_TEMPORARY_VARIABLE  byte = 2  // Push a temporary variable value (followed by 1-byte offset)
 	PUSH_SELF                byte = 3  // Push self onto the stack
-	STORE_INSTANCE_VARIABLE  byte = 4  // Store a value into an instance variable (followed by 4-byte offset)
-	STORE_TEMPORARY_VARIABLE byte = 5  // Store a value into a temporary variable (followed by 4-byte offset)
-	SEND_MESSAGE             byte = 6  // Send a message (followed by 4-byte selector index and 4-byte arg count)
+	STORE_INSTANCE_VARIABLE  byte = 4  // Store a value into an instance variable (followed by 1-byte offset)
+	STORE_TEMPORARY_VARIABLE byte = 5  // Store a value into a temporary variable (followed by 1-byte offset)
+	SEND_MESSAGE             byte = 6  // Send a message (followed by 1-byte selector index and 1-byte arg count)
 	RETURN_STACK_TOP         byte = 7  // Return the value on top of the stack
-	JUMP                     byte = 8  // Jump to a different bytecode (followed by 4-byte target)
-	JUMP_IF_TRUE             byte = 9  // Jump if top of stack is true (followed by 4-byte target)
-	JUMP_IF_FALSE            byte = 10 // Jump if top of stack is false (followed by 4-byte target)
+	JUMP                     byte = 8  // Jump to a different bytecode (followed by 1-byte signed offset)
+	JUMP_IF_TRUE             byte = 9  // Jump if top of stack is true (followed by 1-byte signed offset)
+	JUMP_IF_FALSE            byte = 10 // Jump if top of stack is false (followed by 1-byte signed offset)
 	POP                      byte = 11 // Pop the top value from the stack
 	DUPLICATE                byte = 12 // Duplicate the top value on the stack
-	CREATE_BLOCK             byte = 13 // Create a block (followed by 4-byte bytecode size, 4-byte literal count, 4-byte temp var count)
-	EXECUTE_BLOCK            byte = 14 // Execute a block (followed by 4-byte arg count)
+	CREATE_BLOCK             byte = 13 // Create a block (followed by 1-byte bytecode size, 1-byte literal count, 1-byte temp var count)
+	EXECUTE_BLOCK            byte = 14 // Execute a block (followed by 1-byte arg count)
+
+	// Extension prefixes
+	EXTEND_A byte = 15 // Next higher byte of the first operand of the following instruction (followed by 1 byte)
+	EXTEND_B byte = 16 // Next higher byte of the second operand of the following instruction (followed by 1 byte)
+	EXTEND_C byte = 17 // Next higher byte of the third operand of the following instruction (followed by 1 byte)
+
+	// Long form bytecodes added after the prefixes
+	PUSH_THIS_CONTEXT byte = 18 // Push the running context onto the stack
+
+	// Short form bytecodes, the operand is in the low 4 bits
+	PUSH_TEMPORARY_VARIABLE_SHORT  byte = 0x20 // Push temporary variable 0-15
+	PUSH_LITERAL_SHORT             byte = 0x30 // Push literal 0-15
+	PUSH_INSTANCE_VARIABLE_SHORT   byte = 0x40 // Push instance variable 0-15
+	STORE_TEMPORARY_VARIABLE_SHORT byte = 0x50 // Store into temporary variable 0-15
+	SEND_MESSAGE_SHORT_0           byte = 0x60 // Send the selector in literal 0-15 with no arguments
+	SEND_MESSAGE_SHORT_1           byte = 0x70 // Send the selector in literal 0-15 with 1 argument
+	SEND_MESSAGE_SHORT_2           byte = 0x80 // Send the selector in literal 0-15 with 2 arguments
+
+	// ShortOperandLimit is the number of operand values a short form can hold
+	ShortOperandLimit = 16
 )
 
+// IsShort returns true if the bytecode is a short form
+func IsShort(bytecode byte) bool {
+	return bytecode >= PUSH_TEMPORARY_VARIABLE_SHORT && bytecode < SEND_MESSAGE_SHORT_2+ShortOperandLimit
+}
+
+// IsPrefix returns true if the bytecode is an extension prefix
+func IsPrefix(bytecode byte) bool {
+	return bytecode == EXTEND_A || bytecode == EXTEND_B || bytecode == EXTEND_C
+}
+
 // InstructionSize returns the size of the instruction in bytes (including the opcode)
+// The size does not include any extension prefixes in front of the instruction
 func InstructionSize(bytecode byte) int {
 	switch bytecode {
 	case PUSH_LITERAL, PUSH_INSTANCE_VARIABLE, PUSH_TEMPORARY_VARIABLE,
 		STORE_INSTANCE_VARIABLE, STORE_TEMPORARY_VARIABLE,
 		JUMP, JUMP_IF_TRUE, JUMP_IF_FALSE:
-		return 5 // 1 byte opcode + 4 byte operand
+		return 2 // 1 byte opcode + 1 byte operand
 	case SEND_MESSAGE:
-		return 9 // 1 byte opcode + 4 byte selector index + 4 byte arg count
+		return 3 // 1 byte opcode + 1 byte selector index + 1 byte arg count
 	case CREATE_BLOCK:
-		return 13 // 1 byte opcode + 4 byte bytecode size + 4 byte literal count + 4 byte temp var count
+		return 4 // 1 byte opcode + 1 byte bytecode size + 1 byte literal count + 1 byte temp var count
 	case EXECUTE_BLOCK:
-		return 5 // 1 byte opcode + 4 byte arg count
-	case PUSH_SELF, RETURN_STACK_TOP, POP, DUPLICATE:
+		return 2 // 1 byte opcode + 1 byte arg count
+	case EXTEND_A, EXTEND_B, EXTEND_C:
+		return 2 // 1 byte prefix + 1 byte extension
+	case PUSH_SELF, PUSH_THIS_CONTEXT, RETURN_STACK_TOP, POP, DUPLICATE:
 		return 1 // 1 byte opcode
 	default:
-		return 1 // Default to 1 byte for unknown bytecodes
+		return 1 // Short forms and unknown bytecodes are 1 byte
 	}
 }
 
 // BytecodeName returns the name of the bytecode
+// Short forms are named after the long form they decode to
 func BytecodeName(bytecode byte) string {
 	switch bytecode {
 	case PUSH_LITERAL:
@@ -73,8 +117,35 @@ func BytecodeName(bytecode byte) string {
 		return "CREATE_BLOCK"
 	case EXECUTE_BLOCK:
 		return "EXECUTE_BLOCK"
+	case EXTEND_A:
+		return "EXTEND_A"
+	case EXTEND_B:
+		return "EXTEND_B"
+	case EXTEND_C:
+		return "EXTEND_C"
+	case PUSH_THIS_CONTEXT:
+		return "PUSH_THIS_CONTEXT"
 	default:
+		if IsShort(bytecode) {
+			return BytecodeName(LongForm(bytecode))
+		}
 		return "UNKNOWN"
 	}
 }
 
+// LongForm returns the long form opcode a bytecode decodes to
+func LongForm(bytecode byte) byte {
+	switch bytecode &^ (ShortOperandLimit - 1) {
+	case PUSH_TEMPORARY_VARIABLE_SHORT:
+		return PUSH_TEMPORARY_VARIABLE
+	case PUSH_LITERAL_SHORT:
+		return PUSH_LITERAL
+	case PUSH_INSTANCE_VARIABLE_SHORT:
+		return PUSH_INSTANCE_VARIABLE
+	case STORE_TEMPORARY_VARIABLE_SHORT:
+		return STORE_TEMPORARY_VARIABLE
+	case SEND_MESSAGE_SHORT_0, SEND_MESSAGE_SHORT_1, SEND_MESSAGE_SHORT_2:
+		return SEND_MESSAGE
+	}
+	return bytecode
+}
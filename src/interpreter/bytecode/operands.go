@@ -0,0 +1,271 @@
+package bytecode
+
+import (
+	"fmt"
+)
+
+// MaxOperandBytes is the most bytes an operand can take, including its prefixes
+const MaxOperandBytes = 4
+
+// Instruction is a decoded instruction
+type Instruction struct {
+	// Opcode is the long form opcode, short forms and prefixes are already decoded
+	Opcode byte
+
+	// Operands holds the first OperandCount(Opcode) operands
+	Operands [3]int
+
+	// Size is the number of bytes the instruction takes, including its prefixes
+	Size int
+}
+
+// Operand returns the operand at the given index
+func (i Instruction) Operand(index int) int {
+	return i.Operands[index]
+}
+
+// JumpTarget returns the PC a jump instruction starting at pc lands on
+// Offsets are signed and relative to the end of the instruction
+func (i Instruction) JumpTarget(pc int) int {
+	return pc + i.Size + i.Operands[0]
+}
+
+// OperandCount returns the number of operands of the long form of the bytecode
+func OperandCount(bytecode byte) int {
+	return InstructionSize(LongForm(bytecode)) - 1
+}
+
+// IsKnown returns true if the byte is a defined opcode
+func IsKnown(bytecode byte) bool {
+	return BytecodeName(bytecode) != "UNKNOWN"
+}
+
+// IsJump returns true if the bytecode is a jump whose operand is a relative offset
+func IsJump(bytecode byte) bool {
+	return bytecode == JUMP || bytecode == JUMP_IF_TRUE || bytecode == JUMP_IF_FALSE
+}
+
+// OpcodeNamed returns the long form opcode with the given name, as returned by BytecodeName
+func OpcodeNamed(name string) (byte, bool) {
+	for opcode := 0; opcode < 256; opcode++ {
+		if IsKnown(byte(opcode)) && !IsShort(byte(opcode)) && !IsPrefix(byte(opcode)) && BytecodeName(byte(opcode)) == name {
+			return byte(opcode), true
+		}
+	}
+	return 0, false
+}
+
+// opcodeInfo is what Decode needs to know about one byte value
+type opcodeInfo struct {
+	known    bool
+	prefix   bool
+	short    bool
+	longForm byte
+	size     int
+	operands int
+
+	// shortOperands are the operands a short form carries in its opcode
+	shortOperands [2]int
+}
+
+// opcodeTable describes every byte value so decoding an instruction is a table lookup
+var opcodeTable [256]opcodeInfo
+
+func init() {
+	for value := 0; value < 256; value++ {
+		opcode := byte(value)
+		info := opcodeInfo{
+			known:    BytecodeName(opcode) != "UNKNOWN",
+			prefix:   IsPrefix(opcode),
+			short:    IsShort(opcode),
+			longForm: LongForm(opcode),
+			size:     InstructionSize(opcode),
+			operands: InstructionSize(LongForm(opcode)) - 1,
+		}
+		if info.short {
+			info.shortOperands[0] = int(opcode & (ShortOperandLimit - 1))
+			if info.longForm == SEND_MESSAGE {
+				info.shortOperands[1] = int(opcode-SEND_MESSAGE_SHORT_0) / ShortOperandLimit
+			}
+		}
+		opcodeTable[value] = info
+	}
+}
+
+// Decode decodes the instruction starting at pc, including any extension prefixes
+// Errors do not include the pc, callers add it
+func Decode(bytecodes []byte, pc int) (Instruction, error) {
+	var instruction Instruction
+	err := DecodeInto(&instruction, bytecodes, pc)
+	return instruction, err
+}
+
+// DecodeInto decodes the instruction starting at pc into an existing Instruction
+// The VM decodes every instruction it executes, this avoids copying the result
+func DecodeInto(instruction *Instruction, bytecodes []byte, pc int) error {
+	if pc < 0 || pc >= len(bytecodes) {
+		return fmt.Errorf("pc out of bounds")
+	}
+
+	// Most instructions have no prefixes, decode them without the prefix bookkeeping
+	info := &opcodeTable[bytecodes[pc]]
+	if info.prefix {
+		decoded, err := decodeExtended(bytecodes, pc)
+		*instruction = decoded
+		return err
+	}
+	if !info.known {
+		return fmt.Errorf("unknown opcode %d", bytecodes[pc])
+	}
+
+	instruction.Opcode = info.longForm
+	instruction.Size = info.size
+	if info.short {
+		instruction.Operands[0] = info.shortOperands[0]
+		instruction.Operands[1] = info.shortOperands[1]
+		return nil
+	}
+	if pc+info.size > len(bytecodes) {
+		return fmt.Errorf("truncated %s, needs %d bytes, only %d left", BytecodeName(bytecodes[pc]), info.size, len(bytecodes)-pc)
+	}
+	for index := 0; index < info.operands; index++ {
+		instruction.Operands[index] = int(bytecodes[pc+1+index])
+	}
+	if IsJump(info.longForm) {
+		instruction.Operands[0] = int(int8(instruction.Operands[0]))
+	}
+	return nil
+}
+
+// decodeExtended decodes an instruction that starts with extension prefixes
+func decodeExtended(bytecodes []byte, pc int) (Instruction, error) {
+	// Collect the prefixes, they hold the high bytes of each operand
+	var extensions [3]int
+	var extensionBytes [3]int
+	position := pc
+	for position < len(bytecodes) && IsPrefix(bytecodes[position]) {
+		index := int(bytecodes[position] - EXTEND_A)
+		if position+1 >= len(bytecodes) {
+			return Instruction{}, fmt.Errorf("truncated %s prefix", BytecodeName(bytecodes[position]))
+		}
+		if extensionBytes[index]+1 >= MaxOperandBytes {
+			return Instruction{}, fmt.Errorf("too many %s prefixes", BytecodeName(bytecodes[position]))
+		}
+		extensions[index] = extensions[index]<<8 | int(bytecodes[position+1])
+		extensionBytes[index]++
+		position += 2
+	}
+	if position >= len(bytecodes) {
+		return Instruction{}, fmt.Errorf("prefixes are not followed by an instruction")
+	}
+
+	opcode := bytecodes[position]
+	if !IsKnown(opcode) {
+		return Instruction{}, fmt.Errorf("unknown opcode %d", opcode)
+	}
+
+	instruction := Instruction{Opcode: LongForm(opcode)}
+	count := OperandCount(opcode)
+	if IsShort(opcode) {
+		count = 0
+	}
+	for index := count; index < len(extensionBytes); index++ {
+		if extensionBytes[index] > 0 {
+			return Instruction{}, fmt.Errorf("%s prefix does not match an operand of %s", BytecodeName(EXTEND_A+byte(index)), BytecodeName(opcode))
+		}
+	}
+
+	// Short forms carry their operands in the opcode
+	if IsShort(opcode) {
+		instruction.Operands[0] = int(opcode & (ShortOperandLimit - 1))
+		if instruction.Opcode == SEND_MESSAGE {
+			instruction.Operands[1] = int(opcode-SEND_MESSAGE_SHORT_0) / ShortOperandLimit
+		}
+		instruction.Size = position + 1 - pc
+		return instruction, nil
+	}
+
+	size := InstructionSize(opcode)
+	if position+size > len(bytecodes) {
+		return Instruction{}, fmt.Errorf("truncated %s, needs %d bytes, only %d left", BytecodeName(opcode), size, len(bytecodes)-position)
+	}
+	for index := 0; index < count; index++ {
+		value := extensions[index]<<8 | int(bytecodes[position+1+index])
+		if IsJump(opcode) {
+			// Sign extend from the number of bytes the offset was written in
+			bits := uint(8 * (extensionBytes[index] + 1))
+			value = int(int64(value) << (64 - bits) >> (64 - bits))
+		}
+		instruction.Operands[index] = value
+	}
+	instruction.Size = position + size - pc
+	return instruction, nil
+}
+
+// AppendInstruction appends the shortest encoding of an instruction to the bytecodes
+// The opcode is a long form, the encoding is a short form when one exists for the operands
+func AppendInstruction(bytecodes []byte, opcode byte, operands ...int) []byte {
+	if len(operands) != OperandCount(opcode) {
+		panic(fmt.Sprintf("%s takes %d operands, got %d", BytecodeName(opcode), OperandCount(opcode), len(operands)))
+	}
+
+	if short, ok := shortForm(opcode, operands); ok {
+		return append(bytecodes, short)
+	}
+
+	// Emit the high bytes of each operand as prefixes, most significant first
+	lowBytes := make([]byte, len(operands))
+	for index, operand := range operands {
+		width := operandWidth(operand, IsJump(opcode))
+		for shift := 8 * (width - 1); shift > 0; shift -= 8 {
+			bytecodes = append(bytecodes, EXTEND_A+byte(index), byte(operand>>uint(shift)))
+		}
+		lowBytes[index] = byte(operand)
+	}
+
+	bytecodes = append(bytecodes, opcode)
+	return append(bytecodes, lowBytes...)
+}
+
+// shortForm returns the short form of an instruction if there is one
+func shortForm(opcode byte, operands []int) (byte, bool) {
+	if len(operands) == 0 || operands[0] < 0 || operands[0] >= ShortOperandLimit {
+		return 0, false
+	}
+	operand := byte(operands[0])
+
+	switch opcode {
+	case PUSH_TEMPORARY_VARIABLE:
+		return PUSH_TEMPORARY_VARIABLE_SHORT + operand, true
+	case PUSH_LITERAL:
+		return PUSH_LITERAL_SHORT + operand, true
+	case PUSH_INSTANCE_VARIABLE:
+		return PUSH_INSTANCE_VARIABLE_SHORT + operand, true
+	case STORE_TEMPORARY_VARIABLE:
+		return STORE_TEMPORARY_VARIABLE_SHORT + operand, true
+	case SEND_MESSAGE:
+		switch operands[1] {
+		case 0:
+			return SEND_MESSAGE_SHORT_0 + operand, true
+		case 1:
+			return SEND_MESSAGE_SHORT_1 + operand, true
+		case 2:
+			return SEND_MESSAGE_SHORT_2 + operand, true
+		}
+	}
+	return 0, false
+}
+
+// operandWidth returns the number of bytes needed to encode an operand
+func operandWidth(operand int, signed bool) int {
+	for width := 1; width < MaxOperandBytes; width++ {
+		bits := uint(8 * width)
+		if signed && operand >= -(1<<(bits-1)) && operand < 1<<(bits-1) {
+			return width
+		}
+		if !signed && operand >= 0 && operand < 1<<bits {
+			return width
+		}
+	}
+	return MaxOperandBytes
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"smalltalklsp/interpreter/ast"
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/parser"
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// compileCode parses and compiles a string as either a method or an expression
+func compileCode(virtualMachine *vm.VM, input string, className string, methodMode bool, disabled []string) (method *pile.Method, err error) {
+	classObj := virtualMachine.GetGlobal(className)
+	if classObj == nil || pile.IsImmediate(classObj) || classObj.Type() != pile.OBJ_CLASS {
+		return nil, fmt.Errorf("unknown class: %s", className)
+	}
+
+	// Parse based on whether we're in method or expression mode
+	p := parser.NewParser(input, classObj, virtualMachine)
+	var node ast.Node
+	if methodMode {
+		node, err = p.Parse()
+	} else {
+		node, err = p.ParseExpression()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The compiler panics on code it cannot handle, report that as an error
+	defer func() {
+		if r := recover(); r != nil {
+			method, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+
+	// Compile the parsed code, keeping the source for the debug info
+	bytecodeCompiler := compiler.NewBytecodeCompiler(classObj)
+	bytecodeCompiler.Source = input
+	if err := bytecodeCompiler.Optimizer.Disable(disabled...); err != nil {
+		return nil, err
+	}
+	return bytecodeCompiler.Compile(node), nil
+}
+
+func main() {
+	// Check if we have the right number of arguments
+	if len(os.Args) < 2 {
+		fmt.Println("Usage: disasm [code to compile | -f filename] [--method] [--class ClassName] [--disable pass,...]")
+		fmt.Println("\nCompiles a Smalltalk expression (or method with --method) and prints its bytecode.")
+		fmt.Printf("Optimization passes that can be disabled, or 'all': %s\n", strings.Join(compiler.NewOptimizer().Names(), ", "))
+		fmt.Println("\nExamples:")
+		fmt.Println("  disasm \"3 + 4\"")
+		fmt.Println("  disasm \"[:x | x + 1] value: 2\"")
+		fmt.Println("  disasm \"double: x ^x + x\" --method --class Integer")
+		fmt.Println("  disasm -f mycode.st --method")
+		fmt.Println("  disasm \"3 + 4\" --disable constant-folding")
+		os.Exit(1)
+	}
+
+	// Collect the options and the remaining code arguments
+	methodMode := false
+	className := "Object"
+	fileName := ""
+	disabled := []string{}
+	codeArgs := []string{}
+	for i := 1; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--method":
+			methodMode = true
+		case "--class":
+			if i+1 >= len(os.Args) {
+				fmt.Println("Error: No class specified after --class")
+				os.Exit(1)
+			}
+			i++
+			className = os.Args[i]
+		case "-f":
+			if i+1 >= len(os.Args) {
+				fmt.Println("Error: No file specified after -f")
+				os.Exit(1)
+			}
+			i++
+			fileName = os.Args[i]
+		case "--disable":
+			if i+1 >= len(os.Args) {
+				fmt.Println("Error: No passes specified after --disable")
+				os.Exit(1)
+			}
+			i++
+			if os.Args[i] == "all" {
+				disabled = compiler.NewOptimizer().Names()
+			} else {
+				disabled = append(disabled, strings.Split(os.Args[i], ",")...)
+			}
+		default:
+			codeArgs = append(codeArgs, os.Args[i])
+		}
+	}
+
+	// Get the code to compile - either from a file or directly from arguments
+	code := strings.Join(codeArgs, " ")
+	if fileName != "" {
+		fileContent, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			fmt.Printf("Error reading file: %v\n", err)
+			os.Exit(1)
+		}
+		code = string(fileContent)
+	}
+
+	virtualMachine := vm.NewVM()
+	method, err := compileCode(virtualMachine, code, className, methodMode, disabled)
+	if err != nil {
+		fmt.Printf("Error compiling code: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Print(compiler.Disassemble(method))
+}
@@ -13,10 +13,14 @@ type JSONVisitor struct{}
 
 // VisitMethodNode visits a method node
 func (v *JSONVisitor) VisitMethodNode(node *ast.MethodNode) interface{} {
-	bodyJSON := ""
+	bodyJSON := "null"
 	if node.Body != nil {
 		bodyJSON = node.Body.Accept(v).(string)
 	}
+	statements := make([]string, len(node.Statements))
+	for i, statement := range node.Statements {
+		statements[i] = statement.Accept(v).(string)
+	}
 
 	// Convert array strings to JSON array format
 	paramsJSON := formatStringArray(node.Parameters)
@@ -27,8 +31,9 @@ func (v *JSONVisitor) VisitMethodNode(node *ast.MethodNode) interface{} {
   "selector": "%s",
   "parameters": %s,
   "temporaries": %s,
+  "statements": [%s],
   "body": %s
-}`, node.Selector, paramsJSON, tempsJSON, bodyJSON)
+}`, node.Selector, paramsJSON, tempsJSON, strings.Join(statements, ", "), bodyJSON)
 }
 
 // VisitReturnNode visits a return node
@@ -51,6 +56,13 @@ func (v *JSONVisitor) VisitSelfNode(node *ast.SelfNode) interface{} {
 }`
 }
 
+// VisitThisContextNode visits a thisContext node
+func (v *JSONVisitor) VisitThisContextNode(node *ast.ThisContextNode) interface{} {
+	return `{
+  "type": "ThisContextNode"
+}`
+}
+
 // VisitLiteralNode visits a literal node
 func (v *JSONVisitor) VisitLiteralNode(node *ast.LiteralNode) interface{} {
 	literalJSON := "null"
@@ -142,6 +154,10 @@ func (v *JSONVisitor) VisitBlockNode(node *ast.BlockNode) interface{} {
 	if node.Body != nil {
 		bodyJSON = node.Body.Accept(v).(string)
 	}
+	statements := make([]string, len(node.Statements))
+	for i, statement := range node.Statements {
+		statements[i] = statement.Accept(v).(string)
+	}
 
 	// Convert array strings to JSON array format
 	paramsJSON := formatStringArray(node.Parameters)
@@ -151,8 +167,9 @@ func (v *JSONVisitor) VisitBlockNode(node *ast.BlockNode) interface{} {
   "type": "BlockNode",
   "parameters": %s,
   "temporaries": %s,
+  "statements": [%s],
   "body": %s
-}`, paramsJSON, tempsJSON, bodyJSON)
+}`, paramsJSON, tempsJSON, strings.Join(statements, ", "), bodyJSON)
 }
 
 // Helper functions
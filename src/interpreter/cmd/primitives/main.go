@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	_ "smalltalklsp/interpreter/primitives/strings"
+	"smalltalklsp/interpreter/vm"
+)
+
+func main() {
+	// Optionally list a single module, "core" for the VM's own primitives
+	module := ""
+	if len(os.Args) > 1 {
+		if len(os.Args) > 2 || os.Args[1] == "-h" || os.Args[1] == "--help" {
+			fmt.Println("Usage: primitives [module]")
+			fmt.Println("\nLists the registered primitives, or those of one module ('core' for the VM's own).")
+			os.Exit(1)
+		}
+		module = os.Args[1]
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(out, "NUMBER\tMODULE\tNAME\tARITY\tRECEIVER")
+	for _, primitive := range vm.DefaultPrimitives().Primitives() {
+		primitiveModule := primitive.Module
+		if primitiveModule == "" {
+			primitiveModule = "core"
+		}
+		if module != "" && module != primitiveModule {
+			continue
+		}
+
+		number := "-"
+		if primitive.Index > 0 {
+			number = fmt.Sprint(primitive.Index)
+		}
+		receiver := primitive.Receiver
+		if receiver == "" {
+			receiver = "any"
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%d\t%s\n", number, primitiveModule, primitive.Name, primitive.Arity, receiver)
+	}
+	out.Flush()
+}
@@ -0,0 +1,344 @@
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"smalltalklsp/interpreter/bytecode"
+	"smalltalklsp/interpreter/pile"
+)
+
+// AssemblerVM is the part of the VM the assembler needs to create literals and find classes
+type AssemblerVM interface {
+	NewString(value string) *pile.Object
+	NewFloat(value float64) *pile.Object
+	NewArray(size int) *pile.Object
+	GetGlobal(name string) *pile.Object
+}
+
+// Assemble parses the text produced by Disassemble back into a method.
+// The method is not installed in its class's method dictionary.
+//
+// The text has optional "class:", "selector:", "primitive:", "temps:" and
+// "literals:" sections followed by a "bytecodes:" section with one long form
+// instruction per line, which is encoded in its shortest form. Leading PCs are
+// ignored and anything after a ";" on an instruction line is a comment.
+func Assemble(text string, vm AssemblerVM) (*pile.Method, error) {
+	method := &pile.Method{
+		Object: pile.Object{
+			TypeField: pile.OBJ_METHOD,
+		},
+		Bytecodes:    []byte{},
+		Literals:     []*pile.Object{},
+		TempVarNames: []string{},
+	}
+
+	section := ""
+	for lineNumber, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+
+		var err error
+		switch {
+		case strings.HasPrefix(trimmed, "class:"):
+			err = assembleClass(method, strings.TrimSpace(strings.TrimPrefix(trimmed, "class:")), vm)
+		case strings.HasPrefix(trimmed, "selector:"):
+			method.Selector = pile.NewSymbol(strings.TrimSpace(strings.TrimPrefix(trimmed, "selector:")))
+		case strings.HasPrefix(trimmed, "primitive:"):
+			err = assemblePrimitive(method, strings.TrimSpace(strings.TrimPrefix(trimmed, "primitive:")))
+		case strings.HasPrefix(trimmed, "temps:"):
+			method.TempVarNames = strings.Fields(strings.TrimPrefix(trimmed, "temps:"))
+		case trimmed == "literals:" || trimmed == "bytecodes:":
+			section = strings.TrimSuffix(trimmed, ":")
+		case section == "literals":
+			err = assembleLiteral(method, trimmed, vm)
+		case section == "bytecodes":
+			method.Bytecodes, err = assembleInstruction(method.Bytecodes, trimmed)
+		default:
+			err = fmt.Errorf("unexpected text outside of a section: %s", trimmed)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber+1, err)
+		}
+	}
+
+	return method, nil
+}
+
+// assemblePrimitive marks the method as a primitive, either numbered ("7") or
+// named with an optional module ("'stringConcat' module: 'strings'"), followed
+// by an optional temporary for the failure code ("error: ec")
+func assemblePrimitive(method *pile.Method, text string) error {
+	method.IsPrimitive = true
+	if index := strings.Index(text, " error: "); index >= 0 {
+		method.PrimitiveError = strings.TrimSpace(text[index+len(" error: "):])
+		text = text[:index]
+	}
+	if !strings.HasPrefix(text, "'") {
+		index, err := strconv.Atoi(text)
+		method.PrimitiveIndex = index
+		return err
+	}
+
+	parts := strings.Split(text, "'")
+	switch {
+	case len(parts) == 3 && parts[2] == "":
+		method.SetPrimitiveName(parts[1], "")
+	case len(parts) == 5 && strings.TrimSpace(parts[2]) == "module:" && parts[4] == "":
+		method.SetPrimitiveName(parts[1], parts[3])
+	default:
+		return fmt.Errorf("invalid primitive: %s", text)
+	}
+	return nil
+}
+
+// assembleClass sets the method class from a global class name
+func assembleClass(method *pile.Method, name string, vm AssemblerVM) error {
+	class := vm.GetGlobal(name)
+	if class == nil || pile.IsImmediate(class) || class.Type() != pile.OBJ_CLASS {
+		return fmt.Errorf("unknown class: %s", name)
+	}
+	method.MethodClass = pile.ObjectToClass(class)
+	return nil
+}
+
+// assembleLiteral parses a "index: literal" line and appends the literal
+func assembleLiteral(method *pile.Method, line string, vm AssemblerVM) error {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return fmt.Errorf("expected index: literal, got %s", line)
+	}
+
+	index, err := strconv.Atoi(strings.TrimSpace(line[:colon]))
+	if err != nil {
+		return fmt.Errorf("invalid literal index: %v", err)
+	}
+	if index != len(method.Literals) {
+		return fmt.Errorf("expected literal %d, got %d", len(method.Literals), index)
+	}
+
+	literal, err := ParseLiteral(strings.TrimSpace(line[colon+1:]), vm)
+	if err != nil {
+		return err
+	}
+	method.Literals = append(method.Literals, literal)
+	return nil
+}
+
+// assembleInstruction parses an instruction line and appends its encoding to the bytecodes
+func assembleInstruction(bytecodes []byte, line string) ([]byte, error) {
+	if comment := strings.Index(line, ";"); comment >= 0 {
+		line = line[:comment]
+	}
+	fields := strings.Fields(line)
+
+	// Skip the PC column written by the disassembler
+	if len(fields) > 0 && isDigit(fields[0][0]) {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("missing instruction")
+	}
+
+	opcode, ok := bytecode.OpcodeNamed(fields[0])
+	if !ok {
+		return nil, fmt.Errorf("unknown instruction: %s", fields[0])
+	}
+
+	operands := fields[1:]
+	if len(operands) != bytecode.OperandCount(opcode) {
+		return nil, fmt.Errorf("%s takes %d operands, got %d", fields[0], bytecode.OperandCount(opcode), len(operands))
+	}
+
+	values := make([]int, len(operands))
+	for i, text := range operands {
+		operand, err := strconv.Atoi(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid operand for %s: %s", fields[0], text)
+		}
+		if operand < 0 && !bytecode.IsJump(opcode) {
+			return nil, fmt.Errorf("negative operand for %s: %d", fields[0], operand)
+		}
+		values[i] = operand
+	}
+	return bytecode.AppendInstruction(bytecodes, opcode, values...), nil
+}
+
+// ParseLiteral parses a literal written by FormatLiteral
+func ParseLiteral(text string, vm AssemblerVM) (*pile.Object, error) {
+	reader := &literalReader{text: text, vm: vm}
+	literal, err := reader.read()
+	if err != nil {
+		return nil, err
+	}
+	reader.skipWhitespace()
+	if reader.pos != len(reader.text) {
+		return nil, fmt.Errorf("unexpected text after literal: %s", reader.text[reader.pos:])
+	}
+	return literal, nil
+}
+
+// literalReader reads literals from text
+type literalReader struct {
+	text string
+	pos  int
+	vm   AssemblerVM
+}
+
+// skipWhitespace advances past spaces and tabs
+func (r *literalReader) skipWhitespace() {
+	for r.pos < len(r.text) && (r.text[r.pos] == ' ' || r.text[r.pos] == '\t') {
+		r.pos++
+	}
+}
+
+// read reads one literal
+func (r *literalReader) read() (*pile.Object, error) {
+	r.skipWhitespace()
+	if r.pos >= len(r.text) {
+		return nil, fmt.Errorf("missing literal")
+	}
+
+	c := r.text[r.pos]
+	switch {
+	case c == '\'':
+		value, err := r.readQuoted()
+		if err != nil {
+			return nil, err
+		}
+		return r.vm.NewString(value), nil
+	case c == '#':
+		return r.readHashLiteral()
+	case isDigit(c) || c == '-' || c == '+':
+		return r.readNumber()
+	case isIdentifierStart(c):
+		return r.readName()
+	}
+	return nil, fmt.Errorf("invalid literal: %s", r.text[r.pos:])
+}
+
+// readQuoted reads a quoted string with doubled quotes as escapes
+func (r *literalReader) readQuoted() (string, error) {
+	var value strings.Builder
+	r.pos++ // Skip the opening quote
+	for r.pos < len(r.text) {
+		c := r.text[r.pos]
+		r.pos++
+		if c != '\'' {
+			value.WriteByte(c)
+			continue
+		}
+		if r.pos < len(r.text) && r.text[r.pos] == '\'' {
+			value.WriteByte('\'')
+			r.pos++
+			continue
+		}
+		return value.String(), nil
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+// readHashLiteral reads a symbol or literal array
+func (r *literalReader) readHashLiteral() (*pile.Object, error) {
+	r.pos++ // Skip the #
+	if r.pos >= len(r.text) {
+		return nil, fmt.Errorf("invalid symbol")
+	}
+
+	switch c := r.text[r.pos]; {
+	case c == '\'':
+		value, err := r.readQuoted()
+		if err != nil {
+			return nil, err
+		}
+		return pile.NewSymbol(value), nil
+	case c == '(':
+		return r.readArray()
+	}
+
+	start := r.pos
+	for r.pos < len(r.text) && !strings.ContainsRune(" \t)", rune(r.text[r.pos])) {
+		r.pos++
+	}
+	value := r.text[start:r.pos]
+	if !isSelector(value) {
+		return nil, fmt.Errorf("invalid symbol: #%s", value)
+	}
+	return pile.NewSymbol(value), nil
+}
+
+// readArray reads the elements of a literal array up to the closing parenthesis
+func (r *literalReader) readArray() (*pile.Object, error) {
+	r.pos++ // Skip the (
+	elements := []*pile.Object{}
+	for {
+		r.skipWhitespace()
+		if r.pos >= len(r.text) {
+			return nil, fmt.Errorf("unterminated literal array")
+		}
+		if r.text[r.pos] == ')' {
+			r.pos++
+			break
+		}
+		element, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+
+	arrayObj := r.vm.NewArray(len(elements))
+	array := pile.ObjectToArray(arrayObj)
+	for i, element := range elements {
+		array.AtPut(i, element)
+	}
+	return arrayObj, nil
+}
+
+// readNumber reads an integer or float
+func (r *literalReader) readNumber() (*pile.Object, error) {
+	start := r.pos
+	for r.pos < len(r.text) && !strings.ContainsRune(" \t)", rune(r.text[r.pos])) {
+		r.pos++
+	}
+	text := r.text[start:r.pos]
+
+	if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return pile.MakeIntegerImmediate(value), nil
+	}
+	if value, err := strconv.ParseFloat(text, 64); err == nil {
+		return r.vm.NewFloat(value), nil
+	}
+	return nil, fmt.Errorf("invalid number: %s", text)
+}
+
+// readName reads nil, true, false or the name of a global
+func (r *literalReader) readName() (*pile.Object, error) {
+	start := r.pos
+	for r.pos < len(r.text) && (isIdentifierStart(r.text[r.pos]) || isDigit(r.text[r.pos])) {
+		r.pos++
+	}
+	name := r.text[start:r.pos]
+
+	switch name {
+	case "nil":
+		return pile.MakeNilImmediate(), nil
+	case "true":
+		return pile.MakeTrueImmediate(), nil
+	case "false":
+		return pile.MakeFalseImmediate(), nil
+	case "NaN":
+		return r.vm.NewFloat(math.NaN()), nil
+	}
+
+	global := r.vm.GetGlobal(name)
+	if global == nil || pile.IsNilImmediate(global) {
+		return nil, fmt.Errorf("unknown global: %s", name)
+	}
+	return global, nil
+}
@@ -1,7 +1,6 @@
 package compiler
 
 import (
-	"encoding/binary"
 	"fmt"
 
 	"smalltalklsp/interpreter/ast"
@@ -25,6 +24,16 @@ type BytecodeCompiler struct {
 
 	// Class is the class the method belongs to
 	Class *pile.Object
+
+	// Source is the source text the AST was parsed from
+	// Method nodes carry their own source; set this when compiling an expression
+	Source string
+
+	// DebugInfo maps the generated bytecodes back to the source
+	DebugInfo *pile.DebugInfo
+
+	// Optimizer runs the optimization passes, nil compiles without optimizing
+	Optimizer *Optimizer
 }
 
 // NewBytecodeCompiler creates a new bytecode compiler
@@ -35,6 +44,7 @@ func NewBytecodeCompiler(class *pile.Object) *BytecodeCompiler {
 		Bytecodes:    []byte{},
 		TempVarNames: []string{},
 		Class:        class,
+		Optimizer:    NewOptimizer(),
 	}
 }
 
@@ -50,17 +60,37 @@ func (c *BytecodeCompiler) Compile(node ast.Node) *pile.Method {
 		TempVarNames: []string{},
 	}
 
-	// Visit the node
+	// Method nodes know their own source text
+	if methodNode, ok := node.(*ast.MethodNode); ok && c.Source == "" {
+		c.Source = methodNode.Source
+	}
+	c.DebugInfo = pile.NewDebugInfo(c.Source)
+
+	// Optimize the AST, then visit it
+	node = c.Optimizer.OptimizeAST(node)
 	node.Accept(c)
 
 	// Set the method bytecodes and literals
 	c.Method.Bytecodes = c.Bytecodes
 	c.Method.Literals = c.Literals
 	c.Method.TempVarNames = c.TempVarNames
+	c.Method.DebugInfo = c.DebugInfo
 
 	// Set the method class
 	c.Method.SetMethodClass(pile.ObjectToClass(c.Class))
 
+	// Optimize the generated bytecodes
+	if err := c.Optimizer.OptimizeMethod(c.Method); err != nil {
+		panic(err)
+	}
+	c.Bytecodes = c.Method.Bytecodes
+	c.DebugInfo = c.Method.DebugInfo
+
+	// The compiler must never produce bytecodes the VM cannot execute safely
+	if err := Verify(c.Method); err != nil {
+		panic(err)
+	}
+
 	return c.Method
 }
 
@@ -72,10 +102,40 @@ func (c *BytecodeCompiler) VisitMethodNode(node *ast.MethodNode) interface{} {
 	// Set the temporary variable names
 	c.TempVarNames = append(c.TempVarNames, node.Parameters...)
 	c.TempVarNames = append(c.TempVarNames, node.Temporaries...)
+
+	// The body only runs if the primitive fails, with the failure code in a temporary of its own
+	if node.IsPrimitive {
+		c.Method.SetPrimitive(true)
+		c.Method.SetPrimitiveIndex(node.PrimitiveIndex)
+		c.Method.SetPrimitiveName(node.PrimitiveName, node.PrimitiveModule)
+		if node.PrimitiveErrorName != "" {
+			declared := false
+			for _, name := range c.TempVarNames {
+				declared = declared || name == node.PrimitiveErrorName
+			}
+			if !declared {
+				c.TempVarNames = append(c.TempVarNames, node.PrimitiveErrorName)
+			}
+			c.Method.SetPrimitiveError(node.PrimitiveErrorName)
+		}
+	}
 	c.Method.TempVarNames = c.TempVarNames
 
-	// Compile the method body
-	node.Body.Accept(c)
+	// Compile the method body, discarding the values of the statements before the
+	// last, a method that does not end in a return answers self
+	for _, statement := range node.Statements {
+		statement.Accept(c)
+		c.Bytecodes = bytecode.AppendInstruction(c.Bytecodes, bytecode.POP)
+	}
+	if _, ok := node.Body.(*ast.ReturnNode); ok {
+		node.Body.Accept(c)
+		return nil
+	}
+	if node.Body != nil {
+		node.Body.Accept(c)
+		c.Bytecodes = bytecode.AppendInstruction(c.Bytecodes, bytecode.POP)
+	}
+	c.Bytecodes = append(c.Bytecodes, bytecode.PUSH_SELF, bytecode.RETURN_STACK_TOP)
 
 	return nil
 }
@@ -86,6 +146,7 @@ func (c *BytecodeCompiler) VisitReturnNode(node *ast.ReturnNode) interface{} {
 	node.Expression.Accept(c)
 
 	// Add the return bytecode
+	c.mark(node)
 	c.Bytecodes = append(c.Bytecodes, bytecode.RETURN_STACK_TOP)
 
 	return nil
@@ -94,23 +155,29 @@ func (c *BytecodeCompiler) VisitReturnNode(node *ast.ReturnNode) interface{} {
 // VisitSelfNode visits a self node
 func (c *BytecodeCompiler) VisitSelfNode(node *ast.SelfNode) interface{} {
 	// Add the push self bytecode
+	c.mark(node)
 	c.Bytecodes = append(c.Bytecodes, bytecode.PUSH_SELF)
 
 	return nil
 }
 
+// VisitThisContextNode visits a thisContext node
+func (c *BytecodeCompiler) VisitThisContextNode(node *ast.ThisContextNode) interface{} {
+	// Add the push this context bytecode
+	c.mark(node)
+	c.Bytecodes = append(c.Bytecodes, bytecode.PUSH_THIS_CONTEXT)
+
+	return nil
+}
+
 // VisitLiteralNode visits a literal node
 func (c *BytecodeCompiler) VisitLiteralNode(node *ast.LiteralNode) interface{} {
 	// Add the literal to the literals array
 	literalIndex := c.addLiteral(node.Value)
 
 	// Add the push literal bytecode
-	c.Bytecodes = append(c.Bytecodes, bytecode.PUSH_LITERAL)
-
-	// Add the literal index (4 bytes)
-	indexBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(indexBytes, uint32(literalIndex))
-	c.Bytecodes = append(c.Bytecodes, indexBytes...)
+	c.mark(node)
+	c.Bytecodes = bytecode.AppendInstruction(c.Bytecodes, bytecode.PUSH_LITERAL, literalIndex)
 
 	return nil
 }
@@ -121,19 +188,20 @@ func (c *BytecodeCompiler) VisitVariableNode(node *ast.VariableNode) interface{}
 	for i, name := range c.TempVarNames {
 		if name == node.Name {
 			// Add the push temporary variable bytecode
-			c.Bytecodes = append(c.Bytecodes, bytecode.PUSH_TEMPORARY_VARIABLE)
-
-			// Add the temporary variable index (4 bytes)
-			indexBytes := make([]byte, 4)
-			binary.BigEndian.PutUint32(indexBytes, uint32(i))
-			c.Bytecodes = append(c.Bytecodes, indexBytes...)
+			c.mark(node)
+			c.Bytecodes = bytecode.AppendInstruction(c.Bytecodes, bytecode.PUSH_TEMPORARY_VARIABLE, i)
 
 			return nil
 		}
 	}
 
 	// Check if the variable is an instance variable
-	// TODO: Implement instance variable lookup
+	if index := c.instanceVariableIndex(node.Name); index >= 0 {
+		c.mark(node)
+		c.Bytecodes = bytecode.AppendInstruction(c.Bytecodes, bytecode.PUSH_INSTANCE_VARIABLE, index)
+
+		return nil
+	}
 
 	// If we get here, the variable is not found
 	panic(fmt.Sprintf("Variable not found: %s", node.Name))
@@ -148,24 +216,40 @@ func (c *BytecodeCompiler) VisitAssignmentNode(node *ast.AssignmentNode) interfa
 	for i, name := range c.TempVarNames {
 		if name == node.Variable {
 			// Add the store temporary variable bytecode
-			c.Bytecodes = append(c.Bytecodes, bytecode.STORE_TEMPORARY_VARIABLE)
-
-			// Add the temporary variable index (4 bytes)
-			indexBytes := make([]byte, 4)
-			binary.BigEndian.PutUint32(indexBytes, uint32(i))
-			c.Bytecodes = append(c.Bytecodes, indexBytes...)
+			c.mark(node)
+			c.Bytecodes = bytecode.AppendInstruction(c.Bytecodes, bytecode.STORE_TEMPORARY_VARIABLE, i)
 
 			return nil
 		}
 	}
 
 	// Check if the variable is an instance variable
-	// TODO: Implement instance variable lookup
+	if index := c.instanceVariableIndex(node.Variable); index >= 0 {
+		c.mark(node)
+		c.Bytecodes = bytecode.AppendInstruction(c.Bytecodes, bytecode.STORE_INSTANCE_VARIABLE, index)
+
+		return nil
+	}
 
 	// If we get here, the variable is not found
 	panic(fmt.Sprintf("Variable not found: %s", node.Variable))
 }
 
+// instanceVariableIndex returns the index of an instance variable of the class
+// the method is compiled in, or -1 if it has none by that name. A method of a
+// metaclass sees the class-instance variables.
+func (c *BytecodeCompiler) instanceVariableIndex(name string) int {
+	if c.Class == nil {
+		return -1
+	}
+	for i, instanceVarName := range pile.ObjectToClass(c.Class).InstanceVarNames {
+		if instanceVarName == name {
+			return i
+		}
+	}
+	return -1
+}
+
 // VisitMessageSendNode visits a message send node
 func (c *BytecodeCompiler) VisitMessageSendNode(node *ast.MessageSendNode) interface{} {
 	// Compile the receiver
@@ -180,18 +264,9 @@ func (c *BytecodeCompiler) VisitMessageSendNode(node *ast.MessageSendNode) inter
 	symbol := pile.NewSymbol(node.Selector)
 	selectorIndex := c.addLiteral(symbol)
 
-	// Add the send message bytecode
-	c.Bytecodes = append(c.Bytecodes, bytecode.SEND_MESSAGE)
-
-	// Add the selector index (4 bytes)
-	selectorIndexBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(selectorIndexBytes, uint32(selectorIndex))
-	c.Bytecodes = append(c.Bytecodes, selectorIndexBytes...)
-
-	// Add the argument count (4 bytes)
-	argCountBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(argCountBytes, uint32(len(node.Arguments)))
-	c.Bytecodes = append(c.Bytecodes, argCountBytes...)
+	// Add the send message bytecode with the selector index and argument count
+	c.mark(node)
+	c.Bytecodes = bytecode.AppendInstruction(c.Bytecodes, bytecode.SEND_MESSAGE, selectorIndex, len(node.Arguments))
 
 	return nil
 }
@@ -200,51 +275,63 @@ func (c *BytecodeCompiler) VisitMessageSendNode(node *ast.MessageSendNode) inter
 func (c *BytecodeCompiler) VisitBlockNode(node *ast.BlockNode) interface{} {
 	// Create a new bytecode compiler for the block
 	blockCompiler := NewBytecodeCompiler(c.Class)
+	blockCompiler.Source = c.Source
+	blockCompiler.Optimizer = c.Optimizer
+	blockCompiler.DebugInfo = pile.NewDebugInfo(c.Source)
+
+	// The block shares the method's literals, so its literal indices are the method's too
+	blockCompiler.Literals = c.Literals
 
 	// Set the temporary variable names
 	blockCompiler.TempVarNames = append(blockCompiler.TempVarNames, node.Parameters...)
 	blockCompiler.TempVarNames = append(blockCompiler.TempVarNames, node.Temporaries...)
+	blockCompiler.DebugInfo.TempNames = blockCompiler.TempVarNames
 
-	// Compile the block body
+	// Compile the block body, discarding the values of the statements before the last
+	for _, statement := range node.Statements {
+		statement.Accept(blockCompiler)
+		blockCompiler.Bytecodes = bytecode.AppendInstruction(blockCompiler.Bytecodes, bytecode.POP)
+	}
 	node.Body.Accept(blockCompiler)
 
 	// Add the create block bytecode
-	c.Bytecodes = append(c.Bytecodes, bytecode.CREATE_BLOCK)
-
-	// Add the bytecode size (4 bytes)
+	createPC := len(c.Bytecodes)
+	c.mark(node)
+	c.DebugInfo.AddBlock(createPC, blockCompiler.DebugInfo)
+	// Add the bytecode size, literal count and temporary variable count
 	bytecodeSize := len(blockCompiler.Bytecodes)
-	bytecodeSizeBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(bytecodeSizeBytes, uint32(bytecodeSize))
-	c.Bytecodes = append(c.Bytecodes, bytecodeSizeBytes...)
-
-	// Add the literal count (4 bytes)
 	literalCount := len(blockCompiler.Literals)
-	literalCountBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(literalCountBytes, uint32(literalCount))
-	c.Bytecodes = append(c.Bytecodes, literalCountBytes...)
-
-	// Add the temporary variable count (4 bytes)
 	tempVarCount := len(blockCompiler.TempVarNames)
-	tempVarCountBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(tempVarCountBytes, uint32(tempVarCount))
-	c.Bytecodes = append(c.Bytecodes, tempVarCountBytes...)
+	c.Bytecodes = bytecode.AppendInstruction(c.Bytecodes, bytecode.CREATE_BLOCK, bytecodeSize, literalCount, tempVarCount)
 
-	// Add the block bytecodes
+	// Add the block bytecodes, mapping them at their position in this method too
+	bodyStart := len(c.Bytecodes)
+	for _, entry := range blockCompiler.DebugInfo.Entries {
+		c.DebugInfo.AddEntry(bodyStart+entry.PC, entry.Start, entry.End)
+	}
 	c.Bytecodes = append(c.Bytecodes, blockCompiler.Bytecodes...)
 
-	// Add the block literals to the method literals
-	for _, literal := range blockCompiler.Literals {
-		c.addLiteral(literal)
-	}
+	// The literals the block added belong to the method as well
+	c.Literals = blockCompiler.Literals
 
 	return nil
 }
 
+// mark records that the next instruction was compiled from the given node
+func (c *BytecodeCompiler) mark(node ast.Node) {
+	if c.DebugInfo == nil {
+		return
+	}
+	sourceRange := node.Range()
+	c.DebugInfo.AddEntry(len(c.Bytecodes), sourceRange.Start, sourceRange.End)
+}
+
 // addLiteral adds a literal to the literals array and returns its index
 func (c *BytecodeCompiler) addLiteral(literal *pile.Object) int {
-	// Check if the literal already exists
+	// Check if the literal already exists, or an equal one when deduplicating
+	deduplicate := c.Optimizer.Enabled(LiteralDeduplication)
 	for i, l := range c.Literals {
-		if l == literal {
+		if l == literal || deduplicate && literalsEqual(l, literal) {
 			return i
 		}
 	}
@@ -253,3 +340,18 @@ func (c *BytecodeCompiler) addLiteral(literal *pile.Object) int {
 	c.Literals = append(c.Literals, literal)
 	return len(c.Literals) - 1
 }
+
+// literalsEqual returns true if two literals have the same value
+// Immediates are equal when they are identical; strings and symbols compare their text
+func literalsEqual(a, b *pile.Object) bool {
+	if a == nil || b == nil || pile.IsImmediate(a) || pile.IsImmediate(b) || a.Type() != b.Type() {
+		return false
+	}
+	switch a.Type() {
+	case pile.OBJ_STRING:
+		return pile.ObjectToString(a).GetValue() == pile.ObjectToString(b).GetValue()
+	case pile.OBJ_SYMBOL:
+		return pile.GetSymbolValue(a) == pile.GetSymbolValue(b)
+	}
+	return false
+}
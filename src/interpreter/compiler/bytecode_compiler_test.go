@@ -115,13 +115,10 @@ func TestCompileAdd(t *testing.T) {
 
 	// Check the method bytecodes
 	expectedBytecodes := []byte{
-		bytecode.PUSH_SELF,               // Push self
-		bytecode.PUSH_TEMPORARY_VARIABLE, // Push aNumber
-		0, 0, 0, 0,                       // Temporary variable index 0
-		bytecode.SEND_MESSAGE, // Send message +
-		0, 0, 0, 0,            // Selector index 0
-		0, 0, 0, 1, // Argument count 1
-		bytecode.RETURN_STACK_TOP, // Return the value on top of the stack
+		bytecode.PUSH_SELF,                         // Push self
+		bytecode.PUSH_TEMPORARY_VARIABLE_SHORT + 0, // Push aNumber (temporary variable index 0)
+		bytecode.SEND_MESSAGE_SHORT_1 + 0,          // Send message + (selector index 0, argument count 1)
+		bytecode.RETURN_STACK_TOP,                  // Return the value on top of the stack
 	}
 
 	if len(method.Bytecodes) != len(expectedBytecodes) {
@@ -163,4 +160,30 @@ func TestCompileAdd(t *testing.T) {
 	if method.GetMethodClass() != integerClass {
 		t.Errorf("Expected method class to be %v, got %v", integerClass, method.GetMethodClass())
 	}
-}
\ No newline at end of file
+}
+// TestCompileInstanceVariables tests compiling reads and stores of the class's instance variables
+func TestCompileInstanceVariables(t *testing.T) {
+	pointClass := pile.NewClass("Point", nil)
+	pointClass.InstanceVarNames = []string{"x", "y"}
+
+	// Point>>y: aNumber ^y := aNumber
+	methodNode := &ast.MethodNode{
+		Selector:   "y:",
+		Parameters: []string{"aNumber"},
+		Body: &ast.ReturnNode{
+			Expression: &ast.AssignmentNode{
+				Variable:   "y",
+				Expression: &ast.VariableNode{Name: "aNumber"},
+			},
+		},
+		Class: pile.ClassToObject(pointClass),
+	}
+	method := NewBytecodeCompiler(pile.ClassToObject(pointClass)).Compile(methodNode)
+
+	expected := bytecode.AppendInstruction(nil, bytecode.PUSH_TEMPORARY_VARIABLE, 0)
+	expected = bytecode.AppendInstruction(expected, bytecode.STORE_INSTANCE_VARIABLE, 1)
+	expected = append(expected, bytecode.RETURN_STACK_TOP)
+	if string(method.Bytecodes) != string(expected) {
+		t.Errorf("Expected bytecodes %v, got %v", expected, method.Bytecodes)
+	}
+}
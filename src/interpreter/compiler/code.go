@@ -0,0 +1,313 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+
+	"smalltalklsp/interpreter/bytecode"
+	"smalltalklsp/interpreter/pile"
+)
+
+// Code is the instructions of a method or block in a form passes can rewrite
+// Jumps point at their target instruction instead of holding an offset and
+// block bodies are nested Code, so instructions can be removed without fixing
+// up offsets and sizes by hand. Encode works them out again.
+type Code struct {
+	// Instructions are the instructions in execution order
+	Instructions []*CodeInstruction
+}
+
+// CodeInstruction is one instruction of a Code
+type CodeInstruction struct {
+	// Opcode is the long form opcode
+	Opcode byte
+
+	// Operands are the long form operands
+	// Jump offsets and block body sizes are recomputed when the code is encoded
+	Operands []int
+
+	// Target is the instruction a jump lands on, nil for the end of the code
+	Target *CodeInstruction
+
+	// Block is the body of a CREATE_BLOCK instruction
+	Block *Code
+
+	// pc is the offset the instruction was decoded from, -1 for new instructions
+	pc int
+
+	// bodyPC is the offset the block body was decoded from
+	bodyPC int
+}
+
+// NewCodeInstruction creates an instruction that was not decoded from bytecodes
+func NewCodeInstruction(opcode byte, operands ...int) *CodeInstruction {
+	return &CodeInstruction{Opcode: opcode, Operands: operands, pc: -1, bodyPC: -1}
+}
+
+// DecodeCode decodes bytecodes into Code
+func DecodeCode(bytecodes []byte) (*Code, error) {
+	return decodeCode(bytecodes, 0, len(bytecodes))
+}
+
+// decodeCode decodes the bytecodes in [start, end)
+func decodeCode(bytecodes []byte, start, end int) (*Code, error) {
+	code := &Code{Instructions: []*CodeInstruction{}}
+	byPC := make(map[int]*CodeInstruction)
+	targets := make(map[*CodeInstruction]int)
+
+	pc := start
+	for pc < end {
+		decoded, err := bytecode.Decode(bytecodes[:end], pc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid instruction at %d: %v", pc, err)
+		}
+		instruction := &CodeInstruction{
+			Opcode:   decoded.Opcode,
+			Operands: append([]int{}, decoded.Operands[:bytecode.OperandCount(decoded.Opcode)]...),
+			pc:       pc,
+			bodyPC:   -1,
+		}
+		if bytecode.IsJump(decoded.Opcode) {
+			targets[instruction] = decoded.JumpTarget(pc)
+		}
+		byPC[pc] = instruction
+		code.Instructions = append(code.Instructions, instruction)
+		pc += decoded.Size
+
+		if decoded.Opcode == bytecode.CREATE_BLOCK {
+			bodyEnd := pc + decoded.Operand(0)
+			if bodyEnd > end {
+				return nil, fmt.Errorf("block body at %d runs past the end of the code", pc)
+			}
+			body, err := decodeCode(bytecodes, pc, bodyEnd)
+			if err != nil {
+				return nil, err
+			}
+			instruction.Block = body
+			instruction.bodyPC = pc
+			pc = bodyEnd
+		}
+	}
+
+	for instruction, target := range targets {
+		if target == end {
+			continue
+		}
+		targetInstruction, ok := byPC[target]
+		if !ok {
+			return nil, fmt.Errorf("jump at %d lands at %d, which is not an instruction", instruction.pc, target)
+		}
+		instruction.Target = targetInstruction
+	}
+	return code, nil
+}
+
+// Targets returns the set of instructions that jumps land on
+func (c *Code) Targets() map[*CodeInstruction]bool {
+	targets := make(map[*CodeInstruction]bool)
+	for _, instruction := range c.Instructions {
+		if instruction.Target != nil {
+			targets[instruction.Target] = true
+		}
+	}
+	return targets
+}
+
+// Remove removes the instruction at index
+// Jumps that landed on it land on the instruction after it instead
+func (c *Code) Remove(index int) {
+	removed := c.Instructions[index]
+	var next *CodeInstruction
+	if index+1 < len(c.Instructions) {
+		next = c.Instructions[index+1]
+	}
+	for _, instruction := range c.Instructions {
+		if instruction.Target == removed {
+			instruction.Target = next
+		}
+	}
+	c.Instructions = append(c.Instructions[:index], c.Instructions[index+1:]...)
+}
+
+// Encode encodes the code into bytecodes, choosing the shortest encodings
+func (c *Code) Encode() []byte {
+	bytecodes, _ := c.encode()
+	return bytecodes
+}
+
+// codeLayout records where each instruction was placed when code was encoded
+type codeLayout struct {
+	// pcs are the offsets of the instructions
+	pcs map[*CodeInstruction]int
+
+	// bodyPCs are the offsets of the block bodies of CREATE_BLOCK instructions
+	bodyPCs map[*CodeInstruction]int
+
+	// ends are the offsets just past each Code
+	ends map[*Code]int
+
+	// sizes are the encoded sizes of jumps and CREATE_BLOCK instructions,
+	// whose operands depend on where everything else is placed
+	sizes map[*CodeInstruction]int
+}
+
+// encode encodes the code and returns where each instruction was placed
+// Jump offsets and block sizes depend on the size of the code between them,
+// which depends on the offsets, so sizes start at their smallest and grow
+// until every operand fits.
+func (c *Code) encode() ([]byte, *codeLayout) {
+	layout := &codeLayout{sizes: make(map[*CodeInstruction]int)}
+	for {
+		layout.pcs = make(map[*CodeInstruction]int)
+		layout.bodyPCs = make(map[*CodeInstruction]int)
+		layout.ends = make(map[*Code]int)
+		layout.place(c, 0)
+		if !layout.grow(c) {
+			break
+		}
+	}
+	return layout.emit(c, []byte{}), layout
+}
+
+// place works out the offset of every instruction in code starting at pc
+func (l *codeLayout) place(code *Code, pc int) int {
+	for _, instruction := range code.Instructions {
+		l.pcs[instruction] = pc
+		pc += l.size(instruction)
+		if instruction.Block != nil {
+			l.bodyPCs[instruction] = pc
+			pc = l.place(instruction.Block, pc)
+		}
+	}
+	l.ends[code] = pc
+	return pc
+}
+
+// size returns the encoded size of an instruction in the current layout
+func (l *codeLayout) size(instruction *CodeInstruction) int {
+	if size, ok := l.sizes[instruction]; ok {
+		return size
+	}
+	operands := instruction.Operands
+	if bytecode.IsJump(instruction.Opcode) || instruction.Opcode == bytecode.CREATE_BLOCK {
+		// Start from the smallest operand, grow raises it when needed
+		operands = append([]int{0}, operands[1:]...)
+		size := len(bytecode.AppendInstruction(nil, instruction.Opcode, operands...))
+		l.sizes[instruction] = size
+		return size
+	}
+	return len(bytecode.AppendInstruction(nil, instruction.Opcode, operands...))
+}
+
+// grow makes room for operands that do not fit, returning true if anything grew
+func (l *codeLayout) grow(code *Code) bool {
+	grew := false
+	for _, instruction := range code.Instructions {
+		if instruction.Block != nil && l.grow(instruction.Block) {
+			grew = true
+		}
+		size, ok := l.sizes[instruction]
+		if !ok {
+			continue
+		}
+		needed := len(bytecode.AppendInstruction(nil, instruction.Opcode, l.operands(code, instruction)...))
+		if needed > size {
+			l.sizes[instruction] = needed
+			grew = true
+		}
+	}
+	return grew
+}
+
+// operands returns the operands of an instruction in the current layout
+func (l *codeLayout) operands(code *Code, instruction *CodeInstruction) []int {
+	operands := append([]int{}, instruction.Operands...)
+	switch {
+	case bytecode.IsJump(instruction.Opcode):
+		target := l.ends[code]
+		if instruction.Target != nil {
+			target = l.pcs[instruction.Target]
+		}
+		operands[0] = target - (l.pcs[instruction] + l.sizes[instruction])
+	case instruction.Opcode == bytecode.CREATE_BLOCK:
+		operands[0] = l.ends[instruction.Block] - l.bodyPCs[instruction]
+	}
+	return operands
+}
+
+// emit appends the encoded code to bytecodes
+func (l *codeLayout) emit(code *Code, bytecodes []byte) []byte {
+	for _, instruction := range code.Instructions {
+		operands := l.operands(code, instruction)
+		encoded := bytecode.AppendInstruction(nil, instruction.Opcode, operands...)
+
+		// An operand that got smaller after its instruction grew is padded
+		// with sign or zero EXTEND_A prefixes so the layout stays valid
+		if size, ok := l.sizes[instruction]; ok {
+			pad := byte(0)
+			if operands[0] < 0 {
+				pad = 0xFF
+			}
+			for padded := len(encoded); padded < size; padded += 2 {
+				bytecodes = append(bytecodes, bytecode.EXTEND_A, pad)
+			}
+		}
+		bytecodes = append(bytecodes, encoded...)
+
+		if instruction.Block != nil {
+			bytecodes = l.emit(instruction.Block, bytecodes)
+		}
+	}
+	return bytecodes
+}
+
+// flatten returns the instructions of code and its blocks in bytecode order
+func (c *Code) flatten() []*CodeInstruction {
+	flat := []*CodeInstruction{}
+	for _, instruction := range c.Instructions {
+		flat = append(flat, instruction)
+		if instruction.Block != nil {
+			flat = append(flat, instruction.Block.flatten()...)
+		}
+	}
+	return flat
+}
+
+// remapDebugInfo moves the debug info of code that was decoded and encoded again
+// to the new offsets. Entries of removed instructions move to the next instruction
+// still there, so the instructions they covered stay covered.
+func (l *codeLayout) remapDebugInfo(code *Code, debugInfo *pile.DebugInfo) *pile.DebugInfo {
+	return l.remapRegion(code, debugInfo, 0, 0)
+}
+
+// remapRegion remaps debug info whose offsets are relative to oldBase, to be relative to newBase
+func (l *codeLayout) remapRegion(code *Code, debugInfo *pile.DebugInfo, oldBase, newBase int) *pile.DebugInfo {
+	decoded := []*CodeInstruction{}
+	for _, instruction := range code.flatten() {
+		if instruction.pc >= 0 {
+			decoded = append(decoded, instruction)
+		}
+	}
+
+	result := pile.NewDebugInfo(debugInfo.Source)
+	result.TempNames = debugInfo.TempNames
+	for _, entry := range debugInfo.Entries {
+		index := sort.Search(len(decoded), func(i int) bool {
+			return decoded[i].pc >= oldBase+entry.PC
+		})
+		if index == len(decoded) {
+			continue
+		}
+		result.AddEntry(l.pcs[decoded[index]]-newBase, entry.Start, entry.End)
+	}
+
+	for pc, blockInfo := range debugInfo.Blocks {
+		for _, instruction := range code.Instructions {
+			if instruction.pc == oldBase+pc && instruction.Block != nil {
+				blockInfo = l.remapRegion(instruction.Block, blockInfo, instruction.bodyPC, l.bodyPCs[instruction])
+				result.AddBlock(l.pcs[instruction]-newBase, blockInfo)
+			}
+		}
+	}
+	return result
+}
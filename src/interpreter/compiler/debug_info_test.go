@@ -0,0 +1,123 @@
+package compiler_test
+
+import (
+	"testing"
+
+	"smalltalklsp/interpreter/bytecode"
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/parser"
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// sendPCs returns the PCs of the SEND_MESSAGE instructions in the bytecodes
+func sendPCs(bytecodes []byte) []int {
+	pcs := []int{}
+	for pc := 0; pc < len(bytecodes); {
+		instruction, err := bytecode.Decode(bytecodes, pc)
+		if err != nil {
+			break
+		}
+		if instruction.Opcode == bytecode.SEND_MESSAGE {
+			pcs = append(pcs, pc)
+		}
+		pc += instruction.Size
+	}
+	return pcs
+}
+
+// TestMethodDebugInfo tests that a compiled method records its source and maps sends back to it
+func TestMethodDebugInfo(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	objectClass := virtualMachine.Globals["Object"]
+	source := "double: x\n  ^x + x * 2"
+
+	node, err := parser.NewParser(source, objectClass, virtualMachine).Parse()
+	if err != nil {
+		t.Fatalf("Error parsing method: %v", err)
+	}
+	method := compiler.NewBytecodeCompiler(objectClass).Compile(node)
+
+	debugInfo := method.GetDebugInfo()
+	if debugInfo == nil {
+		t.Fatal("Expected the method to have debug info")
+	}
+	if debugInfo.Source != source {
+		t.Errorf("Expected source %q, got %q", source, debugInfo.Source)
+	}
+
+	pcs := sendPCs(method.Bytecodes)
+	if len(pcs) != 2 {
+		t.Fatalf("Expected 2 sends, got %d", len(pcs))
+	}
+	if got := debugInfo.SourceAt(pcs[0]); got != "x + x" {
+		t.Errorf("Expected first send to map to %q, got %q", "x + x", got)
+	}
+	if got := debugInfo.SourceAt(pcs[1]); got != "x + x * 2" {
+		t.Errorf("Expected second send to map to %q, got %q", "x + x * 2", got)
+	}
+	if got := debugInfo.LineAt(pcs[1]); got != 2 {
+		t.Errorf("Expected second send on line 2, got %d", got)
+	}
+
+	returnPC := len(method.Bytecodes) - 1
+	if got := debugInfo.SourceAt(returnPC); got != "^x + x * 2" {
+		t.Errorf("Expected return to map to %q, got %q", "^x + x * 2", got)
+	}
+}
+
+// TestBlockDebugInfo tests that blocks get their own debug info relative to their own bytecodes
+func TestBlockDebugInfo(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	objectClass := virtualMachine.Globals["Object"]
+	source := "[:x | x foo] value: 3"
+
+	node, err := parser.NewParser(source, objectClass, virtualMachine).ParseExpression()
+	if err != nil {
+		t.Fatalf("Error parsing expression: %v", err)
+	}
+	bytecodeCompiler := compiler.NewBytecodeCompiler(objectClass)
+	bytecodeCompiler.Source = source
+	method := bytecodeCompiler.Compile(node)
+
+	if method.Bytecodes[0] != bytecode.CREATE_BLOCK {
+		t.Fatalf("Expected the method to start with CREATE_BLOCK, got %s", bytecode.BytecodeName(method.Bytecodes[0]))
+	}
+	if got := method.GetDebugInfo().SourceAt(0); got != "[:x | x foo]" {
+		t.Errorf("Expected CREATE_BLOCK to map to %q, got %q", "[:x | x foo]", got)
+	}
+
+	blockInfo := method.GetDebugInfo().BlockAt(0)
+	if blockInfo == nil {
+		t.Fatal("Expected debug info for the block")
+	}
+	if got := blockInfo.SourceAt(0); got != "x" {
+		t.Errorf("Expected block PC 0 to map to %q, got %q", "x", got)
+	}
+	pushX, err := bytecode.Decode(method.Bytecodes, bytecode.InstructionSize(bytecode.CREATE_BLOCK))
+	if err != nil {
+		t.Fatalf("Error decoding the block body: %v", err)
+	}
+	if got := blockInfo.SourceAt(pushX.Size); got != "x foo" {
+		t.Errorf("Expected block send to map to %q, got %q", "x foo", got)
+	}
+
+	// The inlined block body is also mapped at its position in the method
+	bodyStart := bytecode.InstructionSize(bytecode.CREATE_BLOCK)
+	if got := method.GetDebugInfo().SourceAt(bodyStart); got != "x" {
+		t.Errorf("Expected inlined block body to map to %q, got %q", "x", got)
+	}
+
+	// Executing CREATE_BLOCK hands the block its debug info
+	context := vm.NewContext(pile.MethodToObject(method), virtualMachine.NilObject, []*pile.Object{}, nil)
+	if err := virtualMachine.ExecuteCreateBlock(context); err != nil {
+		t.Fatalf("ExecuteCreateBlock returned an error: %v", err)
+	}
+	block := pile.ObjectToBlock(context.Pop())
+	if block.GetDebugInfo() != blockInfo {
+		t.Errorf("Expected the created block to carry the compiled block debug info")
+	}
+	if names := block.GetTempVarNames(); len(names) != 1 || names[0] != "x" {
+		t.Errorf("Expected the block's temporaries to be named from the debug info, got %v", names)
+	}
+}
@@ -0,0 +1,259 @@
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"smalltalklsp/interpreter/bytecode"
+	"smalltalklsp/interpreter/pile"
+)
+
+// Disassemble renders a method as text, one instruction per line, with operands decoded
+// in comments. Short forms and extension prefixes are shown as the long form
+// instruction they decode to. The output can be read back by Assemble.
+func Disassemble(method *pile.Method) string {
+	var out strings.Builder
+
+	if method.MethodClass != nil {
+		fmt.Fprintf(&out, "class: %s\n", method.MethodClass.Name)
+	}
+	if method.Selector != nil && method.Selector.Type() == pile.OBJ_SYMBOL {
+		fmt.Fprintf(&out, "selector: %s\n", pile.GetSymbolValue(method.Selector))
+	}
+	if method.IsPrimitive {
+		if method.PrimitiveName != "" {
+			fmt.Fprintf(&out, "primitive: '%s'", method.PrimitiveName)
+			if method.PrimitiveModule != "" {
+				fmt.Fprintf(&out, " module: '%s'", method.PrimitiveModule)
+			}
+		} else {
+			fmt.Fprintf(&out, "primitive: %d", method.PrimitiveIndex)
+		}
+		if method.PrimitiveError != "" {
+			fmt.Fprintf(&out, " error: %s", method.PrimitiveError)
+		}
+		out.WriteString("\n")
+	}
+
+	var instVarNames []string
+	if method.MethodClass != nil {
+		instVarNames = method.MethodClass.InstanceVarNames
+	}
+	writeCode(&out, method.Bytecodes, method.Literals, method.TempVarNames, instVarNames)
+
+	return out.String()
+}
+
+// DisassembleBlock renders a block's bytecodes in the same format as Disassemble
+func DisassembleBlock(block *pile.Block) string {
+	var out strings.Builder
+	writeCode(&out, block.Bytecodes, block.Literals, block.TempVarNames, nil)
+	return out.String()
+}
+
+// writeCode writes the temps, literals and bytecodes sections
+func writeCode(out *strings.Builder, bytecodes []byte, literals []*pile.Object, tempVarNames []string, instVarNames []string) {
+	if len(tempVarNames) > 0 {
+		fmt.Fprintf(out, "temps: %s\n", strings.Join(tempVarNames, " "))
+	}
+
+	if len(literals) > 0 {
+		out.WriteString("literals:\n")
+		for i, literal := range literals {
+			fmt.Fprintf(out, "%5d: %s\n", i, FormatLiteral(literal))
+		}
+	}
+
+	out.WriteString("bytecodes:\n")
+	d := &disassembler{
+		out:          out,
+		bytecodes:    bytecodes,
+		literals:     literals,
+		tempVarNames: tempVarNames,
+		instVarNames: instVarNames,
+	}
+	d.writeRange(0, len(bytecodes), 0)
+}
+
+// disassembler holds the state needed to decode the operands of one method
+type disassembler struct {
+	out          *strings.Builder
+	bytecodes    []byte
+	literals     []*pile.Object
+	tempVarNames []string
+	instVarNames []string
+}
+
+// writeRange writes the instructions in [start, end) at the given block nesting depth
+func (d *disassembler) writeRange(start, end, depth int) {
+	pc := start
+	for pc < end {
+		instruction, err := bytecode.Decode(d.bytecodes[:end], pc)
+		if err != nil {
+			// Dump whatever is left as raw bytes so nothing is hidden
+			d.writeLine(pc, depth, fmt.Sprintf("BYTE %d", d.bytecodes[pc]), err.Error())
+			pc++
+			continue
+		}
+
+		operands := instruction.Operands[:bytecode.OperandCount(instruction.Opcode)]
+		text := bytecode.BytecodeName(instruction.Opcode)
+		for _, operand := range operands {
+			text += " " + strconv.Itoa(operand)
+		}
+		d.writeLine(pc, depth, text, d.comment(pc, instruction))
+		pc += instruction.Size
+
+		// Compiled blocks are followed by their body, show it nested
+		if instruction.Opcode == bytecode.CREATE_BLOCK {
+			bodyEnd := pc + operands[0]
+			if bodyEnd <= end {
+				d.writeRange(pc, bodyEnd, depth+1)
+				pc = bodyEnd
+			}
+		}
+	}
+}
+
+// writeLine writes one instruction with its PC and an optional comment
+func (d *disassembler) writeLine(pc, depth int, text, comment string) {
+	line := fmt.Sprintf("%5d  %s%s", pc, strings.Repeat("    ", depth), text)
+	if comment != "" {
+		line = fmt.Sprintf("%-44s ; %s", line, comment)
+	}
+	d.out.WriteString(line)
+	d.out.WriteString("\n")
+}
+
+// comment decodes the operands of an instruction
+func (d *disassembler) comment(pc int, instruction bytecode.Instruction) string {
+	operand := instruction.Operand(0)
+	switch instruction.Opcode {
+	case bytecode.PUSH_LITERAL:
+		return d.literal(operand)
+	case bytecode.SEND_MESSAGE:
+		return d.literal(operand)
+	case bytecode.PUSH_TEMPORARY_VARIABLE, bytecode.STORE_TEMPORARY_VARIABLE:
+		if operand < len(d.tempVarNames) {
+			return d.tempVarNames[operand]
+		}
+		return fmt.Sprintf("temp %d", operand)
+	case bytecode.PUSH_INSTANCE_VARIABLE, bytecode.STORE_INSTANCE_VARIABLE:
+		if operand < len(d.instVarNames) {
+			return d.instVarNames[operand]
+		}
+		return fmt.Sprintf("instance variable %d", operand)
+	case bytecode.JUMP, bytecode.JUMP_IF_TRUE, bytecode.JUMP_IF_FALSE:
+		return fmt.Sprintf("-> %d", instruction.JumpTarget(pc))
+	case bytecode.CREATE_BLOCK:
+		return fmt.Sprintf("block of %d bytes, %d literals, %d temps", operand, instruction.Operand(1), instruction.Operand(2))
+	case bytecode.EXECUTE_BLOCK:
+		return fmt.Sprintf("%d arguments", operand)
+	}
+	return ""
+}
+
+// literal describes the literal at the given index
+func (d *disassembler) literal(index int) string {
+	if index < 0 || index >= len(d.literals) {
+		return "literal out of bounds"
+	}
+	return FormatLiteral(d.literals[index])
+}
+
+// FormatLiteral renders a literal in Smalltalk syntax
+// Objects that have no literal syntax are rendered in angle brackets and cannot be assembled
+func FormatLiteral(literal *pile.Object) string {
+	if literal == nil {
+		return "<nil pointer>"
+	}
+
+	if pile.IsImmediate(literal) {
+		if pile.IsFloatImmediate(literal) {
+			return formatFloat(pile.GetFloatImmediate(literal))
+		}
+		return literal.String()
+	}
+
+	switch literal.Type() {
+	case pile.OBJ_BOXED_FLOAT:
+		return formatFloat(pile.ObjectToBoxedFloat(literal).Value)
+	case pile.OBJ_STRING:
+		return "'" + strings.ReplaceAll(pile.ObjectToString(literal).GetValue(), "'", "''") + "'"
+	case pile.OBJ_SYMBOL:
+		return formatSymbol(pile.GetSymbolValue(literal))
+	case pile.OBJ_ARRAY:
+		array := pile.ObjectToArray(literal)
+		elements := make([]string, array.Size())
+		for i := range elements {
+			elements[i] = FormatLiteral(array.At(i))
+		}
+		return "#(" + strings.Join(elements, " ") + ")"
+	case pile.OBJ_CLASS:
+		return pile.ObjectToClass(literal).Name
+	}
+
+	return "<" + literal.String() + ">"
+}
+
+// formatFloat renders a float so that it reads back as a float rather than an integer
+func formatFloat(value float64) string {
+	text := strconv.FormatFloat(value, 'g', -1, 64)
+	if !strings.ContainsAny(text, ".eIN") {
+		text += ".0"
+	}
+	return text
+}
+
+// formatSymbol renders a symbol, quoting it if it is not a valid selector
+func formatSymbol(value string) string {
+	if isSelector(value) {
+		return "#" + value
+	}
+	return "#'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// isSelector returns true if the value is a unary, binary or keyword selector
+func isSelector(value string) bool {
+	if value == "" {
+		return false
+	}
+
+	if strings.Trim(value, binaryCharacters) == "" {
+		return true
+	}
+
+	if strings.Contains(value, ":") && !strings.HasSuffix(value, ":") {
+		return false
+	}
+
+	for _, part := range strings.SplitAfter(value, ":") {
+		if part == "" {
+			continue
+		}
+		name := strings.TrimSuffix(part, ":")
+		if name == "" || !isIdentifierStart(name[0]) {
+			return false
+		}
+		for i := 1; i < len(name); i++ {
+			if !isIdentifierStart(name[i]) && !isDigit(name[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// binaryCharacters are the characters binary selectors are made of
+const binaryCharacters = "+-*/\\=<>~@%|&?,"
+
+// isIdentifierStart returns true if the character can start an identifier
+func isIdentifierStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+// isDigit returns true if the character is a decimal digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,175 @@
+package compiler_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/parser"
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// assertRoundTrip disassembles a method, assembles the text and checks the result matches
+func assertRoundTrip(t *testing.T, virtualMachine *vm.VM, method *pile.Method) {
+	t.Helper()
+
+	text := compiler.Disassemble(method)
+	assembled, err := compiler.Assemble(text, virtualMachine)
+	if err != nil {
+		t.Fatalf("Error assembling:\n%s\n%v", text, err)
+	}
+
+	if !bytes.Equal(assembled.Bytecodes, method.Bytecodes) {
+		t.Errorf("Expected bytecodes %v, got %v\n%s", method.Bytecodes, assembled.Bytecodes, text)
+	}
+	if len(assembled.Literals) != len(method.Literals) {
+		t.Fatalf("Expected %d literals, got %d", len(method.Literals), len(assembled.Literals))
+	}
+	for i, literal := range method.Literals {
+		expected := compiler.FormatLiteral(literal)
+		if got := compiler.FormatLiteral(assembled.Literals[i]); got != expected {
+			t.Errorf("Expected literal %d to be %s, got %s", i, expected, got)
+		}
+	}
+	if assembled.IsPrimitive != method.IsPrimitive || assembled.PrimitiveIndex != method.PrimitiveIndex ||
+		assembled.PrimitiveName != method.PrimitiveName || assembled.PrimitiveModule != method.PrimitiveModule ||
+		assembled.PrimitiveError != method.PrimitiveError {
+		t.Errorf("Expected primitive %d %q %q %q, got %d %q %q %q", method.PrimitiveIndex, method.PrimitiveName,
+			method.PrimitiveModule, method.PrimitiveError, assembled.PrimitiveIndex, assembled.PrimitiveName,
+			assembled.PrimitiveModule, assembled.PrimitiveError)
+	}
+	if assembled.MethodClass != method.MethodClass {
+		t.Errorf("Expected class %v, got %v", method.MethodClass, assembled.MethodClass)
+	}
+	if compiler.Disassemble(assembled) != text {
+		t.Errorf("Expected the assembled method to disassemble to the same text")
+	}
+}
+
+// TestDisassembleCompiledMethod tests that compiled methods survive a round trip through the text format
+func TestDisassembleCompiledMethod(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	objectClass := virtualMachine.Globals["Object"]
+
+	sources := []string{
+		"double: x\n  ^x + x * 2",
+		"test | a | a := #(1 'it''s' #foo #at:put: 2.5 true nil). ^a",
+		"test ^[:x | x * 3] value: 4",
+		"test <primitive: 7> ^false",
+		"test <primitive: 'stringConcat' module: 'strings'> ^self",
+		"test: x <primitive: 1 error: ec> ^ec",
+	}
+	for _, source := range sources {
+		node, err := parser.NewParser(source, objectClass, virtualMachine).Parse()
+		if err != nil {
+			t.Fatalf("Error parsing %q: %v", source, err)
+		}
+		method := compiler.NewBytecodeCompiler(objectClass).Compile(node)
+		method.Selector = pile.NewSymbol("test")
+		assertRoundTrip(t, virtualMachine, method)
+	}
+}
+
+// TestDisassembleFactorial tests the disassembly of a hand-built method with jumps
+func TestDisassembleFactorial(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	integerClass := pile.ObjectToClass(virtualMachine.Globals["Integer"])
+
+	builder := compiler.NewMethodBuilder(integerClass)
+	oneIndex, builder := builder.AddLiteral(virtualMachine.NewInteger(1))
+	factorialIndex, builder := builder.AddLiteral(pile.NewSymbol("factorial"))
+	equalsIndex, builder := builder.AddLiteral(pile.NewSymbol("="))
+	minusIndex, builder := builder.AddLiteral(pile.NewSymbol("-"))
+	timesIndex, builder := builder.AddLiteral(pile.NewSymbol("*"))
+
+	methodObj := builder.
+		PushSelf().PushLiteral(oneIndex).SendMessage(equalsIndex, 1).
+		Duplicate().JumpIfFalse(4).
+		Pop().PushLiteral(oneIndex).Jump(7).
+		Pop().PushSelf().PushSelf().PushLiteral(oneIndex).
+		SendMessage(minusIndex, 1).SendMessage(factorialIndex, 0).SendMessage(timesIndex, 1).
+		ReturnStackTop().
+		Go("factorial")
+	method := pile.ObjectToMethod(methodObj)
+
+	text := compiler.Disassemble(method)
+	for _, expected := range []string{
+		"class: Integer",
+		"selector: factorial",
+		"JUMP_IF_FALSE 4",
+		"; -> 10",
+		"JUMP 7",
+		"; -> 17",
+		"; #factorial",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected disassembly to contain %q:\n%s", expected, text)
+		}
+	}
+
+	assertRoundTrip(t, virtualMachine, method)
+}
+
+// TestParseLiteral tests reading literals back from their printed form
+func TestParseLiteral(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"42", "42"},
+		{"-7", "-7"},
+		{"2.5", "2.5"},
+		{"3.0", "3.0"},
+		{"'it''s'", "'it''s'"},
+		{"#foo", "#foo"},
+		{"#at:put:", "#at:put:"},
+		{"#'hello world'", "#'hello world'"},
+		{"#(1 #(2 3) 'x')", "#(1 #(2 3) 'x')"},
+		{"nil", "nil"},
+		{"true", "true"},
+		{"Object", "Object"},
+	}
+	for _, test := range tests {
+		literal, err := compiler.ParseLiteral(test.text, virtualMachine)
+		if err != nil {
+			t.Errorf("Error parsing %s: %v", test.text, err)
+			continue
+		}
+		if got := compiler.FormatLiteral(literal); got != test.expected {
+			t.Errorf("Expected %s to read back as %s, got %s", test.text, test.expected, got)
+		}
+	}
+}
+
+// TestAssembleErrors tests that malformed text is rejected with the offending line
+func TestAssembleErrors(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"bytecodes:\n  FROBNICATE", "line 2: unknown instruction: FROBNICATE"},
+		{"bytecodes:\n  PUSH_LITERAL", "line 2: PUSH_LITERAL takes 1 operands, got 0"},
+		{"bytecodes:\n  PUSH_LITERAL x", "line 2: invalid operand for PUSH_LITERAL: x"},
+		{"literals:\n  1: 3", "line 2: expected literal 0, got 1"},
+		{"literals:\n  0: 'open", "line 2: unterminated string"},
+		{"class: NoSuchClass", "line 1: unknown class: NoSuchClass"},
+		{"PUSH_SELF", "line 1: unexpected text outside of a section: PUSH_SELF"},
+		{"primitive: 'concat' mod: 'strings'", "line 1: invalid primitive: 'concat' mod: 'strings'"},
+	}
+	for _, test := range tests {
+		_, err := compiler.Assemble(test.text, virtualMachine)
+		if err == nil {
+			t.Errorf("Expected an error assembling %q", test.text)
+			continue
+		}
+		if err.Error() != test.expected {
+			t.Errorf("Expected error %q, got %q", test.expected, err.Error())
+		}
+	}
+}
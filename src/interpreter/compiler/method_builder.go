@@ -1,22 +1,22 @@
 package compiler
 
 import (
-	"encoding/binary"
-
 	"smalltalklsp/interpreter/bytecode"
 	"smalltalklsp/interpreter/pile"
 )
 
 // MethodBuilder provides a fluent interface for creating methods
 type MethodBuilder struct {
-	class          *pile.Class
-	selectorName   string
-	selectorObj    *pile.Object
-	bytecodes      []byte
-	literals       []*pile.Object
-	tempVarNames   []string
-	isPrimitive    bool
-	primitiveIndex int
+	class           *pile.Class
+	selectorName    string
+	selectorObj     *pile.Object
+	bytecodes       []byte
+	literals        []*pile.Object
+	tempVarNames    []string
+	isPrimitive     bool
+	primitiveIndex  int
+	primitiveName   string
+	primitiveModule string
 }
 
 // NewMethodBuilder creates a new MethodBuilder for the given class
@@ -40,6 +40,15 @@ func (mb *MethodBuilder) Primitive(index int) *MethodBuilder {
 	return mb
 }
 
+// NamedPrimitive marks the method as the primitive registered under a name in a module
+// The module is empty for the VM's own primitives
+func (mb *MethodBuilder) NamedPrimitive(name string, module string) *MethodBuilder {
+	mb.primitiveName = name
+	mb.primitiveModule = module
+	mb.isPrimitive = true
+	return mb
+}
+
 // AddLiterals adds multiple literals to the method
 func (mb *MethodBuilder) AddLiterals(literals []*pile.Object) *MethodBuilder {
 	mb.literals = append(mb.literals, literals...)
@@ -59,30 +68,25 @@ func (mb *MethodBuilder) TempVars(names []string) *MethodBuilder {
 	return mb
 }
 
-// addUint32 adds a 32-bit unsigned integer to the bytecodes in big-endian format
-func (mb *MethodBuilder) addUint32(value uint32) *MethodBuilder {
-	bytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(bytes, value)
-	mb.bytecodes = append(mb.bytecodes, bytes...)
+// add appends the shortest encoding of an instruction to the bytecodes
+func (mb *MethodBuilder) add(opcode byte, operands ...int) *MethodBuilder {
+	mb.bytecodes = bytecode.AppendInstruction(mb.bytecodes, opcode, operands...)
 	return mb
 }
 
 // PushLiteral adds a PUSH_LITERAL bytecode with the given literal index
 func (mb *MethodBuilder) PushLiteral(index int) *MethodBuilder {
-	mb.bytecodes = append(mb.bytecodes, bytecode.PUSH_LITERAL)
-	return mb.addUint32(uint32(index))
+	return mb.add(bytecode.PUSH_LITERAL, index)
 }
 
 // PushInstanceVariable adds a PUSH_INSTANCE_VARIABLE bytecode with the given offset
 func (mb *MethodBuilder) PushInstanceVariable(offset int) *MethodBuilder {
-	mb.bytecodes = append(mb.bytecodes, bytecode.PUSH_INSTANCE_VARIABLE)
-	return mb.addUint32(uint32(offset))
+	return mb.add(bytecode.PUSH_INSTANCE_VARIABLE, offset)
 }
 
 // PushTemporaryVariable adds a PUSH_TEMPORARY_VARIABLE bytecode with the given offset
 func (mb *MethodBuilder) PushTemporaryVariable(offset int) *MethodBuilder {
-	mb.bytecodes = append(mb.bytecodes, bytecode.PUSH_TEMPORARY_VARIABLE)
-	return mb.addUint32(uint32(offset))
+	return mb.add(bytecode.PUSH_TEMPORARY_VARIABLE, offset)
 }
 
 // PushSelf adds a PUSH_SELF bytecode
@@ -91,23 +95,25 @@ func (mb *MethodBuilder) PushSelf() *MethodBuilder {
 	return mb
 }
 
+// PushThisContext adds a PUSH_THIS_CONTEXT bytecode
+func (mb *MethodBuilder) PushThisContext() *MethodBuilder {
+	mb.bytecodes = append(mb.bytecodes, bytecode.PUSH_THIS_CONTEXT)
+	return mb
+}
+
 // StoreInstanceVariable adds a STORE_INSTANCE_VARIABLE bytecode with the given offset
 func (mb *MethodBuilder) StoreInstanceVariable(offset int) *MethodBuilder {
-	mb.bytecodes = append(mb.bytecodes, bytecode.STORE_INSTANCE_VARIABLE)
-	return mb.addUint32(uint32(offset))
+	return mb.add(bytecode.STORE_INSTANCE_VARIABLE, offset)
 }
 
 // StoreTemporaryVariable adds a STORE_TEMPORARY_VARIABLE bytecode with the given offset
 func (mb *MethodBuilder) StoreTemporaryVariable(offset int) *MethodBuilder {
-	mb.bytecodes = append(mb.bytecodes, bytecode.STORE_TEMPORARY_VARIABLE)
-	return mb.addUint32(uint32(offset))
+	return mb.add(bytecode.STORE_TEMPORARY_VARIABLE, offset)
 }
 
 // SendMessage adds a SEND_MESSAGE bytecode with the given selector index and argument count
 func (mb *MethodBuilder) SendMessage(selectorIndex, argCount int) *MethodBuilder {
-	mb.bytecodes = append(mb.bytecodes, bytecode.SEND_MESSAGE)
-	mb.addUint32(uint32(selectorIndex))
-	return mb.addUint32(uint32(argCount))
+	return mb.add(bytecode.SEND_MESSAGE, selectorIndex, argCount)
 }
 
 // ReturnStackTop adds a RETURN_STACK_TOP bytecode
@@ -118,20 +124,17 @@ func (mb *MethodBuilder) ReturnStackTop() *MethodBuilder {
 
 // Jump adds a JUMP bytecode with the given target offset
 func (mb *MethodBuilder) Jump(target int) *MethodBuilder {
-	mb.bytecodes = append(mb.bytecodes, bytecode.JUMP)
-	return mb.addUint32(uint32(target))
+	return mb.add(bytecode.JUMP, target)
 }
 
 // JumpIfTrue adds a JUMP_IF_TRUE bytecode with the given target offset
 func (mb *MethodBuilder) JumpIfTrue(target int) *MethodBuilder {
-	mb.bytecodes = append(mb.bytecodes, bytecode.JUMP_IF_TRUE)
-	return mb.addUint32(uint32(target))
+	return mb.add(bytecode.JUMP_IF_TRUE, target)
 }
 
 // JumpIfFalse adds a JUMP_IF_FALSE bytecode with the given target offset
 func (mb *MethodBuilder) JumpIfFalse(target int) *MethodBuilder {
-	mb.bytecodes = append(mb.bytecodes, bytecode.JUMP_IF_FALSE)
-	return mb.addUint32(uint32(target))
+	return mb.add(bytecode.JUMP_IF_FALSE, target)
 }
 
 // Pop adds a POP bytecode
@@ -146,9 +149,9 @@ func (mb *MethodBuilder) Duplicate() *MethodBuilder {
 	return mb
 }
 
-// Go finalizes the method creation and adds it to the class's method dictionary
-// It takes the selector name as a parameter to eliminate the need for a separate Selector call
-func (mb *MethodBuilder) Go(selectorName string) *pile.Object {
+// Build creates the method without verifying it or adding it to the class's method dictionary
+// Use it for bytecode fragments that are executed one instruction at a time
+func (mb *MethodBuilder) Build(selectorName string) *pile.Object {
 	// Set the selector
 	mb.selectorName = selectorName
 	mb.selectorObj = pile.NewSymbol(selectorName)
@@ -163,6 +166,21 @@ func (mb *MethodBuilder) Go(selectorName string) *pile.Object {
 	methodObj.TempVarNames = mb.tempVarNames
 	methodObj.SetPrimitive(mb.isPrimitive)
 	methodObj.SetPrimitiveIndex(mb.primitiveIndex)
+	methodObj.SetPrimitiveName(mb.primitiveName, mb.primitiveModule)
+
+	return method
+}
+
+// Go finalizes the method creation and adds it to the class's method dictionary
+// It takes the selector name as a parameter to eliminate the need for a separate Selector call
+// It panics if the bytecodes do not pass Verify
+func (mb *MethodBuilder) Go(selectorName string) *pile.Object {
+	method := mb.Build(selectorName)
+
+	// Refuse to install bytecodes the VM cannot execute safely
+	if err := Verify(pile.ObjectToMethod(method)); err != nil {
+		panic(err)
+	}
 
 	// Add the method to the class's method dictionary
 	symbolValue := pile.ObjectToSymbol(mb.selectorObj).GetValue()
@@ -172,4 +190,4 @@ func (mb *MethodBuilder) Go(selectorName string) *pile.Object {
 	// No longer reset builder state - each builder should only be used once
 	
 	return method
-}
\ No newline at end of file
+}
@@ -0,0 +1,167 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+
+	"smalltalklsp/interpreter/ast"
+	"smalltalklsp/interpreter/pile"
+)
+
+// Names of the optimizations, used to switch them off one at a time
+const (
+	// ConstantFolding replaces sends between literals with their result
+	ConstantFolding = "constant-folding"
+
+	// DeadCodeElimination removes instructions that can never be reached
+	DeadCodeElimination = "dead-code"
+
+	// JumpThreading points jumps at the final target of a chain of jumps
+	JumpThreading = "jump-threading"
+
+	// PushPopElimination removes values that are pushed and immediately popped
+	PushPopElimination = "push-pop"
+
+	// LiteralDeduplication shares one literal slot between equal literals
+	LiteralDeduplication = "literal-dedup"
+)
+
+// ASTPass rewrites the AST before code is generated for it
+type ASTPass interface {
+	// Name returns the name used to switch the pass off
+	Name() string
+
+	// RewriteAST returns the rewritten node, which may be the node itself
+	RewriteAST(node ast.Node) ast.Node
+}
+
+// CodePass rewrites the generated instructions of a method or block
+type CodePass interface {
+	// Name returns the name used to switch the pass off
+	Name() string
+
+	// RewriteCode rewrites the instructions in place
+	RewriteCode(code *Code)
+}
+
+// Optimizer is the pipeline of optimizations the compiler runs over each method
+// AST passes run before code generation and code passes after it, both in the
+// order they were added. Every pass can be switched off by name for debugging.
+type Optimizer struct {
+	// ASTPasses are the passes run over the AST
+	ASTPasses []ASTPass
+
+	// CodePasses are the passes run over the generated code
+	CodePasses []CodePass
+
+	// disabled holds the names of the passes that are switched off
+	disabled map[string]bool
+}
+
+// NewOptimizer creates an optimizer with all the standard passes switched on
+func NewOptimizer() *Optimizer {
+	return &Optimizer{
+		ASTPasses: []ASTPass{
+			constantFolding{},
+		},
+		CodePasses: []CodePass{
+			jumpThreading{},
+			deadCodeElimination{},
+			pushPopElimination{},
+		},
+		disabled: make(map[string]bool),
+	}
+}
+
+// Names returns the names of all the optimizations, sorted
+func (o *Optimizer) Names() []string {
+	names := []string{LiteralDeduplication}
+	for _, pass := range o.ASTPasses {
+		names = append(names, pass.Name())
+	}
+	for _, pass := range o.CodePasses {
+		names = append(names, pass.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Disable switches off the named optimizations
+func (o *Optimizer) Disable(names ...string) error {
+	known := make(map[string]bool)
+	for _, name := range o.Names() {
+		known[name] = true
+	}
+	for _, name := range names {
+		if !known[name] {
+			return fmt.Errorf("unknown optimization: %s", name)
+		}
+	}
+	for _, name := range names {
+		o.disabled[name] = true
+	}
+	return nil
+}
+
+// Enable switches the named optimizations back on
+func (o *Optimizer) Enable(names ...string) {
+	for _, name := range names {
+		delete(o.disabled, name)
+	}
+}
+
+// Enabled returns true if the named optimization is switched on
+// A nil optimizer has everything switched off
+func (o *Optimizer) Enabled(name string) bool {
+	return o != nil && !o.disabled[name]
+}
+
+// OptimizeAST runs the enabled AST passes over a node and returns the result
+func (o *Optimizer) OptimizeAST(node ast.Node) ast.Node {
+	if o == nil {
+		return node
+	}
+	for _, pass := range o.ASTPasses {
+		if o.Enabled(pass.Name()) {
+			node = pass.RewriteAST(node)
+		}
+	}
+	return node
+}
+
+// OptimizeMethod runs the enabled code passes over a method's bytecodes
+// The method's debug info is updated to match the new bytecodes
+func (o *Optimizer) OptimizeMethod(method *pile.Method) error {
+	if o == nil {
+		return nil
+	}
+	code, err := DecodeCode(method.Bytecodes)
+	if err != nil {
+		return err
+	}
+	o.OptimizeCode(code)
+
+	bytecodes, layout := code.encode()
+	method.Bytecodes = bytecodes
+	if method.DebugInfo != nil {
+		method.DebugInfo = layout.remapDebugInfo(code, method.DebugInfo)
+	}
+	return nil
+}
+
+// OptimizeCode runs the enabled code passes over code and the blocks in it
+func (o *Optimizer) OptimizeCode(code *Code) {
+	if o == nil {
+		return
+	}
+	for _, instruction := range code.Instructions {
+		if instruction.Block != nil {
+			o.OptimizeCode(instruction.Block)
+		}
+	}
+	for _, pass := range o.CodePasses {
+		if o.Enabled(pass.Name()) {
+			pass.RewriteCode(code)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package compiler_test
+
+import (
+	"strings"
+	"testing"
+
+	"smalltalklsp/interpreter/bytecode"
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/parser"
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// onlyPass returns an optimizer with every optimization but the named one switched off
+func onlyPass(t *testing.T, name string) *compiler.Optimizer {
+	optimizer := compiler.NewOptimizer()
+	for _, other := range optimizer.Names() {
+		if other != name {
+			if err := optimizer.Disable(other); err != nil {
+				t.Fatalf("Error disabling %s: %v", other, err)
+			}
+		}
+	}
+	return optimizer
+}
+
+// assertOptimizes checks that running one pass over the input gives the expected bytecodes
+func assertOptimizes(t *testing.T, virtualMachine *vm.VM, pass, input, expected string) {
+	t.Helper()
+	method, err := compiler.Assemble(input, virtualMachine)
+	if err != nil {
+		t.Fatalf("Error assembling %q: %v", input, err)
+	}
+	if err := onlyPass(t, pass).OptimizeMethod(method); err != nil {
+		t.Fatalf("Error optimizing %q: %v", input, err)
+	}
+	if err := compiler.Verify(method); err != nil {
+		t.Errorf("Optimized %q does not verify: %v", input, err)
+	}
+
+	want, err := compiler.Assemble(expected, virtualMachine)
+	if err != nil {
+		t.Fatalf("Error assembling %q: %v", expected, err)
+	}
+	if string(method.Bytecodes) != string(want.Bytecodes) {
+		t.Errorf("%s over %q:\ngot:\n%s\nexpected:\n%s", pass, input, compiler.Disassemble(method), compiler.Disassemble(want))
+	}
+}
+
+// TestCodePasses tests each bytecode pass on its own
+func TestCodePasses(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		name     string
+		pass     string
+		input    string
+		expected string
+	}{
+		{
+			"code after a return",
+			compiler.DeadCodeElimination,
+			"literals:\n 0: 1\nbytecodes:\n PUSH_SELF\n RETURN_STACK_TOP\n PUSH_LITERAL 0\n RETURN_STACK_TOP",
+			"bytecodes:\n PUSH_SELF\n RETURN_STACK_TOP",
+		},
+		{
+			"code skipped by a jump",
+			compiler.DeadCodeElimination,
+			"bytecodes:\n PUSH_SELF\n JUMP 2\n PUSH_SELF\n POP\n RETURN_STACK_TOP",
+			"bytecodes:\n PUSH_SELF\n RETURN_STACK_TOP",
+		},
+		{
+			"dead code in a block",
+			compiler.DeadCodeElimination,
+			"bytecodes:\n CREATE_BLOCK 3 0 0\n PUSH_SELF\n RETURN_STACK_TOP\n PUSH_SELF\n RETURN_STACK_TOP",
+			"bytecodes:\n CREATE_BLOCK 2 0 0\n PUSH_SELF\n RETURN_STACK_TOP\n RETURN_STACK_TOP",
+		},
+		{
+			"jump to a jump",
+			compiler.JumpThreading,
+			"bytecodes:\n PUSH_SELF\n JUMP_IF_TRUE 2\n PUSH_SELF\n RETURN_STACK_TOP\n JUMP -4",
+			"bytecodes:\n PUSH_SELF\n JUMP_IF_TRUE 0\n PUSH_SELF\n RETURN_STACK_TOP\n JUMP -4",
+		},
+		{
+			"jump to the next instruction",
+			compiler.DeadCodeElimination,
+			"bytecodes:\n PUSH_SELF\n JUMP 0\n RETURN_STACK_TOP",
+			"bytecodes:\n PUSH_SELF\n RETURN_STACK_TOP",
+		},
+		{
+			"jump loop",
+			compiler.JumpThreading,
+			"bytecodes:\n JUMP 0\n JUMP -4",
+			"bytecodes:\n JUMP -2\n JUMP -4",
+		},
+		{
+			"nested push and pop",
+			compiler.PushPopElimination,
+			"literals:\n 0: 1\nbytecodes:\n PUSH_SELF\n PUSH_LITERAL 0\n DUPLICATE\n POP\n POP\n RETURN_STACK_TOP",
+			"bytecodes:\n PUSH_SELF\n RETURN_STACK_TOP",
+		},
+		{
+			"store and pop",
+			compiler.PushPopElimination,
+			"temps: a\nbytecodes:\n PUSH_SELF\n STORE_TEMPORARY_VARIABLE 0\n POP\n PUSH_SELF\n RETURN_STACK_TOP",
+			"temps: a\nbytecodes:\n PUSH_SELF\n STORE_TEMPORARY_VARIABLE 0\n POP\n PUSH_SELF\n RETURN_STACK_TOP",
+		},
+		{
+			"push that is a jump target",
+			compiler.PushPopElimination,
+			"bytecodes:\n PUSH_SELF\n JUMP_IF_TRUE 0\n PUSH_SELF\n POP\n PUSH_SELF\n RETURN_STACK_TOP",
+			"bytecodes:\n PUSH_SELF\n JUMP_IF_TRUE 0\n PUSH_SELF\n POP\n PUSH_SELF\n RETURN_STACK_TOP",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertOptimizes(t, virtualMachine, test.pass, test.input, test.expected)
+		})
+	}
+}
+
+// TestCodeRoundTrip tests that decoding and encoding code gives back the same bytecodes
+func TestCodeRoundTrip(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	// Jumps over more than 127 bytes need an extension prefix
+	text := "bytecodes:\n PUSH_SELF\n JUMP_IF_TRUE 200\n" + strings.Repeat(" PUSH_SELF\n POP\n", 100) + " JUMP -209"
+	method, err := compiler.Assemble(text, virtualMachine)
+	if err != nil {
+		t.Fatalf("Error assembling: %v", err)
+	}
+	code, err := compiler.DecodeCode(method.Bytecodes)
+	if err != nil {
+		t.Fatalf("Error decoding: %v", err)
+	}
+	if encoded := code.Encode(); string(encoded) != string(method.Bytecodes) {
+		t.Errorf("Expected the round trip to give the same bytecodes, got %v", encoded)
+	}
+
+	// Removing the code between the jumps shrinks both of them
+	if err := onlyPass(t, compiler.PushPopElimination).OptimizeMethod(method); err != nil {
+		t.Fatalf("Error optimizing: %v", err)
+	}
+	if got := compiler.Disassemble(method); !strings.Contains(got, "JUMP_IF_TRUE 0") || !strings.Contains(got, "JUMP -5") {
+		t.Errorf("Expected both jumps to shrink, got:\n%s", got)
+	}
+}
+
+// TestOptimizeMethodDebugInfo tests that debug info follows the instructions that are left
+func TestOptimizeMethodDebugInfo(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	method, err := compiler.Assemble("bytecodes:\n PUSH_SELF\n JUMP 2\n PUSH_SELF\n POP\n RETURN_STACK_TOP", virtualMachine)
+	if err != nil {
+		t.Fatalf("Error assembling: %v", err)
+	}
+	source := "self skip self drop ^self"
+	method.DebugInfo = pile.NewDebugInfo(source)
+	method.DebugInfo.AddEntry(0, 0, 4)
+	method.DebugInfo.AddEntry(1, 5, 9)
+	method.DebugInfo.AddEntry(3, 10, 14)
+	method.DebugInfo.AddEntry(5, 20, 25)
+
+	if err := compiler.NewOptimizer().OptimizeMethod(method); err != nil {
+		t.Fatalf("Error optimizing: %v", err)
+	}
+
+	want, _ := compiler.Assemble("bytecodes:\n PUSH_SELF\n RETURN_STACK_TOP", virtualMachine)
+	if string(method.Bytecodes) != string(want.Bytecodes) {
+		t.Fatalf("Unexpected bytecodes:\n%s", compiler.Disassemble(method))
+	}
+	if got := method.DebugInfo.SourceAt(0); got != "self" {
+		t.Errorf("Expected pc 0 to map to %q, got %q", "self", got)
+	}
+	if got := method.DebugInfo.SourceAt(1); got != "^self" {
+		t.Errorf("Expected pc 1 to map to %q, got %q", "^self", got)
+	}
+}
+
+// compileWith compiles an expression with the given optimizer
+func compileWith(t *testing.T, virtualMachine *vm.VM, source string, optimizer *compiler.Optimizer) *pile.Method {
+	t.Helper()
+	objectClass := virtualMachine.Globals["Object"]
+	node, err := parser.NewParser(source, objectClass, virtualMachine).ParseExpression()
+	if err != nil {
+		t.Fatalf("Error parsing %q: %v", source, err)
+	}
+	bytecodeCompiler := compiler.NewBytecodeCompiler(objectClass)
+	bytecodeCompiler.Source = source
+	bytecodeCompiler.Optimizer = optimizer
+	return bytecodeCompiler.Compile(node)
+}
+
+// TestConstantFolding tests that sends between integer literals are folded
+func TestConstantFolding(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		source   string
+		expected *pile.Object
+	}{
+		{"3 + 4 * 2", virtualMachine.NewInteger(14)},
+		{"10 - 12", virtualMachine.NewInteger(-2)},
+		{"3 < 4", virtualMachine.NewTrue()},
+		{"3 = 4", virtualMachine.NewFalse()},
+	}
+	for _, test := range tests {
+		method := compileWith(t, virtualMachine, test.source, onlyPass(t, compiler.ConstantFolding))
+		if len(method.Bytecodes) != 1 || len(method.Literals) != 1 || method.Literals[0] != test.expected {
+			t.Errorf("Expected %q to fold to %s, got:\n%s", test.source, compiler.FormatLiteral(test.expected), compiler.Disassemble(method))
+		}
+		if got := method.GetDebugInfo().SourceAt(0); got != test.source {
+			t.Errorf("Expected the folded literal to map to %q, got %q", test.source, got)
+		}
+	}
+
+	// Every statement of a block is folded, not just the last
+	method := compileWith(t, virtualMachine, "[3 + 4. 5 * 2] value", onlyPass(t, compiler.ConstantFolding))
+	if len(sendPCs(method.Bytecodes)) != 1 {
+		t.Errorf("Expected only the value send to be left, got:\n%s", compiler.Disassemble(method))
+	}
+
+	// Sends that are not integer arithmetic, or would overflow, are left alone
+	for _, source := range []string{"3 foo: 4", "'a' = 'a'", "2305843009213693951 + 1"} {
+		method := compileWith(t, virtualMachine, source, onlyPass(t, compiler.ConstantFolding))
+		if len(sendPCs(method.Bytecodes)) != 1 {
+			t.Errorf("Expected %q not to fold, got:\n%s", source, compiler.Disassemble(method))
+		}
+	}
+}
+
+// TestLiteralDeduplication tests that equal literals share a slot only when deduplicating
+func TestLiteralDeduplication(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	source := "'a' foo: 'a' bar: 'b'"
+
+	method := compileWith(t, virtualMachine, source, onlyPass(t, compiler.LiteralDeduplication))
+	if len(method.Literals) != 3 {
+		t.Errorf("Expected 3 literals with deduplication, got %d", len(method.Literals))
+	}
+
+	method = compileWith(t, virtualMachine, source, nil)
+	if len(method.Literals) != 4 {
+		t.Errorf("Expected 4 literals without optimization, got %d", len(method.Literals))
+	}
+}
+
+// TestOptimizerSwitches tests switching passes off and on by name
+func TestOptimizerSwitches(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	optimizer := compiler.NewOptimizer()
+
+	if err := optimizer.Disable("no-such-pass"); err == nil {
+		t.Errorf("Expected disabling an unknown pass to fail")
+	}
+	if err := optimizer.Disable(compiler.ConstantFolding); err != nil {
+		t.Fatalf("Error disabling constant folding: %v", err)
+	}
+	if method := compileWith(t, virtualMachine, "3 + 4", optimizer); len(sendPCs(method.Bytecodes)) != 1 {
+		t.Errorf("Expected no folding with constant folding disabled")
+	}
+
+	optimizer.Enable(compiler.ConstantFolding)
+	method := compileWith(t, virtualMachine, "3 + 4", optimizer)
+	if len(method.Bytecodes) != 1 || method.Bytecodes[0] != bytecode.PUSH_LITERAL_SHORT {
+		t.Errorf("Expected folding once constant folding is enabled again, got:\n%s", compiler.Disassemble(method))
+	}
+}
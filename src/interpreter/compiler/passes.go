@@ -0,0 +1,227 @@
+package compiler
+
+import (
+	"smalltalklsp/interpreter/ast"
+	"smalltalklsp/interpreter/bytecode"
+	"smalltalklsp/interpreter/pile"
+)
+
+// constantFolding replaces arithmetic and comparisons between integer literals
+// with their result. Only selectors Integer implements as primitives are folded,
+// and sends whose result would not fit an immediate integer are left for the
+// run time to promote to a LargeInteger.
+type constantFolding struct{}
+
+// Name returns the name of the pass
+func (constantFolding) Name() string {
+	return ConstantFolding
+}
+
+// RewriteAST folds the sends in a node and everything below it
+func (p constantFolding) RewriteAST(node ast.Node) ast.Node {
+	switch n := node.(type) {
+	case *ast.MethodNode:
+		for i, statement := range n.Statements {
+			n.Statements[i] = p.rewrite(statement)
+		}
+		n.Body = p.rewrite(n.Body)
+	case *ast.ReturnNode:
+		n.Expression = p.rewrite(n.Expression)
+	case *ast.AssignmentNode:
+		n.Expression = p.rewrite(n.Expression)
+	case *ast.BlockNode:
+		for i, statement := range n.Statements {
+			n.Statements[i] = p.rewrite(statement)
+		}
+		n.Body = p.rewrite(n.Body)
+	case *ast.MessageSendNode:
+		n.Receiver = p.rewrite(n.Receiver)
+		for i, arg := range n.Arguments {
+			n.Arguments[i] = p.rewrite(arg)
+		}
+		if value := foldSend(n); value != nil {
+			return &ast.LiteralNode{SourceRange: n.SourceRange, Value: value}
+		}
+	}
+	return node
+}
+
+// rewrite rewrites a child node, which may be missing
+func (p constantFolding) rewrite(node ast.Node) ast.Node {
+	if node == nil {
+		return nil
+	}
+	return p.RewriteAST(node)
+}
+
+// foldSend returns the result of a send between integer literals, or nil if it cannot be folded
+func foldSend(node *ast.MessageSendNode) *pile.Object {
+	if len(node.Arguments) != 1 {
+		return nil
+	}
+	receiver, ok := integerLiteral(node.Receiver)
+	if !ok {
+		return nil
+	}
+	arg, ok := integerLiteral(node.Arguments[0])
+	if !ok {
+		return nil
+	}
+
+	switch node.Selector {
+	case "+":
+		return integerResult(receiver+arg, true)
+	case "-":
+		return integerResult(receiver-arg, true)
+	case "*":
+		product := receiver * arg
+		return integerResult(product, receiver == 0 || product/receiver == arg)
+	case "=":
+		return pile.NewBoolean(receiver == arg).(*pile.Object)
+	case "<":
+		return pile.NewBoolean(receiver < arg).(*pile.Object)
+	case ">":
+		return pile.NewBoolean(receiver > arg).(*pile.Object)
+	}
+	return nil
+}
+
+// integerLiteral returns the value of an immediate integer literal node
+func integerLiteral(node ast.Node) (int64, bool) {
+	literal, ok := node.(*ast.LiteralNode)
+	if !ok || literal.Value == nil || !pile.IsImmediate(literal.Value) || !pile.IsIntegerImmediate(literal.Value) {
+		return 0, false
+	}
+	return pile.GetIntegerImmediate(literal.Value), true
+}
+
+// integerResult returns an immediate integer, or nil if the value does not fit one
+// Operands are immediate integers, so sums and differences cannot overflow an int64
+func integerResult(value int64, exact bool) *pile.Object {
+	if !exact || value > pile.MaxIntegerImmediate || value < pile.MinIntegerImmediate {
+		return nil
+	}
+	return pile.MakeIntegerImmediate(value)
+}
+
+// jumpThreading points jumps whose target is an unconditional jump at that jump's target
+type jumpThreading struct{}
+
+// Name returns the name of the pass
+func (jumpThreading) Name() string {
+	return JumpThreading
+}
+
+// RewriteCode threads the jumps in code
+func (jumpThreading) RewriteCode(code *Code) {
+	for _, instruction := range code.Instructions {
+		// Follow the chain, stopping if it loops back on itself
+		seen := map[*CodeInstruction]bool{instruction: true}
+		for instruction.Target != nil && instruction.Target.Opcode == bytecode.JUMP && !seen[instruction.Target] {
+			seen[instruction.Target] = true
+			instruction.Target = instruction.Target.Target
+		}
+	}
+}
+
+// deadCodeElimination removes instructions no path from the start reaches,
+// such as code after a return or an unconditional jump, and then the
+// unconditional jumps that only skipped over them
+type deadCodeElimination struct{}
+
+// Name returns the name of the pass
+func (deadCodeElimination) Name() string {
+	return DeadCodeElimination
+}
+
+// RewriteCode removes the unreachable instructions in code
+func (deadCodeElimination) RewriteCode(code *Code) {
+	if len(code.Instructions) == 0 {
+		return
+	}
+	indices := make(map[*CodeInstruction]int)
+	for index, instruction := range code.Instructions {
+		indices[instruction] = index
+	}
+
+	reachable := make(map[*CodeInstruction]bool)
+	worklist := []*CodeInstruction{code.Instructions[0]}
+	for len(worklist) > 0 {
+		instruction := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		if instruction == nil || reachable[instruction] {
+			continue
+		}
+		reachable[instruction] = true
+
+		var next *CodeInstruction
+		if index := indices[instruction] + 1; index < len(code.Instructions) {
+			next = code.Instructions[index]
+		}
+		switch instruction.Opcode {
+		case bytecode.RETURN_STACK_TOP:
+		case bytecode.JUMP:
+			worklist = append(worklist, instruction.Target)
+		case bytecode.JUMP_IF_TRUE, bytecode.JUMP_IF_FALSE:
+			worklist = append(worklist, instruction.Target, next)
+		default:
+			worklist = append(worklist, next)
+		}
+	}
+
+	// Jumps only land on reachable instructions, so nothing needs redirecting
+	live := code.Instructions[:0]
+	for _, instruction := range code.Instructions {
+		if reachable[instruction] {
+			live = append(live, instruction)
+		}
+	}
+	code.Instructions = live
+
+	for index := 0; index+1 < len(code.Instructions); {
+		instruction := code.Instructions[index]
+		if instruction.Opcode == bytecode.JUMP && instruction.Target == code.Instructions[index+1] {
+			code.Remove(index)
+			continue
+		}
+		index++
+	}
+}
+
+// pushPopElimination removes an instruction that only pushes a value when the
+// next instruction pops it again
+type pushPopElimination struct{}
+
+// Name returns the name of the pass
+func (pushPopElimination) Name() string {
+	return PushPopElimination
+}
+
+// RewriteCode removes the push and pop pairs in code
+func (pushPopElimination) RewriteCode(code *Code) {
+	targets := code.Targets()
+	for index := 0; index+1 < len(code.Instructions); {
+		push, pop := code.Instructions[index], code.Instructions[index+1]
+		if pop.Opcode != bytecode.POP || !pushesWithoutEffects(push) || targets[push] || targets[pop] {
+			index++
+			continue
+		}
+		code.Remove(index + 1)
+		code.Remove(index)
+
+		// Removing the pair may have put another push next to a pop
+		if index > 0 {
+			index--
+		}
+	}
+}
+
+// pushesWithoutEffects returns true if an instruction does nothing but push a value
+func pushesWithoutEffects(instruction *CodeInstruction) bool {
+	switch instruction.Opcode {
+	case bytecode.PUSH_LITERAL, bytecode.PUSH_INSTANCE_VARIABLE, bytecode.PUSH_TEMPORARY_VARIABLE,
+		bytecode.PUSH_SELF, bytecode.PUSH_THIS_CONTEXT, bytecode.DUPLICATE, bytecode.CREATE_BLOCK:
+		return true
+	}
+	return false
+}
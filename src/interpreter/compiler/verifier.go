@@ -0,0 +1,204 @@
+package compiler
+
+import (
+	"fmt"
+
+	"smalltalklsp/interpreter/bytecode"
+	"smalltalklsp/interpreter/pile"
+)
+
+// VerifyError describes the first problem the verifier found in a method
+type VerifyError struct {
+	// Method names the method as Class>>selector
+	Method string
+
+	// PC is the offset of the offending instruction
+	PC int
+
+	// Message describes the problem
+	Message string
+}
+
+// Error returns the error message
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("invalid bytecode in %s at pc %d: %s", e.Method, e.PC, e.Message)
+}
+
+// Verify checks that a method's bytecodes are safe to execute:
+// every instruction is known and complete, literal and temporary indices are
+// in bounds, jumps land on instruction boundaries and the stack depth is the
+// same on every path into an instruction and never goes negative.
+//
+// The body of a CREATE_BLOCK instruction follows it in the bytecodes and is
+// verified as separate code with its own literal and temporary counts.
+func Verify(method *pile.Method) error {
+	v := &verifier{
+		method:    method,
+		bytecodes: method.Bytecodes,
+	}
+	return v.verifyCode(0, len(method.Bytecodes), len(method.Literals), len(method.TempVarNames))
+}
+
+// verifier holds the state needed to verify one method
+type verifier struct {
+	method    *pile.Method
+	bytecodes []byte
+}
+
+// fail returns a VerifyError for the instruction at pc
+func (v *verifier) fail(pc int, format string, args ...interface{}) error {
+	name := "a method"
+	if v.method.MethodClass != nil && v.method.Selector != nil {
+		name = fmt.Sprintf("%s>>%s", v.method.MethodClass.Name, pile.GetSymbolValue(v.method.Selector))
+	} else if v.method.Selector != nil {
+		name = pile.GetSymbolValue(v.method.Selector)
+	}
+	return &VerifyError{Method: name, PC: pc, Message: fmt.Sprintf(format, args...)}
+}
+
+// verifyCode verifies the instructions in [start, end)
+func (v *verifier) verifyCode(start, end, literalCount, tempCount int) error {
+	// Decode every instruction first so jumps can be checked against the boundaries
+	boundaries := make(map[int]bytecode.Instruction)
+	order := make([]int, 0)
+	pc := start
+	for pc < end {
+		instruction, err := v.decode(pc, end, literalCount, tempCount)
+		if err != nil {
+			return err
+		}
+		boundaries[pc] = instruction
+		order = append(order, pc)
+
+		// Skip over block bodies, they are verified on their own
+		pc += instruction.Size
+		if instruction.Opcode == bytecode.CREATE_BLOCK {
+			pc += instruction.Operand(0)
+		}
+	}
+
+	for _, pc := range order {
+		instruction := boundaries[pc]
+		if !bytecode.IsJump(instruction.Opcode) {
+			continue
+		}
+		name := bytecode.BytecodeName(instruction.Opcode)
+		target := instruction.JumpTarget(pc)
+		if target < start || target >= end {
+			return v.fail(pc, "%s target %d is outside the code [%d, %d)", name, target, start, end)
+		}
+		if _, ok := boundaries[target]; !ok {
+			return v.fail(pc, "%s target %d is not an instruction boundary", name, target)
+		}
+	}
+
+	return v.verifyStack(start, end, boundaries)
+}
+
+// decode checks the instruction at pc and returns it decoded
+func (v *verifier) decode(pc, end, literalCount, tempCount int) (bytecode.Instruction, error) {
+	// Decode within the code so instructions cannot run past its end
+	instruction, err := bytecode.Decode(v.bytecodes[:end], pc)
+	if err != nil {
+		return instruction, v.fail(pc, "%v", err)
+	}
+
+	name := bytecode.BytecodeName(instruction.Opcode)
+	operand := instruction.Operand(0)
+	switch instruction.Opcode {
+	case bytecode.PUSH_LITERAL, bytecode.SEND_MESSAGE:
+		if operand >= literalCount {
+			return instruction, v.fail(pc, "%s literal index %d out of bounds, there are %d literals", name, operand, literalCount)
+		}
+	case bytecode.PUSH_TEMPORARY_VARIABLE, bytecode.STORE_TEMPORARY_VARIABLE:
+		if operand >= tempCount {
+			return instruction, v.fail(pc, "%s temporary index %d out of bounds, there are %d temporaries", name, operand, tempCount)
+		}
+	case bytecode.CREATE_BLOCK:
+		bodyStart := pc + instruction.Size
+		if operand > end-bodyStart {
+			return instruction, v.fail(pc, "block body of %d bytes runs past the end of the code at %d", operand, end)
+		}
+		if err := v.verifyCode(bodyStart, bodyStart+operand, instruction.Operand(1), instruction.Operand(2)); err != nil {
+			return instruction, err
+		}
+	}
+
+	return instruction, nil
+}
+
+// stackEffect returns how many values an instruction pops and pushes
+func stackEffect(instruction bytecode.Instruction) (pops, pushes int) {
+	switch instruction.Opcode {
+	case bytecode.PUSH_LITERAL, bytecode.PUSH_INSTANCE_VARIABLE, bytecode.PUSH_TEMPORARY_VARIABLE,
+		bytecode.PUSH_SELF, bytecode.PUSH_THIS_CONTEXT, bytecode.CREATE_BLOCK:
+		return 0, 1
+	case bytecode.STORE_INSTANCE_VARIABLE, bytecode.STORE_TEMPORARY_VARIABLE:
+		return 1, 1
+	case bytecode.SEND_MESSAGE:
+		return instruction.Operand(1) + 1, 1
+	case bytecode.EXECUTE_BLOCK:
+		return instruction.Operand(0) + 1, 1
+	case bytecode.RETURN_STACK_TOP, bytecode.JUMP_IF_TRUE, bytecode.JUMP_IF_FALSE, bytecode.POP:
+		return 1, 0
+	case bytecode.DUPLICATE:
+		return 1, 2
+	}
+	return 0, 0
+}
+
+// verifyStack follows every path through [start, end) and checks the stack depth
+func (v *verifier) verifyStack(start, end int, boundaries map[int]bytecode.Instruction) error {
+	if start == end {
+		return nil
+	}
+	depths := map[int]int{start: 0}
+	worklist := []int{start}
+
+	for len(worklist) > 0 {
+		pc := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+
+		instruction := boundaries[pc]
+		depth := depths[pc]
+
+		pops, pushes := stackEffect(instruction)
+		if depth < pops {
+			return v.fail(pc, "%s needs %d stack values, only %d on the stack", bytecode.BytecodeName(instruction.Opcode), pops, depth)
+		}
+		depth = depth - pops + pushes
+
+		// Work out where execution can go next
+		successors := []int{}
+		next := pc + instruction.Size
+		if instruction.Opcode == bytecode.CREATE_BLOCK {
+			next += instruction.Operand(0)
+		}
+		switch instruction.Opcode {
+		case bytecode.RETURN_STACK_TOP:
+		case bytecode.JUMP:
+			successors = append(successors, instruction.JumpTarget(pc))
+		case bytecode.JUMP_IF_TRUE, bytecode.JUMP_IF_FALSE:
+			successors = append(successors, instruction.JumpTarget(pc), next)
+		default:
+			successors = append(successors, next)
+		}
+
+		for _, successor := range successors {
+			// Falling off the end returns the top of the stack
+			if successor == end {
+				continue
+			}
+			if previous, ok := depths[successor]; ok {
+				if previous != depth {
+					return v.fail(successor, "stack depth is %d on one path and %d on another", previous, depth)
+				}
+				continue
+			}
+			depths[successor] = depth
+			worklist = append(worklist, successor)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package compiler_test
+
+import (
+	"strings"
+	"testing"
+
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// TestVerifyValidCode tests that well formed bytecodes pass verification
+func TestVerifyValidCode(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []string{
+		// Empty methods return nil
+		"bytecodes:",
+		"literals:\n 0: 3\n 1: #+\nbytecodes:\n PUSH_SELF\n PUSH_LITERAL 0\n SEND_MESSAGE 1 1\n RETURN_STACK_TOP",
+		// Both branches leave one value on the stack
+		"literals:\n 0: 1\n 1: 2\nbytecodes:\n PUSH_SELF\n JUMP_IF_FALSE 3\n PUSH_LITERAL 0\n JUMP 1\n PUSH_LITERAL 1\n RETURN_STACK_TOP",
+		// Block bodies are checked against their own temps
+		"bytecodes:\n CREATE_BLOCK 1 0 1\n PUSH_TEMPORARY_VARIABLE 0\n PUSH_SELF\n EXECUTE_BLOCK 1",
+		// Backward jumps are allowed
+		"bytecodes:\n PUSH_SELF\n POP\n PUSH_SELF\n JUMP_IF_TRUE -5\n PUSH_SELF",
+	}
+	for _, text := range tests {
+		method, err := compiler.Assemble(text, virtualMachine)
+		if err != nil {
+			t.Fatalf("Error assembling %q: %v", text, err)
+		}
+		if err := compiler.Verify(method); err != nil {
+			t.Errorf("Expected %q to verify, got %v", text, err)
+		}
+	}
+}
+
+// TestVerifyInvalidCode tests that each kind of bad bytecode is rejected with a precise error
+func TestVerifyInvalidCode(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"literal index", "bytecodes:\n PUSH_LITERAL 0", "at pc 0: PUSH_LITERAL literal index 0 out of bounds, there are 0 literals"},
+		{"selector index", "literals:\n 0: 1\nbytecodes:\n PUSH_SELF\n SEND_MESSAGE 4 0", "at pc 1: SEND_MESSAGE literal index 4 out of bounds, there are 1 literals"},
+		{"temp index", "temps: a\nbytecodes:\n PUSH_SELF\n STORE_TEMPORARY_VARIABLE 1", "at pc 1: STORE_TEMPORARY_VARIABLE temporary index 1 out of bounds, there are 1 temporaries"},
+		{"jump into operand", "bytecodes:\n JUMP 1\n EXECUTE_BLOCK 0", "at pc 0: JUMP target 3 is not an instruction boundary"},
+		{"jump outside", "bytecodes:\n JUMP 100", "at pc 0: JUMP target 102 is outside the code [0, 2)"},
+		{"underflow", "bytecodes:\n POP", "at pc 0: POP needs 1 stack values, only 0 on the stack"},
+		{"send underflow", "literals:\n 0: #at:put:\nbytecodes:\n PUSH_SELF\n PUSH_SELF\n SEND_MESSAGE 0 2", "at pc 2: SEND_MESSAGE needs 3 stack values, only 2 on the stack"},
+		{"inconsistent depth", "bytecodes:\n PUSH_SELF\n JUMP_IF_TRUE 1\n PUSH_SELF\n PUSH_SELF\n RETURN_STACK_TOP", "at pc 4: stack depth is 0 on one path and 1 on another"},
+		{"block body", "bytecodes:\n CREATE_BLOCK 1 0 0\n PUSH_TEMPORARY_VARIABLE 0", "at pc 4: PUSH_TEMPORARY_VARIABLE temporary index 0 out of bounds, there are 0 temporaries"},
+		{"block size", "bytecodes:\n CREATE_BLOCK 20 0 0\n PUSH_SELF", "at pc 0: block body of 20 bytes runs past the end of the code at 5"},
+	}
+	for _, test := range tests {
+		method, err := compiler.Assemble(test.text, virtualMachine)
+		if err != nil {
+			t.Fatalf("%s: error assembling: %v", test.name, err)
+		}
+		err = compiler.Verify(method)
+		if err == nil {
+			t.Errorf("%s: expected a verification error", test.name)
+			continue
+		}
+		if !strings.HasSuffix(err.Error(), test.expected) {
+			t.Errorf("%s: expected error ending in %q, got %q", test.name, test.expected, err.Error())
+		}
+	}
+}
+
+// TestVerifyMalformedBytes tests bytecodes that cannot be written in the assembler text
+func TestVerifyMalformedBytes(t *testing.T) {
+	tests := []struct {
+		bytecodes []byte
+		expected  string
+	}{
+		{[]byte{200}, "at pc 0: unknown opcode 200"},
+		{[]byte{3, 0}, "at pc 1: truncated PUSH_LITERAL, needs 2 bytes, only 1 left"},
+		{[]byte{15}, "at pc 0: truncated EXTEND_A prefix"},
+		{[]byte{16, 1, 3}, "at pc 0: EXTEND_B prefix does not match an operand of PUSH_SELF"},
+		{[]byte{15, 1, 0x31}, "at pc 0: EXTEND_A prefix does not match an operand of PUSH_LITERAL"},
+	}
+	for _, test := range tests {
+		method := pile.ObjectToMethod(pile.NewMethod(pile.NewSymbol("broken"), nil))
+		method.Bytecodes = test.bytecodes
+		err := compiler.Verify(method)
+		if err == nil {
+			t.Errorf("Expected %v to fail verification", test.bytecodes)
+			continue
+		}
+		if err.Error() != "invalid bytecode in broken "+test.expected {
+			t.Errorf("Expected error %q, got %q", test.expected, err.Error())
+		}
+	}
+}
+
+// TestGoRejectsInvalidMethod tests that the method builder refuses to install bad bytecodes
+func TestGoRejectsInvalidMethod(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	objectClass := pile.ObjectToClass(virtualMachine.Globals["Object"])
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("Expected Go to panic")
+		}
+		if _, ok := r.(*compiler.VerifyError); !ok {
+			t.Errorf("Expected a VerifyError, got %v", r)
+		}
+		if pile.GetClassMethodDictionary(objectClass).HasKey("broken") {
+			t.Errorf("Expected the method not to be installed")
+		}
+	}()
+
+	compiler.NewMethodBuilder(objectClass).PushLiteral(3).Go("broken")
+}
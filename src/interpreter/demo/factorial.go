@@ -49,7 +49,7 @@ func runDemo() {
 	builder.Duplicate()
 
 	// JUMP_IF_FALSE to the false branch
-	builder.JumpIfFalse(12) // Jump past the true branch
+	builder.JumpIfFalse(4) // Jump past the true branch
 
 	// True branch: [1]
 	// POP the boolean (we don't need it anymore)
@@ -59,7 +59,7 @@ func runDemo() {
 	builder.PushLiteral(oneIndex)
 
 	// JUMP past the false branch to the return
-	builder.Jump(35) // Jump to the return
+	builder.Jump(7) // Jump to the return
 
 	// False branch: [self * (self - 1) factorial]
 	// POP the boolean (we don't need it anymore)
@@ -91,18 +91,18 @@ func runDemo() {
 	factorialMethod := builder.Go("factorial")
 
 	// Create literals for the main method
-	fourObj := virtualMachine.NewInteger(4)
+	hundredObj := virtualMachine.NewInteger(100)
 	factorialSelectorObj := pile.NewSymbol("factorial") // Create the selector for use in literals
 
-	// Create a method to compute factorial of 4 using AddLiteral
+	// Create a method to compute factorial of 100, which needs large integers using AddLiteral
 	mainBuilder := compiler.NewMethodBuilder(objectClass)
 
 	// Add literals to the method builder
-	fourIndex, mainBuilder := mainBuilder.AddLiteral(fourObj)                           // Literal 0: 4
+	hundredIndex, mainBuilder := mainBuilder.AddLiteral(hundredObj)                     // Literal 0: 100
 	factorialSelectorIndex, mainBuilder := mainBuilder.AddLiteral(factorialSelectorObj) // Literal 1: factorial
 
-	// Create bytecodes for main: 4 factorial
-	mainBuilder.PushLiteral(fourIndex)
+	// Create bytecodes for main: 100 factorial
+	mainBuilder.PushLiteral(hundredIndex)
 	mainBuilder.SendMessage(factorialSelectorIndex, 0)
 	mainBuilder.ReturnStackTop()
 
@@ -119,7 +119,7 @@ func runDemo() {
 		fmt.Printf("%3d ", method.Bytecodes[i])
 	}
 
-	context := vm.NewContext(mainMethod, fourObj, []*pile.Object{}, nil)
+	context := vm.NewContext(mainMethod, hundredObj, []*pile.Object{}, nil)
 
 	result, err := virtualMachine.ExecuteContext(context)
 	if err != nil {
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/pile"
 	"smalltalklsp/interpreter/vm"
 )
 
@@ -83,5 +85,34 @@ func LoadImageFromFile(vm *vm.VM, path string) error {
 
 	// For now, we'll just use our test image
 	// In a real implementation, this would deserialize all objects
-	return vm.LoadImage(path)
+	if err := vm.LoadImage(path); err != nil {
+		return err
+	}
+
+	// Never run methods whose bytecodes were damaged on disk
+	return verifyMethods(vm)
+}
+
+// verifyMethods verifies the bytecodes of every method of every global class
+func verifyMethods(vm *vm.VM) error {
+	for _, global := range vm.Globals {
+		if global == nil || pile.IsImmediate(global) || global.Type() != pile.OBJ_CLASS {
+			continue
+		}
+		class := pile.ObjectToClass(global)
+		if class.MethodDictionary == nil {
+			continue
+		}
+
+		var err error
+		pile.GetClassMethodDictionary(class).Do(func(selector string, method *pile.Object) {
+			if err == nil && method != nil && method.Type() == pile.OBJ_METHOD {
+				err = compiler.Verify(pile.ObjectToMethod(method))
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("invalid image file: %v", err)
+		}
+	}
+	return nil
 }
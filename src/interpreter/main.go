@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -29,6 +30,10 @@ func main() {
 			result, err := virtualMachine.Execute()
 			if err != nil {
 				fmt.Printf("Error executing image: %s\n", err)
+				var uncaught vm.UncaughtError
+				if errors.As(err, &uncaught) && uncaught.GetWalkback() != nil {
+					fmt.Println(uncaught.GetWalkback())
+				}
 				os.Exit(1)
 			}
 
@@ -1,10 +1,11 @@
-package parser
+package parser_test
 
 import (
 	"testing"
 	"unsafe"
 
 	"smalltalklsp/interpreter/ast"
+	. "smalltalklsp/interpreter/parser"
 	"smalltalklsp/interpreter/pile"
 	"smalltalklsp/interpreter/vm"
 )
@@ -23,7 +24,7 @@ func TestAssignmentExpression(t *testing.T) {
 	p := NewParser("x := 5", classObj, vmInstance)
 
 	// Tokenize the input manually to see what's happening
-	err := p.tokenize()
+	err := p.Tokenize()
 	if err != nil {
 		t.Fatalf("Error tokenizing input: %v", err)
 	}
@@ -46,7 +47,7 @@ func TestAssignmentExpression(t *testing.T) {
 	t.Logf("Before parsing - Current token: Type=%d, Value=%s", p.CurrentToken.Type, p.CurrentToken.Value)
 	
 	// Debug the isAssignment check
-	t.Logf("Is assignment check: %v", p.isAssignment())
+	t.Logf("Is assignment check: %v", p.IsAssignment())
 	
 	// Debug the next token
 	if p.CurrentTokenIndex+1 < len(p.Tokens) {
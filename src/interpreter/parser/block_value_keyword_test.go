@@ -1,10 +1,11 @@
-package parser
+package parser_test
 
 import (
 	"testing"
 	"unsafe"
 
 	"smalltalklsp/interpreter/ast"
+	. "smalltalklsp/interpreter/parser"
 	"smalltalklsp/interpreter/pile"
 	"smalltalklsp/interpreter/vm"
 )
@@ -23,7 +24,7 @@ func TestBlockValueKeyword(t *testing.T) {
 	p := NewParser("[:x | x] value: 5", classObj, vmInstance)
 
 	// Tokenize the input manually to see what's happening
-	err := p.tokenize()
+	err := p.Tokenize()
 	if err != nil {
 		t.Fatalf("Error tokenizing input: %v", err)
 	}
@@ -1,10 +1,11 @@
-package parser
+package parser_test
 
 import (
 	"testing"
 	"unsafe"
 
 	"smalltalklsp/interpreter/ast"
+	. "smalltalklsp/interpreter/parser"
 	"smalltalklsp/interpreter/pile"
 	"smalltalklsp/interpreter/vm"
 )
@@ -23,7 +24,7 @@ func TestDirectParseBlockValue(t *testing.T) {
 	p := NewParser("[5] value", classObj, vmInstance)
 
 	// Tokenize the input manually to see what's happening
-	err := p.tokenize()
+	err := p.Tokenize()
 	if err != nil {
 		t.Fatalf("Error tokenizing input: %v", err)
 	}
@@ -83,3 +84,31 @@ func TestDirectParseBlockValue(t *testing.T) {
 		t.Fatalf("Expected LiteralNode as block body, got %T", blockNode.Body)
 	}
 }
+
+// TestParseBlockStatements tests that a block keeps every statement, including
+// assignments, with the last one as its body
+func TestParseBlockStatements(t *testing.T) {
+	vmInstance := vm.NewVM()
+	p := NewParser("[:x | x foo. x := 3. x]", vmInstance.Globals["Object"], vmInstance)
+	node, err := p.ParseExpression()
+	if err != nil {
+		t.Fatalf("Error parsing expression: %v", err)
+	}
+
+	blockNode, ok := node.(*ast.BlockNode)
+	if !ok {
+		t.Fatalf("Expected BlockNode, got %T", node)
+	}
+	if len(blockNode.Statements) != 2 {
+		t.Fatalf("Expected 2 statements before the body, got %d", len(blockNode.Statements))
+	}
+	if _, ok := blockNode.Statements[0].(*ast.MessageSendNode); !ok {
+		t.Errorf("Expected the first statement to be a MessageSendNode, got %T", blockNode.Statements[0])
+	}
+	if assignment, ok := blockNode.Statements[1].(*ast.AssignmentNode); !ok || assignment.Variable != "x" {
+		t.Errorf("Expected the second statement to assign x, got %T", blockNode.Statements[1])
+	}
+	if variable, ok := blockNode.Body.(*ast.VariableNode); !ok || variable.Name != "x" {
+		t.Errorf("Expected the body to be the variable x, got %T", blockNode.Body)
+	}
+}
@@ -1,10 +1,11 @@
-package parser
+package parser_test
 
 import (
 	"testing"
 	"unsafe"
 
 	"smalltalklsp/interpreter/ast"
+	. "smalltalklsp/interpreter/parser"
 	"smalltalklsp/interpreter/pile"
 	"smalltalklsp/interpreter/vm"
 )
@@ -33,7 +34,7 @@ func TestCombined(t *testing.T) {
 		p := NewParser("#(1 2 3)", classObj, vmInstance)
 		
 		// Initialize tokens
-		err := p.tokenize()
+		err := p.Tokenize()
 		if err != nil {
 			t.Fatalf("Error tokenizing input: %v", err)
 		}
@@ -65,7 +66,7 @@ func runBooleanTest(t *testing.T, input string, expectedValue bool, classObj *pi
 	p := NewParser(input, classObj, vmInstance)
 	
 	// Initialize tokens
-	err := p.tokenize()
+	err := p.Tokenize()
 	if err != nil {
 		t.Fatalf("Error tokenizing input: %v", err)
 	}
@@ -103,7 +104,7 @@ func runIntegerTest(t *testing.T, input string, expectedValue int, classObj *pil
 	p := NewParser(input, classObj, vmInstance)
 	
 	// Initialize tokens
-	err := p.tokenize()
+	err := p.Tokenize()
 	if err != nil {
 		t.Fatalf("Error tokenizing input: %v", err)
 	}
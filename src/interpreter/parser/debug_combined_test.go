@@ -1,10 +1,11 @@
-package parser
+package parser_test
 
 import (
 	"testing"
 	"unsafe"
 
 	"smalltalklsp/interpreter/ast"
+	. "smalltalklsp/interpreter/parser"
 	"smalltalklsp/interpreter/pile"
 	"smalltalklsp/interpreter/vm"
 )
@@ -0,0 +1,23 @@
+package parser
+
+import (
+	"smalltalklsp/interpreter/ast"
+)
+
+// The tests that create a VM are in package parser_test, because the VM
+// imports the parser. These export the internals they exercise.
+
+// Tokenize tokenizes the input
+func (p *Parser) Tokenize() error {
+	return p.tokenize()
+}
+
+// ParseTokens parses an expression from tokens that have already been read
+func (p *Parser) ParseTokens() (ast.Node, error) {
+	return p.parseExpression()
+}
+
+// IsAssignment returns true if the current token starts an assignment
+func (p *Parser) IsAssignment() bool {
+	return p.isAssignment()
+}
@@ -1,10 +1,11 @@
-package parser
+package parser_test
 
 import (
 	"testing"
 	"unsafe"
 
 	"smalltalklsp/interpreter/ast"
+	. "smalltalklsp/interpreter/parser"
 	"smalltalklsp/interpreter/pile"
 	"smalltalklsp/interpreter/vm"
 )
@@ -472,7 +473,7 @@ func TestParseExpression(t *testing.T) {
 			p := NewParser(test.input, classObj, vmInstance)
 
 			// Initialize tokens
-			err := p.tokenize()
+			err := p.Tokenize()
 			if err != nil {
 				t.Fatalf("Error tokenizing input: %v", err)
 			}
@@ -490,7 +491,7 @@ func TestParseExpression(t *testing.T) {
 			p.CurrentTokenIndex = 0
 
 			// Parse the expression
-			node, err := p.parseExpression()
+			node, err := p.ParseTokens()
 			if err != nil {
 				t.Fatalf("Error parsing expression: %v", err)
 			}
@@ -517,7 +518,7 @@ func TestParseArrayLiteral(t *testing.T) {
 	p := NewParser("#(1 2 3)", classObj, vmInstance)
 
 	// Initialize tokens
-	err := p.tokenize()
+	err := p.Tokenize()
 	if err != nil {
 		t.Fatalf("Error tokenizing input: %v", err)
 	}
@@ -533,7 +534,7 @@ func TestParseArrayLiteral(t *testing.T) {
 	p.CurrentTokenIndex = 0
 
 	// Parse the expression
-	node, err := p.parseExpression()
+	node, err := p.ParseTokens()
 	if err != nil {
 		t.Fatalf("Error parsing expression: %v", err)
 	}
@@ -607,7 +608,7 @@ func TestArrayLiteralWithKeywordMessage(t *testing.T) {
 	p := NewParser("#(1 2 3) at: 2", classObj, vmInstance)
 
 	// Initialize tokens
-	err := p.tokenize()
+	err := p.Tokenize()
 	if err != nil {
 		t.Fatalf("Error tokenizing input: %v", err)
 	}
@@ -617,7 +618,7 @@ func TestArrayLiteralWithKeywordMessage(t *testing.T) {
 	p.CurrentTokenIndex = 0
 
 	// Parse the expression
-	node, err := p.parseExpression()
+	node, err := p.ParseTokens()
 	if err != nil {
 		t.Fatalf("Error parsing expression: %v", err)
 	}
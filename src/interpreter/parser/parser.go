@@ -1,7 +1,10 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"smalltalklsp/interpreter/ast"
@@ -19,6 +22,8 @@ type Parser struct {
 	// VM is the virtual machine used for creating literals and accessing globals
 	VM interface {
 		NewInteger(value int64) *pile.Object
+		NewLargeInteger(value *big.Int) *pile.Object
+		NewFloat(value float64) *pile.Object
 		NewString(value string) *pile.Object
 		NewArray(size int) *pile.Object
 		GetGlobal(name string) *pile.Object
@@ -62,11 +67,19 @@ type Token struct {
 
 	// Value is the value of the token
 	Value string
+
+	// Start is the offset of the first byte of the token in the input
+	Start int
+
+	// End is the offset just past the last byte of the token in the input
+	End int
 }
 
 // NewParser creates a new parser
 func NewParser(input string, class *pile.Object, vm interface {
 	NewInteger(value int64) *pile.Object
+	NewLargeInteger(value *big.Int) *pile.Object
+	NewFloat(value float64) *pile.Object
 	NewString(value string) *pile.Object
 	NewArray(size int) *pile.Object
 	GetGlobal(name string) *pile.Object
@@ -99,8 +112,24 @@ func (p *Parser) Parse() (ast.Node, error) {
 	return p.parseMethod()
 }
 
-// ParseExpression parses the input and returns an AST
+// ParseExpression parses the input as a single expression and returns an AST
+// Anything after the expression is a syntax error rather than being left out.
 func (p *Parser) ParseExpression() (ast.Node, error) {
+	node, err := p.parseExpressionInput()
+	if err != nil {
+		return nil, err
+	}
+	if p.CurrentToken.Type == TOKEN_SPECIAL && p.CurrentToken.Value == "." {
+		p.advanceToken()
+	}
+	if p.CurrentToken.Type != TOKEN_EOF {
+		return nil, fmt.Errorf("expected end of expression, got %v", p.CurrentToken)
+	}
+	return node, nil
+}
+
+// parseExpressionInput parses the expression at the start of the input
+func (p *Parser) parseExpressionInput() (ast.Node, error) {
 	// Tokenize the input
 	err := p.tokenize()
 	if err != nil {
@@ -113,6 +142,8 @@ func (p *Parser) ParseExpression() (ast.Node, error) {
 
 	// Check if the input starts with a return statement
 	if p.CurrentToken.Type == TOKEN_SPECIAL && p.CurrentToken.Value == "^" {
+		start := p.CurrentToken.Start
+
 		// Skip the return token
 		p.advanceToken()
 
@@ -124,7 +155,8 @@ func (p *Parser) ParseExpression() (ast.Node, error) {
 
 		// Create a return node
 		return &ast.ReturnNode{
-			Expression: expr,
+			SourceRange: p.rangeFrom(start),
+			Expression:  expr,
 		}, nil
 	}
 
@@ -132,6 +164,7 @@ func (p *Parser) ParseExpression() (ast.Node, error) {
 	if p.isAssignment() {
 		// Get the variable name
 		variableName := p.CurrentToken.Value
+		start := p.CurrentToken.Start
 		
 		// Skip the variable name and :=
 		p.advanceToken() // Skip variable name
@@ -145,6 +178,7 @@ func (p *Parser) ParseExpression() (ast.Node, error) {
 		
 		// Create and return an assignment node
 		return &ast.AssignmentNode{
+			SourceRange: p.rangeFrom(start),
 			Variable: variableName,
 			Expression: expression,
 		}, nil
@@ -157,6 +191,9 @@ func (p *Parser) ParseExpression() (ast.Node, error) {
 // tokenize tokenizes the input
 func (p *Parser) tokenize() error {
 	for p.Position < len(p.Input) {
+		// Remember where the token starts for source ranges
+		start := p.Position
+
 		// Skip whitespace
 		if p.isWhitespace(p.CurrentChar) {
 			p.advance()
@@ -165,19 +202,19 @@ func (p *Parser) tokenize() error {
 
 		// Parse identifiers
 		if p.isAlpha(p.CurrentChar) {
-			p.Tokens = append(p.Tokens, p.parseIdentifier())
+			p.addToken(p.parseIdentifier(), start)
 			continue
 		}
 
 		// Parse numbers
 		if p.isDigit(p.CurrentChar) {
-			p.Tokens = append(p.Tokens, p.parseNumber())
+			p.addToken(p.parseNumber(), start)
 			continue
 		}
 
-		// Parse special characters
-		if p.isSpecial(p.CurrentChar) {
-			p.Tokens = append(p.Tokens, p.parseSpecial())
+		// Parse special characters and binary selectors
+		if p.isSpecial(p.CurrentChar) || p.isBinaryChar(p.CurrentChar) {
+			p.addToken(p.parseSpecial(), start)
 			continue
 		}
 
@@ -187,7 +224,7 @@ func (p *Parser) tokenize() error {
 			if err != nil {
 				return err
 			}
-			p.Tokens = append(p.Tokens, token)
+			p.addToken(token, start)
 			continue
 		}
 
@@ -197,7 +234,7 @@ func (p *Parser) tokenize() error {
 			if err != nil {
 				return err
 			}
-			p.Tokens = append(p.Tokens, token)
+			p.addToken(token, start)
 			continue
 		}
 
@@ -215,11 +252,45 @@ func (p *Parser) tokenize() error {
 	}
 
 	// Add EOF token
-	p.Tokens = append(p.Tokens, Token{Type: TOKEN_EOF, Value: ""})
+	p.Tokens = append(p.Tokens, Token{Type: TOKEN_EOF, Value: "", Start: len(p.Input), End: len(p.Input)})
 
 	return nil
 }
 
+// ErrorPosition returns the offset in the input where parsing stopped
+// After a tokenizing error this is the character being scanned, otherwise
+// it is the start of the token being parsed
+func (p *Parser) ErrorPosition() int {
+	if len(p.Tokens) == 0 || p.Tokens[len(p.Tokens)-1].Type != TOKEN_EOF {
+		return p.Position
+	}
+	return p.CurrentToken.Start
+}
+
+// addToken appends a token that started at the given offset and ends at the current position
+func (p *Parser) addToken(token Token, start int) {
+	token.Start = start
+	token.End = p.Position
+	p.Tokens = append(p.Tokens, token)
+}
+
+// previousTokenEnd returns the end offset of the most recently consumed token
+func (p *Parser) previousTokenEnd() int {
+	index := p.CurrentTokenIndex - 1
+	if index >= len(p.Tokens) {
+		index = len(p.Tokens) - 1
+	}
+	if index < 0 {
+		return 0
+	}
+	return p.Tokens[index].End
+}
+
+// rangeFrom returns the source range from start to the end of the most recently consumed token
+func (p *Parser) rangeFrom(start int) ast.SourceRange {
+	return ast.SourceRange{Start: start, End: p.previousTokenEnd()}
+}
+
 // parseMethod parses a method
 func (p *Parser) parseMethod() (ast.Node, error) {
 	// Initialize the current token
@@ -231,28 +302,96 @@ func (p *Parser) parseMethod() (ast.Node, error) {
 		return nil, err
 	}
 
+	// Create the method node, the primitive pragma may come before or after the temporaries
+	methodNode := &ast.MethodNode{
+		SourceRange: ast.SourceRange{Start: 0, End: len(p.Input)},
+		Source:      p.Input,
+		Selector:    selector,
+		Parameters:  parameters,
+		Class:       p.Class,
+	}
+	if err := p.parsePrimitive(methodNode); err != nil {
+		return nil, err
+	}
+
 	// Parse temporary variables
 	temporaries, err := p.parseTemporaries()
 	if err != nil {
 		return nil, err
 	}
+	methodNode.Temporaries = temporaries
+	if !methodNode.IsPrimitive {
+		if err := p.parsePrimitive(methodNode); err != nil {
+			return nil, err
+		}
+	}
 
 	// Parse the method body
-	body, err := p.parseStatements()
+	statements, body, err := p.parseStatements()
 	if err != nil {
 		return nil, err
 	}
+	methodNode.Statements = statements
+	methodNode.Body = body
 
-	// Create the method node
-	methodNode := &ast.MethodNode{
-		Selector:    selector,
-		Parameters:  parameters,
-		Temporaries: temporaries,
-		Body:        body,
-		Class:       p.Class,
+	return methodNode, nil
+}
+
+// parsePrimitive parses a <primitive: n> or <primitive: 'name' module: 'module'>
+// pragma into the method node, if there is one. Either form can end with
+// error: name, which declares a temporary for the primitive's failure code.
+func (p *Parser) parsePrimitive(methodNode *ast.MethodNode) error {
+	if p.CurrentToken.Type != TOKEN_SPECIAL || p.CurrentToken.Value != "<" {
+		return nil
 	}
+	p.advanceToken()
 
-	return methodNode, nil
+	if p.CurrentToken.Type != TOKEN_IDENTIFIER || p.CurrentToken.Value != "primitive:" {
+		return fmt.Errorf("expected primitive:, got %v", p.CurrentToken)
+	}
+	p.advanceToken()
+
+	switch p.CurrentToken.Type {
+	case TOKEN_NUMBER:
+		index, err := strconv.Atoi(p.CurrentToken.Value)
+		if err != nil {
+			return fmt.Errorf("invalid primitive number: %s", p.CurrentToken.Value)
+		}
+		methodNode.PrimitiveIndex = index
+	case TOKEN_STRING:
+		methodNode.PrimitiveName = p.CurrentToken.Value
+	default:
+		return fmt.Errorf("expected primitive number or name, got %v", p.CurrentToken)
+	}
+	methodNode.IsPrimitive = true
+	p.advanceToken()
+
+	// Named primitives can be in a module
+	if methodNode.PrimitiveName != "" && p.CurrentToken.Type == TOKEN_IDENTIFIER && p.CurrentToken.Value == "module:" {
+		p.advanceToken()
+		if p.CurrentToken.Type != TOKEN_STRING {
+			return fmt.Errorf("expected module name, got %v", p.CurrentToken)
+		}
+		methodNode.PrimitiveModule = p.CurrentToken.Value
+		p.advanceToken()
+	}
+
+	// The failure code is stored in a temporary for the fallback code
+	if p.CurrentToken.Type == TOKEN_IDENTIFIER && p.CurrentToken.Value == "error:" {
+		p.advanceToken()
+		if p.CurrentToken.Type != TOKEN_IDENTIFIER || strings.HasSuffix(p.CurrentToken.Value, ":") {
+			return fmt.Errorf("expected error code name, got %v", p.CurrentToken)
+		}
+		methodNode.PrimitiveErrorName = p.CurrentToken.Value
+		p.advanceToken()
+	}
+
+	if p.CurrentToken.Type != TOKEN_SPECIAL || p.CurrentToken.Value != ">" {
+		return fmt.Errorf("expected >, got %v", p.CurrentToken)
+	}
+	p.advanceToken()
+
+	return nil
 }
 
 // parseMethodSelector parses a method selector
@@ -273,20 +412,24 @@ func (p *Parser) parseMethodSelector() (string, []string, error) {
 		return selector, []string{parameter}, nil
 	}
 
-	// Handle keyword selectors
+	// Handle keyword selectors, one parameter per keyword
 	if p.CurrentToken.Type == TOKEN_IDENTIFIER && strings.HasSuffix(p.CurrentToken.Value, ":") {
-		selector := p.CurrentToken.Value
-		p.advanceToken()
+		selector := ""
+		parameters := []string{}
+		for p.CurrentToken.Type == TOKEN_IDENTIFIER && strings.HasSuffix(p.CurrentToken.Value, ":") {
+			selector += p.CurrentToken.Value
+			p.advanceToken()
 
-		// Parse the parameter
-		if p.CurrentToken.Type != TOKEN_IDENTIFIER {
-			return "", nil, fmt.Errorf("expected identifier, got %v", p.CurrentToken)
-		}
+			// Parse the parameter
+			if p.CurrentToken.Type != TOKEN_IDENTIFIER || strings.HasSuffix(p.CurrentToken.Value, ":") {
+				return "", nil, fmt.Errorf("expected identifier, got %v", p.CurrentToken)
+			}
 
-		parameter := p.CurrentToken.Value
-		p.advanceToken()
+			parameters = append(parameters, p.CurrentToken.Value)
+			p.advanceToken()
+		}
 
-		return selector, []string{parameter}, nil
+		return selector, parameters, nil
 	}
 
 	// Handle unary selectors
@@ -330,44 +473,58 @@ func (p *Parser) parseTemporaries() ([]string, error) {
 	return []string{}, nil
 }
 
-// parseStatements parses statements
-func (p *Parser) parseStatements() (ast.Node, error) {
-	// For now, we only handle a single return statement
-	// Skip any statements before the return
-	for p.CurrentToken.Type != TOKEN_EOF && !(p.CurrentToken.Type == TOKEN_SPECIAL && p.CurrentToken.Value == "^") {
-		// Just advance to the next token
-		p.advanceToken()
-
-		// If we've reached the end of the tokens, break
-		if p.CurrentTokenIndex >= len(p.Tokens) {
-			break
-		}
-	}
-
-	// Parse the return statement
-	if p.CurrentToken.Type == TOKEN_SPECIAL && p.CurrentToken.Value == "^" {
-		p.advanceToken()
-
-		// Initialize the current token index if needed
-		if p.CurrentTokenIndex >= len(p.Tokens) {
-			return nil, fmt.Errorf("unexpected end of input after return token")
+// parseStatements parses the statements of a method body, up to the end of the
+// input, and answers the statements before the last and the last one
+// A return can only be the last statement, see VisitMethodNode for a method
+// that does not end in one.
+func (p *Parser) parseStatements() ([]ast.Node, ast.Node, error) {
+	var statements []ast.Node
+	for p.CurrentToken.Type != TOKEN_EOF {
+		if n := len(statements); n > 0 {
+			if _, ok := statements[n-1].(*ast.ReturnNode); ok {
+				return nil, nil, fmt.Errorf("expected end of method after return, got %v", p.CurrentToken)
+			}
 		}
 
-		// Parse the expression
-		expression, err := p.parseKeywordMessage()
+		statement, err := p.parseStatement()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+		statements = append(statements, statement)
 
-		// Create the return node
-		returnNode := &ast.ReturnNode{
-			Expression: expression,
+		// Statements are separated by periods, the last one can have one too
+		if p.CurrentToken.Type == TOKEN_SPECIAL && p.CurrentToken.Value == "." {
+			p.advanceToken()
+		} else if p.CurrentToken.Type != TOKEN_EOF {
+			return nil, nil, fmt.Errorf("expected period or end of method, got %v", p.CurrentToken)
 		}
+	}
+
+	if len(statements) == 0 {
+		return nil, nil, nil
+	}
+	return statements[:len(statements)-1], statements[len(statements)-1], nil
+}
 
-		return returnNode, nil
+// parseStatement parses a return or an expression, which can be an assignment
+func (p *Parser) parseStatement() (ast.Node, error) {
+	if p.CurrentToken.Type != TOKEN_SPECIAL || p.CurrentToken.Value != "^" {
+		return p.parseExpression()
 	}
 
-	return nil, fmt.Errorf("expected return statement, got %v", p.CurrentToken)
+	start := p.CurrentToken.Start
+	p.advanceToken()
+	if p.CurrentToken.Type == TOKEN_EOF {
+		return nil, fmt.Errorf("unexpected end of input after return token")
+	}
+	expression, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.ReturnNode{
+		SourceRange: p.rangeFrom(start),
+		Expression:  expression,
+	}, nil
 }
 
 // parseExpression parses an expression
@@ -396,6 +553,7 @@ func (p *Parser) parseAssignment() (ast.Node, error) {
 	if p.isAssignment() {
 		// Get the variable name
 		variableName := p.CurrentToken.Value
+		start := p.CurrentToken.Start
 		
 		// Skip the variable name and :=
 		p.advanceToken() // Skip variable name
@@ -409,6 +567,7 @@ func (p *Parser) parseAssignment() (ast.Node, error) {
 		
 		// Create and return an assignment node
 		return &ast.AssignmentNode{
+			SourceRange: p.rangeFrom(start),
 			Variable: variableName,
 			Expression: expression,
 		}, nil
@@ -420,6 +579,9 @@ func (p *Parser) parseAssignment() (ast.Node, error) {
 
 // parseKeywordMessage parses a keyword message (lowest precedence)
 func (p *Parser) parseKeywordMessage() (ast.Node, error) {
+	// Remember where the receiver starts, including any parentheses
+	start := p.CurrentToken.Start
+
 	// First parse a binary expression
 	receiver, err := p.parseBinaryMessage()
 	if err != nil {
@@ -449,9 +611,10 @@ func (p *Parser) parseKeywordMessage() (ast.Node, error) {
 		selector := strings.Join(keywordParts, "")
 
 		return &ast.MessageSendNode{
-			Receiver:  receiver,
-			Selector:  selector,
-			Arguments: arguments,
+			SourceRange: p.rangeFrom(start),
+			Receiver:    receiver,
+			Selector:    selector,
+			Arguments:   arguments,
 		}, nil
 	}
 
@@ -460,6 +623,9 @@ func (p *Parser) parseKeywordMessage() (ast.Node, error) {
 
 // parseBinaryMessage parses a binary message (medium precedence)
 func (p *Parser) parseBinaryMessage() (ast.Node, error) {
+	// Remember where the receiver starts, including any parentheses
+	start := p.CurrentToken.Start
+
 	// First parse a unary message
 	left, err := p.parseUnaryMessage()
 	if err != nil {
@@ -486,9 +652,10 @@ func (p *Parser) parseBinaryMessage() (ast.Node, error) {
 
 		// Create a message send node
 		left = &ast.MessageSendNode{
-			Receiver:  left,
-			Selector:  selector,
-			Arguments: []ast.Node{right},
+			SourceRange: p.rangeFrom(start),
+			Receiver:    left,
+			Selector:    selector,
+			Arguments:   []ast.Node{right},
 		}
 	}
 
@@ -497,6 +664,9 @@ func (p *Parser) parseBinaryMessage() (ast.Node, error) {
 
 // parseUnaryMessage parses a unary message (highest precedence)
 func (p *Parser) parseUnaryMessage() (ast.Node, error) {
+	// Remember where the receiver starts, including any parentheses
+	start := p.CurrentToken.Start
+
 	// First parse a primary expression
 	receiver, err := p.parsePrimary()
 	if err != nil {
@@ -511,9 +681,10 @@ func (p *Parser) parseUnaryMessage() (ast.Node, error) {
 
 		// Create a message send node
 		receiver = &ast.MessageSendNode{
-			Receiver:  receiver,
-			Selector:  selector,
-			Arguments: []ast.Node{},
+			SourceRange: p.rangeFrom(start),
+			Receiver:    receiver,
+			Selector:    selector,
+			Arguments:   []ast.Node{},
 		}
 	}
 
@@ -522,13 +693,22 @@ func (p *Parser) parseUnaryMessage() (ast.Node, error) {
 
 // parsePrimary parses a primary expression
 func (p *Parser) parsePrimary() (ast.Node, error) {
+	// Remember where the primary starts for source ranges
+	start := p.CurrentToken.Start
+
 	// Handle self
 	if p.CurrentToken.Type == TOKEN_IDENTIFIER && p.CurrentToken.Value == "self" {
 		p.advanceToken()
-		return &ast.SelfNode{}, nil
+		return &ast.SelfNode{SourceRange: p.rangeFrom(start)}, nil
+	}
+
+	// Handle thisContext
+	if p.CurrentToken.Type == TOKEN_IDENTIFIER && p.CurrentToken.Value == "thisContext" {
+		p.advanceToken()
+		return &ast.ThisContextNode{SourceRange: p.rangeFrom(start)}, nil
 	}
 
-	// Handle true and false
+	// Handle true, false and nil
 	if p.CurrentToken.Type == TOKEN_IDENTIFIER && p.CurrentToken.Value == "true" {
 		p.advanceToken()
 
@@ -540,7 +720,8 @@ func (p *Parser) parsePrimary() (ast.Node, error) {
 			return nil, fmt.Errorf("failed to create immediate true value")
 		}
 		return &ast.LiteralNode{
-			Value: trueValue,
+			SourceRange: p.rangeFrom(start),
+			Value:       trueValue,
 		}, nil
 	}
 
@@ -555,7 +736,16 @@ func (p *Parser) parsePrimary() (ast.Node, error) {
 			return nil, fmt.Errorf("failed to create immediate false value")
 		}
 		return &ast.LiteralNode{
-			Value: falseValue,
+			SourceRange: p.rangeFrom(start),
+			Value:       falseValue,
+		}, nil
+	}
+
+	if p.CurrentToken.Type == TOKEN_IDENTIFIER && p.CurrentToken.Value == "nil" {
+		p.advanceToken()
+		return &ast.LiteralNode{
+			SourceRange: p.rangeFrom(start),
+			Value:       pile.MakeNilImmediate(),
 		}, nil
 	}
 
@@ -566,20 +756,32 @@ func (p *Parser) parsePrimary() (ast.Node, error) {
 			Value: p.VM.NewString(p.CurrentToken.Value),
 		}
 		p.advanceToken()
+		literalNode.SourceRange = p.rangeFrom(start)
+		return literalNode, nil
+	}
+
+	// Handle symbol literals
+	if p.CurrentToken.Type == TOKEN_SYMBOL && p.CurrentToken.Value != "(" {
+		literalNode := &ast.LiteralNode{
+			Value: pile.NewSymbol(p.CurrentToken.Value),
+		}
+		p.advanceToken()
+		literalNode.SourceRange = p.rangeFrom(start)
 		return literalNode, nil
 	}
 
 	// Handle number literals
 	if p.CurrentToken.Type == TOKEN_NUMBER {
-		// Parse the number
-		var value int64
-		fmt.Sscanf(p.CurrentToken.Value, "%d", &value)
-
 		// Create a number literal node using the VM
+		value, err := p.numberLiteral()
+		if err != nil {
+			return nil, err
+		}
 		literalNode := &ast.LiteralNode{
-			Value: p.VM.NewInteger(value),
+			Value: value,
 		}
 		p.advanceToken()
+		literalNode.SourceRange = p.rangeFrom(start)
 		return literalNode, nil
 	}
 
@@ -624,11 +826,11 @@ func (p *Parser) parsePrimary() (ast.Node, error) {
 
 			// If it's a class or other global, return it as a literal node
 			// TODO look it up at runtime since the value may have changed
-			return &ast.LiteralNode{Value: globalObj}, nil
+			return &ast.LiteralNode{SourceRange: p.rangeFrom(start), Value: globalObj}, nil
 		}
 
 		// Otherwise, treat it as a regular variable
-		return &ast.VariableNode{Name: name}, nil
+		return &ast.VariableNode{SourceRange: p.rangeFrom(start), Name: name}, nil
 	}
 
 	return nil, fmt.Errorf("expected primary expression, got %v", p.CurrentToken)
@@ -636,6 +838,9 @@ func (p *Parser) parsePrimary() (ast.Node, error) {
 
 // parseArrayLiteral parses an array literal like #(1 2 3)
 func (p *Parser) parseArrayLiteral() (ast.Node, error) {
+	// The array literal starts at the # token
+	start := p.CurrentToken.Start
+
 	// Skip the opening symbol token (the # has already been handled by the tokenizer)
 	p.advanceToken()
 
@@ -655,11 +860,12 @@ func (p *Parser) parseArrayLiteral() (ast.Node, error) {
 		// Parse the element (only literals are allowed in array literals)
 		if p.CurrentToken.Type == TOKEN_NUMBER {
 			// Parse number literal
-			var value int64
-			fmt.Sscanf(p.CurrentToken.Value, "%d", &value)
-
+			value, err := p.numberLiteral()
+			if err != nil {
+				return nil, err
+			}
 			element := &ast.LiteralNode{
-				Value: p.VM.NewInteger(value),
+				Value: value,
 			}
 			elements = append(elements, element)
 			p.advanceToken()
@@ -670,6 +876,21 @@ func (p *Parser) parseArrayLiteral() (ast.Node, error) {
 			}
 			elements = append(elements, element)
 			p.advanceToken()
+		} else if p.CurrentToken.Type == TOKEN_SYMBOL && p.CurrentToken.Value == "(" {
+			// Parse a nested array literal
+			element, err := p.parseArrayLiteral()
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+		} else if p.CurrentToken.Type == TOKEN_SYMBOL {
+			// Parse symbol literal
+			elements = append(elements, &ast.LiteralNode{Value: pile.NewSymbol(p.CurrentToken.Value)})
+			p.advanceToken()
+		} else if p.CurrentToken.Type == TOKEN_IDENTIFIER && p.CurrentToken.Value == "nil" {
+			// Parse nil literal
+			elements = append(elements, &ast.LiteralNode{Value: pile.MakeNilImmediate()})
+			p.advanceToken()
 		} else if p.CurrentToken.Type == TOKEN_IDENTIFIER &&
 			(p.CurrentToken.Value == "true" || p.CurrentToken.Value == "false") {
 			// Parse boolean literal
@@ -722,12 +943,16 @@ func (p *Parser) parseArrayLiteral() (ast.Node, error) {
 
 	// Create a literal node with the array object
 	return &ast.LiteralNode{
-		Value: arrayObj,
+		SourceRange: p.rangeFrom(start),
+		Value:       arrayObj,
 	}, nil
 }
 
 // parseBlock parses a block expression
 func (p *Parser) parseBlock() (ast.Node, error) {
+	// The block starts at the opening bracket
+	start := p.CurrentToken.Start
+
 	// Skip the opening bracket
 	p.advanceToken()
 
@@ -809,8 +1034,8 @@ func (p *Parser) parseBlock() (ast.Node, error) {
 
 	// Parse expressions until we reach the closing bracket or EOF
 	for p.CurrentToken.Type != TOKEN_EOF && (p.CurrentToken.Type != TOKEN_SPECIAL || p.CurrentToken.Value != "]") {
-		// Parse an expression
-		expr, err := p.parseKeywordMessage()
+		// Parse an expression, which can be an assignment
+		expr, err := p.parseExpression()
 		if err != nil {
 			return nil, err
 		}
@@ -842,19 +1067,22 @@ func (p *Parser) parseBlock() (ast.Node, error) {
 			return nil, fmt.Errorf("failed to create nil immediate value")
 		}
 		return &ast.BlockNode{
+			SourceRange: p.rangeFrom(start),
 			Parameters:  parameters,
 			Temporaries: temporaries,
 			Body:        &ast.LiteralNode{Value: nilValue},
 		}, nil
 	}
 
-	// Use the last expression as the block's body (for now, ignoring statements before the last one)
+	// The last expression is the block's body, whose value the block answers
 	body := bodyExpressions[len(bodyExpressions)-1]
 
 	// Create the block node
 	blockNode := &ast.BlockNode{
+		SourceRange: p.rangeFrom(start),
 		Parameters:  parameters,
 		Temporaries: temporaries,
+		Statements:  bodyExpressions[:len(bodyExpressions)-1],
 		Body:        body,
 	}
 
@@ -900,6 +1128,32 @@ func (p *Parser) isSpecial(c byte) bool {
 	return strings.ContainsRune("+-*/=<>[](){}^.|:,~", rune(c))
 }
 
+// isBinaryChar returns true if the character can be part of a binary selector
+func (p *Parser) isBinaryChar(c byte) bool {
+	return strings.ContainsRune("+-*/=<>,~\\&@%|", rune(c))
+}
+
+// numberLiteral creates the number the current number token stands for
+// A number with a fraction part or an exponent is a Float, and an integer too
+// big for an immediate is a large integer.
+func (p *Parser) numberLiteral() (*pile.Object, error) {
+	text := p.CurrentToken.Value
+	if strings.ContainsAny(text, ".e") {
+		// An exponent too big for a float parses to infinity, which ParseFloat answers with ErrRange
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil && !errors.Is(err, strconv.ErrRange) {
+			return nil, fmt.Errorf("malformed number: %s", text)
+		}
+		return p.VM.NewFloat(value), nil
+	}
+
+	value, ok := new(big.Int).SetString(text, 10)
+	if !ok {
+		return nil, fmt.Errorf("malformed number: %s", text)
+	}
+	return p.VM.NewLargeInteger(value), nil
+}
+
 // parseIdentifier parses an identifier
 func (p *Parser) parseIdentifier() Token {
 	var value strings.Builder
@@ -942,6 +1196,24 @@ func (p *Parser) parseNumber() Token {
 		}
 	}
 
+	// Handle an exponent, which must have digits after the e and an optional minus sign
+	if p.Position < len(p.Input) && p.CurrentChar == 'e' {
+		digits := p.Position + 1
+		if digits < len(p.Input) && p.Input[digits] == '-' {
+			digits++
+		}
+		if digits < len(p.Input) && p.isDigit(p.Input[digits]) {
+			for p.Position < digits {
+				value.WriteByte(p.CurrentChar)
+				p.advance()
+			}
+			for p.Position < len(p.Input) && p.isDigit(p.CurrentChar) {
+				value.WriteByte(p.CurrentChar)
+				p.advance()
+			}
+		}
+	}
+
 	return Token{Type: TOKEN_NUMBER, Value: value.String()}
 }
 
@@ -954,9 +1226,15 @@ func (p *Parser) parseSpecial() Token {
 		return Token{Type: TOKEN_ASSIGNMENT, Value: ":="}
 	}
 	
-	// Regular special character
+	// Binary selectors can have several characters, such as <= and \\, but | stands alone
 	value := string(p.CurrentChar)
 	p.advance()
+	if value != "|" && p.isBinaryChar(value[0]) {
+		for p.Position < len(p.Input) && p.isBinaryChar(p.CurrentChar) && p.CurrentChar != '|' {
+			value += string(p.CurrentChar)
+			p.advance()
+		}
+	}
 	return Token{Type: TOKEN_SPECIAL, Value: value}
 }
 
@@ -1010,10 +1288,23 @@ func (p *Parser) parseSymbol() (Token, error) {
 		return Token{Type: TOKEN_SYMBOL, Value: "("}, nil
 	}
 
-	// Otherwise, parse an identifier symbol
+	// Otherwise, parse an identifier symbol, which may have several keywords like #at:put:
 	if p.isAlpha(p.CurrentChar) {
-		token := p.parseIdentifier()
-		return Token{Type: TOKEN_SYMBOL, Value: token.Value}, nil
+		value := p.parseIdentifier().Value
+		for strings.HasSuffix(value, ":") && p.Position < len(p.Input) && p.isAlpha(p.CurrentChar) {
+			value += p.parseIdentifier().Value
+		}
+		return Token{Type: TOKEN_SYMBOL, Value: value}, nil
+	}
+
+	// Or a binary selector symbol such as #+
+	if p.isBinaryChar(p.CurrentChar) {
+		var value strings.Builder
+		for p.Position < len(p.Input) && p.isBinaryChar(p.CurrentChar) {
+			value.WriteByte(p.CurrentChar)
+			p.advance()
+		}
+		return Token{Type: TOKEN_SYMBOL, Value: value.String()}, nil
 	}
 
 	return Token{}, fmt.Errorf("invalid symbol")
@@ -1,10 +1,12 @@
-package parser
+package parser_test
 
 import (
+	"math"
 	"testing"
 	"unsafe"
 
 	"smalltalklsp/interpreter/ast"
+	. "smalltalklsp/interpreter/parser"
 	"smalltalklsp/interpreter/pile"
 	"smalltalklsp/interpreter/vm"
 )
@@ -353,3 +355,222 @@ func TestParseBlockValueMessage(t *testing.T) {
 		t.Errorf("Expected value to be 5, got %d", value)
 	}
 }
+
+// TestParsePrimitivePragma tests parsing numbered and named primitive pragmas
+func TestParsePrimitivePragma(t *testing.T) {
+	vmInstance := vm.NewVM()
+	classObj := vmInstance.Globals["Object"]
+
+	tests := []struct {
+		source string
+		index  int
+		name   string
+		module string
+	}{
+		{"+ other <primitive: 1> ^self", 1, "", ""},
+		{"size | n | <primitive: 30> ^n", 30, "", ""},
+		{"size <primitive: 'stringSize'> ^self", 0, "stringSize", ""},
+		{", other <primitive: 'stringConcat' module: 'strings'> ^self", 0, "stringConcat", "strings"},
+	}
+	for _, test := range tests {
+		node, err := NewParser(test.source, classObj, vmInstance).Parse()
+		if err != nil {
+			t.Fatalf("Error parsing %q: %v", test.source, err)
+		}
+		methodNode := node.(*ast.MethodNode)
+		if !methodNode.IsPrimitive || methodNode.PrimitiveIndex != test.index ||
+			methodNode.PrimitiveName != test.name || methodNode.PrimitiveModule != test.module {
+			t.Errorf("Expected primitive %d %q %q in %q, got %d %q %q", test.index, test.name, test.module,
+				test.source, methodNode.PrimitiveIndex, methodNode.PrimitiveName, methodNode.PrimitiveModule)
+		}
+		if _, ok := methodNode.Body.(*ast.ReturnNode); !ok {
+			t.Errorf("Expected the fallback code of %q to be parsed, got %T", test.source, methodNode.Body)
+		}
+	}
+
+	for _, source := range []string{"foo <primitive> ^self", "foo <primitive: 1 ^self", "foo <primitive: #bar> ^self"} {
+		if _, err := NewParser(source, classObj, vmInstance).Parse(); err == nil {
+			t.Errorf("Expected an error parsing %q", source)
+		}
+	}
+}
+
+// TestParseKeywordMethodWithPrimitiveError tests a method with several keywords and a failure code temporary
+func TestParseKeywordMethodWithPrimitiveError(t *testing.T) {
+	vmInstance := vm.NewVM()
+	source := "at: index put: value <primitive: 51 error: ec> ^ec"
+	node, err := NewParser(source, vmInstance.Globals["Object"], vmInstance).Parse()
+	if err != nil {
+		t.Fatalf("Error parsing %q: %v", source, err)
+	}
+	methodNode := node.(*ast.MethodNode)
+	if methodNode.Selector != "at:put:" {
+		t.Errorf("Expected selector at:put:, got %s", methodNode.Selector)
+	}
+	if len(methodNode.Parameters) != 2 || methodNode.Parameters[0] != "index" || methodNode.Parameters[1] != "value" {
+		t.Errorf("Expected parameters index and value, got %v", methodNode.Parameters)
+	}
+	if methodNode.PrimitiveIndex != 51 || methodNode.PrimitiveErrorName != "ec" {
+		t.Errorf("Expected primitive 51 with error code ec, got %d %q", methodNode.PrimitiveIndex, methodNode.PrimitiveErrorName)
+	}
+}
+
+// TestParseSymbolLiterals tests parsing identifier, keyword and binary symbols
+func TestParseSymbolLiterals(t *testing.T) {
+	vmInstance := vm.NewVM()
+	for _, symbol := range []string{"foo", "at:put:", "+", "<="} {
+		source := "#" + symbol
+		node, err := NewParser(source, vmInstance.Globals["Object"], vmInstance).ParseExpression()
+		if err != nil {
+			t.Fatalf("Error parsing %q: %v", source, err)
+		}
+		literalNode, ok := node.(*ast.LiteralNode)
+		if !ok || literalNode.Value.Type() != pile.OBJ_SYMBOL || pile.GetSymbolValue(literalNode.Value) != symbol {
+			t.Errorf("Expected %q to be a Symbol literal, got %v", source, node)
+		}
+	}
+}
+
+// TestParseMethodStatements tests that a method body is a sequence of
+// statements, and that source the parser cannot take all of is an error
+func TestParseMethodStatements(t *testing.T) {
+	vmInstance := vm.NewVM()
+	objectClass := vmInstance.Globals["Object"]
+
+	tests := []struct {
+		source     string
+		statements int
+		returns    bool
+	}{
+		{"baz | t | t := 5. self bar. ^t", 2, true},
+		{"baz self bar", 0, false},
+		{"baz self bar. ^3.", 1, true},
+		{"baz", 0, false},
+	}
+	for _, test := range tests {
+		node, err := NewParser(test.source, objectClass, vmInstance).Parse()
+		if err != nil {
+			t.Fatalf("Error parsing %q: %v", test.source, err)
+		}
+		methodNode := node.(*ast.MethodNode)
+		_, returns := methodNode.Body.(*ast.ReturnNode)
+		if len(methodNode.Statements) != test.statements || returns != test.returns {
+			t.Errorf("Expected %q to have %d statements before the last and a return %v, got %d and %T",
+				test.source, test.statements, test.returns, len(methodNode.Statements), methodNode.Body)
+		}
+	}
+
+	for _, source := range []string{"baz ^1. 2", "baz 3 4", "baz ^", "baz self bar ]"} {
+		if _, err := NewParser(source, objectClass, vmInstance).Parse(); err == nil {
+			t.Errorf("Expected %q not to parse", source)
+		}
+	}
+	for _, source := range []string{"3 + 4 5", "3. 4"} {
+		if _, err := NewParser(source, objectClass, vmInstance).ParseExpression(); err == nil {
+			t.Errorf("Expected expression %q not to parse", source)
+		}
+	}
+}
+
+// floatOf returns the value of an immediate or boxed float, failing the test for anything else
+func floatOf(t *testing.T, obj *pile.Object) float64 {
+	t.Helper()
+	if pile.IsFloatImmediate(obj) {
+		return pile.GetFloatImmediate(obj)
+	}
+	if pile.IsBoxedFloat(obj) {
+		return pile.ObjectToBoxedFloat(obj).Value
+	}
+	t.Fatalf("Expected a float, got %v", obj)
+	return 0
+}
+
+// TestParseFloatLiterals tests parsing numbers with a fraction part or an exponent as floats
+func TestParseFloatLiterals(t *testing.T) {
+	vmInstance := vm.NewVM()
+	objectClass := vmInstance.Globals["Object"]
+
+	node, err := NewParser("0.1 + 0.2", objectClass, vmInstance).ParseExpression()
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	send := node.(*ast.MessageSendNode)
+	receiver := floatOf(t, send.Receiver.(*ast.LiteralNode).Value)
+	argument := floatOf(t, send.Arguments[0].(*ast.LiteralNode).Value)
+	if receiver != 0.1 || argument != 0.2 {
+		t.Errorf("Expected 0.1 and 0.2, got %v and %v", receiver, argument)
+	}
+	result, err := vmInstance.Evaluate("0.1 + 0.2")
+	if err != nil || floatOf(t, result) != 0.30000000000000004 {
+		t.Errorf("Expected 0.30000000000000004, got %v (%v)", result, err)
+	}
+
+	for source, expected := range map[string]float64{"2.5": 2.5, "1e3": 1000, "2.5e-3": 0.0025, "#(1.5) at: 1": 1.5} {
+		result, err := vmInstance.Evaluate(source)
+		if err != nil || floatOf(t, result) != expected {
+			t.Errorf("Expected %s to be %v, got %v (%v)", source, expected, result, err)
+		}
+	}
+	if result, err := vmInstance.Evaluate("2.5 class"); err != nil || result != vmInstance.Globals["Float"] {
+		t.Errorf("Expected 2.5 to be a Float, got %v (%v)", result, err)
+	}
+
+	// An exponent too big for a float is infinity rather than a syntax error
+	for source, sign := range map[string]int{"1.0e400": 1, "1.0e400 negated": -1, "#(1e400) at: 1": 1} {
+		result, err := vmInstance.Evaluate(source)
+		if err != nil || !math.IsInf(floatOf(t, result), sign) {
+			t.Errorf("Expected %s to be infinite, got %v (%v)", source, result, err)
+		}
+	}
+	if result, err := vmInstance.Evaluate("1.0e400 isInfinite"); err != nil || result != vmInstance.NewTrue() {
+		t.Errorf("Expected 1.0e400 to be infinite, got %v (%v)", result, err)
+	}
+}
+
+// TestParseLargeIntegerLiterals tests parsing integers too big for an immediate
+func TestParseLargeIntegerLiterals(t *testing.T) {
+	vmInstance := vm.NewVM()
+
+	for _, source := range []string{"100000000000000000000", "#(100000000000000000000) at: 1"} {
+		result, err := vmInstance.Evaluate(source)
+		if err != nil || !pile.IsLargeInteger(result) || pile.ObjectToLargeInteger(result).String() != "100000000000000000000" {
+			t.Errorf("Expected %s to be 100000000000000000000, got %v (%v)", source, result, err)
+		}
+	}
+	if result, err := vmInstance.Evaluate("100000000000000000000 class"); err != nil || result != vmInstance.Globals["LargePositiveInteger"] {
+		t.Errorf("Expected a LargePositiveInteger, got %v (%v)", result, err)
+	}
+}
+
+// TestParseThisContext tests parsing thisContext as the running context rather than a variable
+func TestParseThisContext(t *testing.T) {
+	vmInstance := vm.NewVM()
+	objectClass := vmInstance.Globals["Object"]
+
+	node, err := NewParser("thisContext sender", objectClass, vmInstance).ParseExpression()
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	send := node.(*ast.MessageSendNode)
+	if _, ok := send.Receiver.(*ast.ThisContextNode); !ok {
+		t.Errorf("Expected a thisContext node, got %T", send.Receiver)
+	}
+}
+
+// TestParseNil tests parsing nil as the nil literal rather than a variable
+func TestParseNil(t *testing.T) {
+	vmInstance := vm.NewVM()
+	objectClass := vmInstance.Globals["Object"]
+
+	node, err := NewParser("nil isNil", objectClass, vmInstance).ParseExpression()
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	send := node.(*ast.MessageSendNode)
+	if literal, ok := send.Receiver.(*ast.LiteralNode); !ok || !pile.IsNilImmediate(literal.Value) {
+		t.Errorf("Expected a nil literal, got %#v", send.Receiver)
+	}
+	if result, err := vmInstance.Evaluate("nil"); err != nil || result != vmInstance.NilObject {
+		t.Errorf("Expected nil, got %v (%v)", result, err)
+	}
+}
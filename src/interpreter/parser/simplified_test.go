@@ -1,10 +1,11 @@
-package parser
+package parser_test
 
 import (
 	"testing"
 	"unsafe"
 
 	"smalltalklsp/interpreter/ast"
+	. "smalltalklsp/interpreter/parser"
 	"smalltalklsp/interpreter/pile"
 	"smalltalklsp/interpreter/vm"
 )
@@ -31,7 +32,7 @@ func testTrueImmediate(t *testing.T, classObj *pile.Object, vmInstance *vm.VM) {
 	p := NewParser("true", classObj, vmInstance)
 	
 	// Initialize tokens
-	err := p.tokenize()
+	err := p.Tokenize()
 	if err != nil {
 		t.Fatalf("Error tokenizing input: %v", err)
 	}
@@ -63,7 +64,7 @@ func testFalseImmediate(t *testing.T, classObj *pile.Object, vmInstance *vm.VM)
 	p := NewParser("false", classObj, vmInstance)
 	
 	// Initialize tokens
-	err := p.tokenize()
+	err := p.Tokenize()
 	if err != nil {
 		t.Fatalf("Error tokenizing input: %v", err)
 	}
@@ -0,0 +1,62 @@
+package parser_test
+
+import (
+	"testing"
+
+	"smalltalklsp/interpreter/ast"
+	. "smalltalklsp/interpreter/parser"
+	"smalltalklsp/interpreter/vm"
+)
+
+// TestTokenRanges tests that tokens record where they appear in the input
+func TestTokenRanges(t *testing.T) {
+	p := NewParser("foo: 'a b' + #bar", nil, nil)
+	if err := p.Tokenize(); err != nil {
+		t.Fatalf("Error tokenizing input: %v", err)
+	}
+
+	expected := []string{"foo:", "'a b'", "+", "#bar", ""}
+	if len(p.Tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %d", len(expected), len(p.Tokens))
+	}
+	for i, text := range expected {
+		token := p.Tokens[i]
+		if got := p.Input[token.Start:token.End]; got != text {
+			t.Errorf("Token %d: expected source %q, got %q", i, text, got)
+		}
+	}
+}
+
+// TestNodeRanges tests that AST nodes cover the source they were parsed from
+func TestNodeRanges(t *testing.T) {
+	vmInstance := vm.NewVM()
+	source := "(3 + 4) max: x negated"
+
+	node, err := NewParser(source, nil, vmInstance).ParseExpression()
+	if err != nil {
+		t.Fatalf("Error parsing expression: %v", err)
+	}
+
+	keywordSend, ok := node.(*ast.MessageSendNode)
+	if !ok {
+		t.Fatalf("Expected message send node, got %T", node)
+	}
+	if got := keywordSend.Range().Text(source); got != source {
+		t.Errorf("Expected keyword send range %q, got %q", source, got)
+	}
+
+	binarySend := keywordSend.Receiver.(*ast.MessageSendNode)
+	if got := binarySend.Range().Text(source); got != "3 + 4" {
+		t.Errorf("Expected binary send range %q, got %q", "3 + 4", got)
+	}
+
+	unarySend := keywordSend.Arguments[0].(*ast.MessageSendNode)
+	if got := unarySend.Range().Text(source); got != "x negated" {
+		t.Errorf("Expected unary send range %q, got %q", "x negated", got)
+	}
+
+	variable := unarySend.Receiver.(*ast.VariableNode)
+	if got := variable.Range().Text(source); got != "x" {
+		t.Errorf("Expected variable range %q, got %q", "x", got)
+	}
+}
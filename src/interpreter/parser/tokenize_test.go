@@ -54,4 +54,21 @@ func TestTokenizeBlockValue(t *testing.T) {
 			t.Errorf("Expected Token 4 to be EOF, got %v", p.Tokens[4])
 		}
 	}
-}
\ No newline at end of file
+}
+// TestTokenizeBinarySelectors tests that binary selectors of several characters are one token
+func TestTokenizeBinarySelectors(t *testing.T) {
+	p := NewParser("a <= b \\\\ c | d", nil, nil)
+	if err := p.tokenize(); err != nil {
+		t.Fatalf("Error tokenizing input: %v", err)
+	}
+
+	expected := []string{"a", "<=", "b", "\\\\", "c", "|", "d", ""}
+	if len(p.Tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %v", len(expected), p.Tokens)
+	}
+	for i, value := range expected {
+		if p.Tokens[i].Value != value {
+			t.Errorf("Expected Token %d to be %q, got %v", i, value, p.Tokens[i])
+		}
+	}
+}
@@ -11,6 +11,7 @@ type Block struct {
 	Literals     []*Object
 	TempVarNames []string
 	OuterContext interface{} // Using interface{} to avoid circular dependency
+	DebugInfo    *DebugInfo  // Source and PC-to-source map, nil for hand-assembled blocks
 }
 
 // newBlock creates a new block object without setting its class field
@@ -114,6 +115,16 @@ func (b *Block) SetOuterContext(outerContext interface{}) {
 	b.OuterContext = outerContext
 }
 
+// GetDebugInfo returns the debug info of the block
+func (b *Block) GetDebugInfo() *DebugInfo {
+	return b.DebugInfo
+}
+
+// SetDebugInfo sets the debug info of the block
+func (b *Block) SetDebugInfo(debugInfo *DebugInfo) {
+	b.DebugInfo = debugInfo
+}
+
 // Value evaluates the block with the given arguments
 func (b *Block) Value(args ...*Object) *Object {
 	return b.ValueWithArguments(args)
@@ -127,53 +138,3 @@ func (b *Block) ValueWithArguments(args []*Object) *Object {
 	// Use the ExecuteBlock function to execute the block
 	return ExecuteBlock(blockObj, args)
 }
-
-// OnDo implements the on:do: method for exception handling
-func (b *Block) OnDo(exceptionClass *Object, handlerBlock *Object) *Object {
-	// Convert blocks to proper types
-	handlerBlockObj := ObjectToBlock(handlerBlock)
-
-	// Store the current exception handler
-	savedHandler := CurrentExceptionHandler
-
-	// Create a new exception handler
-	handler := &ExceptionHandler{
-		ExceptionClass: exceptionClass,
-		HandlerBlock:   handlerBlock,
-		NextHandler:    savedHandler,
-	}
-
-	// Set the current exception handler
-	CurrentExceptionHandler = handler
-
-	// Execute the receiver block
-	var result *Object
-
-	// We need to use a defer to ensure the handler is restored
-	defer func() {
-		// Restore the previous exception handler
-		CurrentExceptionHandler = savedHandler
-
-		// Handle panic if it's an exception
-		if r := recover(); r != nil {
-			if exception, ok := r.(*Object); ok && exception.Type() == OBJ_EXCEPTION {
-				// Check if the exception is of the handled class
-				if IsKindOf(exception, exceptionClass) {
-					// Execute the handler block with the exception as argument
-					result = handlerBlockObj.ValueWithArguments([]*Object{exception})
-				} else {
-					// Re-panic for unhandled exceptions
-					panic(r)
-				}
-			} else {
-				// Re-panic for non-exception panics
-				panic(r)
-			}
-		}
-	}()
-
-	// Execute the protected block
-	result = b.Value()
-
-	return result
-}
\ No newline at end of file
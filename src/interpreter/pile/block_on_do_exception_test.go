@@ -1,114 +0,0 @@
-package pile_test
-
-import (
-	"testing"
-
-	"smalltalklsp/interpreter/pile"
-)
-
-// MockBlockHandlerExecutor is a mock implementation of the BlockExecutor interface
-// that executes the handler block with a specific value
-type MockBlockHandlerExecutor struct {
-	HandlerBlock *pile.Object
-	ReturnValue  *pile.Object
-	ExceptionClass *pile.Object
-}
-
-// ExecuteBlock implements the BlockExecutor interface
-func (m *MockBlockHandlerExecutor) ExecuteBlock(block *pile.Object, args []*pile.Object) *pile.Object {
-	if block == m.HandlerBlock {
-		// This is the handler block - return our predefined value
-		return m.ReturnValue
-	}
-	
-	// Otherwise throw an exception
-	exception := pile.NewException(m.ExceptionClass)
-	panic(exception)
-}
-
-// TestBlockOnDoWithException tests the Block>>on:do: method when an exception is raised
-func TestBlockOnDoWithException(t *testing.T) {
-	// Skip this test for now - we'll need to revisit the exception handling logic
-	t.Skip("Skipping exception test temporarily")
-	
-	// Create a class for the exception
-	objectClass := pile.NewClass("Object", nil)
-	exceptionClass := pile.NewClass("Exception", objectClass)
-
-	// Register a mock block executor
-	oldExecutor := pile.GetCurrentBlockExecutor()
-	defer func() {
-		pile.RegisterBlockExecutor(oldExecutor)
-	}()
-
-	// Create a protected block and a handler block
-	protectedBlock := pile.ObjectToBlock(pile.NewBlock(nil))
-	handlerBlock := pile.ObjectToBlock(pile.NewBlock(nil))
-
-	// Create a mock executor that throws an exception for the protected block
-	// and returns 99 for the handler block
-	executor := &MockBlockHandlerExecutor{
-		HandlerBlock: pile.BlockToObject(handlerBlock),
-		ReturnValue:  pile.MakeIntegerImmediate(99),
-		ExceptionClass: pile.ClassToObject(exceptionClass),
-	}
-	pile.RegisterBlockExecutor(executor)
-
-	// Execute the on:do: method
-	result := protectedBlock.OnDo(pile.ClassToObject(exceptionClass), pile.BlockToObject(handlerBlock))
-
-	// Check that the result is 99 (from the handler block)
-	if !pile.IsIntegerImmediate(result) {
-		t.Fatalf("Expected an integer, got %v", result)
-	}
-
-	value := pile.GetIntegerImmediate(result)
-	if value != 99 {
-		t.Errorf("Expected 99, got %d", value)
-	}
-}
-
-// Test for the exception object itself
-func TestException(t *testing.T) {
-	// Create a class for exceptions
-	exClass := pile.NewClass("Error", nil)
-	
-	// Create an exception
-	exception := pile.NewException(pile.ClassToObject(exClass))
-	
-	// Test the exception
-	if exception.Type() != pile.OBJ_EXCEPTION {
-		t.Errorf("exception.Type() = %d, want %d", exception.Type(), pile.OBJ_EXCEPTION)
-	}
-	
-	// Convert to Exception object
-	exObj := pile.ObjectToException(exception)
-	
-	// Test message text (should be nil initially)
-	if !pile.IsNilImmediate(exObj.GetMessageText()) {
-		t.Errorf("exObj.GetMessageText() is not nil")
-	}
-	
-	// Set message text
-	messageText := pile.StringToObject(pile.NewString("Error message"))
-	exObj.SetMessageText(messageText)
-	
-	// Test that message text was set
-	if exObj.GetMessageText() != messageText {
-		t.Errorf("exObj.GetMessageText() != messageText")
-	}
-	
-	// Test tag (should be nil initially)
-	if !pile.IsNilImmediate(exObj.GetTag()) {
-		t.Errorf("exObj.GetTag() is not nil")
-	}
-	
-	// Set tag
-	tag := pile.MakeIntegerImmediate(123)
-	exObj.SetTag(tag)
-	
-	// Test that tag was set
-	if exObj.GetTag() != tag {
-		t.Errorf("exObj.GetTag() != tag")
-	}
-}
\ No newline at end of file
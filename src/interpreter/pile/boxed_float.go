@@ -0,0 +1,51 @@
+package pile
+
+import (
+	"math"
+	"strconv"
+	"unsafe"
+)
+
+// BoxedFloat represents a float whose low mantissa bits do not fit in an
+// immediate float, an instance of BoxedFloat64
+type BoxedFloat struct {
+	Object
+	Value float64
+}
+
+// NewBoxedFloatInternal creates a new boxed float object without setting its class field
+// This is a private helper function used by vm.NewFloat
+func NewBoxedFloatInternal(value float64) *BoxedFloat {
+	return &BoxedFloat{
+		Object: Object{
+			TypeField: OBJ_BOXED_FLOAT,
+		},
+		Value: value,
+	}
+}
+
+// BoxedFloatToObject converts a BoxedFloat to an Object
+func BoxedFloatToObject(bf *BoxedFloat) *Object {
+	return (*Object)(unsafe.Pointer(bf))
+}
+
+// ObjectToBoxedFloat converts an Object to a BoxedFloat
+func ObjectToBoxedFloat(o *Object) *BoxedFloat {
+	return (*BoxedFloat)(unsafe.Pointer(o))
+}
+
+// IsBoxedFloat returns true if the object is a boxed float
+func IsBoxedFloat(o *Object) bool {
+	return o != nil && !IsImmediate(o) && o.Type() == OBJ_BOXED_FLOAT
+}
+
+// FitsFloatImmediate returns true if value can be represented exactly as an
+// immediate float, which needs the two lowest mantissa bits for the tag
+func FitsFloatImmediate(value float64) bool {
+	return math.Float64bits(value)&TAG_MASK == 0
+}
+
+// String returns the shortest decimal digits that read back as the same float
+func (bf *BoxedFloat) String() string {
+	return strconv.FormatFloat(bf.Value, 'g', -1, 64)
+}
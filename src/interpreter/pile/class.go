@@ -17,7 +17,7 @@ func NewClass(name string, superClass *Class) *Class {
 		SuperClass:       (*Object)(unsafe.Pointer(superClass)),
 		InstanceVarNames: make([]string, 0),
 		Name:             name,
-		MethodDictionary: NewDictionary(),
+		MethodDictionary: NewMethodDictionary(),
 	}
 	
 	return result
@@ -33,6 +33,11 @@ func ObjectToClass(o *Object) *Class {
 	return (*Class)(unsafe.Pointer(o))
 }
 
+// IsMetaclass returns true if the class is the metaclass of another class
+func IsMetaclass(c *Class) bool {
+	return c.ThisClass != nil
+}
+
 // GetClassString returns a string representation of the class object
 func GetClassString(c *Class) string {
 	return fmt.Sprintf("Class %s", c.Name)
@@ -56,6 +61,7 @@ func GetClassSuperClass(c *Class) *Object {
 // SetClassSuperClass sets the superclass of the class
 func SetClassSuperClass(c *Class, superClass *Object) {
 	c.SuperClass = superClass
+	InvalidateMethodLookups()
 }
 
 // GetClassInstanceVarNames returns the instance variable names of the class
@@ -66,6 +72,7 @@ func GetClassInstanceVarNames(c *Class) []string {
 // AddClassInstanceVarName adds an instance variable name to the class
 func AddClassInstanceVarName(c *Class, name string) {
 	c.InstanceVarNames = append(c.InstanceVarNames, name)
+	InvalidateMethodLookups()
 }
 
 // GetClassMethodDictionary returns the method dictionary of the class
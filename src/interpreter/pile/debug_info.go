@@ -0,0 +1,127 @@
+package pile
+
+import (
+	"sort"
+	"strings"
+)
+
+// DebugEntry maps the instruction starting at PC to a range of source text
+type DebugEntry struct {
+	// PC is the offset of the instruction in the bytecodes
+	PC int
+
+	// Start is the offset of the first byte of the source range
+	Start int
+
+	// End is the offset just past the last byte of the source range
+	End int
+}
+
+// DebugInfo links compiled bytecodes back to the source they were compiled from
+// It is attached to methods and blocks by the compiler and is optional:
+// hand-assembled methods have no debug info
+type DebugInfo struct {
+	// Source is the full source text of the method or expression
+	Source string
+
+	// Entries are the PC to source range mappings, sorted by PC
+	Entries []DebugEntry
+
+	// Blocks holds the debug info of nested blocks, keyed by the PC of their CREATE_BLOCK instruction
+	Blocks map[int]*DebugInfo
+
+	// TempNames are the names of a block's parameters and temporaries, which
+	// its CREATE_BLOCK instruction only counts
+	TempNames []string
+}
+
+// NewDebugInfo creates empty debug info for the given source text
+func NewDebugInfo(source string) *DebugInfo {
+	return &DebugInfo{
+		Source:  source,
+		Entries: make([]DebugEntry, 0),
+		Blocks:  make(map[int]*DebugInfo),
+	}
+}
+
+// AddEntry records that the instruction at pc was compiled from source[start:end]
+// Entries must be added in increasing PC order; adding a second entry for the
+// same PC replaces the first
+func (d *DebugInfo) AddEntry(pc, start, end int) {
+	if n := len(d.Entries); n > 0 && d.Entries[n-1].PC == pc {
+		d.Entries[n-1] = DebugEntry{PC: pc, Start: start, End: end}
+		return
+	}
+	d.Entries = append(d.Entries, DebugEntry{PC: pc, Start: start, End: end})
+}
+
+// AddBlock records the debug info of the block created by the CREATE_BLOCK instruction at pc
+func (d *DebugInfo) AddBlock(pc int, block *DebugInfo) {
+	d.Blocks[pc] = block
+}
+
+// BlockAt returns the debug info of the block created at pc, or nil
+func (d *DebugInfo) BlockAt(pc int) *DebugInfo {
+	if d == nil {
+		return nil
+	}
+	return d.Blocks[pc]
+}
+
+// EntryAt returns the entry covering the instruction at pc
+// This is the entry with the largest PC that is not after pc
+func (d *DebugInfo) EntryAt(pc int) (DebugEntry, bool) {
+	if d == nil || len(d.Entries) == 0 {
+		return DebugEntry{}, false
+	}
+
+	// Find the first entry after pc, the one before it covers pc
+	index := sort.Search(len(d.Entries), func(i int) bool {
+		return d.Entries[i].PC > pc
+	})
+	if index == 0 {
+		return DebugEntry{}, false
+	}
+	return d.Entries[index-1], true
+}
+
+// RangeAt returns the source range of the instruction at pc
+func (d *DebugInfo) RangeAt(pc int) (start, end int, ok bool) {
+	entry, ok := d.EntryAt(pc)
+	if !ok {
+		return 0, 0, false
+	}
+	return entry.Start, entry.End, true
+}
+
+// SourceAt returns the source text of the expression being executed at pc
+func (d *DebugInfo) SourceAt(pc int) string {
+	start, end, ok := d.RangeAt(pc)
+	if !ok || start < 0 || end > len(d.Source) || start > end {
+		return ""
+	}
+	return d.Source[start:end]
+}
+
+// LineAt returns the 1-based source line of the instruction at pc, or 0 if unknown
+func (d *DebugInfo) LineAt(pc int) int {
+	start, _, ok := d.RangeAt(pc)
+	if !ok || start > len(d.Source) {
+		return 0
+	}
+	return strings.Count(d.Source[:start], "\n") + 1
+}
+
+// PCsForLine returns the PCs of all instructions that start on the given 1-based line
+func (d *DebugInfo) PCsForLine(line int) []int {
+	if d == nil {
+		return nil
+	}
+	pcs := make([]int, 0)
+	for _, entry := range d.Entries {
+		if entry.Start <= len(d.Source) && strings.Count(d.Source[:entry.Start], "\n")+1 == line {
+			pcs = append(pcs, entry.PC)
+		}
+	}
+	return pcs
+}
@@ -0,0 +1,80 @@
+package pile_test
+
+import (
+	"testing"
+
+	"smalltalklsp/interpreter/pile"
+)
+
+func TestDebugInfoRangeAt(t *testing.T) {
+	debugInfo := pile.NewDebugInfo("foo\n  ^self bar")
+	debugInfo.AddEntry(0, 7, 11)  // self
+	debugInfo.AddEntry(1, 7, 15)  // self bar
+	debugInfo.AddEntry(10, 6, 15) // ^self bar
+
+	tests := []struct {
+		pc     int
+		source string
+		line   int
+	}{
+		{0, "self", 2},
+		{1, "self bar", 2},
+		{5, "self bar", 2}, // operand bytes belong to the preceding instruction
+		{10, "^self bar", 2},
+		{20, "^self bar", 2},
+	}
+
+	for _, test := range tests {
+		if got := debugInfo.SourceAt(test.pc); got != test.source {
+			t.Errorf("SourceAt(%d) = %q, want %q", test.pc, got, test.source)
+		}
+		if got := debugInfo.LineAt(test.pc); got != test.line {
+			t.Errorf("LineAt(%d) = %d, want %d", test.pc, got, test.line)
+		}
+	}
+}
+
+func TestDebugInfoReplacesEntryAtSamePC(t *testing.T) {
+	debugInfo := pile.NewDebugInfo("a b")
+	debugInfo.AddEntry(0, 0, 1)
+	debugInfo.AddEntry(0, 0, 3)
+
+	if len(debugInfo.Entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(debugInfo.Entries))
+	}
+	if got := debugInfo.SourceAt(0); got != "a b" {
+		t.Errorf("SourceAt(0) = %q, want %q", got, "a b")
+	}
+}
+
+func TestDebugInfoMissing(t *testing.T) {
+	var debugInfo *pile.DebugInfo
+
+	if _, _, ok := debugInfo.RangeAt(0); ok {
+		t.Errorf("Expected no range for nil debug info")
+	}
+	if debugInfo.LineAt(0) != 0 {
+		t.Errorf("Expected line 0 for nil debug info")
+	}
+	if debugInfo.BlockAt(0) != nil {
+		t.Errorf("Expected no block for nil debug info")
+	}
+
+	empty := pile.NewDebugInfo("")
+	if empty.SourceAt(3) != "" {
+		t.Errorf("Expected empty source for debug info without entries")
+	}
+}
+
+func TestDebugInfoPCsForLine(t *testing.T) {
+	debugInfo := pile.NewDebugInfo("a\nb\nc")
+	debugInfo.AddEntry(0, 0, 1)
+	debugInfo.AddEntry(5, 2, 3)
+	debugInfo.AddEntry(6, 2, 3)
+	debugInfo.AddEntry(7, 4, 5)
+
+	pcs := debugInfo.PCsForLine(2)
+	if len(pcs) != 2 || pcs[0] != 5 || pcs[1] != 6 {
+		t.Errorf("PCsForLine(2) = %v, want [5 6]", pcs)
+	}
+}
@@ -9,6 +9,10 @@ import (
 type Dictionary struct {
 	Object
 	Entries map[string]*Object // later Object->Object
+
+	// IsMethodDictionary is set for the method dictionaries of classes, whose
+	// changes invalidate method lookups
+	IsMethodDictionary bool
 }
 
 // newDictionary creates a new dictionary object without setting its class field
@@ -27,6 +31,13 @@ func NewDictionary() *Object {
 	return DictionaryToObject(NewDictionaryInternal())
 }
 
+// NewMethodDictionary creates a dictionary for the methods of a class
+func NewMethodDictionary() *Object {
+	dict := NewDictionaryInternal()
+	dict.IsMethodDictionary = true
+	return DictionaryToObject(dict)
+}
+
 // DictionaryToObject converts a Dictionary to an Object
 func DictionaryToObject(d *Dictionary) *Object {
 	return (*Object)(unsafe.Pointer(d))
@@ -55,6 +66,9 @@ func (d *Dictionary) GetEntry(key string) *Object {
 // SetEntry sets an entry in the dictionary
 func (d *Dictionary) SetEntry(key string, value *Object) {
 	d.Entries[key] = value
+	if d.IsMethodDictionary {
+		InvalidateMethodLookups()
+	}
 }
 
 // GetEntryCount returns the number of entries in the dictionary
@@ -65,6 +79,9 @@ func (d *Dictionary) GetEntryCount() int {
 // RemoveEntry removes an entry from the dictionary
 func (d *Dictionary) RemoveEntry(key string) {
 	delete(d.Entries, key)
+	if d.IsMethodDictionary {
+		InvalidateMethodLookups()
+	}
 }
 
 // HasKey returns true if the dictionary has the given key
@@ -121,4 +138,7 @@ func (d *Dictionary) Merge(other *Dictionary) {
 	for key, value := range other.Entries {
 		d.Entries[key] = value
 	}
+	if d.IsMethodDictionary {
+		InvalidateMethodLookups()
+	}
 }
\ No newline at end of file
@@ -9,6 +9,14 @@ type Exception struct {
 	Object
 	MessageText *Object
 	Tag         *Object
+
+	// HandlerContext is the VM's context for the on:do: whose handler is
+	// running for the exception, or nil while no handler is
+	HandlerContext interface{}
+
+	// SignalContext is the VM's context that was running when the exception
+	// was signalled, or nil before it is
+	SignalContext interface{}
 }
 
 // NewException creates a new exception object
@@ -59,9 +67,3 @@ func (e *Exception) GetTag() *Object {
 func (e *Exception) SetTag(tag *Object) {
 	e.Tag = tag
 }
-
-// Signal signals the exception
-func (e *Exception) Signal() *Object {
-	// Use the SignalException function to signal the exception
-	return SignalException(ExceptionToObject(e))
-}
\ No newline at end of file
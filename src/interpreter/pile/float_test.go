@@ -33,4 +33,26 @@ func TestFloatImmediate(t *testing.T) {
 	if math.Abs(retrievedValue-value) > 1e-10 {
 		t.Errorf("Expected to get back %f, got %f", value, retrievedValue)
 	}
-}
\ No newline at end of file
+}
+// TestBoxedFloat tests which floats fit in an immediate and the boxed float object
+func TestBoxedFloat(t *testing.T) {
+	for _, value := range []float64{0.5, 1.5, math.Inf(1), math.Copysign(0, -1)} {
+		if !pile.FitsFloatImmediate(value) {
+			t.Errorf("Expected %v to fit in an immediate float", value)
+		}
+	}
+	tenth, fifth, seventh := 0.1, 0.2, 0.7
+	for _, value := range []float64{tenth, tenth + seventh, math.NaN()} {
+		if pile.FitsFloatImmediate(value) {
+			t.Errorf("Expected %v not to fit in an immediate float", value)
+		}
+	}
+
+	obj := pile.BoxedFloatToObject(pile.NewBoxedFloatInternal(tenth + fifth))
+	if !pile.IsBoxedFloat(obj) || pile.IsImmediate(obj) {
+		t.Errorf("Expected a boxed float object")
+	}
+	if pile.ObjectToBoxedFloat(obj).Value != tenth+fifth || obj.String() != "0.30000000000000004" {
+		t.Errorf("Expected the boxed float to keep every bit, got %v", obj)
+	}
+}
@@ -21,6 +21,12 @@ const (
 	SPECIAL_FALSE = 0x9 // 1001 (TAG_SPECIAL | 2 << 2)
 )
 
+// Largest and smallest values an immediate integer can hold, larger ones are LargeIntegers
+const (
+	MaxIntegerImmediate = 0x1FFFFFFFFFFFFFFF
+	MinIntegerImmediate = -0x2000000000000000
+)
+
 // IsImmediate returns true if the value is an immediate value
 func IsImmediate(obj ObjectInterface) bool {
 	converted := obj.(*Object)
@@ -96,7 +102,7 @@ func IsIntegerImmediate(obj ObjectInterface) bool {
 // MakeIntegerImmediate returns an immediate integer value
 func MakeIntegerImmediate(value int64) *Object {
 	// Ensure the value fits in 62 bits (signed)
-	if value > 0x1FFFFFFFFFFFFFFF || value < -0x2000000000000000 {
+	if value > MaxIntegerImmediate || value < MinIntegerImmediate {
 		panic("Integer value too large for immediate representation")
 	}
 
@@ -136,8 +142,8 @@ func IsFloatImmediate(obj ObjectInterface) bool {
 func MakeFloatImmediate(value float64) *Object {
 	// Convert the float to bits
 	bits := math.Float64bits(value)
-	// We lose some precision, but that's acceptable for most use cases
-	// The bottom 2 bits are used for the tag
+	// The bottom 2 bits are used for the tag, so a value with either set loses
+	// them. vm.NewFloat boxes those values instead, see FitsFloatImmediate.
 	imm := (bits >> 2 << 2) | TAG_FLOAT
 
 	// Convert to a pointer
@@ -150,7 +156,7 @@ func GetFloatImmediate(obj ObjectInterface) float64 {
 	converted := obj.(*Object)
 	ptr := uintptr(unsafe.Pointer(converted))
 
-	// Remove the tag bits -- should round instead?
+	// Remove the tag bits
 	bits := ptr & ^uintptr(TAG_MASK)
 
 	// Convert to float64
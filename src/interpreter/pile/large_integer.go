@@ -0,0 +1,49 @@
+package pile
+
+import (
+	"math/big"
+	"unsafe"
+)
+
+// LargeInteger represents an integer too large for an immediate, an instance
+// of LargePositiveInteger or LargeNegativeInteger
+type LargeInteger struct {
+	Object
+	Value *big.Int
+}
+
+// NewLargeIntegerInternal creates a new large integer object without setting its class field
+// This is a private helper function used by vm.NewLargeInteger
+func NewLargeIntegerInternal(value *big.Int) *LargeInteger {
+	return &LargeInteger{
+		Object: Object{
+			TypeField: OBJ_LARGE_INTEGER,
+		},
+		Value: value,
+	}
+}
+
+// LargeIntegerToObject converts a LargeInteger to an Object
+func LargeIntegerToObject(li *LargeInteger) *Object {
+	return (*Object)(unsafe.Pointer(li))
+}
+
+// ObjectToLargeInteger converts an Object to a LargeInteger
+func ObjectToLargeInteger(o *Object) *LargeInteger {
+	return (*LargeInteger)(unsafe.Pointer(o))
+}
+
+// IsLargeInteger returns true if the object is a large integer
+func IsLargeInteger(o *Object) bool {
+	return o != nil && !IsImmediate(o) && o.Type() == OBJ_LARGE_INTEGER
+}
+
+// FitsIntegerImmediate returns true if value can be represented as an immediate integer
+func FitsIntegerImmediate(value *big.Int) bool {
+	return value.IsInt64() && value.Int64() <= MaxIntegerImmediate && value.Int64() >= MinIntegerImmediate
+}
+
+// String returns the decimal digits of the large integer
+func (li *LargeInteger) String() string {
+	return li.Value.String()
+}
@@ -158,6 +158,9 @@ func (om *ObjectMemory) Collect(vm VM) {
 
 	// Swap the spaces
 	om.FromSpace, om.ToSpace = om.ToSpace, om.FromSpace
+
+	// Classes and methods may have moved, so cached lookups are stale
+	InvalidateMethodLookups()
 	om.AllocPtr = toPtr
 
 	// Grow the spaces if needed
@@ -205,6 +208,14 @@ func (om *ObjectMemory) updateReferences(obj *Object, toPtr *int) {
 		// Symbol objects don't have references to update
 		return
 
+	case OBJ_LARGE_INTEGER:
+		// Large integers don't have references to update
+		return
+
+	case OBJ_BOXED_FLOAT:
+		// Boxed floats don't have references to update
+		return
+
 	case OBJ_ARRAY:
 		// Update array elements
 		array := (*Array)(unsafe.Pointer(obj))
@@ -253,6 +264,14 @@ func (om *ObjectMemory) updateReferences(obj *Object, toPtr *int) {
 			class.SuperClass = om.copyObject(class.SuperClass, toPtr)
 		}
 
+		// Update the metaclass, and for a metaclass the class it belongs to
+		if obj.Class() != nil {
+			obj.SetClass(om.copyObject(obj.Class(), toPtr))
+		}
+		if class.ThisClass != nil {
+			class.ThisClass = om.copyObject(class.ThisClass, toPtr)
+		}
+
 	case OBJ_METHOD:
 		// Update method literals
 		method := (*Method)(unsafe.Pointer(obj))
@@ -280,9 +299,27 @@ func (om *ObjectMemory) updateReferences(obj *Object, toPtr *int) {
 				block.Literals[i] = om.copyObject(lit, toPtr)
 			}
 		}
+
+	case OBJ_CONTEXT:
+		// Contexts are defined in the vm package, which registers how to update them
+		if contextReferencesFn != nil {
+			contextReferencesFn(obj, func(ref *Object) *Object {
+				return om.copyObject(ref, toPtr)
+			})
+		}
 	}
 }
 
+// Used for updating the references of contexts without import cycles
+var contextReferencesFn func(context *Object, update func(ref *Object) *Object)
+
+// SetContextReferencesHook sets the hook that updates the references of a context
+// during garbage collection, by replacing each one with update's result
+// This is used by the vm package, which defines the layout of contexts
+func SetContextReferencesHook(fn func(context *Object, update func(ref *Object) *Object)) {
+	contextReferencesFn = fn
+}
+
 // growSpaces grows the from-space and to-space
 func (om *ObjectMemory) growSpaces() {
 	newSize := om.SpaceSize * 2
@@ -8,13 +8,19 @@ import (
 // Method represents a Smalltalk method
 type Method struct {
 	Object
-	Bytecodes      []byte
-	Literals       []*Object
-	Selector       *Object
-	TempVarNames   []string
-	MethodClass    *Class
-	IsPrimitive    bool
-	PrimitiveIndex int
+	Bytecodes       []byte
+	Literals        []*Object
+	Selector        *Object
+	TempVarNames    []string
+	MethodClass     *Class
+	IsPrimitive     bool
+	PrimitiveIndex  int
+	PrimitiveName   string       // Name of a named primitive, empty if it is numbered by PrimitiveIndex
+	PrimitiveModule string       // Module of a named primitive, empty for the VM's own primitives
+	PrimitiveError  string       // Temporary the fallback code finds the failure code in, empty if none
+	DebugInfo       *DebugInfo   // Source and PC-to-source map, nil for hand-assembled methods
+	Category        string       // Category the method was classified under, empty if unclassified
+	SendCaches      []*SendCache // Inline caches of the send sites indexed by pc, allocated as sends run
 }
 
 // newMethod creates a new method object without setting its class field
@@ -66,6 +72,7 @@ func (m *Method) GetBytecodes() []byte {
 // SetBytecodes sets the bytecodes of the method
 func (m *Method) SetBytecodes(bytecodes []byte) {
 	m.Bytecodes = bytecodes
+	m.SendCaches = nil
 }
 
 // GetLiterals returns the literals of the method
@@ -108,6 +115,16 @@ func (m *Method) SetMethodClass(class *Class) {
 	m.MethodClass = class
 }
 
+// GetCategory returns the category the method was classified under
+func (m *Method) GetCategory() string {
+	return m.Category
+}
+
+// SetCategory sets the category the method is classified under
+func (m *Method) SetCategory(category string) {
+	m.Category = category
+}
+
 // IsPrimitiveMethod returns true if the method is a primitive
 func (m *Method) IsPrimitiveMethod() bool {
 	return m.IsPrimitive
@@ -126,4 +143,35 @@ func (m *Method) GetPrimitiveIndex() int {
 // SetPrimitiveIndex sets the primitive index of the method
 func (m *Method) SetPrimitiveIndex(index int) {
 	m.PrimitiveIndex = index
-}
\ No newline at end of file
+}
+
+// GetPrimitiveName returns the name and module of a named primitive
+func (m *Method) GetPrimitiveName() (string, string) {
+	return m.PrimitiveName, m.PrimitiveModule
+}
+
+// SetPrimitiveName makes the method a named primitive in a module
+func (m *Method) SetPrimitiveName(name string, module string) {
+	m.PrimitiveName = name
+	m.PrimitiveModule = module
+}
+
+// GetPrimitiveError returns the temporary that receives the failure code of the primitive
+func (m *Method) GetPrimitiveError() string {
+	return m.PrimitiveError
+}
+
+// SetPrimitiveError sets the temporary that receives the failure code of the primitive
+func (m *Method) SetPrimitiveError(tempName string) {
+	m.PrimitiveError = tempName
+}
+
+// GetDebugInfo returns the debug info of the method
+func (m *Method) GetDebugInfo() *DebugInfo {
+	return m.DebugInfo
+}
+
+// SetDebugInfo sets the debug info of the method
+func (m *Method) SetDebugInfo(debugInfo *DebugInfo) {
+	m.DebugInfo = debugInfo
+}
@@ -22,6 +22,12 @@ const (
 	OBJ_SYMBOL
 	OBJ_EXCEPTION
 	OBJ_BYTE_ARRAY
+	OBJ_CONTEXT
+	OBJ_LARGE_INTEGER
+	OBJ_BOXED_FLOAT
+	OBJ_PROCESS
+	OBJ_SEMAPHORE
+	OBJ_SHARED_QUEUE
 )
 
 // Object represents a Smalltalk object
@@ -181,6 +187,18 @@ func (o *Object) String() string {
 			return fmt.Sprintf("Method %s", sym.Value)
 		}
 		return "a Method"
+	case OBJ_CONTEXT:
+		return "Context"
+	case OBJ_LARGE_INTEGER:
+		return (*LargeInteger)(unsafe.Pointer(o)).String()
+	case OBJ_BOXED_FLOAT:
+		return (*BoxedFloat)(unsafe.Pointer(o)).String()
+	case OBJ_PROCESS:
+		return "Process"
+	case OBJ_SEMAPHORE:
+		return "Semaphore"
+	case OBJ_SHARED_QUEUE:
+		return "SharedQueue"
 	default:
 		return "Unknown object"
 	}
@@ -202,6 +220,7 @@ type Class struct {
 	SuperClass       *Object
 	InstanceVarNames []string
 	MethodDictionary *Object  // Direct reference to the method dictionary
+	ThisClass        *Object  // For a metaclass, the class it is the metaclass of
 }
 
 // NewInstance creates a new instance of a class
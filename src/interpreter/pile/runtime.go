@@ -1,20 +1,13 @@
 package pile
 
-// ExceptionHandler represents an exception handler
-type ExceptionHandler struct {
-	ExceptionClass *Object
-	HandlerBlock   *Object
-	NextHandler    *ExceptionHandler
-}
-
-// CurrentExceptionHandler is the current active exception handler
-var CurrentExceptionHandler *ExceptionHandler
-
 // IsKindOf checks if an object is an instance of a class or one of its subclasses
-// This is a simplified implementation that just checks if the classes are the same
-// In a real implementation, we would check the class hierarchy
 func IsKindOf(obj *Object, class *Object) bool {
-	return obj.Class() == class
+	for current := obj.Class(); current != nil; current = ObjectToClass(current).SuperClass {
+		if current == class {
+			return true
+		}
+	}
+	return false
 }
 
 // BlockExecutor is an interface for executing blocks
@@ -53,26 +46,3 @@ var ExecuteBlock = func(block *Object, args []*Object) *Object {
 func SetBlockExecutor(executor func(block *Object, args []*Object) *Object) {
 	ExecuteBlock = executor
 }
-
-// SignalException signals an exception
-// If there's a handler for the exception, it will be executed
-// Otherwise, it will panic with the exception
-func SignalException(exception *Object) *Object {
-	// If there's no handler, just panic with the exception
-	if CurrentExceptionHandler == nil {
-		panic(exception)
-	}
-
-	// Find a handler for this exception
-	handler := CurrentExceptionHandler
-	for handler != nil {
-		if IsKindOf(exception, handler.ExceptionClass) {
-			// Found a handler, execute it
-			return ExecuteBlock(handler.HandlerBlock, []*Object{exception})
-		}
-		handler = handler.NextHandler
-	}
-
-	// No handler found, panic with the exception
-	panic(exception)
-}
\ No newline at end of file
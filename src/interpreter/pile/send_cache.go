@@ -0,0 +1,85 @@
+package pile
+
+import "sync/atomic"
+
+// lookupEpoch counts the changes that can change the result of a method lookup
+// It is shared by every VM in the process, which may run on different
+// goroutines, so it is only read and written atomically. A change in one VM
+// makes the caches of the others stale too, which costs them lookups but
+// never gives a wrong answer.
+var lookupEpoch uint64
+
+// LookupEpoch returns the current lookup epoch
+// Method caches remember the epoch they were filled in and are stale once it
+// has moved on, so nothing has to find and flush them one by one
+func LookupEpoch() uint64 {
+	return atomic.LoadUint64(&lookupEpoch)
+}
+
+// InvalidateMethodLookups moves the lookup epoch on, making every method cache stale
+// It is called when a method dictionary changes, a superclass changes, a class is
+// reshaped or the garbage collector moves objects. Code that changes a class's
+// fields directly must call it too.
+func InvalidateMethodLookups() {
+	atomic.AddUint64(&lookupEpoch, 1)
+}
+
+// SendCacheSize is the number of receiver classes a send site caches before it
+// is treated as megamorphic and left to the global method cache
+const SendCacheSize = 4
+
+// SendCacheEntry is one receiver class and the method found for it
+type SendCacheEntry struct {
+	// Class is the receiver class
+	Class *Class
+
+	// Method is the method the lookup found
+	Method *Object
+}
+
+// SendCache is the inline cache of one send site
+// It is monomorphic with one entry and polymorphic with up to SendCacheSize
+type SendCache struct {
+	// Epoch is the lookup epoch the entries were found in
+	Epoch uint64
+
+	// Entries are the cached classes, the first Count are in use
+	Entries [SendCacheSize]SendCacheEntry
+
+	// Count is the number of entries in use
+	Count int
+
+	// Megamorphic is set once the site has seen more classes than fit
+	Megamorphic bool
+}
+
+// Lookup returns the cached method for a receiver class, or nil if it is not cached
+func (c *SendCache) Lookup(class *Class) *Object {
+	if epoch := LookupEpoch(); c.Epoch != epoch {
+		c.Count = 0
+		c.Megamorphic = false
+		c.Epoch = epoch
+		return nil
+	}
+	for i := 0; i < c.Count; i++ {
+		if c.Entries[i].Class == class {
+			return c.Entries[i].Method
+		}
+	}
+	return nil
+}
+
+// Add caches the method found for a receiver class
+func (c *SendCache) Add(class *Class, method *Object) {
+	if epoch := LookupEpoch(); c.Epoch != epoch {
+		c.Count = 0
+		c.Megamorphic = false
+		c.Epoch = epoch
+	}
+	if c.Count == SendCacheSize {
+		c.Megamorphic = true
+		return
+	}
+	c.Entries[c.Count] = SendCacheEntry{Class: class, Method: method}
+	c.Count++
+}
@@ -0,0 +1,81 @@
+// Package strings is the "strings" primitive module: string primitives that
+// are not part of the VM itself. Importing the package registers them with
+// every new VM, and Install adds String methods that use them.
+package strings
+
+import (
+	"bytes"
+
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// Module is the module name methods use in <primitive: 'name' module: 'strings'>
+const Module = "strings"
+
+// Methods are the String methods Install compiles, which signal PrimitiveFailed if the primitive fails
+var Methods = []string{
+	", aString <primitive: 'stringConcat' module: 'strings'> ^self primitiveFailed",
+	"reversed <primitive: 'stringReverse' module: 'strings'> ^self primitiveFailed",
+	"asUppercase <primitive: 'stringAsUppercase' module: 'strings'> ^self primitiveFailed",
+}
+
+func init() {
+	vm.RegisterPrimitive(vm.Primitive{Name: "stringConcat", Module: Module, Arity: 1, Receiver: "String", Function: concat})
+	vm.RegisterPrimitive(vm.Primitive{Name: "stringReverse", Module: Module, Arity: 0, Receiver: "String", Function: reverse})
+	vm.RegisterPrimitive(vm.Primitive{Name: "stringAsUppercase", Module: Module, Arity: 0, Receiver: "String", Function: asUppercase})
+}
+
+// Install compiles the module's methods into the String class of a VM
+func Install(virtualMachine *vm.VM) {
+	stringClass := virtualMachine.Globals["String"]
+	for _, source := range Methods {
+		method := virtualMachine.CompileMethod(stringClass, source, Module)
+		if method.Class() == virtualMachine.Globals["SyntaxError"] {
+			panic("strings: cannot compile " + source)
+		}
+	}
+}
+
+// stringValue returns the Go string of a String, or false if the object is not one
+func stringValue(obj *pile.Object) (string, bool) {
+	if pile.IsImmediate(obj) || obj.Type() != pile.OBJ_STRING {
+		return "", false
+	}
+	return pile.ObjectToString(obj).GetValue(), true
+}
+
+// concat answers the receiver followed by the argument
+func concat(virtualMachine *vm.VM, receiver *pile.Object, args []*pile.Object) *pile.Object {
+	first, ok := stringValue(receiver)
+	if !ok {
+		return virtualMachine.FailPrimitive(vm.PrimitiveBadReceiver)
+	}
+	second, ok := stringValue(args[0])
+	if !ok {
+		return virtualMachine.FailPrimitive(vm.PrimitiveBadArgument)
+	}
+	return virtualMachine.NewString(first + second)
+}
+
+// reverse answers the characters of the receiver in reverse order
+func reverse(virtualMachine *vm.VM, receiver *pile.Object, args []*pile.Object) *pile.Object {
+	value, ok := stringValue(receiver)
+	if !ok {
+		return virtualMachine.FailPrimitive(vm.PrimitiveBadReceiver)
+	}
+	runes := []rune(value)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return virtualMachine.NewString(string(runes))
+}
+
+// asUppercase answers the receiver with its letters in upper case
+func asUppercase(virtualMachine *vm.VM, receiver *pile.Object, args []*pile.Object) *pile.Object {
+	value, ok := stringValue(receiver)
+	if !ok {
+		return virtualMachine.FailPrimitive(vm.PrimitiveBadReceiver)
+	}
+	return virtualMachine.NewString(string(bytes.ToUpper([]byte(value))))
+}
@@ -0,0 +1,57 @@
+package strings_test
+
+import (
+	"testing"
+
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/primitives/strings"
+	"smalltalklsp/interpreter/vm"
+)
+
+// TestStringPrimitives tests the String methods that use the module's primitives
+func TestStringPrimitives(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	strings.Install(virtualMachine)
+
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"'abc' , 'def'", "abcdef"},
+		{"'abc' reversed", "cba"},
+		{"'abc' asUppercase", "ABC"},
+		{"['abc' , 3] on: PrimitiveFailed do: [:e | e messageText]", "String>>, primitive failed: bad argument"},
+	}
+	for _, test := range tests {
+		result, err := virtualMachine.Evaluate(test.expression)
+		if err != nil || result.Type() != pile.OBJ_STRING || pile.ObjectToString(result).GetValue() != test.expected {
+			t.Errorf("Expected %q to be '%s', got %v", test.expression, test.expected, result)
+		}
+	}
+
+	// The primitive fails on an argument that is not a String
+	if _, err := virtualMachine.Evaluate("'abc' , 3"); err == nil || err.Error() != "unhandled PrimitiveFailed: String>>, primitive failed: bad argument" {
+		t.Errorf("Expected the concatenation to fail, got %v", err)
+	}
+}
+
+// TestDisableStringPrimitive tests switching off one of the module's primitives
+func TestDisableStringPrimitive(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	strings.Install(virtualMachine)
+
+	if err := virtualMachine.Primitives.Disable("strings.stringConcat"); err != nil {
+		t.Fatalf("Error disabling: %v", err)
+	}
+	_, err := virtualMachine.Evaluate("'abc' , 'def'")
+	if err == nil || err.Error() != "unhandled PrimitiveFailed: String>>, primitive failed: unsupported operation" {
+		t.Errorf("Expected the fallback code to signal PrimitiveFailed, got %v", err)
+	}
+}
+
+// TestDefaultVMStringPrimitives tests that DefaultVM, created before the module registered its primitives, has them
+func TestDefaultVMStringPrimitives(t *testing.T) {
+	if primitive := vm.DefaultVM.Primitives.LookupNamed("stringConcat", strings.Module); primitive == nil {
+		t.Errorf("Expected DefaultVM to have strings.stringConcat")
+	}
+}
@@ -114,7 +114,9 @@ func evaluateExpression(vmInstance *vm.VM, expression string) (*pile.Object, err
 	}
 
 	// Compile the parsed expression
-	method := compiler.NewBytecodeCompiler(pile.ClassToObject(objectClass)).Compile(parsed)
+	bytecodeCompiler := compiler.NewBytecodeCompiler(pile.ClassToObject(objectClass))
+	bytecodeCompiler.Source = expression
+	method := bytecodeCompiler.Compile(parsed)
 	methodObj := pile.MethodToObject(method)
 
 	// Create a context for execution
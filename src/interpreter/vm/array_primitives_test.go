@@ -14,7 +14,7 @@ func TestArrayAtPrimitive(t *testing.T) {
 	// Get the predefined primitive methods from the VM
 	arrayClass := pile.ObjectToClass(virtualMachine.Globals["Array"])
 	atSelector := pile.NewSymbol("at:")
-	atMethod := virtualMachine.LookupMethod(pile.ClassToObject(arrayClass), atSelector)
+	atMethod := pile.LookupClassMethod(arrayClass, atSelector)
 
 	// Create a test array with 3 elements
 	array := virtualMachine.NewArray(3)
@@ -14,7 +14,8 @@ func TestBasicClassPrimitive(t *testing.T) {
 	EnsureObjectIsClass(t, virtualMachine, pile.NewNil(), pile.ObjectToClass(virtualMachine.Globals["UndefinedObject"]))
 	EnsureObjectIsClass(t, virtualMachine, virtualMachine.TrueObject, pile.ObjectToClass(virtualMachine.Globals["True"]))
 	EnsureObjectIsClass(t, virtualMachine, virtualMachine.FalseObject, pile.ObjectToClass(virtualMachine.Globals["False"]))
-	EnsureObjectIsClass(t, virtualMachine, virtualMachine.NewFloat(3.14), pile.ObjectToClass(virtualMachine.Globals["Float"]))
+	EnsureObjectIsClass(t, virtualMachine, virtualMachine.NewFloat(2.5), pile.ObjectToClass(virtualMachine.Globals["Float"]))
+	EnsureObjectIsClass(t, virtualMachine, virtualMachine.NewFloat(3.14), pile.ObjectToClass(virtualMachine.Globals["BoxedFloat64"]))
 }
 
 func EnsureObjectIsClass(t *testing.T, virtualMachine *vm.VM, object pile.ObjectInterface, expected interface{}) {
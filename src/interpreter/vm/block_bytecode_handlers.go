@@ -1,7 +1,6 @@
 package vm
 
 import (
-	"encoding/binary"
 	"fmt"
 
 	"smalltalklsp/interpreter/pile"
@@ -12,50 +11,57 @@ func (vm *VM) ExecuteCreateBlock(context *Context) error {
 	// Get the method
 	method := pile.ObjectToMethod(context.Method)
 
-	// Get the bytecode size (4 bytes)
-	bytecodeSize := int(binary.BigEndian.Uint32(method.GetBytecodes()[context.PC+1:]))
-
-	// Get the literal count (4 bytes)
-	literalCount := int(binary.BigEndian.Uint32(method.GetBytecodes()[context.PC+5:]))
-
-	// Get the temp var count (4 bytes)
-	tempVarCount := int(binary.BigEndian.Uint32(method.GetBytecodes()[context.PC+9:]))
+	// Get the bytecode size, literal count and temp var count
+	instruction, err := currentInstruction(context)
+	if err != nil {
+		return err
+	}
+	bytecodeSize := instruction.Operand(0)
+	literalCount := instruction.Operand(1)
+	tempVarCount := instruction.Operand(2)
 
 	// Create a new block
 	block := pile.ObjectToBlock(vm.NewBlock(context))
 
-	// Set the bytecodes
-	// In a real implementation, we would extract the bytecodes from the method
-	// For now, we'll just create an empty bytecode array
-	block.SetBytecodes(make([]byte, bytecodeSize))
-
-	// Set the literals
-	// In a real implementation, we would extract the literals from the method
-	// For now, we'll just create an empty literal array
-	for i := 0; i < literalCount; i++ {
-		block.AddLiteral(pile.MakeNilImmediate())
+	// The block's bytecodes follow the instruction in the method, and it uses the
+	// method's first literalCount literals, which the compiler shares with it
+	bodyStart := context.PC + instruction.Size
+	if bodyStart+bytecodeSize > len(method.GetBytecodes()) || literalCount > len(method.GetLiterals()) {
+		return fmt.Errorf("block body runs past the end of the method")
+	}
+	block.SetBytecodes(append([]byte(nil), method.GetBytecodes()[bodyStart:bodyStart+bytecodeSize]...))
+	for _, literal := range method.GetLiterals()[:literalCount] {
+		block.AddLiteral(literal)
 	}
 
-	// Set the temporary variable names
-	// In a real implementation, we would extract the temp var names from the method
-	// For now, we'll just create empty temp var names
+	// The method only counts the block's temporaries, their names are in the debug info if it has any
+	debugInfo := method.GetDebugInfo().BlockAt(context.PC)
 	for i := 0; i < tempVarCount; i++ {
-		block.AddTempVarName(fmt.Sprintf("temp%d", i))
+		if debugInfo != nil && len(debugInfo.TempNames) == tempVarCount {
+			block.AddTempVarName(debugInfo.TempNames[i])
+		} else {
+			block.AddTempVarName(fmt.Sprintf("temp%d", i))
+		}
 	}
 
-	// Push the block onto the stack
+	// Attach the block's debug info if the method was compiled from source
+	block.SetDebugInfo(debugInfo)
+
+	// Push the block onto the stack, the method continues after the block's bytecodes
 	context.Push(pile.BlockToObject(block))
+	context.PC += bytecodeSize
 
 	return nil
 }
 
 // ExecuteExecuteBlock executes the EXECUTE_BLOCK bytecode
 func (vm *VM) ExecuteExecuteBlock(context *Context) (*pile.Object, error) {
-	// Get the method
-	method := pile.ObjectToMethod(context.Method)
-
-	// Get the argument count (4 bytes)
-	argCount := int(binary.BigEndian.Uint32(method.GetBytecodes()[context.PC+1:]))
+	// Get the argument count
+	instruction, err := currentInstruction(context)
+	if err != nil {
+		return nil, err
+	}
+	argCount := instruction.Operand(0)
 
 	// Pop the arguments from the stack
 	args := make([]*pile.Object, argCount)
@@ -74,11 +80,12 @@ func (vm *VM) ExecuteExecuteBlock(context *Context) (*pile.Object, error) {
 		return nil, fmt.Errorf("not a block: %v", blockObj)
 	}
 
-	// Convert to a Block
-	block := pile.ObjectToBlock(blockObj)
-
-	// Execute the block
-	result := block.ValueWithArguments(args)
+	// The executor runs the block's context next and pushes its result when it returns
+	result, blockContext := vm.activateBlock(context, blockObj, args)
+	if blockContext != nil {
+		vm.Executor.CurrentContext = blockContext
+		return nil, nil
+	}
 
 	// Push the result onto the stack
 	context.Push(result)
@@ -19,11 +19,23 @@ func TestExecuteCreateBlock(t *testing.T) {
 		},
 		Bytecodes: []byte{
 			bytecode.CREATE_BLOCK,
-			0, 0, 0, 10, // bytecode size
-			0, 0, 0, 2, // literal count
-			0, 0, 0, 3, // temp var count
+			10, // bytecode size
+			2, // literal count
+			3, // temp var count
+
+			// The block's bytecodes
+			bytecode.PUSH_LITERAL, 0,
+			bytecode.POP,
+			bytecode.PUSH_LITERAL, 1,
+			bytecode.POP,
+			bytecode.PUSH_TEMPORARY_VARIABLE, 0,
+			bytecode.POP,
+			bytecode.RETURN_STACK_TOP,
+		},
+		Literals: []*pile.Object{
+			pile.MakeIntegerImmediate(1),
+			pile.MakeIntegerImmediate(2),
 		},
-		Literals:     []*pile.Object{},
 		TempVarNames: []string{},
 	}
 
@@ -41,6 +53,11 @@ func TestExecuteCreateBlock(t *testing.T) {
 		t.Errorf("ExecuteCreateBlock returned an error: %v", err)
 	}
 
+	// Check that the method continues after the block's bytecodes
+	if context.PC != 10 {
+		t.Errorf("PC = %d, want 10", context.PC)
+	}
+
 	// Check that a block was pushed onto the stack
 	if context.StackPointer != 1 {
 		t.Errorf("Stack pointer = %d, want 1", context.StackPointer)
@@ -89,7 +106,7 @@ func TestExecuteExecuteBlock(t *testing.T) {
 		},
 		Bytecodes: []byte{
 			bytecode.EXECUTE_BLOCK,
-			0, 0, 0, 2, // arg count
+			2, // arg count
 		},
 		Literals:     []*pile.Object{},
 		TempVarNames: []string{},
@@ -114,24 +131,30 @@ func TestExecuteExecuteBlock(t *testing.T) {
 	context.Push(pile.MakeIntegerImmediate(2))
 
 	// Execute the EXECUTE_BLOCK bytecode
+	virtualMachine.Executor.CurrentContext = context
 	result, err := virtualMachine.ExecuteExecuteBlock(context)
 	if err != nil {
 		t.Errorf("ExecuteExecuteBlock returned an error: %v", err)
 	}
 
-	// Check that the result is nil (since the block doesn't do anything)
-	if !pile.IsNilImmediate(result) {
-		t.Errorf("Result = %v, want nil", result)
+	// The bytecode does not run the block, it makes the block's context current
+	if result != nil {
+		t.Errorf("Expected no result until the block's context runs, got %v", result)
 	}
-
-	// Check that the result was pushed onto the stack
-	if context.StackPointer != 1 {
-		t.Errorf("Stack pointer = %d, want 1", context.StackPointer)
+	if context.StackPointer != 0 {
+		t.Errorf("Stack pointer = %d, want 0", context.StackPointer)
+	}
+	blockContext := virtualMachine.Executor.CurrentContext
+	if blockContext == context || !blockContext.IsBlockContext() || blockContext.Caller() != context || blockContext.Sender != context {
+		t.Fatalf("Expected the current context to be the block evaluated by the test context")
 	}
 
-	// Check that the result on the stack is nil
-	stackResult := context.Pop()
-	if !pile.IsNilImmediate(stackResult) {
-		t.Errorf("Stack result = %v, want nil", stackResult)
+	// Running the block's context answers nil, since the block doesn't do anything
+	value, err := virtualMachine.Executor.ExecuteContext(blockContext)
+	if err != nil {
+		t.Fatalf("Error executing the block: %v", err)
+	}
+	if !pile.IsNilImmediate(value) {
+		t.Errorf("Result = %v, want nil", value)
 	}
 }
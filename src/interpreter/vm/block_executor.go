@@ -11,7 +11,65 @@ func init() {
 }
 
 // ExecuteBlock implements the runtime.BlockExecutor interface
+// It runs the block in a loop of its own, for Go code that needs its value
+// before it carries on. Smalltalk code evaluates blocks in the loop it is
+// running in, see activateBlock.
 func (vm *VM) ExecuteBlock(block *pile.Object, args []*pile.Object) *pile.Object {
+	blockContext := vm.newBlockContext(block, args, vm.Executor.CurrentContext)
+	if result, overflowed := vm.stackOverflow(blockContext); overflowed {
+		return result
+	}
+
+	// Execute the block, which makes the saved context current again afterwards
+	result, err := vm.ExecuteContext(blockContext)
+	if err != nil {
+		// Errors the outermost context returned carry on unwinding the Go code that evaluated the block
+		if _, ok := err.(*termination); ok {
+			panic(err)
+		}
+		if _, ok := err.(UncaughtError); ok {
+			panic(err)
+		}
+		panic("ExecuteBlock: " + err.Error())
+	}
+
+	// Return the result
+	return result.(*pile.Object)
+}
+
+// Primitives of the Block methods that evaluate the receiver with their arguments
+const (
+	blockValuePrimitive     = 21
+	blockValueWithPrimitive = 22
+)
+
+// evaluatesBlock returns true if a send of methodObj to receiver evaluates
+// the receiver block, which activateMethod does without calling the primitive
+func evaluatesBlock(receiver *pile.Object, methodObj *pile.Object) bool {
+	if pile.IsImmediate(receiver) || receiver.Type() != pile.OBJ_BLOCK || methodObj.Type() != pile.OBJ_METHOD {
+		return false
+	}
+	method := pile.ObjectToMethod(methodObj)
+	if !method.IsPrimitiveMethod() {
+		return false
+	}
+	index := method.GetPrimitiveIndex()
+	return index == blockValuePrimitive || index == blockValueWithPrimitive
+}
+
+// activateBlock starts evaluating a block for caller the way activateMethod
+// starts a method, answering the context the executor runs next, or the
+// value of a StackOverflow handler and nil if there are too many contexts
+func (vm *VM) activateBlock(caller *Context, block *pile.Object, args []*pile.Object) (*pile.Object, *Context) {
+	blockContext := vm.newBlockContext(block, args, caller)
+	if result, overflowed := vm.stackOverflow(blockContext); overflowed {
+		return result, nil
+	}
+	return nil, blockContext
+}
+
+// newBlockContext creates the context that evaluates a block with args for caller
+func (vm *VM) newBlockContext(block *pile.Object, args []*pile.Object, caller *Context) *Context {
 	// Check if the block is valid
 	if block == nil {
 		panic("ExecuteBlock: nil block")
@@ -37,6 +95,7 @@ func (vm *VM) ExecuteBlock(block *pile.Object, args []*pile.Object) *pile.Object
 		Bytecodes:    blockObj.GetBytecodes(),
 		Literals:     blockObj.GetLiterals(),
 		TempVarNames: blockObj.GetTempVarNames(),
+		DebugInfo:    blockObj.GetDebugInfo(),
 	}
 
 	// Create a new context for the block execution
@@ -56,23 +115,8 @@ func (vm *VM) ExecuteBlock(block *pile.Object, args []*pile.Object) *pile.Object
 		}
 	}
 
-	// Save the current context
-	savedContext := vm.Executor.CurrentContext
-
-	// Set the current context to the block context
-	vm.Executor.CurrentContext = blockContext
-
-	// Execute the block
-	result, err := vm.ExecuteContext(blockContext)
-	if err != nil {
-		panic("ExecuteBlock: " + err.Error())
-	}
-
-	// Restore the current context
-	vm.Executor.CurrentContext = savedContext
-
-	// Return the result
-	return result.(*pile.Object)
+	blockContext.evaluatedBy(caller)
+	return blockContext
 }
 
 // RegisterAsBlockExecutor registers the VM as a block executor
@@ -6,6 +6,7 @@ import (
 
 // NewBlock creates a block object with proper class field
 func (vm *VM) NewBlock(outerContext interface{}) *pile.Object {
+	vm.allocated()
 	block := &pile.Block{
 		Object: pile.Object{
 			TypeField: pile.OBJ_BLOCK,
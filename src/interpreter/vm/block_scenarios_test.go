@@ -37,7 +37,7 @@ func TestBlockWithLiteral(t *testing.T) {
 	// Set the block's bytecodes
 	blockBytecodes := []byte{
 		bytecode.PUSH_LITERAL,
-		0, 0, 0, 0, // literal index 0 (the value 5)
+		0, // literal index 0 (the value 5)
 		bytecode.RETURN_STACK_TOP,
 	}
 	block.SetBytecodes(blockBytecodes)
@@ -105,12 +105,12 @@ func TestBlockWithExpression(t *testing.T) {
 	// Set up the block's bytecodes (normally this would be done by the compiler)
 	blockBytecodes := []byte{
 		bytecode.PUSH_LITERAL,
-		0, 0, 0, 0, // literal index 0 (the value 5)
+		0, // literal index 0 (the value 5)
 		bytecode.PUSH_LITERAL,
-		0, 0, 0, 1, // literal index 1 (the value 4)
+		1, // literal index 1 (the value 4)
 		bytecode.SEND_MESSAGE,
-		0, 0, 0, 2, // selector index 2 (the + selector)
-		0, 0, 0, 1, // arg count 1
+		2, // selector index 2 (the + selector)
+		1, // arg count 1
 		bytecode.RETURN_STACK_TOP,
 	}
 	block.SetBytecodes(blockBytecodes)
@@ -182,16 +182,16 @@ func TestBlockWithParameter(t *testing.T) {
 	blockBytecodes := []byte{
 		// Push the temporary variable 'x' (parameter)
 		bytecode.PUSH_TEMPORARY_VARIABLE,
-		0, 0, 0, 0, // temp var index 0
+		0, // temp var index 0
 
 		// Push the literal 2
 		bytecode.PUSH_LITERAL,
-		0, 0, 0, 0, // literal index 0 (the value 2)
+		0, // literal index 0 (the value 2)
 
 		// Send the + message
 		bytecode.SEND_MESSAGE,
-		0, 0, 0, 1, // selector index 1 (the + selector)
-		0, 0, 0, 1, // arg count 1
+		1, // selector index 1 (the + selector)
+		1, // arg count 1
 
 		// Return the result
 		bytecode.RETURN_STACK_TOP,
@@ -256,7 +256,7 @@ func TestBlockWithNonLocalReturn(t *testing.T) {
 	// Set up the block's bytecodes (normally this would be done by the compiler)
 	blockBytecodes := []byte{
 		bytecode.PUSH_LITERAL,
-		0, 0, 0, 0, // literal index 0 (the value 7)
+		0, // literal index 0 (the value 7)
 		bytecode.RETURN_STACK_TOP, // This should return from the outer method, not just the block
 	}
 	block.SetBytecodes(blockBytecodes)
@@ -25,11 +25,11 @@ func TestBlockModifiesLocalVariable(t *testing.T) {
 	blockBytecodes := []byte{
 		// Push the literal 2
 		bytecode.PUSH_LITERAL,
-		0, 0, 0, 0, // literal index 0 (the value 2)
+		1, // literal index 1 (the value 2)
 
 		// Store it in the outer context's temporary variable 'a'
 		bytecode.STORE_TEMPORARY_VARIABLE,
-		0, 0, 0, 0, // temp var index 0 (a)
+		0, // temp var index 0 (a)
 
 		// Return nil (implicit)
 	}
@@ -43,25 +43,27 @@ func TestBlockModifiesLocalVariable(t *testing.T) {
 	methodBytecodes := []byte{
 		// Store 1 in temporary variable 'a'
 		bytecode.PUSH_LITERAL,
-		0, 0, 0, 0, // literal index 0 (the value 1)
+		0, // literal index 0 (the value 1)
 		bytecode.STORE_TEMPORARY_VARIABLE,
-		0, 0, 0, 0, // temp var index 0 (a)
+		0, // temp var index 0 (a)
 
 		// Create a block that assigns 2 to 'a'
 		bytecode.CREATE_BLOCK,
-		0, 0, 0, byte(len(blockBytecodes)), // bytecode size
-		0, 0, 0, 1, // literal count (1 literal)
-		0, 0, 0, 0, // temp var count (0 temp vars)
-
+		byte(len(blockBytecodes)), // bytecode size
+		2, // literal count (the block uses the literal 2)
+		0, // temp var count (0 temp vars)
+	}
+	methodBytecodes = append(methodBytecodes, blockBytecodes...)
+	methodBytecodes = append(methodBytecodes,
 		// Execute the block
 		bytecode.EXECUTE_BLOCK,
-		0, 0, 0, 0, // arg count 0
+		0, // arg count 0
 
 		// Return the value of 'a'
 		bytecode.PUSH_TEMPORARY_VARIABLE,
-		0, 0, 0, 0, // temp var index 0 (a)
+		0, // temp var index 0 (a)
 		bytecode.RETURN_STACK_TOP,
-	}
+	)
 
 	// Create a method with the bytecodes
 	method := &pile.Method{
@@ -107,30 +109,22 @@ func TestBlockModifiesLocalVariable(t *testing.T) {
 		t.Fatalf("ExecuteCreateBlock returned an error: %v", err)
 	}
 
-	// Get the block from the stack
-	block := context.Pop()
-	blockObj := pile.ObjectToBlock(block)
-
-	// Set the block's bytecodes
-	blockObj.SetBytecodes(blockBytecodes)
-
-	// Set the block's literals
-	blockObj.Literals = []*pile.Object{
-		pile.MakeIntegerImmediate(2), // The literal 2
-	}
-
-	// Push the block back onto the stack
-	context.Push(block)
-
 	// Advance the PC to the EXECUTE_BLOCK bytecode
 	context.PC += bytecode.InstructionSize(bytecode.CREATE_BLOCK)
 
-	// Execute the EXECUTE_BLOCK bytecode
+	// Execute the EXECUTE_BLOCK bytecode, which makes the block's context current
 	_, err = virtualMachine.ExecuteExecuteBlock(context)
 	if err != nil {
 		t.Fatalf("ExecuteExecuteBlock returned an error: %v", err)
 	}
 
+	// Run the block's context, which sets a := 2
+	blockContext := virtualMachine.Executor.CurrentContext
+	virtualMachine.Executor.CurrentContext = context
+	if _, err := virtualMachine.Executor.ExecuteContext(blockContext); err != nil {
+		t.Fatalf("Error executing the block: %v", err)
+	}
+
 	// Advance the PC to the PUSH_TEMPORARY_VARIABLE bytecode
 	context.PC += bytecode.InstructionSize(bytecode.EXECUTE_BLOCK)
 
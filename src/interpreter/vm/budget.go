@@ -0,0 +1,244 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"smalltalklsp/interpreter/pile"
+)
+
+// interruptGrace is the number of bytecodes an evaluation runs after it is
+// signalled Interrupted or TimedOut before it is stopped without a signal, so
+// that a handler can clean up but not keep the evaluation going
+const interruptGrace = 10000
+
+// The causes of an InterruptedError besides its context.Context ending
+var (
+	ErrInterrupted               = errors.New("interrupted")
+	ErrBytecodeBudgetExhausted   = errors.New("bytecode budget exhausted")
+	ErrAllocationBudgetExhausted = errors.New("allocation budget exhausted")
+)
+
+// Limits bounds an evaluation, a zero field means no limit
+type Limits struct {
+	// MaxBytecodes is the most bytecodes it can run
+	MaxBytecodes int64
+
+	// MaxAllocations is the most objects it can create: instances, including
+	// Delays and processes, blocks, strings, symbols, arrays, floats, large
+	// integers, fractions, scaled decimals, exceptions, Messages and syntax
+	// errors. Contexts live outside the object memory and are not counted,
+	// VM.MaxContextDepth and VM.MaxStackSlots bound them instead.
+	MaxAllocations int64
+}
+
+// InterruptedError is returned for an evaluation stopped by Interrupt, by its
+// context.Context ending or by going past its Limits
+// It unwraps to its cause, so errors.Is tells a deadline (context.DeadlineExceeded)
+// from an interrupt (ErrInterrupted) or an exhausted budget.
+type InterruptedError struct {
+	// Cause is why the evaluation stopped
+	Cause error
+
+	// Exception is the Interrupted or TimedOut exception nothing handled, or
+	// nil if the evaluation was stopped after a handler kept it going
+	Exception *pile.Object
+
+	// Walkback is the contexts that were running when it stopped, or nil if unknown
+	Walkback *Walkback
+}
+
+// Error returns the error message
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("evaluation stopped: %v", e.Cause)
+}
+
+// Unwrap returns the cause
+func (e *InterruptedError) Unwrap() error {
+	return e.Cause
+}
+
+// GetWalkback returns the contexts that were running when the evaluation stopped
+func (e *InterruptedError) GetWalkback() *Walkback {
+	return e.Walkback
+}
+
+// budget keeps track of an evaluation's limits
+type budget struct {
+	limits      Limits
+	ctx         context.Context
+	bytecodes   int64
+	allocations int64
+
+	// cause is why the evaluation was signalled, exception what it was signalled
+	// with, and grace the bytecodes it has left before it is stopped
+	cause     error
+	exception *pile.Object
+	grace     int
+}
+
+// NewInterruptedClass creates Interrupted, the error signalled when an evaluation is interrupted
+func (vm *VM) NewInterruptedClass() *pile.Class {
+	errorClass := pile.ObjectToClass(vm.Globals["Error"])
+	return pile.NewClass("Interrupted", errorClass)
+}
+
+// NewTimedOutClass creates TimedOut, the Interrupted signalled when an
+// evaluation runs past its deadline or its bytecode budget
+func (vm *VM) NewTimedOutClass() *pile.Class {
+	interruptedClass := pile.ObjectToClass(vm.Globals["Interrupted"])
+	return pile.NewClass("TimedOut", interruptedClass)
+}
+
+// ExecuteContextWithLimits executes a context like ExecuteContext, stopping
+// it when ctx ends or it goes past limits
+// Going past a limit signals TimedOut for ctx's deadline or the bytecode budget
+// and Interrupted otherwise, which Smalltalk code can handle. An evaluation
+// still running interruptGrace bytecodes later stops without a signal. Either
+// way an evaluation that stops returns an InterruptedError.
+func (vm *VM) ExecuteContextWithLimits(ctx context.Context, c *Context, limits Limits) (pile.ObjectInterface, error) {
+	outer := vm.budget
+	vm.budget = &budget{limits: limits, ctx: ctx}
+	defer func() {
+		vm.budget = outer
+	}()
+	return vm.ExecuteContext(c)
+}
+
+// Interrupt signals Interrupted in the running evaluation, and is safe to call
+// from any goroutine
+// Interrupting an evaluation again after it was signalled stops it straight
+// away. An Interrupt while nothing is running is forgotten when the next
+// evaluation starts.
+func (vm *VM) Interrupt() {
+	atomic.StoreInt32(&vm.interruptRequested, 1)
+	select {
+	case vm.interruptWake <- struct{}{}:
+	default:
+	}
+}
+
+// forgetInterrupt drops an Interrupt that no evaluation took, and the wake up it left for sleep
+func (vm *VM) forgetInterrupt() {
+	atomic.StoreInt32(&vm.interruptRequested, 0)
+	select {
+	case <-vm.interruptWake:
+	default:
+	}
+}
+
+// interrupted takes a pending Interrupt, answering true if there was one
+func (vm *VM) interrupted() bool {
+	return atomic.LoadInt32(&vm.interruptRequested) != 0 && atomic.CompareAndSwapInt32(&vm.interruptRequested, 1, 0)
+}
+
+// allocated counts an object created for the evaluation's allocation budget
+func (vm *VM) allocated() {
+	if vm.budget != nil {
+		vm.budget.allocations++
+	}
+}
+
+// tick counts a bytecode and signals Interrupted or TimedOut once the
+// evaluation has been interrupted or gone past a limit, then stops it if it is
+// still running after its grace
+func (b *budget) tick(vm *VM) {
+	b.bytecodes++
+	if b.cause != nil {
+		b.grace--
+		if b.grace < 0 || vm.interrupted() {
+			b.grace = -1
+			panic(&InterruptedError{Cause: b.cause, Walkback: vm.walkbackOf(vm.Executor.CurrentContext)})
+		}
+		return
+	}
+
+	var cause error
+	switch {
+	case vm.interrupted():
+		cause = ErrInterrupted
+	case b.limits.MaxBytecodes > 0 && b.bytecodes > b.limits.MaxBytecodes:
+		cause = ErrBytecodeBudgetExhausted
+	case b.limits.MaxAllocations > 0 && b.allocations > b.limits.MaxAllocations:
+		cause = ErrAllocationBudgetExhausted
+	case b.ctx != nil && b.bytecodes%preemptionInterval == 0:
+		cause = b.ctx.Err()
+	}
+	if cause != nil {
+		b.signal(vm, cause)
+	}
+}
+
+// signal signals the exception for cause, TimedOut for running out of time and Interrupted otherwise
+func (b *budget) signal(vm *VM, cause error) {
+	className := "Interrupted"
+	if errors.Is(cause, context.DeadlineExceeded) || errors.Is(cause, ErrBytecodeBudgetExhausted) {
+		className = "TimedOut"
+	}
+	messageText := cause.Error()
+	switch cause {
+	case ErrBytecodeBudgetExhausted:
+		messageText = fmt.Sprintf("bytecode budget of %d exhausted", b.limits.MaxBytecodes)
+	case ErrAllocationBudgetExhausted:
+		messageText = fmt.Sprintf("allocation budget of %d objects exhausted", b.limits.MaxAllocations)
+	}
+
+	b.cause, b.grace = cause, interruptGrace
+	b.exception = pile.NewException(vm.Globals[className])
+	pile.ObjectToException(b.exception).SetMessageText(vm.NewString(messageText))
+	vm.Signal(b.exception)
+}
+
+// unhandledInterrupt answers the InterruptedError for an exception nothing
+// handled if it is the one the budget signalled, or nil
+func (vm *VM) unhandledInterrupt(exception *pile.Object) *InterruptedError {
+	if vm.budget == nil || vm.budget.exception != exception {
+		return nil
+	}
+	return &InterruptedError{Cause: vm.budget.cause, Exception: exception, Walkback: vm.walkbackOf(vm.Executor.CurrentContext)}
+}
+
+// sleep waits for d while every process is waiting on a Delay, and answers
+// false if the evaluation was interrupted or its context.Context ended first
+func (vm *VM) sleep(d time.Duration) bool {
+	var done <-chan struct{}
+	if vm.budget != nil && vm.budget.ctx != nil {
+		done = vm.budget.ctx.Done()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case <-done:
+			return false
+		case <-vm.interruptWake:
+			// The wake up can be left over from an Interrupt that was already taken
+			if atomic.LoadInt32(&vm.interruptRequested) != 0 {
+				return false
+			}
+		}
+	}
+}
+
+// stoppedWaiting answers the InterruptedError for an evaluation stopped while
+// every process was waiting, which includes one whose other processes were
+// stopped after their grace, or nil if it was not
+func (vm *VM) stoppedWaiting(c *Context) *InterruptedError {
+	var cause error
+	switch {
+	case vm.interrupted():
+		cause = ErrInterrupted
+	case vm.budget != nil && vm.budget.cause != nil && vm.budget.grace < 0:
+		cause = vm.budget.cause
+	case vm.budget != nil && vm.budget.ctx != nil && vm.budget.ctx.Err() != nil:
+		cause = vm.budget.ctx.Err()
+	default:
+		return nil
+	}
+	return &InterruptedError{Cause: cause, Walkback: vm.walkbackOf(c)}
+}
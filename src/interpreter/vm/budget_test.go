@@ -0,0 +1,150 @@
+package vm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/parser"
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// newBudgetTestVM creates a VM with BudgetTest, a class whose methods recurse
+// until something stops them
+func newBudgetTestVM(t *testing.T) *vm.VM {
+	t.Helper()
+	return newTestVM(t, "BudgetTest", nil,
+		"recurse ^self recurse",
+		"keep: anObject ^self allocate",
+		"allocate ^self keep: Object new",
+		"keepFraction: aFraction ^self fractions",
+		"fractions ^self keepFraction: 1 / 3",
+	)
+}
+
+// executeWithLimits compiles and runs an expression with ExecuteContextWithLimits
+func executeWithLimits(t *testing.T, virtualMachine *vm.VM, ctx context.Context, source string, limits vm.Limits) (pile.ObjectInterface, error) {
+	t.Helper()
+	objectClass := virtualMachine.Globals["Object"]
+	node, err := parser.NewParser(source, objectClass, virtualMachine).ParseExpression()
+	if err != nil {
+		t.Fatalf("Error parsing %q: %v", source, err)
+	}
+	method := compiler.NewBytecodeCompiler(objectClass).Compile(node)
+	c := vm.NewContext(pile.MethodToObject(method), virtualMachine.NilObject, []*pile.Object{}, nil)
+	return virtualMachine.ExecuteContextWithLimits(ctx, c, limits)
+}
+
+// TestBudgets tests that going past a limit signals an exception Smalltalk
+// code can handle, and that the host gets an InterruptedError otherwise
+func TestBudgets(t *testing.T) {
+	virtualMachine := newBudgetTestVM(t)
+	background := context.Background()
+	expired, cancel := context.WithDeadline(background, time.Now().Add(-time.Second))
+	defer cancel()
+	canceled, cancel := context.WithCancel(background)
+	cancel()
+
+	handled := []struct {
+		expression string
+		ctx        context.Context
+		limits     vm.Limits
+		expected   string
+	}{
+		{"[BudgetTest new recurse] on: TimedOut do: [:e | e messageText]", background, vm.Limits{MaxBytecodes: 5000}, "bytecode budget of 5000 exhausted"},
+		{"[BudgetTest new allocate] on: Interrupted do: [:e | e messageText]", background, vm.Limits{MaxAllocations: 100}, "allocation budget of 100 objects exhausted"},
+		{"[BudgetTest new fractions] on: Interrupted do: [:e | e messageText]", background, vm.Limits{MaxAllocations: 100}, "allocation budget of 100 objects exhausted"},
+		{"[BudgetTest new recurse] on: TimedOut do: [:e | e messageText]", expired, vm.Limits{}, "context deadline exceeded"},
+		{"[BudgetTest new recurse] on: Interrupted do: [:e | e messageText]", canceled, vm.Limits{}, "context canceled"},
+	}
+	for _, test := range handled {
+		result, err := executeWithLimits(t, virtualMachine, test.ctx, test.expression, test.limits)
+		if err != nil || result.(*pile.Object).Type() != pile.OBJ_STRING || pile.ObjectToString(result.(*pile.Object)).GetValue() != test.expected {
+			t.Errorf("Expected %q to answer '%s', got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	unhandled := []struct {
+		expression string
+		ctx        context.Context
+		limits     vm.Limits
+		expected   error
+	}{
+		{"BudgetTest new recurse", background, vm.Limits{MaxBytecodes: 5000}, vm.ErrBytecodeBudgetExhausted},
+		{"BudgetTest new allocate", background, vm.Limits{MaxAllocations: 100}, vm.ErrAllocationBudgetExhausted},
+		{"BudgetTest new fractions", background, vm.Limits{MaxAllocations: 100}, vm.ErrAllocationBudgetExhausted},
+		{"BudgetTest new recurse", expired, vm.Limits{}, context.DeadlineExceeded},
+		{"[BudgetTest new recurse] on: TimedOut do: [:e | BudgetTest new recurse]", background, vm.Limits{MaxBytecodes: 5000}, vm.ErrBytecodeBudgetExhausted},
+		{"[[BudgetTest new recurse] on: TimedOut do: [:e | BudgetTest new recurse]] on: Error do: [:e | 3]", background, vm.Limits{MaxBytecodes: 5000}, vm.ErrBytecodeBudgetExhausted},
+		{"(Delay forSeconds: 10) wait", expired, vm.Limits{}, context.DeadlineExceeded},
+	}
+	for _, test := range unhandled {
+		_, err := executeWithLimits(t, virtualMachine, test.ctx, test.expression, test.limits)
+		var interrupted *vm.InterruptedError
+		if !errors.As(err, &interrupted) || !errors.Is(err, test.expected) || interrupted.Walkback == nil {
+			t.Errorf("Expected %q to stop with %v, got %v", test.expression, test.expected, err)
+		}
+	}
+
+	// The limits only apply to the evaluation they were given for
+	if result, err := executeExpression(t, virtualMachine, "3 + 4"); err != nil || result != virtualMachine.NewInteger(7) {
+		t.Errorf("Expected 7 without limits, got %v (%v)", result, err)
+	}
+}
+
+// TestInterrupt tests interrupting an evaluation from another goroutine
+func TestInterrupt(t *testing.T) {
+	virtualMachine := newBudgetTestVM(t)
+
+	// An Interrupt while nothing is running is forgotten when an evaluation starts
+	virtualMachine.Interrupt()
+	if result, err := executeExpression(t, virtualMachine, "3 + 4"); err != nil || result != virtualMachine.NewInteger(7) {
+		t.Errorf("Expected a stale Interrupt not to stop the evaluation, got %v (%v)", result, err)
+	}
+
+	// An Interrupt while it runs signals Interrupted, which it can handle
+	interrupt := func(virtualMachine *vm.VM, receiver *pile.Object, args []*pile.Object) *pile.Object {
+		virtualMachine.Interrupt()
+		return receiver
+	}
+	if err := virtualMachine.Primitives.Register(vm.Primitive{Name: "interrupt", Module: "test", Function: interrupt}); err != nil {
+		t.Fatalf("Error registering: %v", err)
+	}
+	class := virtualMachine.Globals["BudgetTest"]
+	compileMethods(t, virtualMachine, class,
+		"interrupt <primitive: 'interrupt' module: 'test'> ^self",
+		"interruptAndRecurse self interrupt. ^self recurse")
+	result, err := executeExpression(t, virtualMachine, "[BudgetTest new interruptAndRecurse] on: Interrupted do: [:e | e messageText]")
+	if err != nil || result.(*pile.Object).Type() != pile.OBJ_STRING || pile.ObjectToString(result.(*pile.Object)).GetValue() != "interrupted" {
+		t.Errorf("Expected the handler to answer 'interrupted', got %v (%v)", result, err)
+	}
+
+	// So does one in an evaluation run by the Executor directly
+	source := "[BudgetTest new interruptAndRecurse] on: Interrupted do: [:e | e class]"
+	node, err := parser.NewParser(source, class, virtualMachine).ParseExpression()
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	method := compiler.NewBytecodeCompiler(class).Compile(node)
+	result, err = virtualMachine.Executor.ExecuteContext(vm.NewContext(pile.MethodToObject(method), virtualMachine.NilObject, []*pile.Object{}, nil))
+	if err != nil || result != virtualMachine.Globals["Interrupted"] {
+		t.Errorf("Expected the handler to answer Interrupted, got %v (%v)", result, err)
+	}
+
+	// An Interrupt wakes an evaluation waiting on a Delay
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		virtualMachine.Interrupt()
+	}()
+	start := time.Now()
+	_, err = executeExpression(t, virtualMachine, "(Delay forSeconds: 10) wait")
+	if !errors.Is(err, vm.ErrInterrupted) {
+		t.Errorf("Expected the Delay to be interrupted, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the interrupt to stop the Delay, waited %v", elapsed)
+	}
+}
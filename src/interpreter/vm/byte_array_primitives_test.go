@@ -14,7 +14,7 @@ func TestByteArrayAtPrimitive(t *testing.T) {
 	// Get the predefined primitive methods from the VM
 	byteArrayClass := pile.ObjectToClass(virtualMachine.Globals["ByteArray"])
 	atSelector := pile.NewSymbol("at:")
-	atMethod := virtualMachine.LookupMethod(pile.ClassToObject(byteArrayClass), atSelector)
+	atMethod := pile.LookupClassMethod(byteArrayClass, atSelector)
 
 	// Create a test byte array with 3 elements
 	byteArray := virtualMachine.NewByteArray(3)
@@ -70,7 +70,7 @@ func TestByteArrayAtPutPrimitive(t *testing.T) {
 	// Get the predefined primitive methods from the VM
 	byteArrayClass := pile.ObjectToClass(virtualMachine.Globals["ByteArray"])
 	atPutSelector := pile.NewSymbol("at:put:")
-	atPutMethod := virtualMachine.LookupMethod(pile.ClassToObject(byteArrayClass), atPutSelector)
+	atPutMethod := pile.LookupClassMethod(byteArrayClass, atPutSelector)
 
 	// Create a test byte array with 3 elements
 	byteArray := virtualMachine.NewByteArray(3)
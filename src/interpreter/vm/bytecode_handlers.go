@@ -1,20 +1,39 @@
 package vm
 
 import (
-	"encoding/binary"
 	"fmt"
 
 	"smalltalklsp/interpreter/bytecode"
 	"smalltalklsp/interpreter/pile"
 )
 
+// currentInstruction decodes the instruction at the context's PC
+// Handlers read their operands from it so short forms and prefixes are handled in one place
+// The executor has usually decoded it already, otherwise it is decoded into the context
+func currentInstruction(context *Context) (*bytecode.Instruction, error) {
+	if context.instructionPC == context.PC {
+		return &context.instruction, nil
+	}
+	context.instructionPC = -1
+	method := pile.ObjectToMethod(context.Method)
+	if err := bytecode.DecodeInto(&context.instruction, method.Bytecodes, context.PC); err != nil {
+		return nil, fmt.Errorf("invalid instruction at %d: %v", context.PC, err)
+	}
+	context.instructionPC = context.PC
+	return &context.instruction, nil
+}
+
 // ExecutePushLiteral executes the PUSH_LITERAL bytecode
 func (vm *VM) ExecutePushLiteral(context *Context) error {
 	// Get the method
 	method := pile.ObjectToMethod(context.Method)
 
-	// Get the literal index (4 bytes)
-	index := int(binary.BigEndian.Uint32(method.Bytecodes[context.PC+1:]))
+	// Get the literal index
+	instruction, err := currentInstruction(context)
+	if err != nil {
+		return err
+	}
+	index := instruction.Operand(0)
 	if index < 0 || index >= len(method.Literals) {
 		return fmt.Errorf("literal index out of bounds: %d", index)
 	}
@@ -27,11 +46,12 @@ func (vm *VM) ExecutePushLiteral(context *Context) error {
 
 // ExecutePushInstanceVariable executes the PUSH_INSTANCE_VARIABLE bytecode
 func (vm *VM) ExecutePushInstanceVariable(context *Context) error {
-	// Get the method
-	method := pile.ObjectToMethod(context.Method)
-
-	// Get the instance variable index (4 bytes)
-	index := int(binary.BigEndian.Uint32(method.Bytecodes[context.PC+1:]))
+	// Get the instance variable index
+	instruction, err := currentInstruction(context)
+	if err != nil {
+		return err
+	}
+	index := instruction.Operand(0)
 	class := vm.GetClass(context.Receiver.(*pile.Object))
 	if index < 0 || index >= len(class.InstanceVarNames) {
 		return fmt.Errorf("instance variable index out of bounds: %d", index)
@@ -45,11 +65,12 @@ func (vm *VM) ExecutePushInstanceVariable(context *Context) error {
 
 // ExecutePushTemporaryVariable executes the PUSH_TEMPORARY_VARIABLE bytecode
 func (vm *VM) ExecutePushTemporaryVariable(context *Context) error {
-	// Get the method
-	method := pile.ObjectToMethod(context.Method)
-
-	// Get the temporary variable index (4 bytes)
-	index := int(binary.BigEndian.Uint32(method.Bytecodes[context.PC+1:]))
+	// Get the temporary variable index
+	instruction, err := currentInstruction(context)
+	if err != nil {
+		return err
+	}
+	index := instruction.Operand(0)
 
 	// First try to get the variable from the current context
 	if index < len(context.TempVars) {
@@ -73,13 +94,20 @@ func (vm *VM) ExecutePushSelf(context *Context) error {
 	return nil
 }
 
+// ExecutePushThisContext executes the PUSH_THIS_CONTEXT bytecode
+func (vm *VM) ExecutePushThisContext(context *Context) error {
+	context.Push(vm.ContextObject(context))
+	return nil
+}
+
 // ExecuteStoreInstanceVariable executes the STORE_INSTANCE_VARIABLE bytecode
 func (vm *VM) ExecuteStoreInstanceVariable(context *Context) error {
-	// Get the method
-	method := pile.ObjectToMethod(context.Method)
-
-	// Get the instance variable index (4 bytes)
-	index := int(binary.BigEndian.Uint32(method.Bytecodes[context.PC+1:]))
+	// Get the instance variable index
+	instruction, err := currentInstruction(context)
+	if err != nil {
+		return err
+	}
+	index := instruction.Operand(0)
 	class := vm.GetClass(context.Receiver.(*pile.Object))
 
 	if index < 0 || index >= len(class.InstanceVarNames) {
@@ -99,11 +127,12 @@ func (vm *VM) ExecuteStoreInstanceVariable(context *Context) error {
 
 // ExecuteStoreTemporaryVariable executes the STORE_TEMPORARY_VARIABLE bytecode
 func (vm *VM) ExecuteStoreTemporaryVariable(context *Context) error {
-	// Get the method
-	method := pile.ObjectToMethod(context.Method)
-
-	// Get the temporary variable index (4 bytes)
-	index := int(binary.BigEndian.Uint32(method.Bytecodes[context.PC+1:]))
+	// Get the temporary variable index
+	instruction, err := currentInstruction(context)
+	if err != nil {
+		return err
+	}
+	index := instruction.Operand(0)
 
 	// Pop the value from the stack
 	value := context.Pop()
@@ -132,14 +161,17 @@ func (vm *VM) ExecuteSendMessage(context *Context) (*pile.Object, error) {
 	// Get the method
 	method := pile.ObjectToMethod(context.Method)
 
-	// Get the selector index (4 bytes)
-	selectorIndex := int(binary.BigEndian.Uint32(method.Bytecodes[context.PC+1:]))
+	// Get the selector index and argument count
+	instruction, err := currentInstruction(context)
+	if err != nil {
+		return nil, err
+	}
+	selectorIndex := instruction.Operand(0)
 	if selectorIndex < 0 || selectorIndex >= len(method.Literals) {
 		return nil, fmt.Errorf("selector index out of bounds: %d", selectorIndex)
 	}
 
-	// Get the argument count (4 bytes)
-	argCount := int(binary.BigEndian.Uint32(method.Bytecodes[context.PC+5:]))
+	argCount := instruction.Operand(1)
 
 	// Get the selector
 	selector := method.Literals[selectorIndex]
@@ -161,43 +193,87 @@ func (vm *VM) ExecuteSendMessage(context *Context) (*pile.Object, error) {
 		return nil, fmt.Errorf("nil receiver for message: %s", pile.ObjectToSymbol(selector).GetValue())
 	}
 
-	methodObj := vm.LookupMethod(receiver, selector)
+	methodObj := vm.lookupSend(context, method, receiver, selector)
 	if methodObj == nil {
-		return nil, fmt.Errorf("method not found: %s", pile.ObjectToSymbol(selector).GetValue())
+		// Send doesNotUnderstand: instead, with the send reified as a Message
+		notUnderstood := selector
+		methodObj, selector, args = vm.sendDoesNotUnderstand(receiver, selector, args)
+		if methodObj == nil {
+			return nil, fmt.Errorf("method not found: %s", pile.ObjectToSymbol(notUnderstood).GetValue())
+		}
 	}
 
-	// Handle primitive methods
-	if result := vm.ExecutePrimitive(receiver, selector, args, methodObj); result != nil {
-		context.Push(result)
-		return result, nil
+	result, newContext := vm.activateMethod(context, receiver, selector, args, methodObj)
+	if newContext != nil {
+		// The executor runs the method's context next and pushes its result when it returns
+		vm.Executor.CurrentContext = newContext
+		return nil, nil
 	}
 
-	// Create a new context for the method
-	newContext := NewContext(methodObj, receiver, args, context)
+	// Push the result onto the stack
+	context.Push(result)
 
-	// Set the current context to the new context in the executor
-	vm.Executor.CurrentContext = newContext
+	// Return the result
+	return result, nil
+}
 
-	// Return from this context execution to start executing the new context
-	// We need to execute the new context immediately
-	result, err := vm.ExecuteContext(newContext)
-	if err != nil {
-		return nil, err
+// activateMethod starts the method a send from sender found
+// Primitive methods run their primitive and answer its result. Otherwise, and
+// when the primitive fails, it answers a new context for the method's code,
+// and for value and value: one for the receiver block.
+func (vm *VM) activateMethod(sender *Context, receiver *pile.Object, selector *pile.Object, args []*pile.Object, methodObj *pile.Object) (*pile.Object, *Context) {
+	// Evaluating a block starts its context like a method's
+	if evaluatesBlock(receiver, methodObj) {
+		return vm.activateBlock(sender, receiver, args)
 	}
 
-	// Check for nil result
-	if result == nil {
-		return nil, fmt.Errorf("method not found: %s", pile.ObjectToSymbol(selector).GetValue())
+	// Handle primitive methods
+	if result := vm.ExecutePrimitive(receiver, selector, args, methodObj); result != nil {
+		return result, nil
 	}
 
-	// Move back to the sender context in the executor
-	vm.Executor.CurrentContext = context
+	// A primitive that failed with no code to fall back to is an error
+	method := pile.ObjectToMethod(methodObj)
+	primitiveFailed := method.IsPrimitiveMethod()
+	if primitiveFailed && len(method.GetBytecodes()) == 0 {
+		// Answers the value of the handler, if there is one
+		return vm.Signal(vm.NewPrimitiveFailed(receiver, args, method)), nil
+	}
 
-	// Push the result onto the stack
-	context.Push(result)
+	// Create a new context for the method
+	newContext := NewContext(methodObj, receiver, args, sender)
+	if result, overflowed := vm.stackOverflow(newContext); overflowed {
+		return result, nil
+	}
+	if primitiveFailed {
+		vm.storePrimitiveFailure(newContext, method)
+	}
+	return nil, newContext
+}
 
-	// Return the result
-	return result.(*pile.Object), nil
+// Send sends a message from Go code, such as a primitive, and returns the answer
+// The method runs in its own executor loop, called from the current context.
+// It panics if the send fails in a way Smalltalk code cannot handle.
+func (vm *VM) Send(receiver *pile.Object, selector *pile.Object, args []*pile.Object) *pile.Object {
+	methodObj := vm.LookupMethod(receiver, selector)
+	if methodObj == nil {
+		// Send doesNotUnderstand: instead, with the send reified as a Message
+		notUnderstood := selector
+		methodObj, selector, args = vm.sendDoesNotUnderstand(receiver, selector, args)
+		if methodObj == nil {
+			panic(fmt.Sprintf("method not found: %s", pile.GetSymbolValue(notUnderstood)))
+		}
+	}
+
+	result, newContext := vm.activateMethod(vm.Executor.CurrentContext, receiver, selector, args, methodObj)
+	if newContext == nil {
+		return result
+	}
+	value, err := vm.Executor.ExecuteContext(newContext)
+	if err != nil {
+		panic(fmt.Sprintf("Error sending %s: %v", pile.GetSymbolValue(selector), err))
+	}
+	return value.(*pile.Object)
 }
 
 // ExecuteReturnStackTop executes the RETURN_STACK_TOP bytecode
@@ -215,15 +291,14 @@ func (vm *VM) ExecuteJump(context *Context) (bool, error) {
 	// Get the method
 	method := pile.ObjectToMethod(context.Method)
 
-	// Get the jump offset (4 bytes)
-	if context.PC+1 >= len(method.Bytecodes) {
-		return false, fmt.Errorf("jump offset out of bounds")
+	// Get the jump instruction, its offset is signed
+	instruction, err := currentInstruction(context)
+	if err != nil {
+		return false, err
 	}
-	offset := int(binary.BigEndian.Uint32(method.Bytecodes[context.PC+1:]))
 
-	// The offset is relative to the current instruction
-	// We need to add the size of the instruction to get past this instruction
-	newPC := context.PC + bytecode.InstructionSize(bytecode.JUMP) + offset
+	// The offset is relative to the end of the instruction, including its prefixes
+	newPC := instruction.JumpTarget(context.PC)
 
 	// Check if the new PC is valid
 	if newPC < 0 || newPC >= len(method.Bytecodes) {
@@ -242,11 +317,11 @@ func (vm *VM) ExecuteJumpIfTrue(context *Context) (bool, error) {
 	// Get the method
 	method := pile.ObjectToMethod(context.Method)
 
-	// Get the jump offset (4 bytes)
-	if context.PC+1 >= len(method.Bytecodes) {
-		return false, fmt.Errorf("jump offset out of bounds")
+	// Get the jump instruction, its offset is signed
+	instruction, err := currentInstruction(context)
+	if err != nil {
+		return false, err
 	}
-	offset := int(binary.BigEndian.Uint32(method.Bytecodes[context.PC+1:]))
 
 	// Pop the condition from the stack
 	condition := context.Pop()
@@ -254,9 +329,8 @@ func (vm *VM) ExecuteJumpIfTrue(context *Context) (bool, error) {
 	// If the condition is true, jump by the offset
 	isTrue := condition.IsTrue()
 	if isTrue {
-		// The offset is relative to the current instruction
-		// We need to add the size of the instruction to get past this instruction
-		newPC := context.PC + bytecode.InstructionSize(bytecode.JUMP_IF_TRUE) + offset
+		// The offset is relative to the end of the instruction, including its prefixes
+		newPC := instruction.JumpTarget(context.PC)
 		// Check if the new PC is valid
 		if newPC < 0 || newPC >= len(method.Bytecodes) {
 			return false, fmt.Errorf("jump target out of bounds: %d", newPC)
@@ -275,11 +349,11 @@ func (vm *VM) ExecuteJumpIfFalse(context *Context) (bool, error) {
 	// Get the method
 	method := pile.ObjectToMethod(context.Method)
 
-	// Get the jump offset (4 bytes)
-	if context.PC+1 >= len(method.Bytecodes) {
-		return false, fmt.Errorf("jump offset out of bounds")
+	// Get the jump instruction, its offset is signed
+	instruction, err := currentInstruction(context)
+	if err != nil {
+		return false, err
 	}
-	offset := int(binary.BigEndian.Uint32(method.Bytecodes[context.PC+1:]))
 
 	// Pop the condition from the stack
 	condition := context.Pop()
@@ -287,9 +361,8 @@ func (vm *VM) ExecuteJumpIfFalse(context *Context) (bool, error) {
 	// If the condition is false, jump by the offset
 	isTrue := condition.IsTrue()
 	if !isTrue {
-		// The offset is relative to the current instruction
-		// We need to add the size of the instruction to get past this instruction
-		newPC := context.PC + bytecode.InstructionSize(bytecode.JUMP_IF_FALSE) + offset
+		// The offset is relative to the end of the instruction, including its prefixes
+		newPC := instruction.JumpTarget(context.PC)
 		// Check if the new PC is valid
 		if newPC < 0 || newPC >= len(method.Bytecodes) {
 			return false, fmt.Errorf("jump target out of bounds: %d", newPC)
@@ -148,7 +148,7 @@ func TestExecuteSendMessage(t *testing.T) {
 
 	context := vm.NewContext(methodObj, pile.ClassToObject(pile.ObjectToClass(virtualMachine.Globals["Object"])), []*pile.Object{}, nil)
 
-	context.PC = 10 // After the two PUSH_LITERAL instructions
+	context.PC = 2 // After the two PUSH_LITERAL instructions
 
 	context.Push(virtualMachine.NewInteger(2)) // Receiver
 	context.Push(virtualMachine.NewInteger(3)) // Argument
@@ -249,7 +249,7 @@ func TestExecuteStoreInstanceVariable(t *testing.T) {
 
 	methodObj := compiler.NewMethodBuilder(class).
 		StoreInstanceVariable(0).
-		Go("test")
+		Build("test")
 
 	context := vm.NewContext(methodObj, instance, []*pile.Object{}, nil)
 
@@ -293,7 +293,7 @@ func TestExecuteStoreTemporaryVariable(t *testing.T) {
 	methodObj := compiler.NewMethodBuilder(pile.ObjectToClass(virtualMachine.Globals["Object"])).
 		TempVars([]string{"temp"}).
 		StoreTemporaryVariable(0).
-		Go("test")
+		Build("test")
 
 	context := vm.NewContext(methodObj, pile.ClassToObject(pile.ObjectToClass(virtualMachine.Globals["Object"])), []*pile.Object{}, nil)
 
@@ -398,7 +398,7 @@ func TestExecuteJumpIfTrue(t *testing.T) {
 		PushSelf().PushSelf().PushSelf().PushSelf().PushSelf().
 		PushSelf().PushSelf().PushSelf().PushSelf().PushSelf().
 		PushSelf().PushSelf().PushSelf().PushSelf().PushSelf().
-		Go("test")
+		Build("test")
 
 	// Test with true condition
 	{
@@ -451,7 +451,7 @@ func TestExecuteJumpIfFalse(t *testing.T) {
 		PushSelf().PushSelf().PushSelf().PushSelf().PushSelf().
 		PushSelf().PushSelf().PushSelf().PushSelf().PushSelf().
 		PushSelf().PushSelf().PushSelf().PushSelf().PushSelf().
-		Go("test")
+		Build("test")
 
 	// Test with false condition
 	{
@@ -40,19 +40,24 @@ func TestInstructionSize(t *testing.T) {
 		bytecode byte
 		expected int
 	}{
-		{bytecode.PUSH_LITERAL, 5},
-		{bytecode.PUSH_INSTANCE_VARIABLE, 5},
-		{bytecode.PUSH_TEMPORARY_VARIABLE, 5},
+		{bytecode.PUSH_LITERAL, 2},
+		{bytecode.PUSH_INSTANCE_VARIABLE, 2},
+		{bytecode.PUSH_TEMPORARY_VARIABLE, 2},
 		{bytecode.PUSH_SELF, 1},
-		{bytecode.STORE_INSTANCE_VARIABLE, 5},
-		{bytecode.STORE_TEMPORARY_VARIABLE, 5},
-		{bytecode.SEND_MESSAGE, 9},
+		{bytecode.STORE_INSTANCE_VARIABLE, 2},
+		{bytecode.STORE_TEMPORARY_VARIABLE, 2},
+		{bytecode.SEND_MESSAGE, 3},
 		{bytecode.RETURN_STACK_TOP, 1},
-		{bytecode.JUMP, 5},
-		{bytecode.JUMP_IF_TRUE, 5},
-		{bytecode.JUMP_IF_FALSE, 5},
+		{bytecode.JUMP, 2},
+		{bytecode.JUMP_IF_TRUE, 2},
+		{bytecode.JUMP_IF_FALSE, 2},
 		{bytecode.POP, 1},
 		{bytecode.DUPLICATE, 1},
+		{bytecode.CREATE_BLOCK, 4},
+		{bytecode.EXECUTE_BLOCK, 2},
+		{bytecode.EXTEND_A, 2},
+		{bytecode.PUSH_LITERAL_SHORT + 3, 1},
+		{bytecode.SEND_MESSAGE_SHORT_2 + 15, 1},
 		{255, 1}, // Test unknown bytecode
 	}
 
@@ -62,4 +67,67 @@ func TestInstructionSize(t *testing.T) {
 			t.Errorf("InstructionSize(%d) = %d, expected %d", test.bytecode, result, test.expected)
 		}
 	}
-}
\ No newline at end of file
+}
+func TestAppendInstructionEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		opcode   byte
+		operands []int
+		expected []byte
+	}{
+		{"short push temporary", bytecode.PUSH_TEMPORARY_VARIABLE, []int{3}, []byte{bytecode.PUSH_TEMPORARY_VARIABLE_SHORT + 3}},
+		{"short send", bytecode.SEND_MESSAGE, []int{15, 2}, []byte{bytecode.SEND_MESSAGE_SHORT_2 + 15}},
+		{"long push literal", bytecode.PUSH_LITERAL, []int{16}, []byte{bytecode.PUSH_LITERAL, 16}},
+		{"long send with 3 arguments", bytecode.SEND_MESSAGE, []int{1, 3}, []byte{bytecode.SEND_MESSAGE, 1, 3}},
+		{"extended literal", bytecode.PUSH_LITERAL, []int{300}, []byte{bytecode.EXTEND_A, 1, bytecode.PUSH_LITERAL, 44}},
+		{"extended argument count", bytecode.SEND_MESSAGE, []int{20, 256}, []byte{bytecode.EXTEND_B, 1, bytecode.SEND_MESSAGE, 20, 0}},
+		{"backward jump", bytecode.JUMP, []int{-2}, []byte{bytecode.JUMP, 0xFE}},
+		{"extended forward jump", bytecode.JUMP, []int{200}, []byte{bytecode.EXTEND_A, 0, bytecode.JUMP, 200}},
+		{"extended backward jump", bytecode.JUMP_IF_FALSE, []int{-300}, []byte{bytecode.EXTEND_A, 0xFE, bytecode.JUMP_IF_FALSE, 0xD4}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded := bytecode.AppendInstruction(nil, test.opcode, test.operands...)
+			if string(encoded) != string(test.expected) {
+				t.Fatalf("AppendInstruction = %v, expected %v", encoded, test.expected)
+			}
+
+			instruction, err := bytecode.Decode(encoded, 0)
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			if instruction.Opcode != test.opcode {
+				t.Errorf("Decode opcode = %s, expected %s", bytecode.BytecodeName(instruction.Opcode), bytecode.BytecodeName(test.opcode))
+			}
+			if instruction.Size != len(encoded) {
+				t.Errorf("Decode size = %d, expected %d", instruction.Size, len(encoded))
+			}
+			for index, operand := range test.operands {
+				if instruction.Operand(index) != operand {
+					t.Errorf("Decode operand %d = %d, expected %d", index, instruction.Operand(index), operand)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		bytecodes []byte
+	}{
+		{"unknown opcode", []byte{255}},
+		{"truncated operand", []byte{bytecode.SEND_MESSAGE, 1}},
+		{"truncated prefix", []byte{bytecode.EXTEND_A}},
+		{"prefix without instruction", []byte{bytecode.EXTEND_A, 1}},
+		{"prefix on short form", []byte{bytecode.EXTEND_A, 1, bytecode.PUSH_LITERAL_SHORT}},
+		{"prefix past last operand", []byte{bytecode.EXTEND_B, 1, bytecode.PUSH_LITERAL, 0}},
+	}
+
+	for _, test := range tests {
+		if _, err := bytecode.Decode(test.bytecodes, 0); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package vm
+
+import (
+	"fmt"
+
+	"smalltalklsp/interpreter/ast"
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/parser"
+	"smalltalklsp/interpreter/pile"
+)
+
+// Instance variable indices of SyntaxError
+const (
+	syntaxErrorMessageText = 0
+	syntaxErrorSource      = 1
+	syntaxErrorPosition    = 2
+)
+
+// NewBehaviorClass creates Behavior, the superclass of Class that holds the
+// reflective methods every class understands
+func (vm *VM) NewBehaviorClass() *pile.Class {
+	objectClass := pile.ObjectToClass(vm.Globals["Object"])
+	result := pile.NewClass("Behavior", objectClass)
+
+	// compile: method (compiles a method and installs it in the receiver)
+	compiler.NewMethodBuilder(result).Primitive(70).Go("compile:")
+
+	// compile:classified: method (compiles and installs a method under a category)
+	compiler.NewMethodBuilder(result).Primitive(71).Go("compile:classified:")
+
+	// new and basicNew methods (create a new instance of the receiver)
+	compiler.NewMethodBuilder(result).Primitive(60).Go("new")
+	compiler.NewMethodBuilder(result).Primitive(60).Go("basicNew")
+
+	// superclass and name methods, see metaclass.go
+	compiler.NewMethodBuilder(result).Primitive(62).Go("superclass")
+	compiler.NewMethodBuilder(result).Primitive(63).Go("name")
+
+	return result
+}
+
+// NewCompilerClass creates Compiler, whose class side evaluates expressions
+func (vm *VM) NewCompilerClass() *pile.Class {
+	objectClass := pile.ObjectToClass(vm.Globals["Object"])
+	result := vm.NewClass("Compiler", objectClass)
+
+	// evaluate: method on the class side (compiles and runs an expression, returning its value)
+	compiler.NewMethodBuilder(vm.GetClass(pile.ClassToObject(result))).Primitive(72).Go("evaluate:")
+
+	return result
+}
+
+// NewCompiledMethodClass creates CompiledMethod, the class of the methods
+// compile: answers and contexts run
+func (vm *VM) NewCompiledMethodClass() *pile.Class {
+	objectClass := pile.ObjectToClass(vm.Globals["Object"])
+	result := pile.NewClass("CompiledMethod", objectClass)
+
+	// selector and methodClass methods (answer the selector and the class the method belongs to)
+	compiler.NewMethodBuilder(result).Primitive(172).Go("selector")
+	compiler.NewMethodBuilder(result).Primitive(173).Go("methodClass")
+
+	return result
+}
+
+// NewSyntaxErrorClass creates SyntaxError, which the compiler primitives
+// return when source does not parse or compile
+func (vm *VM) NewSyntaxErrorClass() *pile.Class {
+	objectClass := pile.ObjectToClass(vm.Globals["Object"])
+	result := pile.NewClass("SyntaxError", objectClass)
+	result.InstanceVarNames = []string{"messageText", "source", "position"}
+
+	// Accessors for the instance variables
+	compiler.NewMethodBuilder(result).PushInstanceVariable(syntaxErrorMessageText).ReturnStackTop().Go("messageText")
+	compiler.NewMethodBuilder(result).PushInstanceVariable(syntaxErrorSource).ReturnStackTop().Go("source")
+	compiler.NewMethodBuilder(result).PushInstanceVariable(syntaxErrorPosition).ReturnStackTop().Go("position")
+
+	return result
+}
+
+// NewSyntaxError creates a SyntaxError
+// The position is a 1-based index into the source like Smalltalk string
+// indices, or 0 when the error cannot be tied to a place in the source
+func (vm *VM) NewSyntaxError(messageText string, source string, position int) *pile.Object {
+	vm.allocated()
+	syntaxErrorClass := vm.Globals["SyntaxError"]
+	result := pile.NewClassInstance(pile.ObjectToClass(syntaxErrorClass))
+	result.SetClass(syntaxErrorClass)
+	result.SetInstanceVarByIndex(syntaxErrorMessageText, vm.NewString(messageText))
+	result.SetInstanceVarByIndex(syntaxErrorSource, vm.NewString(source))
+	result.SetInstanceVarByIndex(syntaxErrorPosition, vm.NewInteger(int64(position)))
+	return result
+}
+
+// CompileMethod parses and compiles source as a method of class and installs
+// it in the class's method dictionary, replacing any method with the same selector.
+// It returns the method, or a SyntaxError if the source does not parse or compile
+// or uses a primitive number the VM does not have.
+func (vm *VM) CompileMethod(class *pile.Object, source string, category string) *pile.Object {
+	p := parser.NewParser(source, class, vm)
+	node, err := p.Parse()
+	if err != nil {
+		return vm.NewSyntaxError(err.Error(), source, p.ErrorPosition()+1)
+	}
+
+	method, err := compileNode(class, node, source)
+	if err != nil {
+		return vm.NewSyntaxError(err.Error(), source, 0)
+	}
+	if method.IsPrimitiveMethod() && method.PrimitiveName == "" && vm.Primitives.Lookup(method.GetPrimitiveIndex()) == nil {
+		return vm.NewSyntaxError(fmt.Sprintf("unknown primitive %d", method.GetPrimitiveIndex()), source, 0)
+	}
+	method.SetCategory(category)
+
+	methodObj := pile.MethodToObject(method)
+	methodDict := pile.GetClassMethodDictionary(pile.ObjectToClass(class))
+	methodDict.SetEntry(pile.GetSymbolValue(method.GetSelector()), methodObj)
+	return methodObj
+}
+
+// Evaluate parses, compiles and runs source as an expression with nil as the receiver
+// It returns the value of the expression, or a SyntaxError if the source does not
+// parse or compile. Run from Go with nothing else running, it returns the error
+// that stopped the expression, as ExecuteContext does; run from Smalltalk, such
+// an error unwinds the evaluation that is running.
+func (vm *VM) Evaluate(source string) (*pile.Object, error) {
+	class := vm.Globals["UndefinedObject"]
+	p := parser.NewParser(source, class, vm)
+	node, err := p.ParseExpression()
+	if err != nil {
+		return vm.NewSyntaxError(err.Error(), source, p.ErrorPosition()+1), nil
+	}
+
+	method, err := compileNode(class, node, source)
+	if err != nil {
+		return vm.NewSyntaxError(err.Error(), source, 0), nil
+	}
+
+	// Run the expression as if it were called from the current context
+	sender := vm.Executor.CurrentContext
+	context := NewContext(pile.MethodToObject(method), vm.NilObject, []*pile.Object{}, sender)
+	result, err := vm.ExecuteContext(context)
+	vm.Executor.CurrentContext = sender
+	if err != nil {
+		return nil, err
+	}
+	return result.(*pile.Object), nil
+}
+
+// compileNode compiles a parsed method or expression
+// The compiler panics on code it cannot compile, such as an undefined
+// variable, so the panic is turned back into an error here
+func compileNode(class *pile.Object, node ast.Node, source string) (method *pile.Method, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	bytecodeCompiler := compiler.NewBytecodeCompiler(class)
+	bytecodeCompiler.Source = source
+	return bytecodeCompiler.Compile(node), nil
+}
+
+// isClass returns true if an object is a class
+func isClass(obj *pile.Object) bool {
+	return !pile.IsImmediate(obj) && obj.Type() == pile.OBJ_CLASS
+}
+
+// isString returns true if an object is a string
+func isString(obj *pile.Object) bool {
+	return !pile.IsImmediate(obj) && obj.Type() == pile.OBJ_STRING
+}
@@ -0,0 +1,155 @@
+package vm_test
+
+import (
+	"errors"
+	"testing"
+
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// assertSyntaxError checks that an object is a SyntaxError and returns its position
+func assertSyntaxError(t *testing.T, virtualMachine *vm.VM, obj *pile.Object) int64 {
+	t.Helper()
+	if pile.IsImmediate(obj) || obj.Class() != virtualMachine.Globals["SyntaxError"] {
+		t.Fatalf("Expected a SyntaxError, got %v", obj)
+	}
+	if messageText := pile.ObjectToString(obj.GetInstanceVarByIndex(0)).GetValue(); messageText == "" {
+		t.Errorf("Expected the SyntaxError to have a message")
+	}
+	return pile.GetIntegerImmediate(obj.GetInstanceVarByIndex(2))
+}
+
+// TestCompilePrimitives tests compiling and installing methods from Smalltalk
+func TestCompilePrimitives(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	integerClass := pile.ObjectToClass(virtualMachine.Globals["Integer"])
+
+	method := evaluate(t, virtualMachine, "Integer compile: 'double ^self + self'")
+	if pile.ObjectToMethod(method) == nil {
+		t.Fatalf("Expected compile: to return a method, got %v", method)
+	}
+	if installed := pile.GetClassMethodDictionary(integerClass).GetEntry("double"); installed != method {
+		t.Errorf("Expected compile: to install the method in Integer")
+	}
+	if result := evaluate(t, virtualMachine, "3 double"); result != virtualMachine.NewInteger(6) {
+		t.Errorf("Expected 3 double to be 6, got %v", result)
+	}
+
+	// Recompiling replaces the method and records the category
+	method = evaluate(t, virtualMachine, "Integer compile: 'double ^self + self + self' classified: 'arithmetic'")
+	if category := pile.ObjectToMethod(method).GetCategory(); category != "arithmetic" {
+		t.Errorf("Expected category %q, got %q", "arithmetic", category)
+	}
+	if result := evaluate(t, virtualMachine, "3 double"); result != virtualMachine.NewInteger(9) {
+		t.Errorf("Expected the recompiled 3 double to be 9, got %v", result)
+	}
+}
+
+// TestCompileStatements tests that every statement of a compiled method runs
+func TestCompileStatements(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	objectClass := virtualMachine.Globals["Object"]
+
+	for _, source := range []string{"baz | t | t := 5. ^t", "bar self zork. ^3", "qux 3 + 4"} {
+		assertCompiled(t, virtualMachine, virtualMachine.CompileMethod(objectClass, source, ""))
+	}
+	if result, err := executeExpression(t, virtualMachine, "Object new baz"); err != nil || result != virtualMachine.NewInteger(5) {
+		t.Errorf("Expected baz to answer 5, got %v (%v)", result, err)
+	}
+	if _, err := executeExpression(t, virtualMachine, "Object new bar"); err == nil {
+		t.Errorf("Expected bar to send zork, which Object does not understand")
+	}
+
+	// A method that does not end in a return answers self
+	result, err := executeExpression(t, virtualMachine, "Object new qux")
+	if err != nil || pile.IsImmediate(result.(*pile.Object)) || result.(*pile.Object).Class() != objectClass {
+		t.Errorf("Expected qux to answer the receiver, got %v (%v)", result, err)
+	}
+}
+
+// TestCompiledMethodMessages tests sending messages to the method compile: answers
+func TestCompiledMethodMessages(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	if result, err := executeExpression(t, virtualMachine, "(Object compile: 'bar ^3') selector"); err != nil || pile.GetSymbolValue(result.(*pile.Object)) != "bar" {
+		t.Errorf("Expected the selector #bar, got %v (%v)", result, err)
+	}
+	if result, err := executeExpression(t, virtualMachine, "(Object compile: 'bar ^3') class"); err != nil || result != virtualMachine.Globals["CompiledMethod"] {
+		t.Errorf("Expected CompiledMethod, got %v (%v)", result, err)
+	}
+	if result, err := executeExpression(t, virtualMachine, "(Object compile: 'bar ^3') methodClass"); err != nil || result != virtualMachine.Globals["Object"] {
+		t.Errorf("Expected Object, got %v (%v)", result, err)
+	}
+}
+
+// evaluate evaluates an expression, failing the test if it stops with an error
+func evaluate(t *testing.T, virtualMachine *vm.VM, source string) *pile.Object {
+	t.Helper()
+	result, err := virtualMachine.Evaluate(source)
+	if err != nil {
+		t.Fatalf("Error evaluating %q: %v", source, err)
+	}
+	return result
+}
+
+// assertCompiled checks that CompileMethod answered a method
+func assertCompiled(t *testing.T, virtualMachine *vm.VM, obj *pile.Object) {
+	t.Helper()
+	if pile.ObjectToMethod(obj) == nil {
+		t.Fatalf("Expected a method, got %v", obj)
+	}
+}
+
+// TestCompilePrimitiveErrors tests that bad source gives a SyntaxError and installs nothing
+func TestCompilePrimitiveErrors(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	objectClass := virtualMachine.Globals["Object"]
+
+	// Parse errors point at where parsing stopped
+	if position := assertSyntaxError(t, virtualMachine, virtualMachine.CompileMethod(objectClass, "foo ^", "")); position != 6 {
+		t.Errorf("Expected the parse error at position 6, got %d", position)
+	}
+	if position := assertSyntaxError(t, virtualMachine, virtualMachine.CompileMethod(objectClass, "foo ^'bar", "")); position != 10 {
+		t.Errorf("Expected the unterminated string error at position 10, got %d", position)
+	}
+
+	// Compile errors have no position
+	if position := assertSyntaxError(t, virtualMachine, virtualMachine.CompileMethod(objectClass, "foo ^bar", "")); position != 0 {
+		t.Errorf("Expected the compile error to have no position, got %d", position)
+	}
+	// Source the parser cannot take all of is an error, not a shorter method
+	assertSyntaxError(t, virtualMachine, virtualMachine.CompileMethod(objectClass, "foo ^1. 2", ""))
+	assertSyntaxError(t, virtualMachine, virtualMachine.CompileMethod(objectClass, "foo 3 4", ""))
+	if pile.GetClassMethodDictionary(pile.ObjectToClass(objectClass)).GetEntry("foo") != nil {
+		t.Errorf("Expected nothing to be installed for source with errors")
+	}
+
+	// The error is a Smalltalk object with accessors
+	result := evaluate(t, virtualMachine, "(Object compile: 'foo ^bar') messageText")
+	if pile.IsImmediate(result) || result.Type() != pile.OBJ_STRING {
+		t.Errorf("Expected messageText to answer a string, got %v", result)
+	}
+}
+
+// TestCompilerEvaluate tests evaluating expressions from Smalltalk
+func TestCompilerEvaluate(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	if result := evaluate(t, virtualMachine, "Compiler evaluate: '3 + 4'"); result != virtualMachine.NewInteger(7) {
+		t.Errorf("Expected 7, got %v", result)
+	}
+	assertSyntaxError(t, virtualMachine, evaluate(t, virtualMachine, "Compiler evaluate: '3 +'"))
+
+	// Errors are returned to Go, and signalled in Smalltalk
+	var unhandled *vm.UnhandledExceptionError
+	if _, err := virtualMachine.Evaluate("3 zork"); !errors.As(err, &unhandled) {
+		t.Errorf("Expected an unhandled exception, got %v", err)
+	}
+	if _, err := virtualMachine.Evaluate("Compiler evaluate: '3 zork'"); !errors.As(err, &unhandled) {
+		t.Errorf("Expected an unhandled exception, got %v", err)
+	}
+	if result := evaluate(t, virtualMachine, "[Compiler evaluate: '3 zork'] on: MessageNotUnderstood do: [:e | 5]"); result != virtualMachine.NewInteger(5) {
+		t.Errorf("Expected the handler to answer 5, got %v", result)
+	}
+}
@@ -61,7 +61,7 @@ func setupFactorialMethod(virtualMachine *vm.VM) *pile.Object {
 	builder.Duplicate()
 
 	// JUMP_IF_FALSE to the false branch
-	builder.JumpIfFalse(12) // Jump past the true branch
+	builder.JumpIfFalse(4) // Jump past the true branch
 
 	// True branch: [1]
 	// POP the boolean (we don't need it anymore)
@@ -71,7 +71,7 @@ func setupFactorialMethod(virtualMachine *vm.VM) *pile.Object {
 	builder.PushLiteral(oneIndex)
 
 	// JUMP past the false branch to the return
-	builder.Jump(35) // Jump to the return
+	builder.Jump(7) // Jump to the return
 
 	// False branch: [self * (self - 1) factorial]
 	// POP the boolean (we don't need it anymore)
@@ -164,6 +164,9 @@ func BenchmarkFactorial(b *testing.B) {
 				messagesSendsPerSecond := float64(messageSends) / duration.Seconds()
 				b.ReportMetric(messagesSendsPerSecond, "sends/sec")
 			}
+
+			// Report the encoded size of the method
+			b.ReportMetric(float64(len(pile.ObjectToMethod(factorialMethod).Bytecodes)), "bytecode-bytes")
 		})
 	}
 }
@@ -293,6 +296,44 @@ var messageSendTestCases = []struct {
 		},
 		expected: 15,
 	},
+	{
+		name: "InheritedSend",
+		setup: func(virtualMachine *vm.VM) (*pile.Object, *pile.Object) {
+			// Build a hierarchy four classes deep below Object
+			class := pile.ObjectToClass(virtualMachine.Globals["Object"])
+			var top *pile.Class
+			for _, name := range []string{"Level1", "Level2", "Level3", "Level4"} {
+				class = pile.NewClass(name, class)
+				if top == nil {
+					top = class
+				}
+			}
+
+			// answer is defined at the top, so every lookup from Level4 walks the whole chain
+			answerBuilder := compiler.NewMethodBuilder(top)
+			answerIndex, answerBuilder := answerBuilder.AddLiteral(virtualMachine.NewInteger(42))
+			answerBuilder.PushLiteral(answerIndex).ReturnStackTop().Go("answer")
+
+			// Create a method that sends it twice: ^self answer + self answer
+			builder := compiler.NewMethodBuilder(class)
+			answerSelectorIndex, builder := builder.AddLiteral(pile.NewSymbol("answer"))
+			plusIndex, builder := builder.AddLiteral(pile.NewSymbol("+"))
+			builder.PushSelf()
+			builder.SendMessage(answerSelectorIndex, 0)
+			builder.PushSelf()
+			builder.SendMessage(answerSelectorIndex, 0)
+			builder.SendMessage(plusIndex, 1)
+			builder.ReturnStackTop()
+			testMethod := builder.Go("test")
+
+			// Create an instance of the deepest class as the receiver
+			receiver := pile.NewInstance(class)
+			receiver.SetClass(pile.ClassToObject(class))
+
+			return testMethod, receiver
+		},
+		expected: 84,
+	},
 }
 
 // BenchmarkMessageSend is a parameterized benchmark for message sending
@@ -329,6 +370,9 @@ func BenchmarkMessageSend(b *testing.B) {
 					b.Fatalf("Expected an immediate integer, got %v", result)
 				}
 			}
+
+			// Report the encoded size of the method
+			b.ReportMetric(float64(len(pile.ObjectToMethod(testMethod).Bytecodes)), "bytecode-bytes")
 		})
 	}
 }
@@ -1,11 +1,14 @@
 package vm
 
 import (
+	"smalltalklsp/interpreter/bytecode"
 	"smalltalklsp/interpreter/pile"
 )
 
 // Context represents a method activation context
+// It is an object itself, of class MethodContext or BlockContext, see VM.ContextObject
 type Context struct {
+	pile.Object
 	Method       *pile.Object
 	Receiver     pile.ObjectInterface
 	Arguments    []*pile.Object
@@ -14,6 +17,29 @@ type Context struct {
 	PC           int
 	Stack        []*pile.Object
 	StackPointer int
+
+	// instruction is the instruction the executor decoded at instructionPC,
+	// handlers reuse it instead of decoding it again
+	instruction   bytecode.Instruction
+	instructionPC int
+
+	// block is true for a block context, whose Sender is the context that
+	// defined the block, and caller is the context that evaluated it
+	block  bool
+	caller *Context
+
+	// depth is the number of contexts in the call chain ending in this one, and
+	// slots is the number of temporaries and stack slots they allocated
+	depth int
+	slots int
+
+	// disabled is true for an on:do: context while a handler it or a context
+	// it called found is running, signals from the handler skip it
+	disabled bool
+
+	// primitiveFailure is the failure code of the primitive whose fallback code
+	// the context runs, for primitiveFailed
+	primitiveFailure string
 }
 
 // NewContext creates a new method activation context
@@ -33,16 +59,72 @@ func NewContext(method *pile.Object, receiver pile.ObjectInterface, arguments []
 		tempVars[i] = pile.NewNil()
 	}
 
-	return &Context{
-		Method:       method,
-		Receiver:     receiver,
-		Arguments:    arguments,
-		TempVars:     tempVars,
-		Sender:       sender,
-		PC:           0,
-		Stack:        make([]*pile.Object, 100), // Initial stack size
-		StackPointer: 0,
+	// The compiler puts the parameters first in the temporaries
+	for i := 0; i < len(arguments) && i < tempVarsSize; i++ {
+		tempVars[i] = arguments[i]
+	}
+
+	context := &Context{
+		Object:        pile.Object{TypeField: pile.OBJ_CONTEXT},
+		Method:        method,
+		Receiver:      receiver,
+		Arguments:     arguments,
+		TempVars:      tempVars,
+		Sender:        sender,
+		PC:            0,
+		Stack:         make([]*pile.Object, 100), // Initial stack size
+		StackPointer:  0,
+		instructionPC: -1,
+	}
+	context.countFrom(sender)
+	return context
+}
+
+// countFrom counts the context into the call chain that caller ends
+func (c *Context) countFrom(caller *Context) {
+	c.depth = 1
+	c.slots = len(c.TempVars) + len(c.Stack)
+	if caller != nil {
+		c.depth += caller.depth
+		c.slots += caller.slots
+	}
+}
+
+// evaluatedBy makes the context a block context evaluated by caller
+func (c *Context) evaluatedBy(caller *Context) {
+	c.block = true
+	c.caller = caller
+	c.countFrom(caller)
+}
+
+// restart makes the context run its method again from the start with the same
+// arguments, for retry
+func (c *Context) restart() {
+	c.PC = 0
+	c.StackPointer = 0
+	for i := len(c.Arguments); i < len(c.TempVars); i++ {
+		c.TempVars[i] = pile.NewNil()
 	}
+	c.disabled = false
+}
+
+// Caller returns the context that called this one, which for a block context
+// is the one that evaluated it rather than its Sender
+func (c *Context) Caller() *Context {
+	if c.block {
+		return c.caller
+	}
+	return c.Sender
+}
+
+// IsBlockContext returns true if the context is evaluating a block
+func (c *Context) IsBlockContext() bool {
+	return c.block
+}
+
+// Depth returns the number of contexts in the call chain ending in this one
+func (c *Context) Depth() int {
+	return c.depth
 }
 
 // Push pushes an object onto the stack
@@ -160,3 +242,22 @@ func (c *Context) GetPC() int {
 func (c *Context) SetPC(pc int) {
 	c.PC = pc
 }
+
+// GetDebugInfo returns the debug info of the context's method, or nil
+func (c *Context) GetDebugInfo() *pile.DebugInfo {
+	method := pile.ObjectToMethod(c.Method)
+	if method == nil {
+		return nil
+	}
+	return method.GetDebugInfo()
+}
+
+// SourceLine returns the 1-based source line being executed, or 0 if unknown
+func (c *Context) SourceLine() int {
+	return c.GetDebugInfo().LineAt(c.PC)
+}
+
+// SourceText returns the source of the expression being executed, or "" if unknown
+func (c *Context) SourceText() string {
+	return c.GetDebugInfo().SourceAt(c.PC)
+}
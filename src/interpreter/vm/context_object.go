@@ -0,0 +1,244 @@
+package vm
+
+import (
+	"unsafe"
+
+	"smalltalklsp/interpreter/bytecode"
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/pile"
+)
+
+// init registers how the garbage collector updates the references of a context
+func init() {
+	pile.SetContextReferencesHook(updateContextReferences)
+}
+
+// NewContextPartClass creates ContextPart, the abstract superclass of
+// MethodContext and BlockContext with the accessors both understand
+func (vm *VM) NewContextPartClass() *pile.Class {
+	objectClass := pile.ObjectToClass(vm.Globals["Object"])
+	result := pile.NewClass("ContextPart", objectClass)
+
+	compiler.NewMethodBuilder(result).Primitive(90).Go("sender")
+	compiler.NewMethodBuilder(result).Primitive(91).Go("method")
+	compiler.NewMethodBuilder(result).Primitive(92).Go("receiver")
+	compiler.NewMethodBuilder(result).Primitive(93).Go("pc")
+	compiler.NewMethodBuilder(result).Primitive(94).Go("pc:")
+	compiler.NewMethodBuilder(result).Primitive(95).Go("tempAt:")
+	compiler.NewMethodBuilder(result).Primitive(96).Go("tempAt:put:")
+	compiler.NewMethodBuilder(result).Primitive(97).Go("size")
+
+	return result
+}
+
+// NewMethodContextClass creates MethodContext, the class of contexts running a method
+func (vm *VM) NewMethodContextClass() *pile.Class {
+	contextPartClass := pile.ObjectToClass(vm.Globals["ContextPart"])
+	return pile.NewClass("MethodContext", contextPartClass)
+}
+
+// NewBlockContextClass creates BlockContext, the class of contexts evaluating a block
+func (vm *VM) NewBlockContextClass() *pile.Class {
+	contextPartClass := pile.ObjectToClass(vm.Globals["ContextPart"])
+	result := pile.NewClass("BlockContext", contextPartClass)
+
+	// outerContext answers the context that defined the block
+	compiler.NewMethodBuilder(result).Primitive(98).Go("outerContext")
+
+	return result
+}
+
+// ContextToObject converts a Context to an Object
+// Use VM.ContextObject for contexts that Smalltalk code will see, which sets the class
+func ContextToObject(c *Context) *pile.Object {
+	return &c.Object
+}
+
+// ObjectToContext converts an Object to a Context, or returns nil if the object is not a context
+func ObjectToContext(o *pile.Object) *Context {
+	if o == nil || pile.IsImmediate(o) || o.Type() != pile.OBJ_CONTEXT {
+		return nil
+	}
+	return (*Context)(unsafe.Pointer(o))
+}
+
+// ContextObject returns a context as an object Smalltalk code can send messages to,
+// an instance of MethodContext or BlockContext, or nil for no context
+// Contexts get their class here rather than when they are created, since most
+// of them are never seen from Smalltalk.
+func (vm *VM) ContextObject(context *Context) *pile.Object {
+	if context == nil {
+		return vm.NilObject.(*pile.Object)
+	}
+	if context.Class() == nil {
+		if context.block {
+			context.SetClass(vm.Globals["BlockContext"])
+		} else {
+			context.SetClass(vm.Globals["MethodContext"])
+		}
+	}
+	return ContextToObject(context)
+}
+
+// updateContextReferences replaces each reference of a context object with
+// update's result during garbage collection, and updates the contexts it refers to
+func updateContextReferences(obj *pile.Object, update func(ref *pile.Object) *pile.Object) {
+	context := ObjectToContext(obj)
+	if context.Class() != nil {
+		context.SetClass(update(context.Class()))
+	}
+	context.Method = update(context.Method)
+	context.Receiver = update(context.GetReceiver())
+	for i, arg := range context.Arguments {
+		if arg != nil {
+			context.Arguments[i] = update(arg)
+		}
+	}
+	for i, tempVar := range context.TempVars {
+		if tempVar != nil {
+			context.TempVars[i] = update(tempVar.(*pile.Object))
+		}
+	}
+	for i := 0; i < context.StackPointer; i++ {
+		if context.Stack[i] != nil {
+			context.Stack[i] = update(context.Stack[i])
+		}
+	}
+
+	// The contexts themselves are not moved, updating them traces their references too
+	if context.Sender != nil {
+		update(ContextToObject(context.Sender))
+	}
+	if context.caller != nil {
+		update(ContextToObject(context.caller))
+	}
+}
+
+// primitiveContextSender answers the context that called the receiver, which
+// for a block context is the one that evaluated the block, or nil
+func (vm *VM) primitiveContextSender(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	context := ObjectToContext(receiver)
+	if context == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return vm.ContextObject(context.Caller())
+}
+
+// primitiveContextMethod answers the method the receiver is running
+func (vm *VM) primitiveContextMethod(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	context := ObjectToContext(receiver)
+	if context == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return context.Method
+}
+
+// primitiveContextReceiver answers the receiver of the method the receiver is running
+func (vm *VM) primitiveContextReceiver(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	context := ObjectToContext(receiver)
+	if context == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return context.GetReceiver()
+}
+
+// primitiveContextPC answers the offset in its method's bytecodes where the
+// receiver carries on, which for a context waiting on a send is after the send
+func (vm *VM) primitiveContextPC(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	context := ObjectToContext(receiver)
+	if context == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return vm.NewInteger(int64(context.PC))
+}
+
+// primitiveContextPCPut moves the receiver to another instruction of its method,
+// or to the end of the method, where it returns the top of its stack
+func (vm *VM) primitiveContextPCPut(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	context := ObjectToContext(receiver)
+	if context == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	if !pile.IsIntegerImmediate(args[0]) {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	pc := int(pile.GetIntegerImmediate(args[0]))
+	if !isInstructionStart(pile.ObjectToMethod(context.Method).GetBytecodes(), pc) {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	context.PC = pc
+	return args[0]
+}
+
+// isInstructionStart returns true if pc is where an instruction of bytecodes
+// starts, or the end of bytecodes
+func isInstructionStart(bytecodes []byte, pc int) bool {
+	start := 0
+	for start < pc {
+		instruction, err := bytecode.Decode(bytecodes, start)
+		if err != nil {
+			return false
+		}
+		start += instruction.Size
+	}
+	return start == pc
+}
+
+// contextTempIndex returns the 0-based index of the temporary a context
+// primitive's 1-based index argument names, or false if there is no such temporary
+func contextTempIndex(context *Context, index *pile.Object) (int, bool) {
+	if !pile.IsIntegerImmediate(index) {
+		return 0, false
+	}
+	i := int(pile.GetIntegerImmediate(index)) - 1
+	return i, i >= 0 && i < len(context.TempVars)
+}
+
+// primitiveContextTempAt answers a temporary of the receiver by 1-based index,
+// the arguments come first
+func (vm *VM) primitiveContextTempAt(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	context := ObjectToContext(receiver)
+	if context == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	i, ok := contextTempIndex(context, args[0])
+	if !ok {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	if context.TempVars[i] == nil {
+		return vm.NilObject.(*pile.Object)
+	}
+	return context.TempVars[i].(*pile.Object)
+}
+
+// primitiveContextTempAtPut stores into a temporary of the receiver by 1-based index
+func (vm *VM) primitiveContextTempAtPut(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	context := ObjectToContext(receiver)
+	if context == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	i, ok := contextTempIndex(context, args[0])
+	if !ok {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	context.TempVars[i] = args[1]
+	return args[1]
+}
+
+// primitiveContextSize answers the number of temporaries of the receiver, including the arguments
+func (vm *VM) primitiveContextSize(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	context := ObjectToContext(receiver)
+	if context == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return vm.NewInteger(int64(len(context.TempVars)))
+}
+
+// primitiveContextOuterContext answers the context that defined the block the receiver is evaluating
+func (vm *VM) primitiveContextOuterContext(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	context := ObjectToContext(receiver)
+	if context == nil || !context.block {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return vm.ContextObject(context.Sender)
+}
@@ -0,0 +1,183 @@
+package vm_test
+
+import (
+	"testing"
+
+	"smalltalklsp/interpreter/bytecode"
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// newContextTestVM returns a VM where Integer>>caller answers the context that sent it
+func newContextTestVM(t *testing.T) *vm.VM {
+	t.Helper()
+	virtualMachine := vm.NewVM()
+	compileMethods(t, virtualMachine, virtualMachine.Globals["Integer"],
+		"caller ^thisContext sender",
+		"peek: anObject ^self caller",
+		"fail ^Error new signal: 'failed'",
+		"divide ^self / 0",
+		"unknown ^self foo")
+	return virtualMachine
+}
+
+// TestContextAccessors tests that a method's context answers its parts
+func TestContextAccessors(t *testing.T) {
+	virtualMachine := newContextTestVM(t)
+
+	result, err := executeExpression(t, virtualMachine, "3 peek: 'four'")
+	if err != nil {
+		t.Fatalf("Error executing: %v", err)
+	}
+	context := result.(*pile.Object)
+	if context.Type() != pile.OBJ_CONTEXT || virtualMachine.GetClass(context).Name != "MethodContext" {
+		t.Fatalf("Expected a MethodContext, got %v", context)
+	}
+
+	send := func(receiver *pile.Object, selector string, args ...*pile.Object) *pile.Object {
+		return virtualMachine.Send(receiver, pile.NewSymbol(selector), args)
+	}
+	if receiver := send(context, "receiver"); receiver != virtualMachine.NewInteger(3) {
+		t.Errorf("Expected the receiver 3, got %v", receiver)
+	}
+	peek := virtualMachine.LookupMethod(virtualMachine.NewInteger(3), pile.NewSymbol("peek:"))
+	if method := send(context, "method"); method != peek {
+		t.Errorf("Expected the method Integer>>peek:, got %v", method)
+	}
+	if argument := send(context, "tempAt:", virtualMachine.NewInteger(1)); pile.ObjectToString(argument).GetValue() != "four" {
+		t.Errorf("Expected the argument 'four', got %v", argument)
+	}
+	if size := send(context, "size"); size != virtualMachine.NewInteger(1) {
+		t.Errorf("Expected one temporary, got %v", size)
+	}
+
+	// The context is waiting on the send of caller, its pc is past the send
+	pc := pile.GetIntegerImmediate(send(context, "pc"))
+	instruction, err := bytecode.Decode(pile.ObjectToMethod(peek).GetBytecodes(), int(pc))
+	if err != nil || instruction.Opcode != bytecode.RETURN_STACK_TOP {
+		t.Errorf("Expected pc %d to be at the return, got %v (%v)", pc, instruction, err)
+	}
+
+	// Its sender is the context of the expression, whose sender is nil
+	sender := send(context, "sender")
+	if virtualMachine.GetClass(sender).Name != "MethodContext" || send(sender, "receiver") != virtualMachine.NilObject {
+		t.Errorf("Expected the expression's context as the sender, got %v", sender)
+	}
+	if outermost := send(sender, "sender"); outermost != virtualMachine.NilObject {
+		t.Errorf("Expected the expression's context to have no sender, got %v", outermost)
+	}
+	if send(context, "sender") != sender {
+		t.Errorf("Expected the same object for the sender each time")
+	}
+}
+
+// TestContextManipulation tests changing a context from Smalltalk
+func TestContextManipulation(t *testing.T) {
+	virtualMachine := newContextTestVM(t)
+	virtualMachine.CompileMethod(virtualMachine.Globals["Integer"], "twice: aNumber ^(self caller tempAt: 1 put: 10) + aNumber", "")
+
+	tests := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		// Storing into the context changes the argument the method reads next
+		{"3 twice: 4", virtualMachine.NewInteger(20)},
+		{"(3 peek: 4) tempAt: 1 put: 5", virtualMachine.NewInteger(5)},
+		{"(3 peek: 4) pc: 0", virtualMachine.NewInteger(0)},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	failures := []struct {
+		expression string
+		expected   string
+	}{
+		{"(3 peek: 4) tempAt: 2", "unhandled PrimitiveFailed: MethodContext>>tempAt: primitive failed: bad argument"},
+		{"(3 peek: 4) tempAt: 0 put: 5", "unhandled PrimitiveFailed: MethodContext>>tempAt:put: primitive failed: bad argument"},
+		{"(3 peek: 4) pc: 1000", "unhandled PrimitiveFailed: MethodContext>>pc: primitive failed: bad argument"},
+		{"(3 peek: 4) outerContext", "unhandled MessageNotUnderstood: MethodContext doesNotUnderstand: #outerContext"},
+	}
+	for _, test := range failures {
+		_, err := executeExpression(t, virtualMachine, test.expression)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Expected %q to fail with %q, got %v", test.expression, test.expected, err)
+		}
+	}
+}
+
+// TestBlockContext tests the context of a block evaluation
+func TestBlockContext(t *testing.T) {
+	virtualMachine := newContextTestVM(t)
+
+	// A block answering self caller, defined in a method with 3 as the receiver
+	method := &pile.Method{Object: pile.Object{TypeField: pile.OBJ_METHOD}}
+	outerContext := vm.NewContext(pile.MethodToObject(method), virtualMachine.NewInteger(3), []*pile.Object{}, nil)
+	block := pile.ObjectToBlock(virtualMachine.NewBlock(outerContext))
+	block.SetBytecodes([]byte{bytecode.PUSH_SELF, bytecode.SEND_MESSAGE, 0, 0, bytecode.RETURN_STACK_TOP})
+	block.AddLiteral(pile.NewSymbol("caller"))
+
+	context := virtualMachine.ExecuteBlock(pile.BlockToObject(block), []*pile.Object{})
+	if virtualMachine.GetClass(context).Name != "BlockContext" {
+		t.Fatalf("Expected a BlockContext, got %v", context)
+	}
+	if outer := virtualMachine.Send(context, pile.NewSymbol("outerContext"), nil); outer != vm.ContextToObject(outerContext) {
+		t.Errorf("Expected the defining context as the outer context, got %v", outer)
+	}
+	if receiver := virtualMachine.Send(context, pile.NewSymbol("receiver"), nil); receiver != virtualMachine.NewInteger(3) {
+		t.Errorf("Expected the receiver 3, got %v", receiver)
+	}
+
+	// Nothing evaluated the block from Smalltalk, so it has no sender
+	if sender := virtualMachine.Send(context, pile.NewSymbol("sender"), nil); sender != virtualMachine.NilObject {
+		t.Errorf("Expected no sender, got %v", sender)
+	}
+}
+
+// TestThisContext tests thisContext in methods and blocks, and the context
+// that signalled an exception
+func TestThisContext(t *testing.T) {
+	virtualMachine := newContextTestVM(t)
+
+	context, err := executeExpression(t, virtualMachine, "thisContext")
+	if err != nil || virtualMachine.GetClass(context.(*pile.Object)).Name != "MethodContext" {
+		t.Fatalf("Expected the expression's MethodContext, got %v (%v)", context, err)
+	}
+
+	tests := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		{"thisContext receiver", virtualMachine.NilObject},
+		{"thisContext sender", virtualMachine.NilObject},
+		{"3 caller receiver", virtualMachine.NilObject},
+		{"[:x | thisContext tempAt: 1] value: 7", virtualMachine.NewInteger(7)},
+		{"[thisContext outerContext receiver] value", virtualMachine.NilObject},
+		{"[3 fail] on: Error do: [:e | e signalerContext receiver]", virtualMachine.NewInteger(3)},
+		{"Error new signalerContext", virtualMachine.NilObject},
+		{"[3 divide] on: ZeroDivide do: [:e | e signalerContext receiver]", virtualMachine.NewInteger(3)},
+		{"[3 unknown] on: MessageNotUnderstood do: [:e | e signalerContext receiver]", virtualMachine.NewInteger(3)},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	// A block's context is a BlockContext, and the method that signalled is fail
+	if result, err := executeExpression(t, virtualMachine, "[thisContext] value"); err != nil || virtualMachine.GetClass(result.(*pile.Object)).Name != "BlockContext" {
+		t.Errorf("Expected a BlockContext, got %v (%v)", result, err)
+	}
+	result, err := executeExpression(t, virtualMachine, "[3 fail] on: Error do: [:e | e signalerContext method selector]")
+	if err != nil || pile.GetSymbolValue(result.(*pile.Object)) != "fail" {
+		t.Errorf("Expected the signaler to be running fail, got %v (%v)", result, err)
+	}
+	result, err = executeExpression(t, virtualMachine, "[3 divide] on: ZeroDivide do: [:e | e signalerContext method selector]")
+	if err != nil || pile.GetSymbolValue(result.(*pile.Object)) != "divide" {
+		t.Errorf("Expected the signaler to be running divide, got %v (%v)", result, err)
+	}
+}
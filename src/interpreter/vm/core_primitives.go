@@ -0,0 +1,514 @@
+package vm
+
+import (
+	"math/big"
+
+	"smalltalklsp/interpreter/pile"
+)
+
+// corePrimitives returns a table with the VM's own primitives, registered by number without a module
+// It initializes defaultPrimitives rather than running from init, since
+// DefaultVM is created before init functions run.
+func corePrimitives() *PrimitiveTable {
+	table := NewPrimitiveTable()
+	for _, primitive := range []Primitive{
+		{Index: 1, Name: "integerAdd", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerAdd},
+		{Index: 2, Name: "integerMultiply", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerMultiply},
+		{Index: 3, Name: "integerEqual", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerEqual},
+		{Index: 4, Name: "integerSubtract", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerSubtract},
+		{Index: 5, Name: "basicClass", Arity: 0, Function: (*VM).primitiveBasicClass},
+		{Index: 6, Name: "integerLessThan", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerLessThan},
+		{Index: 7, Name: "integerGreaterThan", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerGreaterThan},
+		{Index: 8, Name: "integerAsFloat", Arity: 0, Receiver: "Integer", Function: (*VM).primitiveIntegerAsFloat},
+		{Index: 10, Name: "floatAdd", Arity: 1, Receiver: "Float", Function: (*VM).primitiveFloatAdd},
+		{Index: 11, Name: "floatSubtract", Arity: 1, Receiver: "Float", Function: (*VM).primitiveFloatSubtract},
+		{Index: 12, Name: "floatMultiply", Arity: 1, Receiver: "Float", Function: (*VM).primitiveFloatMultiply},
+		{Index: 13, Name: "floatDivide", Arity: 1, Receiver: "Float", Function: (*VM).primitiveFloatDivide},
+		{Index: 14, Name: "floatEqual", Arity: 1, Receiver: "Float", Function: (*VM).primitiveFloatEqual},
+		{Index: 15, Name: "floatLessThan", Arity: 1, Receiver: "Float", Function: (*VM).primitiveFloatLessThan},
+		{Index: 16, Name: "floatGreaterThan", Arity: 1, Receiver: "Float", Function: (*VM).primitiveFloatGreaterThan},
+		{Index: 20, Name: "blockNew", Arity: 0, Receiver: "Block", Function: (*VM).primitiveBlockNew},
+		{Index: 21, Name: "blockValue", Arity: 0, Receiver: "Block", Function: (*VM).primitiveBlockValue},
+		{Index: 22, Name: "blockValueWith", Arity: 1, Receiver: "Block", Function: (*VM).primitiveBlockValueWith},
+		{Index: 30, Name: "stringSize", Arity: 0, Receiver: "String", Function: (*VM).primitiveStringSize},
+		{Index: 40, Name: "arrayAt", Arity: 1, Receiver: "Array", Function: (*VM).primitiveArrayAt},
+		{Index: 50, Name: "byteArrayAt", Arity: 1, Receiver: "ByteArray", Function: (*VM).primitiveByteArrayAt},
+		{Index: 51, Name: "byteArrayAtPut", Arity: 2, Receiver: "ByteArray", Function: (*VM).primitiveByteArrayAtPut},
+		{Index: 60, Name: "basicNew", Arity: 0, Function: (*VM).primitiveBasicNew},
+		{Index: 61, Name: "metaclassInstanceVariableNames", Arity: 1, Receiver: "Metaclass", Function: (*VM).primitiveMetaclassInstanceVariableNames},
+		{Index: 62, Name: "behaviorSuperclass", Arity: 0, Receiver: "Behavior", Function: (*VM).primitiveBehaviorSuperclass},
+		{Index: 63, Name: "behaviorName", Arity: 0, Receiver: "Behavior", Function: (*VM).primitiveBehaviorName},
+		{Index: 64, Name: "metaclassSoleInstance", Arity: 0, Receiver: "Metaclass", Function: (*VM).primitiveMetaclassSoleInstance},
+		{Index: 70, Name: "compile", Arity: 1, Function: (*VM).primitiveCompile},
+		{Index: 71, Name: "compileClassified", Arity: 2, Function: (*VM).primitiveCompileClassified},
+		{Index: 72, Name: "evaluate", Arity: 1, Receiver: "Compiler class", Function: (*VM).primitiveEvaluate},
+		{Index: 80, Name: "doesNotUnderstand", Arity: 1, Function: (*VM).primitiveDoesNotUnderstand},
+		{Index: 81, Name: "exceptionMessageText", Arity: 0, Receiver: "Exception", Function: (*VM).primitiveExceptionMessageText},
+		{Index: 82, Name: "performWith", Arity: 2, Function: (*VM).primitivePerformWith},
+		{Index: 83, Name: "notANumber", Arity: 2, Function: (*VM).primitiveNotANumber},
+		{Index: 90, Name: "contextSender", Arity: 0, Receiver: "ContextPart", Function: (*VM).primitiveContextSender},
+		{Index: 91, Name: "contextMethod", Arity: 0, Receiver: "ContextPart", Function: (*VM).primitiveContextMethod},
+		{Index: 92, Name: "contextReceiver", Arity: 0, Receiver: "ContextPart", Function: (*VM).primitiveContextReceiver},
+		{Index: 93, Name: "contextPC", Arity: 0, Receiver: "ContextPart", Function: (*VM).primitiveContextPC},
+		{Index: 94, Name: "contextPCPut", Arity: 1, Receiver: "ContextPart", Function: (*VM).primitiveContextPCPut},
+		{Index: 95, Name: "contextTempAt", Arity: 1, Receiver: "ContextPart", Function: (*VM).primitiveContextTempAt},
+		{Index: 96, Name: "contextTempAtPut", Arity: 2, Receiver: "ContextPart", Function: (*VM).primitiveContextTempAtPut},
+		{Index: 97, Name: "contextSize", Arity: 0, Receiver: "ContextPart", Function: (*VM).primitiveContextSize},
+		{Index: 98, Name: "contextOuterContext", Arity: 0, Receiver: "BlockContext", Function: (*VM).primitiveContextOuterContext},
+		{Index: 100, Name: "integerQuotient", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerQuotient},
+		{Index: 101, Name: "integerModulo", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerModulo},
+		{Index: 102, Name: "integerQuo", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerQuo},
+		{Index: 103, Name: "integerRem", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerRem},
+		{Index: 104, Name: "integerLessOrEqual", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerLessOrEqual},
+		{Index: 105, Name: "integerGreaterOrEqual", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerGreaterOrEqual},
+		{Index: 106, Name: "integerBitAnd", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerBitAnd},
+		{Index: 107, Name: "integerBitOr", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerBitOr},
+		{Index: 108, Name: "integerBitXor", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerBitXor},
+		{Index: 109, Name: "integerBitShift", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerBitShift},
+		{Index: 110, Name: "integerPrintString", Arity: 0, Receiver: "Integer", Function: (*VM).primitiveIntegerPrintString},
+		{Index: 111, Name: "integerPrintStringBase", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerPrintStringBase},
+		{Index: 112, Name: "integerDivide", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerDivide},
+		{Index: 113, Name: "integerGcd", Arity: 1, Receiver: "Integer", Function: (*VM).primitiveIntegerGcd},
+		{Index: 114, Name: "numberSign", Arity: 0, Receiver: "Number", Function: (*VM).primitiveNumberSign},
+		{Index: 115, Name: "numberAsScaledDecimal", Arity: 1, Receiver: "Number", Function: (*VM).primitiveNumberAsScaledDecimal},
+		{Index: 120, Name: "fractionAdd", Arity: 1, Receiver: "Fraction", Function: (*VM).primitiveFractionAdd},
+		{Index: 121, Name: "fractionSubtract", Arity: 1, Receiver: "Fraction", Function: (*VM).primitiveFractionSubtract},
+		{Index: 122, Name: "fractionMultiply", Arity: 1, Receiver: "Fraction", Function: (*VM).primitiveFractionMultiply},
+		{Index: 123, Name: "fractionDivide", Arity: 1, Receiver: "Fraction", Function: (*VM).primitiveFractionDivide},
+		{Index: 124, Name: "fractionEqual", Arity: 1, Receiver: "Fraction", Function: (*VM).primitiveFractionEqual},
+		{Index: 125, Name: "fractionLessThan", Arity: 1, Receiver: "Fraction", Function: (*VM).primitiveFractionLessThan},
+		{Index: 126, Name: "fractionGreaterThan", Arity: 1, Receiver: "Fraction", Function: (*VM).primitiveFractionGreaterThan},
+		{Index: 127, Name: "fractionAsFloat", Arity: 0, Receiver: "Fraction", Function: (*VM).primitiveFractionAsFloat},
+		{Index: 128, Name: "fractionPrintString", Arity: 0, Receiver: "Fraction", Function: (*VM).primitiveFractionPrintString},
+		{Index: 129, Name: "fractionNumeratorDenominator", Arity: 2, Receiver: "Fraction class", Function: (*VM).primitiveFractionNumeratorDenominator},
+		{Index: 130, Name: "scaledDecimalAdd", Arity: 1, Receiver: "ScaledDecimal", Function: (*VM).primitiveScaledDecimalAdd},
+		{Index: 131, Name: "scaledDecimalSubtract", Arity: 1, Receiver: "ScaledDecimal", Function: (*VM).primitiveScaledDecimalSubtract},
+		{Index: 132, Name: "scaledDecimalMultiply", Arity: 1, Receiver: "ScaledDecimal", Function: (*VM).primitiveScaledDecimalMultiply},
+		{Index: 133, Name: "scaledDecimalDivide", Arity: 1, Receiver: "ScaledDecimal", Function: (*VM).primitiveScaledDecimalDivide},
+		{Index: 134, Name: "scaledDecimalEqual", Arity: 1, Receiver: "ScaledDecimal", Function: (*VM).primitiveScaledDecimalEqual},
+		{Index: 135, Name: "scaledDecimalLessThan", Arity: 1, Receiver: "ScaledDecimal", Function: (*VM).primitiveScaledDecimalLessThan},
+		{Index: 136, Name: "scaledDecimalGreaterThan", Arity: 1, Receiver: "ScaledDecimal", Function: (*VM).primitiveScaledDecimalGreaterThan},
+		{Index: 137, Name: "scaledDecimalAsFloat", Arity: 0, Receiver: "ScaledDecimal", Function: (*VM).primitiveScaledDecimalAsFloat},
+		{Index: 138, Name: "scaledDecimalPrintString", Arity: 0, Receiver: "ScaledDecimal", Function: (*VM).primitiveScaledDecimalPrintString},
+		{Index: 140, Name: "floatSqrt", Arity: 0, Receiver: "Float", Function: (*VM).primitiveFloatSqrt},
+		{Index: 141, Name: "floatLn", Arity: 0, Receiver: "Float", Function: (*VM).primitiveFloatLn},
+		{Index: 142, Name: "floatExp", Arity: 0, Receiver: "Float", Function: (*VM).primitiveFloatExp},
+		{Index: 143, Name: "floatSin", Arity: 0, Receiver: "Float", Function: (*VM).primitiveFloatSin},
+		{Index: 144, Name: "floatCos", Arity: 0, Receiver: "Float", Function: (*VM).primitiveFloatCos},
+		{Index: 145, Name: "floatTan", Arity: 0, Receiver: "Float", Function: (*VM).primitiveFloatTan},
+		{Index: 146, Name: "floatArcSin", Arity: 0, Receiver: "Float", Function: (*VM).primitiveFloatArcSin},
+		{Index: 147, Name: "floatArcCos", Arity: 0, Receiver: "Float", Function: (*VM).primitiveFloatArcCos},
+		{Index: 148, Name: "floatArcTan", Arity: 0, Receiver: "Float", Function: (*VM).primitiveFloatArcTan},
+		{Index: 149, Name: "floatIsNaN", Arity: 0, Receiver: "Float", Function: (*VM).primitiveFloatIsNaN},
+		{Index: 150, Name: "floatIsInfinite", Arity: 0, Receiver: "Float", Function: (*VM).primitiveFloatIsInfinite},
+		{Index: 151, Name: "floatPrintString", Arity: 0, Receiver: "Float", Function: (*VM).primitiveFloatPrintString},
+		{Index: 152, Name: "numberTruncated", Arity: 0, Receiver: "Number", Function: (*VM).primitiveNumberTruncated},
+		{Index: 153, Name: "numberFloor", Arity: 0, Receiver: "Number", Function: (*VM).primitiveNumberFloor},
+		{Index: 154, Name: "numberCeiling", Arity: 0, Receiver: "Number", Function: (*VM).primitiveNumberCeiling},
+		{Index: 155, Name: "numberRounded", Arity: 0, Receiver: "Number", Function: (*VM).primitiveNumberRounded},
+		{Index: 156, Name: "numberRaisedTo", Arity: 1, Receiver: "Number", Function: (*VM).primitiveNumberRaisedTo},
+		{Index: 157, Name: "numberReadFrom", Arity: 1, Receiver: "Number class", Function: (*VM).primitiveNumberReadFrom},
+		{Index: 160, Name: "exceptionSignal", Arity: 0, Receiver: "Exception", Function: (*VM).primitiveExceptionSignal},
+		{Index: 161, Name: "exceptionMessageTextPut", Arity: 1, Receiver: "Exception", Function: (*VM).primitiveExceptionMessageTextPut},
+		{Index: 162, Name: "exceptionDefaultAction", Arity: 0, Receiver: "Exception", Function: (*VM).primitiveExceptionDefaultAction},
+		{Index: 163, Name: "exceptionReturn", Arity: 1, Receiver: "Exception", Function: (*VM).primitiveExceptionReturn},
+		{Index: 164, Name: "exceptionRetry", Arity: 0, Receiver: "Exception", Function: (*VM).primitiveExceptionRetry},
+		{Index: 165, Name: "exceptionResume", Arity: 1, Receiver: "Exception", Function: (*VM).primitiveExceptionResume},
+		{Index: 166, Name: "exceptionPass", Arity: 0, Receiver: "Exception", Function: (*VM).primitiveExceptionPass},
+		{Index: 167, Name: "exceptionOuter", Arity: 0, Receiver: "Exception", Function: (*VM).primitiveExceptionOuter},
+		{Index: 168, Name: "blockEnsure", Arity: 1, Receiver: "Block", Function: (*VM).primitiveBlockEnsure},
+		{Index: 169, Name: "blockIfCurtailed", Arity: 1, Receiver: "Block", Function: (*VM).primitiveBlockIfCurtailed},
+		{Index: 170, Name: "isKindOf", Arity: 1, Function: (*VM).primitiveIsKindOf},
+		{Index: 171, Name: "halt", Arity: 0, Function: (*VM).primitiveHalt},
+		{Index: 172, Name: "methodSelector", Arity: 0, Receiver: "CompiledMethod", Function: (*VM).primitiveMethodSelector},
+		{Index: 173, Name: "methodClass", Arity: 0, Receiver: "CompiledMethod", Function: (*VM).primitiveMethodClass},
+		{Index: 174, Name: "exceptionSignalerContext", Arity: 0, Receiver: "Exception", Function: (*VM).primitiveExceptionSignalerContext},
+		{Index: 175, Name: "primitiveFailed", Arity: 0, Function: (*VM).primitivePrimitiveFailed},
+		{Index: 180, Name: "blockNewProcess", Arity: 0, Receiver: "Block", Function: (*VM).primitiveBlockNewProcess},
+		{Index: 181, Name: "processResume", Arity: 0, Receiver: "Process", Function: (*VM).primitiveProcessResume},
+		{Index: 182, Name: "processSuspend", Arity: 0, Receiver: "Process", Function: (*VM).primitiveProcessSuspend},
+		{Index: 183, Name: "processTerminate", Arity: 0, Receiver: "Process", Function: (*VM).primitiveProcessTerminate},
+		{Index: 184, Name: "processPriority", Arity: 0, Receiver: "Process", Function: (*VM).primitiveProcessPriority},
+		{Index: 185, Name: "processPriorityPut", Arity: 1, Receiver: "Process", Function: (*VM).primitiveProcessPriorityPut},
+		{Index: 186, Name: "processIsTerminated", Arity: 0, Receiver: "Process", Function: (*VM).primitiveProcessIsTerminated},
+		{Index: 187, Name: "processorYield", Arity: 0, Receiver: "ProcessorScheduler", Function: (*VM).primitiveProcessorYield},
+		{Index: 188, Name: "processorActiveProcess", Arity: 0, Receiver: "ProcessorScheduler", Function: (*VM).primitiveProcessorActiveProcess},
+		{Index: 189, Name: "semaphoreSignal", Arity: 0, Receiver: "Semaphore", Function: (*VM).primitiveSemaphoreSignal},
+		{Index: 190, Name: "semaphoreWait", Arity: 0, Receiver: "Semaphore", Function: (*VM).primitiveSemaphoreWait},
+		{Index: 191, Name: "sharedQueueNextPut", Arity: 1, Receiver: "SharedQueue", Function: (*VM).primitiveSharedQueueNextPut},
+		{Index: 192, Name: "sharedQueueNext", Arity: 0, Receiver: "SharedQueue", Function: (*VM).primitiveSharedQueueNext},
+		{Index: 193, Name: "sharedQueueSize", Arity: 0, Receiver: "SharedQueue", Function: (*VM).primitiveSharedQueueSize},
+		{Index: 194, Name: "delayForMilliseconds", Arity: 1, Receiver: "Delay class", Function: (*VM).primitiveDelayForMilliseconds},
+		{Index: 195, Name: "delayWait", Arity: 0, Receiver: "Delay", Function: (*VM).primitiveDelayWait},
+		{Index: 196, Name: "semaphoreCritical", Arity: 1, Receiver: "Semaphore", Function: (*VM).primitiveSemaphoreCritical},
+		{Index: 199, Name: "blockOnDo", Arity: 2, Receiver: "Block", Function: (*VM).primitiveBlockOnDo},
+	} {
+		if err := table.Register(primitive); err != nil {
+			panic(err)
+		}
+	}
+	return table
+}
+
+// primitiveIntegerAdd adds two integers, or an integer and a float
+func (vm *VM) primitiveIntegerAdd(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	// Handle immediate integers, the sum of two always fits in an int64
+	if val1, val2, ok := immediateOperands(receiver, args); ok {
+		return vm.NewInteger(val1 + val2)
+	}
+	checkImmediateIntegers(receiver, args)
+	if val1, val2, ok := integerOperands(receiver, args); ok {
+		return vm.NewLargeInteger(new(big.Int).Add(val1, val2))
+	}
+	// Handle integer + float
+	if val2, ok := floatValue(args[0]); ok && pile.IsIntegerImmediate(receiver) {
+		return vm.NewFloat(float64(pile.GetIntegerImmediate(receiver)) + val2)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveIntegerMultiply multiplies two integers
+func (vm *VM) primitiveIntegerMultiply(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	// The product of two immediate integers may not fit in an int64, dividing it back checks
+	if val1, val2, ok := immediateOperands(receiver, args); ok {
+		if product := val1 * val2; val1 == 0 || product/val1 == val2 {
+			return vm.NewInteger(product)
+		}
+	}
+	checkImmediateIntegers(receiver, args)
+	if val1, val2, ok := integerOperands(receiver, args); ok {
+		return vm.NewLargeInteger(new(big.Int).Mul(val1, val2))
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveIntegerEqual compares two integers
+func (vm *VM) primitiveIntegerEqual(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := immediateOperands(receiver, args); ok {
+		return pile.NewBoolean(val1 == val2).(*pile.Object)
+	}
+	checkImmediateIntegers(receiver, args)
+	if val1, val2, ok := integerOperands(receiver, args); ok {
+		return pile.NewBoolean(val1.Cmp(val2) == 0).(*pile.Object)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveIntegerSubtract subtracts two integers
+func (vm *VM) primitiveIntegerSubtract(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := immediateOperands(receiver, args); ok {
+		return vm.NewInteger(val1 - val2)
+	}
+	checkImmediateIntegers(receiver, args)
+	if val1, val2, ok := integerOperands(receiver, args); ok {
+		return vm.NewLargeInteger(new(big.Int).Sub(val1, val2))
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveIntegerLessThan compares two integers
+func (vm *VM) primitiveIntegerLessThan(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := immediateOperands(receiver, args); ok {
+		return pile.NewBoolean(val1 < val2).(*pile.Object)
+	}
+	checkImmediateIntegers(receiver, args)
+	if val1, val2, ok := integerOperands(receiver, args); ok {
+		return pile.NewBoolean(val1.Cmp(val2) < 0).(*pile.Object)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveIntegerGreaterThan compares two integers
+func (vm *VM) primitiveIntegerGreaterThan(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := immediateOperands(receiver, args); ok {
+		return pile.NewBoolean(val1 > val2).(*pile.Object)
+	}
+	checkImmediateIntegers(receiver, args)
+	if val1, val2, ok := integerOperands(receiver, args); ok {
+		return pile.NewBoolean(val1.Cmp(val2) > 0).(*pile.Object)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// checkImmediateIntegers panics if the receiver or the argument of an integer
+// primitive is an OBJ_INTEGER that is not immediate, which the VM never creates
+// Integers outside the immediate range are OBJ_LARGE_INTEGERs. ExecutePrimitive
+// signals the panic as a PrimitiveFailed.
+func checkImmediateIntegers(receiver *pile.Object, args []*pile.Object) {
+	if (!pile.IsImmediate(receiver) && receiver.Type() == pile.OBJ_INTEGER) ||
+		(!pile.IsImmediate(args[0]) && args[0].Type() == pile.OBJ_INTEGER) {
+		panic("Non-immediate integer encountered")
+	}
+}
+
+// primitiveBasicClass returns the class of the receiver
+func (vm *VM) primitiveBasicClass(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return pile.ClassToObject(vm.GetClass(receiver))
+}
+
+// floatValue returns the value of an immediate or boxed float, or false if the
+// object is not a float
+func floatValue(obj *pile.Object) (float64, bool) {
+	if pile.IsFloatImmediate(obj) {
+		return pile.GetFloatImmediate(obj), true
+	}
+	if pile.IsBoxedFloat(obj) {
+		return pile.ObjectToBoxedFloat(obj).Value, true
+	}
+	return 0, false
+}
+
+// floatOperands returns the float values of the receiver and the argument of a
+// float primitive, which may be a float or an integer
+func floatOperands(receiver *pile.Object, args []*pile.Object) (float64, float64, bool) {
+	val1, ok := floatValue(receiver)
+	if !ok {
+		return 0, 0, false
+	}
+	if val2, ok := floatValue(args[0]); ok {
+		return val1, val2, true
+	}
+	if pile.IsIntegerImmediate(args[0]) {
+		return val1, float64(pile.GetIntegerImmediate(args[0])), true
+	}
+	return 0, 0, false
+}
+
+// primitiveFloatAdd adds a float or an integer to a float
+func (vm *VM) primitiveFloatAdd(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := floatOperands(receiver, args); ok {
+		return vm.NewFloat(val1 + val2)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveFloatSubtract subtracts a float or an integer from a float
+func (vm *VM) primitiveFloatSubtract(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := floatOperands(receiver, args); ok {
+		return vm.NewFloat(val1 - val2)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveFloatMultiply multiplies a float by a float or an integer
+func (vm *VM) primitiveFloatMultiply(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := floatOperands(receiver, args); ok {
+		return vm.NewFloat(val1 * val2)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveFloatDivide divides a float by a float or an integer, signalling ZeroDivide for zero
+func (vm *VM) primitiveFloatDivide(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := floatOperands(receiver, args); ok {
+		if val2 == 0 {
+			return vm.signalZeroDivide(receiver, "/")
+		}
+		return vm.NewFloat(val1 / val2)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveFloatEqual compares a float with a float or an integer
+func (vm *VM) primitiveFloatEqual(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := floatOperands(receiver, args); ok {
+		return pile.NewBoolean(val1 == val2).(*pile.Object)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveFloatLessThan compares a float with a float or an integer
+func (vm *VM) primitiveFloatLessThan(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := floatOperands(receiver, args); ok {
+		return pile.NewBoolean(val1 < val2).(*pile.Object)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveFloatGreaterThan compares a float with a float or an integer
+func (vm *VM) primitiveFloatGreaterThan(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := floatOperands(receiver, args); ok {
+		return pile.NewBoolean(val1 > val2).(*pile.Object)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveBlockNew creates a new block instance
+func (vm *VM) primitiveBlockNew(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if receiver.Type() == pile.OBJ_CLASS && receiver == vm.Globals["Block"] {
+		return vm.NewBlock(vm.Executor.CurrentContext)
+	}
+	return nil
+}
+
+// primitiveBlockValue executes a block with no arguments
+func (vm *VM) primitiveBlockValue(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if receiver.Type() == pile.OBJ_BLOCK {
+		return vm.ExecuteBlock(receiver, args)
+	}
+	return nil
+}
+
+// primitiveBlockValueWith executes a block with one argument
+func (vm *VM) primitiveBlockValueWith(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if receiver.Type() == pile.OBJ_BLOCK {
+		return vm.ExecuteBlock(receiver, args)
+	}
+	return nil
+}
+
+// primitiveStringSize returns the length of a string
+func (vm *VM) primitiveStringSize(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if receiver.Type() == pile.OBJ_STRING {
+		return vm.NewInteger(int64(pile.ObjectToString(receiver).Length()))
+	}
+	return nil
+}
+
+// primitiveArrayAt returns the element at a 1-based index
+func (vm *VM) primitiveArrayAt(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if receiver.Type() == pile.OBJ_ARRAY && pile.IsIntegerImmediate(args[0]) {
+		array := pile.ObjectToArray(receiver)
+
+		// Get the index (1-based in Smalltalk, 0-based in Go)
+		index := pile.GetIntegerImmediate(args[0]) - 1
+		if index < 0 || int(index) >= array.Size() {
+			return vm.signalSubscriptOutOfBounds(receiver, "at:", args)
+		}
+
+		return array.At(int(index))
+	}
+	return nil
+}
+
+// primitiveByteArrayAt returns the byte at a 1-based index as an integer
+func (vm *VM) primitiveByteArrayAt(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if receiver.Type() == pile.OBJ_BYTE_ARRAY && pile.IsIntegerImmediate(args[0]) {
+		byteArray := pile.ObjectToByteArray(receiver)
+
+		// Get the index (1-based in Smalltalk, 0-based in Go)
+		index := pile.GetIntegerImmediate(args[0]) - 1
+		if index < 0 || int(index) >= byteArray.Size() {
+			return vm.signalSubscriptOutOfBounds(receiver, "at:", args)
+		}
+
+		return vm.NewInteger(int64(byteArray.At(int(index))))
+	}
+	return nil
+}
+
+// primitiveByteArrayAtPut sets the byte at a 1-based index and returns the value
+func (vm *VM) primitiveByteArrayAtPut(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if receiver.Type() == pile.OBJ_BYTE_ARRAY && pile.IsIntegerImmediate(args[0]) && pile.IsIntegerImmediate(args[1]) {
+		byteArray := pile.ObjectToByteArray(receiver)
+
+		// Get the index (1-based in Smalltalk, 0-based in Go)
+		index := pile.GetIntegerImmediate(args[0]) - 1
+		value := pile.GetIntegerImmediate(args[1])
+		if index < 0 || int(index) >= byteArray.Size() {
+			return vm.signalSubscriptOutOfBounds(receiver, "at:put:", args)
+		}
+		if value < 0 || value > 255 {
+			return vm.signalImproperStore(receiver, "at:put:", args, "not a byte")
+		}
+
+		byteArray.AtPut(int(index), byte(value))
+		return args[1]
+	}
+	return nil
+}
+
+// primitiveBasicNew creates a new instance of the receiver class
+// A metaclass has its class as its only instance, so it cannot make another,
+// and processes only come from blocks.
+func (vm *VM) primitiveBasicNew(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if isClass(receiver) && !pile.IsMetaclass(pile.ObjectToClass(receiver)) {
+		class := pile.ObjectToClass(receiver)
+		vm.allocated()
+		switch {
+		case inheritsFrom(class, "Process"):
+			return vm.FailPrimitive(PrimitiveBadReceiver)
+		case inheritsFrom(class, "Semaphore"):
+			return vm.newSemaphore(receiver)
+		case inheritsFrom(class, "SharedQueue"):
+			return vm.newSharedQueue(receiver)
+		}
+		instance := pile.NewInstance(class)
+
+		// Exceptions keep their description and handler outside their instance variables
+		if inheritsFrom(class, "Exception") {
+			exception := pile.NewException(receiver)
+			exception.InstanceVarsField = instance.InstanceVarsField
+			instance = exception
+		}
+
+		// We need to explicitly set the class of the instance
+		instance.SetClass(receiver)
+		return instance
+	}
+	return vm.FailPrimitive(PrimitiveBadReceiver)
+}
+
+// primitiveCompile compiles a method and installs it in the receiver
+func (vm *VM) primitiveCompile(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if isClass(receiver) && isString(args[0]) {
+		return vm.CompileMethod(receiver, pile.ObjectToString(args[0]).GetValue(), "")
+	}
+	return nil
+}
+
+// primitiveCompileClassified compiles a method and installs it in the receiver under a category
+func (vm *VM) primitiveCompileClassified(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if isClass(receiver) && isString(args[0]) && isString(args[1]) {
+		return vm.CompileMethod(receiver, pile.ObjectToString(args[0]).GetValue(), pile.ObjectToString(args[1]).GetValue())
+	}
+	return nil
+}
+
+// primitiveEvaluate compiles and runs an expression
+func (vm *VM) primitiveEvaluate(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if isString(args[0]) {
+		result, err := vm.Evaluate(pile.ObjectToString(args[0]).GetValue())
+		if err != nil {
+			// Carry on unwinding the evaluation that sent evaluate:
+			panic(err)
+		}
+		return result
+	}
+	return nil
+}
+
+// primitiveMethodSelector answers the selector of a method
+func (vm *VM) primitiveMethodSelector(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	method := pile.ObjectToMethod(receiver)
+	if method == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return method.GetSelector()
+}
+
+// primitiveMethodClass answers the class a method is installed in
+func (vm *VM) primitiveMethodClass(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	method := pile.ObjectToMethod(receiver)
+	if method == nil || method.GetMethodClass() == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return pile.ClassToObject(method.GetMethodClass())
+}
+
+// primitiveDoesNotUnderstand signals MessageNotUnderstood
+// It answers the value of the handler, if there is one
+func (vm *VM) primitiveDoesNotUnderstand(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if !pile.IsImmediate(args[0]) && args[0].Class() == vm.Globals["Message"] {
+		return vm.Signal(vm.NewMessageNotUnderstood(receiver, args[0]))
+	}
+	return nil
+}
+
+// primitiveExceptionMessageText returns the description of an exception
+func (vm *VM) primitiveExceptionMessageText(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if !pile.IsImmediate(receiver) && receiver.Type() == pile.OBJ_EXCEPTION {
+		return pile.ObjectToException(receiver).GetMessageText()
+	}
+	return nil
+}
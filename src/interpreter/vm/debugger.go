@@ -0,0 +1,459 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"smalltalklsp/interpreter/bytecode"
+	"smalltalklsp/interpreter/parser"
+	"smalltalklsp/interpreter/pile"
+)
+
+// Debugger pauses the VM at breakpoints, at halt and after steps, see AttachDebugger
+// Pausing calls Handler on the goroutine running the Smalltalk code, before the
+// next bytecode runs, and the Action it answers says how to carry on. While
+// the handler runs it can inspect the paused contexts, evaluate expressions in
+// them with EvaluateIn and edit methods with CompileMethod, nothing pauses again
+// until it returns.
+type Debugger struct {
+	// Handler is called with each pause and answers how to carry on
+	Handler func(*Pause) Action
+
+	vm          *VM
+	breakpoints []*Breakpoint
+	step        *stepping
+
+	// pausing is true while Handler or an evaluation it started is running
+	pausing bool
+}
+
+// Breakpoint pauses the contexts running a method, as they start or as they
+// reach a line
+type Breakpoint struct {
+	// Class and Selector are the method, Class is the class that defines it
+	Class    *pile.Class
+	Selector string
+
+	// Line is the 1-based source line it pauses at, 0 for the start of the method
+	Line int
+
+	// Hits is the number of times it paused
+	Hits int
+}
+
+// PauseReason is why the debugger paused
+type PauseReason int
+
+const (
+	// PausedAtBreakpoint is a context reaching a breakpoint
+	PausedAtBreakpoint PauseReason = iota
+
+	// PausedAtHalt is a context sending halt
+	PausedAtHalt
+
+	// PausedAfterStep is a step finishing
+	PausedAfterStep
+)
+
+// Pause is the VM paused in a context
+type Pause struct {
+	Reason PauseReason
+
+	// Breakpoint is the breakpoint it paused at, nil unless Reason is PausedAtBreakpoint
+	Breakpoint *Breakpoint
+
+	// Context is the innermost context, about to run the bytecode at its PC, or
+	// for a halt the context that sent it
+	Context *Context
+
+	vm *VM
+}
+
+// ActionKind is how to carry on after a pause
+type ActionKind int
+
+const (
+	// Continue runs until the next breakpoint or halt
+	Continue ActionKind = iota
+
+	// StepInto pauses at the next bytecode or statement, in whatever context runs it
+	StepInto
+
+	// StepOver pauses at the next bytecode or statement of the frame or its callers,
+	// running the methods and blocks it calls without pausing
+	StepOver
+
+	// StepOut pauses once the frame has returned, in its caller
+	StepOut
+
+	// Return makes the frame return Value straight away and pauses in its caller
+	Return
+
+	// Restart runs the frame again from the start with the same arguments, and
+	// pauses there, running its method as edited since if it is a method context
+	Restart
+)
+
+// Granularity is how far a step goes
+type Granularity int
+
+const (
+	// StepBytecode steps a bytecode at a time
+	StepBytecode Granularity = iota
+
+	// StepStatement steps to the start of a statement
+	StepStatement
+)
+
+// Action is how to carry on after a pause
+type Action struct {
+	Kind        ActionKind
+	Granularity Granularity
+
+	// Frame is the context the action applies to, one of the pause's Frames,
+	// or nil for its Context
+	Frame *Context
+
+	// Value is what Return makes the frame return, nil for nil
+	Value *pile.Object
+}
+
+// ActionError is the error the evaluation returns when the handler answers
+// an Action whose Frame is not one of the pause's Frames
+type ActionError struct {
+	// Action is the action the handler answered
+	Action Action
+
+	// Walkback is the paused contexts
+	Walkback *Walkback
+
+	frame string
+}
+
+// Error describes the frame that was not paused
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("debugger: %s is not one of the paused contexts", e.frame)
+}
+
+// GetWalkback returns the paused contexts
+func (e *ActionError) GetWalkback() *Walkback {
+	return e.Walkback
+}
+
+// stepping is a step that has not finished, relative to the depth and the process of its frame
+type stepping struct {
+	kind        ActionKind
+	granularity Granularity
+	depth       int
+	process     *Process
+}
+
+// AttachDebugger makes the VM pause at breakpoints and halt and call handler
+// with each pause, replacing any debugger attached before
+func (vm *VM) AttachDebugger(handler func(*Pause) Action) *Debugger {
+	vm.debugger = &Debugger{Handler: handler, vm: vm}
+	return vm.debugger
+}
+
+// DetachDebugger stops the VM pausing, halt signals Halt again
+func (vm *VM) DetachDebugger() {
+	vm.debugger = nil
+}
+
+// BreakAt adds a breakpoint at the start of the method class defines for
+// selector, class is a class or a metaclass for a class method
+func (d *Debugger) BreakAt(class *pile.Object, selector string) (*Breakpoint, error) {
+	return d.BreakAtLine(class, selector, 0)
+}
+
+// BreakAtLine adds a breakpoint at a 1-based line of the source of the method
+// class defines for selector, which must have code on that line, 0 for its start
+// It pauses the method and the blocks in it as they reach the line.
+func (d *Debugger) BreakAtLine(class *pile.Object, selector string, line int) (*Breakpoint, error) {
+	classObj := pile.ObjectToClass(class)
+	method := pile.ObjectToMethod(pile.GetClassMethodDictionary(classObj).GetEntry(selector))
+	if method == nil {
+		return nil, fmt.Errorf("%s>>%s is not defined", classObj.Name, selector)
+	}
+	if line != 0 && len(method.GetDebugInfo().PCsForLine(line)) == 0 {
+		return nil, fmt.Errorf("%s>>%s has no code on line %d", classObj.Name, selector, line)
+	}
+
+	breakpoint := &Breakpoint{Class: classObj, Selector: selector, Line: line}
+	d.breakpoints = append(d.breakpoints, breakpoint)
+	return breakpoint, nil
+}
+
+// Breakpoints answers the breakpoints in the order they were added
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	return append([]*Breakpoint(nil), d.breakpoints...)
+}
+
+// RemoveBreakpoint removes a breakpoint
+func (d *Debugger) RemoveBreakpoint(breakpoint *Breakpoint) {
+	for i, each := range d.breakpoints {
+		if each == breakpoint {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return
+		}
+	}
+}
+
+// check pauses before context runs its next bytecode if a step finishes or a breakpoint is reached there
+func (d *Debugger) check(context *Context) {
+	if d.pausing || d.Handler == nil {
+		return
+	}
+	if context.PC >= len(pile.ObjectToMethod(context.Method).GetBytecodes()) {
+		return
+	}
+
+	if d.step != nil && d.step.due(d.vm, context) {
+		d.pause(&Pause{Reason: PausedAfterStep, Context: context, vm: d.vm})
+		return
+	}
+	if breakpoint := d.breakpointAt(context); breakpoint != nil {
+		breakpoint.Hits++
+		d.pause(&Pause{Reason: PausedAtBreakpoint, Breakpoint: breakpoint, Context: context, vm: d.vm})
+	}
+}
+
+// breakpointAt answers the breakpoint context reaches with its next bytecode, or nil
+func (d *Debugger) breakpointAt(context *Context) *Breakpoint {
+	if len(d.breakpoints) == 0 {
+		return nil
+	}
+	home := context
+	for home.block && home.Sender != nil {
+		home = home.Sender
+	}
+	method := pile.ObjectToMethod(home.Method)
+	if method.MethodClass == nil || method.Selector == nil {
+		return nil
+	}
+	selector := pile.GetSymbolValue(method.Selector)
+
+	for _, breakpoint := range d.breakpoints {
+		if breakpoint.Class != method.MethodClass || breakpoint.Selector != selector {
+			continue
+		}
+		if breakpoint.Line == 0 {
+			if context == home && context.PC == 0 {
+				return breakpoint
+			}
+			continue
+		}
+
+		// A line is reached by its first bytecode that follows one on another line
+		debugInfo := context.GetDebugInfo()
+		if debugInfo.LineAt(context.PC) != breakpoint.Line {
+			continue
+		}
+		if context.PC == 0 || context.instructionPC < 0 || debugInfo.LineAt(context.instructionPC) != breakpoint.Line {
+			return breakpoint
+		}
+	}
+	return nil
+}
+
+// due returns true if the step finishes as context is about to run its next bytecode
+func (s *stepping) due(vm *VM, context *Context) bool {
+	if vm.Processor.active != s.process {
+		return false
+	}
+	switch s.kind {
+	case StepOut:
+		return context.depth < s.depth
+	case StepOver:
+		if context.depth > s.depth {
+			return false
+		}
+	}
+	return s.granularity == StepBytecode || context.atStatement()
+}
+
+// atStatement returns true if the next bytecode of the context starts a statement
+func (c *Context) atStatement() bool {
+	return c.PC == 0 || (c.instructionPC >= 0 && c.instruction.Opcode == bytecode.POP)
+}
+
+// pause calls the handler and carries on as it answers
+func (d *Debugger) pause(pause *Pause) {
+	d.step = nil
+	action := d.handle(pause)
+
+	if err := pause.Validate(action); err != nil {
+		panic(err)
+	}
+	frame := action.Frame
+	if frame == nil {
+		frame = pause.Context
+	}
+
+	stepFrom := func(kind ActionKind) {
+		d.step = &stepping{kind: kind, granularity: action.Granularity, depth: frame.depth, process: d.vm.Processor.active}
+	}
+	switch action.Kind {
+	case StepInto, StepOver, StepOut:
+		stepFrom(action.Kind)
+	case Return:
+		value := action.Value
+		if value == nil {
+			value = pile.MakeNilImmediate()
+		}
+		stepFrom(StepOut)
+		panic(&unwind{target: frame, value: value})
+	case Restart:
+		frame.useInstalledMethod()
+		stepFrom(StepInto)
+		panic(&unwind{target: frame, retry: true})
+	}
+}
+
+// handle calls the handler with nothing pausing until it returns
+func (d *Debugger) handle(pause *Pause) Action {
+	d.pausing = true
+	defer func() {
+		d.pausing = false
+	}()
+	return d.Handler(pause)
+}
+
+// primitiveHalt pauses the context that sent halt if a debugger is attached,
+// and signals Halt otherwise, answering the receiver either way
+func (vm *VM) primitiveHalt(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if d := vm.debugger; d != nil && d.Handler != nil && !d.pausing {
+		d.pause(&Pause{Reason: PausedAtHalt, Context: vm.Executor.CurrentContext, vm: vm})
+		return receiver
+	}
+	vm.Signal(vm.newException("Halt"))
+	return receiver
+}
+
+// NewHaltClass creates Halt, the exception halt signals when no debugger is attached
+func (vm *VM) NewHaltClass() *pile.Class {
+	exceptionClass := pile.ObjectToClass(vm.Globals["Exception"])
+	return pile.NewClass("Halt", exceptionClass)
+}
+
+// Frames answers the paused contexts, innermost first, each followed by its caller
+func (p *Pause) Frames() []*Context {
+	var result []*Context
+	for c := p.Context; c != nil; c = c.Caller() {
+		result = append(result, c)
+	}
+	return result
+}
+
+// Validate returns an *ActionError if the action's Frame is not one of the
+// paused contexts, the handler can check an action with it before answering it
+func (p *Pause) Validate(action Action) error {
+	if action.Frame == nil || p.running(action.Frame) {
+		return nil
+	}
+	return &ActionError{Action: action, Walkback: p.vm.walkbackOf(p.Context), frame: p.vm.describeContext(action.Frame)}
+}
+
+// running returns true if frame is one of the paused contexts
+func (p *Pause) running(frame *Context) bool {
+	for c := p.Context; c != nil; c = c.Caller() {
+		if c == frame {
+			return true
+		}
+	}
+	return false
+}
+
+// PC answers the PC of the bytecode a frame is at, the next one for Context
+// and the send waiting for a callee to return for the others
+func (p *Pause) PC(frame *Context) int {
+	if frame == p.Context || frame.instructionPC < 0 {
+		return frame.PC
+	}
+	return frame.instructionPC
+}
+
+// Line answers the 1-based source line a frame is at, or 0 if unknown
+func (p *Pause) Line(frame *Context) int {
+	return frame.GetDebugInfo().LineAt(p.PC(frame))
+}
+
+// Walkback describes the paused contexts like the walkback of an error
+func (p *Pause) Walkback() *Walkback {
+	return p.vm.NewWalkback(p.Context)
+}
+
+// TempNames returns the names of the context's temporaries, its arguments first
+func (c *Context) TempNames() []string {
+	return pile.ObjectToMethod(c.Method).GetTempVarNames()
+}
+
+// StackValues returns the values on the context's stack, the top last
+func (c *Context) StackValues() []*pile.Object {
+	return append([]*pile.Object(nil), c.Stack[:c.StackPointer]...)
+}
+
+// useInstalledMethod makes a method context run the method its class has for
+// its selector now, if that was compiled since the context started
+// Restarting sets the new method's temporaries besides the arguments to nil.
+func (c *Context) useInstalledMethod() {
+	if c.block {
+		return
+	}
+	method := pile.ObjectToMethod(c.Method)
+	if method.MethodClass == nil || method.Selector == nil {
+		return
+	}
+	installed := pile.GetClassMethodDictionary(method.MethodClass).GetEntry(pile.GetSymbolValue(method.Selector))
+	if installed == nil || installed == c.Method {
+		return
+	}
+
+	tempVars := make([]pile.ObjectInterface, len(pile.ObjectToMethod(installed).GetTempVarNames()))
+	copy(tempVars, c.TempVars[:len(c.Arguments)])
+	c.Method = installed
+	c.TempVars = tempVars
+}
+
+// EvaluateIn evaluates source as an expression in a context, with its
+// receiver as self and its temporaries as variables, and answers its value
+// Assignments to the temporaries change them in the context. Errors do not
+// unwind the context, they are returned like errors from ExecuteContext, and
+// nothing pauses while the expression runs.
+func (vm *VM) EvaluateIn(context *Context, source string) (pile.ObjectInterface, error) {
+	names := context.TempNames()
+	methodSource := "doIt"
+	if len(names) > 0 {
+		methodSource += "\n| " + strings.Join(names, " ") + " |"
+	}
+	methodSource += "\n^" + strings.TrimPrefix(strings.TrimSpace(source), "^")
+
+	class := pile.ClassToObject(vm.GetClass(context.GetReceiver()))
+	node, err := parser.NewParser(methodSource, class, vm).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("syntax error: %v", err)
+	}
+	method, err := compileNode(class, node, methodSource)
+	if err != nil {
+		return nil, fmt.Errorf("syntax error: %v", err)
+	}
+
+	// The expression runs as an evaluation of its own, with the context's temporaries
+	evaluation := NewContext(pile.MethodToObject(method), context.Receiver, []*pile.Object{}, nil)
+	copy(evaluation.TempVars, context.TempVars)
+	if d := vm.debugger; d != nil {
+		pausing := d.pausing
+		d.pausing = true
+		defer func() {
+			d.pausing = pausing
+		}()
+	}
+	current := vm.Executor.CurrentContext
+	result, err := vm.ExecuteContext(evaluation)
+	vm.Executor.CurrentContext = current
+	if err != nil {
+		return nil, err
+	}
+	copy(context.TempVars, evaluation.TempVars[:len(names)])
+	return result, nil
+}
@@ -0,0 +1,273 @@
+package vm_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// newDebuggerTestVM creates a VM with DebugTest, whose run method has a block
+// of a few statements over a few lines and whose steps method has a statement
+// on each line
+func newDebuggerTestVM(t *testing.T) *vm.VM {
+	t.Helper()
+	return newTestVM(t, "DebugTest", nil,
+		"double: n ^n + n",
+		"work ^self double: 3",
+		"run ^[:x |\n  self work.\n  x + 1]\n    value: 5",
+		"stop ^self halt",
+		"answer ^41",
+		"steps\n  | a |\n  a := self answer.\n  a := a + 1.\n  ^self double: a",
+	)
+}
+
+// describePause describes where a pause is as the innermost frame's method and line
+func describePause(pause *vm.Pause) string {
+	return fmt.Sprintf("%s:%d", pause.Walkback().Frames[0].Method, pause.Line(pause.Context))
+}
+
+// TestDebuggerBreakpoints tests breakpoints on methods and lines, inspecting
+// the paused contexts and evaluating expressions in them
+func TestDebuggerBreakpoints(t *testing.T) {
+	virtualMachine := newDebuggerTestVM(t)
+	class := virtualMachine.Globals["DebugTest"]
+
+	var pauses []string
+	var evaluated pile.ObjectInterface
+	debugger := virtualMachine.AttachDebugger(func(pause *vm.Pause) vm.Action {
+		pauses = append(pauses, describePause(pause))
+		context := pause.Context
+		switch {
+		case pause.Reason != vm.PausedAtBreakpoint:
+			t.Errorf("Expected to pause at a breakpoint, got %v", pause.Reason)
+		case pause.Breakpoint.Selector == "double:":
+			if names := context.TempNames(); !reflect.DeepEqual(names, []string{"n"}) || context.GetTempVarByIndex(0) != virtualMachine.NewInteger(3) {
+				t.Errorf("Expected n to be 3, got %v %v", names, context.GetTempVars())
+			}
+			if frames := pause.Frames(); len(frames) != 5 || frames[1].GetReceiver() != context.GetReceiver() {
+				t.Errorf("Expected double: to be called from work in the block in run, got %d frames", len(frames))
+			}
+		default:
+			var err error
+			if evaluated, err = virtualMachine.EvaluateIn(context, "x * 2"); err != nil {
+				t.Errorf("Error evaluating: %v", err)
+			}
+			if _, err := virtualMachine.EvaluateIn(context, "x := 7"); err != nil {
+				t.Errorf("Error assigning: %v", err)
+			}
+			if _, err := virtualMachine.EvaluateIn(context, "x foo"); err == nil {
+				t.Errorf("Expected evaluating x foo to fail")
+			}
+		}
+		return vm.Action{Kind: vm.Continue}
+	})
+
+	doubleBreakpoint, err := debugger.BreakAt(class, "double:")
+	if err != nil {
+		t.Fatalf("Error adding a breakpoint: %v", err)
+	}
+	if _, err := debugger.BreakAtLine(class, "run", 3); err != nil {
+		t.Fatalf("Error adding a breakpoint: %v", err)
+	}
+	if _, err := debugger.BreakAt(class, "missing"); err == nil {
+		t.Errorf("Expected no breakpoint in a method that is not defined")
+	}
+	if _, err := debugger.BreakAtLine(class, "run", 9); err == nil {
+		t.Errorf("Expected no breakpoint on a line with no code")
+	}
+
+	result, err := executeExpression(t, virtualMachine, "DebugTest new run")
+	if err != nil || result != virtualMachine.NewInteger(8) {
+		t.Errorf("Expected the assignment to x to make run answer 8, got %v (%v)", result, err)
+	}
+	if evaluated != virtualMachine.NewInteger(10) {
+		t.Errorf("Expected x * 2 to be 10, got %v", evaluated)
+	}
+	expected := []string{"DebugTest>>double::1", "[] in DebugTest>>run:3"}
+	if !reflect.DeepEqual(pauses, expected) || doubleBreakpoint.Hits != 1 {
+		t.Errorf("Expected pauses %v, got %v", expected, pauses)
+	}
+
+	debugger.RemoveBreakpoint(doubleBreakpoint)
+	virtualMachine.DetachDebugger()
+	pauses = nil
+	if _, err := executeExpression(t, virtualMachine, "DebugTest new run"); err != nil || len(pauses) != 0 {
+		t.Errorf("Expected no pauses once detached, got %v (%v)", pauses, err)
+	}
+}
+
+// TestDebuggerStepping tests stepping into, over and out of methods
+func TestDebuggerStepping(t *testing.T) {
+	virtualMachine := newDebuggerTestVM(t)
+
+	var pauses []string
+	actions := []vm.Action{
+		{Kind: vm.StepInto, Granularity: vm.StepBytecode},
+		{Kind: vm.StepInto, Granularity: vm.StepStatement},
+		{Kind: vm.StepOut},
+		{Kind: vm.StepOver, Granularity: vm.StepStatement},
+		{Kind: vm.StepOver, Granularity: vm.StepStatement},
+	}
+	debugger := virtualMachine.AttachDebugger(func(pause *vm.Pause) vm.Action {
+		pauses = append(pauses, fmt.Sprintf("%s@%d", describePause(pause), pause.PC(pause.Context)))
+		if len(pauses) > len(actions) {
+			return vm.Action{Kind: vm.Continue}
+		}
+		return actions[len(pauses)-1]
+	})
+	if _, err := debugger.BreakAt(virtualMachine.Globals["DebugTest"], "work"); err != nil {
+		t.Fatalf("Error adding a breakpoint: %v", err)
+	}
+
+	result, err := executeExpression(t, virtualMachine, "DebugTest new run")
+	if err != nil || result != virtualMachine.NewInteger(6) {
+		t.Errorf("Expected 6, got %v (%v)", result, err)
+	}
+	expected := []string{
+		"DebugTest>>work:1@0",
+		"DebugTest>>work:1@1",
+		"DebugTest>>double::1@0",
+		"DebugTest>>work:1@3",
+		"[] in DebugTest>>run:3@3",
+	}
+	if !reflect.DeepEqual(pauses, expected) {
+		t.Errorf("Expected pauses %v, got %v", expected, pauses)
+	}
+}
+
+// TestDebuggerMethodStatements tests a line breakpoint and statement
+// stepping in a method of several statements without blocks
+func TestDebuggerMethodStatements(t *testing.T) {
+	virtualMachine := newDebuggerTestVM(t)
+
+	var pauses []string
+	var temps []pile.ObjectInterface
+	actions := []vm.Action{
+		{Kind: vm.StepOver, Granularity: vm.StepStatement},
+		{Kind: vm.StepOver, Granularity: vm.StepStatement},
+		{Kind: vm.StepInto, Granularity: vm.StepStatement},
+	}
+	debugger := virtualMachine.AttachDebugger(func(pause *vm.Pause) vm.Action {
+		pauses = append(pauses, describePause(pause))
+		temps = append(temps, pause.Context.GetTempVarByIndex(0))
+		if len(pauses) > len(actions) {
+			return vm.Action{Kind: vm.Continue}
+		}
+		return actions[len(pauses)-1]
+	})
+	if _, err := debugger.BreakAtLine(virtualMachine.Globals["DebugTest"], "steps", 3); err != nil {
+		t.Fatalf("Error adding a breakpoint: %v", err)
+	}
+
+	result, err := executeExpression(t, virtualMachine, "DebugTest new steps")
+	if err != nil || result != virtualMachine.NewInteger(84) {
+		t.Errorf("Expected 84, got %v (%v)", result, err)
+	}
+	expected := []string{"DebugTest>>steps:3", "DebugTest>>steps:4", "DebugTest>>steps:5", "DebugTest>>double::1"}
+	if !reflect.DeepEqual(pauses, expected) {
+		t.Errorf("Expected pauses %v, got %v", expected, pauses)
+	}
+	expectedTemps := []pile.ObjectInterface{virtualMachine.NilObject, virtualMachine.NewInteger(41), virtualMachine.NewInteger(42), virtualMachine.NewInteger(42)}
+	if !reflect.DeepEqual(temps, expectedTemps) {
+		t.Errorf("Expected a to be %v at the pauses, got %v", expectedTemps, temps)
+	}
+}
+
+// TestDebuggerHalt tests halt with and without a debugger
+func TestDebuggerHalt(t *testing.T) {
+	virtualMachine := newDebuggerTestVM(t)
+
+	_, err := executeExpression(t, virtualMachine, "DebugTest new stop")
+	var unhandled *vm.UnhandledExceptionError
+	if !errors.As(err, &unhandled) || unhandled.Exception.Class() != virtualMachine.Globals["Halt"] {
+		t.Errorf("Expected an unhandled Halt without a debugger, got %v", err)
+	}
+	if result, err := executeExpression(t, virtualMachine, "[DebugTest new stop] on: Halt do: [:e | 3]"); err != nil || result != virtualMachine.NewInteger(3) {
+		t.Errorf("Expected the handler to answer 3, got %v (%v)", result, err)
+	}
+
+	var pauses []string
+	virtualMachine.AttachDebugger(func(pause *vm.Pause) vm.Action {
+		if pause.Reason != vm.PausedAtHalt {
+			t.Errorf("Expected to pause at halt, got %v", pause.Reason)
+		}
+		pauses = append(pauses, describePause(pause))
+		return vm.Action{Kind: vm.Continue}
+	})
+	result, err := executeExpression(t, virtualMachine, "DebugTest new stop")
+	if err != nil || result.(*pile.Object).Class() != virtualMachine.Globals["DebugTest"] {
+		t.Errorf("Expected halt to answer the receiver, got %v (%v)", result, err)
+	}
+	if !reflect.DeepEqual(pauses, []string{"DebugTest>>stop:1"}) {
+		t.Errorf("Expected to pause in stop, got %v", pauses)
+	}
+}
+
+// TestDebuggerBadFrame tests that an action on a context that is not paused
+// stops the evaluation with an ActionError
+func TestDebuggerBadFrame(t *testing.T) {
+	virtualMachine := newDebuggerTestVM(t)
+
+	var validated error
+	debugger := virtualMachine.AttachDebugger(func(pause *vm.Pause) vm.Action {
+		action := vm.Action{Kind: vm.Return, Frame: vm.NewContext(pause.Context.Method, virtualMachine.NilObject, []*pile.Object{}, nil)}
+		validated = pause.Validate(action)
+		return action
+	})
+	if _, err := debugger.BreakAt(virtualMachine.Globals["DebugTest"], "answer"); err != nil {
+		t.Fatalf("Error adding a breakpoint: %v", err)
+	}
+
+	_, err := executeExpression(t, virtualMachine, "DebugTest new answer")
+	var actionError *vm.ActionError
+	if !errors.As(err, &actionError) || actionError.Walkback == nil {
+		t.Fatalf("Expected an ActionError, got %v", err)
+	}
+	if validated == nil || validated.Error() != err.Error() {
+		t.Errorf("Expected Validate to return the same error, got %v", validated)
+	}
+	if err.Error() != "debugger: UndefinedObject(DebugTest)>>answer is not one of the paused contexts" {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+}
+
+// TestDebuggerReturnAndRestart tests returning from a frame and restarting
+// one after editing its method
+func TestDebuggerReturnAndRestart(t *testing.T) {
+	virtualMachine := newDebuggerTestVM(t)
+	class := virtualMachine.Globals["DebugTest"]
+
+	var pauses []string
+	debugger := virtualMachine.AttachDebugger(func(pause *vm.Pause) vm.Action {
+		pauses = append(pauses, describePause(pause))
+		switch {
+		case pause.Reason != vm.PausedAtBreakpoint:
+			return vm.Action{Kind: vm.Continue}
+		case pause.Breakpoint.Selector == "double:":
+			return vm.Action{Kind: vm.Return, Value: virtualMachine.NewInteger(100)}
+		default:
+			virtualMachine.CompileMethod(class, "answer ^42", "")
+			return vm.Action{Kind: vm.Restart, Frame: pause.Frames()[0]}
+		}
+	})
+	for _, selector := range []string{"double:", "answer"} {
+		if _, err := debugger.BreakAt(class, selector); err != nil {
+			t.Fatalf("Error adding a breakpoint: %v", err)
+		}
+	}
+
+	if result, err := executeExpression(t, virtualMachine, "DebugTest new work"); err != nil || result != virtualMachine.NewInteger(100) {
+		t.Errorf("Expected double: to return 100, got %v (%v)", result, err)
+	}
+	if result, err := executeExpression(t, virtualMachine, "DebugTest new answer"); err != nil || result != virtualMachine.NewInteger(42) {
+		t.Errorf("Expected the restarted answer to be 42, got %v (%v)", result, err)
+	}
+	expected := []string{"DebugTest>>double::1", "DebugTest>>work:1", "DebugTest>>answer:1", "DebugTest>>answer:1"}
+	if !reflect.DeepEqual(pauses, expected) {
+		t.Errorf("Expected pauses %v, got %v", expected, pauses)
+	}
+}
@@ -0,0 +1,347 @@
+package vm
+
+import (
+	"fmt"
+
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/pile"
+)
+
+// onDoPrimitive marks Block>>on:do: so signal can find its contexts on the
+// stack. It always fails, and the method evaluates the protected block.
+const onDoPrimitive = 199
+
+// Temporary variable indices of Block>>on:do:
+const (
+	onDoExceptionClass = 0
+	onDoHandlerBlock   = 1
+)
+
+// ensurePrimitive and ifCurtailedPrimitive mark Block>>ensure: and
+// Block>>ifCurtailed: so an unwind can find their contexts on the stack. They
+// always fail, and the methods evaluate the receiver.
+const (
+	ensurePrimitive      = 168
+	ifCurtailedPrimitive = 169
+)
+
+// Temporary variable indices of Block>>ensure: and Block>>ifCurtailed:, whose
+// methods set complete once an unwind no longer needs to evaluate the argument
+const (
+	unwindBlock    = 0
+	unwindComplete = 1
+)
+
+// unwind is what a Go panic carries to unwind the stack to an on:do: context,
+// which then answers value, or for retry evaluates its receiver again
+// Each executor loop the panic passes makes its caller current and lets it
+// continue, until the loop running the target stops it, see Executor.execute.
+type unwind struct {
+	target *Context
+	value  *pile.Object
+	retry  bool
+}
+
+// resumption is what a Go panic carries to make the signal of exception answer value
+type resumption struct {
+	exception *pile.Object
+	value     *pile.Object
+}
+
+// NewExceptionClass creates Exception, the root of the exception classes
+func (vm *VM) NewExceptionClass() *pile.Class {
+	objectClass := pile.ObjectToClass(vm.Globals["Object"])
+	result := pile.NewClass("Exception", objectClass)
+
+	// messageText method (returns the description of the exception)
+	compiler.NewMethodBuilder(result).Primitive(81).Go("messageText")
+
+	// messageText: method (sets the description and answers the exception)
+	compiler.NewMethodBuilder(result).Primitive(161).Go("messageText:")
+
+	// signal method (looks for a handler and answers the value it resumes with)
+	compiler.NewMethodBuilder(result).Primitive(160).Go("signal")
+
+	// signalerContext method (answers the context that signalled the exception)
+	compiler.NewMethodBuilder(result).Primitive(174).Go("signalerContext")
+
+	// defaultAction method (what signal does when nothing handles the exception)
+	compiler.NewMethodBuilder(result).Primitive(162).Go("defaultAction")
+
+	// Handler methods, for the exception a handler block is running for
+	compiler.NewMethodBuilder(result).Primitive(163).Go("return:")
+	compiler.NewMethodBuilder(result).Primitive(164).Go("retry")
+	compiler.NewMethodBuilder(result).Primitive(165).Go("resume:")
+	compiler.NewMethodBuilder(result).Primitive(166).Go("pass")
+	compiler.NewMethodBuilder(result).Primitive(167).Go("outer")
+
+	// return and resume methods (return: nil and resume: nil)
+	for _, selector := range []string{"return", "resume"} {
+		builder := compiler.NewMethodBuilder(result)
+		builder.AddLiterals([]*pile.Object{pile.MakeNilImmediate(), pile.NewSymbol(selector + ":")})
+		builder.PushSelf().PushLiteral(0).SendMessage(1, 1).ReturnStackTop().Go(selector)
+	}
+
+	return result
+}
+
+// NewErrorClass creates Error, the superclass of the exceptions for program errors
+func (vm *VM) NewErrorClass() *pile.Class {
+	exceptionClass := pile.ObjectToClass(vm.Globals["Exception"])
+	return pile.NewClass("Error", exceptionClass)
+}
+
+// NewWarningClass creates Warning, the exceptions that resume with nil when
+// nothing handles them
+func (vm *VM) NewWarningClass() *pile.Class {
+	exceptionClass := pile.ObjectToClass(vm.Globals["Exception"])
+	result := pile.NewClass("Warning", exceptionClass)
+
+	// defaultAction method (answers nil)
+	builder := compiler.NewMethodBuilder(result)
+	builder.AddLiterals([]*pile.Object{pile.MakeNilImmediate()})
+	builder.PushLiteral(0).ReturnStackTop().Go("defaultAction")
+
+	return result
+}
+
+// NewIllegalResumeAttemptClass creates IllegalResumeAttempt, the error
+// signalled when a handler resumes an exception that is not resumable
+func (vm *VM) NewIllegalResumeAttemptClass() *pile.Class {
+	errorClass := pile.ObjectToClass(vm.Globals["Error"])
+	return pile.NewClass("IllegalResumeAttempt", errorClass)
+}
+
+// newException creates an instance of the named exception class, counting it
+// for the evaluation's allocation budget
+func (vm *VM) newException(className string) *pile.Object {
+	vm.allocated()
+	return pile.NewException(vm.Globals[className])
+}
+
+// isHandlerContext returns true if the context is running Block>>on:do:
+func (c *Context) isHandlerContext() bool {
+	method := pile.ObjectToMethod(c.Method)
+	return !c.block && method.IsPrimitiveMethod() && method.GetPrimitiveIndex() == onDoPrimitive
+}
+
+// Signal signals an exception from the current context and answers the value
+// a handler resumes it with. A handler that returns, retries or completes
+// unwinds the stack to its on:do: instead, and an exception nothing handles is
+// sent defaultAction, whose value signal answers.
+func (vm *VM) Signal(exception *pile.Object) *pile.Object {
+	pile.ObjectToException(exception).SignalContext = vm.Executor.CurrentContext
+	return vm.signalFrom(exception, vm.Executor.CurrentContext)
+}
+
+// signalFrom signals an exception, looking for a handler in start and its callers
+func (vm *VM) signalFrom(exception *pile.Object, start *Context) (result *pile.Object) {
+	handler, searched := vm.findHandler(exception, start)
+	if handler == nil {
+		return vm.Send(exception, pile.NewSymbol("defaultAction"), []*pile.Object{})
+	}
+
+	// Signals from the handler block look past the handlers searched to get here
+	for _, context := range searched {
+		context.disabled = true
+	}
+	state := pile.ObjectToException(exception)
+	outerHandler := state.HandlerContext
+	state.HandlerContext = handler
+	defer func() {
+		for _, context := range searched {
+			context.disabled = false
+		}
+		state.HandlerContext = outerHandler
+
+		if r := recover(); r != nil {
+			if resumed, ok := r.(*resumption); ok && resumed.exception == exception {
+				result = resumed.value
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	// A handler block that completes returns its value from on:do:
+	handlerBlock := handler.TempVars[onDoHandlerBlock].(*pile.Object)
+	value := vm.ExecuteBlock(handlerBlock, []*pile.Object{exception})
+	panic(&unwind{target: handler, value: value})
+}
+
+// findHandler answers the first enabled on:do: context from start on whose
+// exception class handles the exception, and the on:do: contexts it looked
+// at, or nil if none does
+func (vm *VM) findHandler(exception *pile.Object, start *Context) (*Context, []*Context) {
+	var searched []*Context
+	handles := pile.NewSymbol("handles:")
+	for context := start; context != nil; context = context.Caller() {
+		if !context.isHandlerContext() || context.disabled {
+			continue
+		}
+		searched = append(searched, context)
+		exceptionClass := context.TempVars[onDoExceptionClass].(*pile.Object)
+		if pile.IsTrueImmediate(vm.Send(exceptionClass, handles, []*pile.Object{exception})) {
+			return context, searched
+		}
+	}
+	return nil, nil
+}
+
+// handlerContext returns the on:do: context whose handler is running for an
+// exception, or nil if none is
+func handlerContext(exception *pile.Object) *Context {
+	if pile.IsImmediate(exception) || exception.Type() != pile.OBJ_EXCEPTION {
+		return nil
+	}
+	handler, _ := pile.ObjectToException(exception).HandlerContext.(*Context)
+	return handler
+}
+
+// primitiveExceptionSignal signals the receiver
+func (vm *VM) primitiveExceptionSignal(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if pile.IsImmediate(receiver) || receiver.Type() != pile.OBJ_EXCEPTION {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return vm.Signal(receiver)
+}
+
+// primitiveExceptionSignalerContext answers the context that signalled the
+// receiver, the innermost one that is not running a method of the exception
+// itself, or nil if it has not been signalled
+func (vm *VM) primitiveExceptionSignalerContext(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if pile.IsImmediate(receiver) || receiver.Type() != pile.OBJ_EXCEPTION {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	context, _ := pile.ObjectToException(receiver).SignalContext.(*Context)
+	for context != nil && context.GetReceiver() == receiver {
+		context = context.Caller()
+	}
+	return vm.ContextObject(context)
+}
+
+// primitiveExceptionMessageTextPut sets the description of an exception and answers it
+func (vm *VM) primitiveExceptionMessageTextPut(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if pile.IsImmediate(receiver) || receiver.Type() != pile.OBJ_EXCEPTION {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	pile.ObjectToException(receiver).SetMessageText(args[0])
+	return receiver
+}
+
+// primitiveExceptionDefaultAction unwinds the whole stack for an exception
+// nothing handles, the outermost context returns it as an UnhandledExceptionError
+func (vm *VM) primitiveExceptionDefaultAction(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if pile.IsImmediate(receiver) || receiver.Type() != pile.OBJ_EXCEPTION {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	vm.unhandled(receiver)
+	return nil
+}
+
+// primitiveExceptionReturn returns the argument from the on:do: whose handler is running
+func (vm *VM) primitiveExceptionReturn(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	handler := handlerContext(receiver)
+	if handler == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	panic(&unwind{target: handler, value: args[0]})
+}
+
+// primitiveExceptionRetry evaluates the protected block of the on:do: whose
+// handler is running again
+func (vm *VM) primitiveExceptionRetry(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	handler := handlerContext(receiver)
+	if handler == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	panic(&unwind{target: handler, retry: true})
+}
+
+// primitiveExceptionResume makes signal answer the argument, or signals
+// IllegalResumeAttempt if the exception is not resumable
+func (vm *VM) primitiveExceptionResume(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if handlerContext(receiver) == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	if !pile.IsTrueImmediate(vm.Send(receiver, pile.NewSymbol("isResumable"), []*pile.Object{})) {
+		illegalResume := vm.newException("IllegalResumeAttempt")
+		messageText := fmt.Sprintf("%s is not resumable", vm.GetClass(receiver).Name)
+		pile.ObjectToException(illegalResume).SetMessageText(vm.NewString(messageText))
+		return vm.Signal(illegalResume)
+	}
+	panic(&resumption{exception: receiver, value: args[0]})
+}
+
+// primitiveExceptionPass hands the exception to the handlers outside the one
+// running, as if that one did not handle it. If an outer handler resumes it,
+// signal answers the value.
+func (vm *VM) primitiveExceptionPass(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	handler := handlerContext(receiver)
+	if handler == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	value := vm.signalFrom(receiver, handler.Caller())
+	panic(&resumption{exception: receiver, value: value})
+}
+
+// primitiveExceptionOuter hands the exception to the handlers outside the one
+// running, and answers the value an outer handler resumes it with
+func (vm *VM) primitiveExceptionOuter(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	handler := handlerContext(receiver)
+	if handler == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return vm.signalFrom(receiver, handler.Caller())
+}
+
+// primitiveBlockOnDo marks the contexts of Block>>on:do: for signal, and
+// always fails so the method evaluates the receiver
+func (vm *VM) primitiveBlockOnDo(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return nil
+}
+
+// primitiveBlockEnsure marks the contexts of Block>>ensure: for an unwind,
+// and always fails so the method evaluates the receiver and then the argument
+func (vm *VM) primitiveBlockEnsure(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return nil
+}
+
+// primitiveBlockIfCurtailed marks the contexts of Block>>ifCurtailed: for an
+// unwind, and always fails so the method evaluates the receiver
+func (vm *VM) primitiveBlockIfCurtailed(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return nil
+}
+
+// curtailBlock answers the block to evaluate when an unwind abandons the
+// context before it completes, which only ensure: and ifCurtailed: have, and
+// marks the context complete so the block is evaluated once. It answers nil
+// for any other context.
+func (c *Context) curtailBlock() *pile.Object {
+	method := pile.ObjectToMethod(c.Method)
+	if c.block || !method.IsPrimitiveMethod() {
+		return nil
+	}
+	if index := method.GetPrimitiveIndex(); index != ensurePrimitive && index != ifCurtailedPrimitive {
+		return nil
+	}
+	if !pile.IsNilImmediate(c.TempVars[unwindComplete]) {
+		return nil
+	}
+	c.TempVars[unwindComplete] = pile.MakeTrueImmediate()
+	return c.TempVars[unwindBlock].(*pile.Object)
+}
+
+// primitiveIsKindOf answers whether the receiver is an instance of the
+// argument or of one of its subclasses
+func (vm *VM) primitiveIsKindOf(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if !isClass(args[0]) {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	for class := vm.GetClass(receiver); class != nil; class = pile.ObjectToClass(class.SuperClass) {
+		if pile.ClassToObject(class) == args[0] {
+			return vm.NewTrue()
+		}
+	}
+	return vm.NewFalse()
+}
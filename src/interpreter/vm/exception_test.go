@@ -0,0 +1,153 @@
+package vm_test
+
+import (
+	"testing"
+
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// newExceptionTestVM creates a VM with ExceptionTest, a class whose methods signal
+// and handle exceptions and record what ran in its count instance variable
+func newExceptionTestVM(t *testing.T) *vm.VM {
+	t.Helper()
+	return newTestVM(t, "ExceptionTest", []string{"count", "divisor"},
+		"count ^count",
+		"fail ^1 / 0",
+		"callFail ^self fail + 1",
+		"catch ^[self callFail] on: ZeroDivide do: [:e | 4]",
+		"retryDivide divisor := 0. ^[10 / divisor] on: ZeroDivide do: [:e | divisor := 2. e retry]",
+		"ensureCompleted [count := 1] ensure: [count := count + 10]. ^count",
+		"ensureUnwound ^[[count := 1. 1 / 0] ensure: [count := count + 10]] on: ZeroDivide do: [:e | count]",
+		"reset ^count := 0",
+		"curtailedCompleted [count := 1] ifCurtailed: [count := 5]. ^count",
+		"curtailedUnwound [[count := 1. 1 / 0] ifCurtailed: [count := 5]] on: ZeroDivide do: [:e | 0]. ^count",
+	)
+}
+
+// TestExceptionHandling tests on:do: with the handler's value, return:, retry,
+// resume:, pass, outer and signals from handlers
+func TestExceptionHandling(t *testing.T) {
+	virtualMachine := newExceptionTestVM(t)
+
+	tests := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		{"[1 / 0] on: ZeroDivide do: [:e | 7]", virtualMachine.NewInteger(7)},
+		{"[3 + 4] on: ZeroDivide do: [:e | 0]", virtualMachine.NewInteger(7)},
+		{"[1 / 0] on: Error do: [:e | 7]", virtualMachine.NewInteger(7)},
+		{"[1 / 0] on: Exception do: [:e | e class]", virtualMachine.Globals["ZeroDivide"]},
+		{"[(1 / 0) + 100] on: ZeroDivide do: [:e | e return: 3]", virtualMachine.NewInteger(3)},
+		{"[1 / 0] on: ZeroDivide do: [:e | e return]", virtualMachine.NewNil()},
+		{"[3 foo] on: MessageNotUnderstood do: [:e | e receiver]", virtualMachine.NewInteger(3)},
+		{"[3 foo] on: MessageNotUnderstood do: [:e | e resume: 5]", virtualMachine.NewInteger(5)},
+		{"[(3 foo) + 1] on: MessageNotUnderstood do: [:e | e resume: 5]", virtualMachine.NewInteger(6)},
+		{"ExceptionTest new catch", virtualMachine.NewInteger(4)},
+		{"ExceptionTest new retryDivide", virtualMachine.NewInteger(5)},
+		{"[(Warning signal: 'careful') + 1] on: Warning do: [:e | e resume: 41]", virtualMachine.NewInteger(42)},
+		{"Warning signal: 'careful'", virtualMachine.NewNil()},
+		{"[[1 / 0] on: ZeroDivide do: [:e | e pass]] on: Error do: [:e | 9]", virtualMachine.NewInteger(9)},
+		{"[[(Warning signal: 'w') + 1] on: Warning do: [:e | e pass]] on: Warning do: [:e | e resume: 5]", virtualMachine.NewInteger(6)},
+		{"[[(Warning signal: 'w') + 1] on: Warning do: [:e | e outer + 10]] on: Warning do: [:e | e resume: 5]", virtualMachine.NewInteger(15)},
+		{"[[1 / 0] on: ZeroDivide do: [:e | 2 / 0]] on: ZeroDivide do: [:e | 8]", virtualMachine.NewInteger(8)},
+		{"[[1 / 0] on: Warning do: [:e | 1]] on: ZeroDivide do: [:e | 2]", virtualMachine.NewInteger(2)},
+		{"[ZeroDivide new signal] on: ZeroDivide do: [:e | e dividend]", virtualMachine.NewNil()},
+		{"3 isKindOf: Number", virtualMachine.NewTrue()},
+		{"3 isKindOf: String", virtualMachine.NewFalse()},
+		{"ZeroDivide handles: ZeroDivide new", virtualMachine.NewTrue()},
+		{"Warning handles: ZeroDivide new", virtualMachine.NewFalse()},
+		{"ZeroDivide new isResumable", virtualMachine.NewFalse()},
+		{"Warning new isResumable", virtualMachine.NewTrue()},
+		{"MessageNotUnderstood new isResumable", virtualMachine.NewTrue()},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	strings := []struct {
+		expression string
+		expected   string
+	}{
+		{"[1 / 0] on: ZeroDivide do: [:e | e messageText]", "Integer>>/ division by zero"},
+		{"[Error signal: 'boom'] on: Error do: [:e | e messageText]", "boom"},
+		{"[Error new signal: 'boom'] on: Error do: [:e | e messageText]", "boom"},
+	}
+	for _, test := range strings {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result.Type() != pile.OBJ_STRING || pile.ObjectToString(result).GetValue() != test.expected {
+			t.Errorf("Expected %q to answer '%s', got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	failures := []struct {
+		expression string
+		expected   string
+	}{
+		{"[1 / 0] on: Warning do: [:e | 7]", "unhandled ZeroDivide: Integer>>/ division by zero"},
+		{"[1 / 0] on: ZeroDivide do: [:e | 2 / 0]", "unhandled ZeroDivide: Integer>>/ division by zero"},
+		{"[1 / 0] on: ZeroDivide do: [:e | e resume: 5]", "unhandled IllegalResumeAttempt: ZeroDivide is not resumable"},
+		{"Error signal: 'boom'", "unhandled Error: boom"},
+		{"Exception new signal", "unhandled Exception"},
+		{"ZeroDivide new return: 3", "unhandled PrimitiveFailed: ZeroDivide>>return: primitive failed: bad receiver"},
+	}
+	for _, test := range failures {
+		_, err := executeExpression(t, virtualMachine, test.expression)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Expected %q to fail with %q, got %v", test.expression, test.expected, err)
+		}
+	}
+
+	// The VM carries on after unwinding
+	if virtualMachine.Executor.CurrentContext != nil {
+		t.Errorf("Expected no current context after the exceptions")
+	}
+}
+
+// TestEnsureAndIfCurtailed tests that ensure: blocks run whether or not the
+// receiver completes and ifCurtailed: blocks only when it is unwound
+func TestEnsureAndIfCurtailed(t *testing.T) {
+	virtualMachine := newExceptionTestVM(t)
+
+	tests := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		{"[3] ensure: [4]", virtualMachine.NewInteger(3)},
+		{"ExceptionTest new ensureCompleted", virtualMachine.NewInteger(11)},
+		{"[3] ifCurtailed: [4]", virtualMachine.NewInteger(3)},
+		{"ExceptionTest new curtailedCompleted", virtualMachine.NewInteger(1)},
+		{"ExceptionTest new curtailedUnwound", virtualMachine.NewInteger(5)},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	// The handler runs before the stack unwinds, then the ensure: block
+	probe, err := executeExpression(t, virtualMachine, "ExceptionTest new")
+	if err != nil {
+		t.Fatalf("Error creating ExceptionTest: %v", err)
+	}
+	virtualMachine.Globals["Probe"] = probe.(*pile.Object)
+	if result, err := executeExpression(t, virtualMachine, "Probe ensureUnwound"); err != nil || result != virtualMachine.NewInteger(1) {
+		t.Errorf("Expected the handler to see count 1, got %v (%v)", result, err)
+	}
+	if result, err := executeExpression(t, virtualMachine, "Probe count"); err != nil || result != virtualMachine.NewInteger(11) {
+		t.Errorf("Expected the ensure: block to run while unwinding, got %v (%v)", result, err)
+	}
+
+	// An unhandled exception runs ensure: blocks on its way out
+	executeExpression(t, virtualMachine, "Probe reset")
+	if _, err := executeExpression(t, virtualMachine, "[1 / 0] ensure: [Probe ensureCompleted]"); err == nil {
+		t.Errorf("Expected the division by zero to be unhandled")
+	}
+	if result, err := executeExpression(t, virtualMachine, "Probe count"); err != nil || result != virtualMachine.NewInteger(11) {
+		t.Errorf("Expected the ensure: block to run for an unhandled exception, got %v (%v)", result, err)
+	}
+}
@@ -14,6 +14,9 @@ type Executor struct {
 
 	// CurrentContext is the context currently being executed
 	CurrentContext *Context
+
+	// ticks counts bytecodes between preemption points
+	ticks int
 }
 
 // NewExecutor creates a new executor
@@ -23,38 +26,97 @@ func NewExecutor(vm *VM) *Executor {
 	}
 }
 
-// Execute executes the current context
+// Execute executes the current context until it returns to its sender
 func (e *Executor) Execute() (pile.ObjectInterface, error) {
-	var finalResult pile.ObjectInterface
+	context := e.CurrentContext
+	e.CurrentContext = context.Sender
+	return e.ExecuteContext(context)
+}
 
-	for e.CurrentContext != nil {
-		// Execute the current context
-		result, err := e.ExecuteContext(e.CurrentContext)
-		if err != nil {
-			return nil, err
+// ExecuteContext executes context until it returns and answers its result
+// Sends switch CurrentContext to the context of the method they activate and
+// returns switch back to the sender, all in this one loop, so Smalltalk code
+// does not use Go stack however deeply it recurses. Afterwards CurrentContext is
+// whatever it was before, so Go code such as primitives can run contexts too.
+// An exception handler returning or retrying unwinds to its on:do: context,
+// which stops the loop running that context and continues it from there.
+// Run from Go with nothing else running, it forgets any Interrupt that came
+// after the previous evaluation finished, and it gives a budget without limits
+// to an evaluation that has none so that an Interrupt can stop it.
+func (e *Executor) ExecuteContext(base *Context) (pile.ObjectInterface, error) {
+	caller := e.CurrentContext
+	if caller == nil {
+		e.VM.forgetInterrupt()
+	}
+	if e.VM.budget == nil {
+		e.VM.budget = &budget{}
+		defer func() {
+			e.VM.budget = nil
+		}()
+	}
+	e.CurrentContext = base
+
+	for {
+		result, done, err := e.execute(base, caller)
+		if done {
+			return result, err
+		}
+	}
+}
+
+// execute runs CurrentContext and its callees until base returns, and answers
+// its result and true, or a VMError if a bytecode fails. An unwind to one of the contexts it is running stops it
+// early and answers false, with the context to continue in current. Any other
+// panic makes caller current again on its way out, as a VMError unless the VM
+// panicked with it on purpose.
+func (e *Executor) execute(base *Context, caller *Context) (result pile.ObjectInterface, done bool, err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
 		}
+		unwinding, ok := r.(*unwind)
+		if !ok || !e.running(unwinding.target, base) {
+			if !isControlPanic(r) {
+				r = e.VM.newVMError(r, e.CurrentContext)
+			}
+			e.curtail(nil, base)
+			e.CurrentContext = caller
+			panic(r)
+		}
+		e.curtail(unwinding.target, base)
+		switch {
+		case unwinding.retry:
+			unwinding.target.restart()
+			e.CurrentContext = unwinding.target
+		case unwinding.target == base:
+			e.CurrentContext = caller
+			result, done, err = unwinding.value, true, nil
+		default:
+			e.returnToSender(unwinding.target, unwinding.value)
+		}
+	}()
 
-		// Save the result if this is the top-level context
-		if e.CurrentContext.Sender == nil {
-			finalResult = result
+	for {
+		// Waiting Delays that are due can preempt the active process
+		if e.ticks++; e.ticks >= preemptionInterval {
+			e.ticks = 0
+			e.VM.Processor.preemptionPoint()
 		}
 
-		// Move to the sender context
-		e.CurrentContext = e.CurrentContext.Sender
+		// Interrupts and the evaluation's limits can stop it
+		e.VM.budget.tick(e.VM)
+		if profiler := e.VM.profiler; profiler != nil {
+			profiler.tick()
+		}
 
-		// If we have a sender, push the result onto its stack
-		if e.CurrentContext != nil {
-			e.CurrentContext.Push(result)
+		// The debugger can pause before the next bytecode
+		if debugger := e.VM.debugger; debugger != nil {
+			debugger.check(e.CurrentContext)
 		}
-	}
 
-	return finalResult, nil
-}
+		context := e.CurrentContext
 
-// ExecuteContext executes a single context until it returns
-func (e *Executor) ExecuteContext(context *Context) (pile.ObjectInterface, error) {
-	// Execute the context
-	for {
 		// Get the method
 		method := pile.ObjectToMethod(context.Method)
 
@@ -64,18 +126,32 @@ func (e *Executor) ExecuteContext(context *Context) (pile.ObjectInterface, error
 
 			// If we've reached the end of the method, return the top of the stack
 			// This handles the case where we jump to the end of the bytecode array
+			var returnValue pile.ObjectInterface = e.VM.NilObject
 			if context.StackPointer > 0 {
-				returnValue := context.Pop()
-				return returnValue, nil
+				returnValue = context.Pop()
 			}
-			return e.VM.NilObject, nil
+			if context == base {
+				e.CurrentContext = caller
+				return returnValue, true, nil
+			}
+			e.returnToSender(context, returnValue)
+			continue
 		}
 
-		// Get the current bytecode
-		opcode := method.GetBytecodes()[context.PC]
+		// Decode the current instruction, short forms and prefixes decode to their long form
+		// The handlers read their operands from the decoded instruction on the context
+		instruction := &context.instruction
+		context.instructionPC = -1
+		if err := bytecode.DecodeInto(instruction, method.GetBytecodes(), context.PC); err != nil {
+			e.curtail(nil, base)
+			e.CurrentContext = caller
+			return nil, true, e.VM.newVMError(fmt.Errorf("invalid instruction at %d: %v", context.PC, err), context)
+		}
+		context.instructionPC = context.PC
+		opcode := instruction.Opcode
 
-		// Get the instruction size
-		size := bytecode.InstructionSize(opcode)
+		// Get the instruction size, including any prefixes
+		size := instruction.Size
 
 		// Execute the bytecode
 		var err error
@@ -94,6 +170,9 @@ func (e *Executor) ExecuteContext(context *Context) (pile.ObjectInterface, error
 		case bytecode.PUSH_SELF:
 			err = e.VM.ExecutePushSelf(context)
 
+		case bytecode.PUSH_THIS_CONTEXT:
+			err = e.VM.ExecutePushThisContext(context)
+
 		case bytecode.STORE_INSTANCE_VARIABLE:
 			err = e.VM.ExecuteStoreInstanceVariable(context)
 
@@ -101,23 +180,20 @@ func (e *Executor) ExecuteContext(context *Context) (pile.ObjectInterface, error
 			err = e.VM.ExecuteStoreTemporaryVariable(context)
 
 		case bytecode.SEND_MESSAGE:
-			returnValue, err := e.VM.ExecuteSendMessage(context)
-			if err == nil {
-				if returnValue != nil {
-					// We got a result from a primitive method
-					// Continue execution in the current context
-					context.PC += size
-					continue
-				} else {
-					// A nil return value with no error means we've started a new context
-					return e.VM.NilObject, nil
-				}
-			}
+			// A primitive pushes its result, otherwise the send makes the method's
+			// context current, either way the sender continues after the send
+			_, err = e.VM.ExecuteSendMessage(context)
 
 		case bytecode.RETURN_STACK_TOP:
-			returnValue, err := e.VM.ExecuteReturnStackTop(context)
+			var returnValue *pile.Object
+			returnValue, err = e.VM.ExecuteReturnStackTop(context)
 			if err == nil {
-				return returnValue, nil
+				if context == base {
+					e.CurrentContext = caller
+					return returnValue, true, nil
+				}
+				e.returnToSender(context, returnValue)
+				continue
 			}
 
 		case bytecode.JUMP:
@@ -148,29 +224,59 @@ func (e *Executor) ExecuteContext(context *Context) (pile.ObjectInterface, error
 			err = e.VM.ExecuteCreateBlock(context)
 
 		case bytecode.EXECUTE_BLOCK:
-			returnValue, err := e.VM.ExecuteExecuteBlock(context)
-			if err == nil {
-				if returnValue != nil {
-					// We got a result from executing the block
-					// Continue execution in the current context
-					context.PC += size
-					continue
-				} else {
-					// A nil return value with no error means we've started a new context
-					return e.VM.NilObject, nil
-				}
-			}
+			_, err = e.VM.ExecuteExecuteBlock(context)
 
 		default:
-			return nil, fmt.Errorf("unknown bytecode: %d", opcode)
+			e.curtail(nil, base)
+			e.CurrentContext = caller
+			return nil, true, e.VM.newVMError(fmt.Errorf("unknown bytecode: %d", opcode), context)
 		}
 
 		// Check for errors
 		if err != nil {
-			return nil, err
+			e.curtail(nil, base)
+			e.CurrentContext = caller
+			return nil, true, e.VM.newVMError(err, context)
 		}
 
 		// Increment the PC
 		context.PC += size
 	}
-}
\ No newline at end of file
+}
+
+// returnToSender makes the caller of context current again and pushes the
+// value context returned, the caller's PC is already past the send. A block
+// context returns to the context that evaluated it.
+func (e *Executor) returnToSender(context *Context, returnValue pile.ObjectInterface) {
+	e.CurrentContext = context.Caller()
+	e.CurrentContext.Push(returnValue)
+}
+
+// curtail evaluates the unwind blocks of the ensure: and ifCurtailed:
+// contexts from CurrentContext out to base that an unwind to target abandons,
+// or of all of them if target is nil, innermost first
+func (e *Executor) curtail(target *Context, base *Context) {
+	for context := e.CurrentContext; context != nil && context != target; context = context.Caller() {
+		if block := context.curtailBlock(); block != nil {
+			e.CurrentContext = context
+			e.VM.ExecuteBlock(block, []*pile.Object{})
+		}
+		if context == base {
+			return
+		}
+	}
+}
+
+// running returns true if target is CurrentContext or one of its callers up to
+// base, the contexts the loop running base is responsible for
+func (e *Executor) running(target *Context, base *Context) bool {
+	for context := e.CurrentContext; context != nil; context = context.Caller() {
+		if context == target {
+			return true
+		}
+		if context == base {
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package vm_test
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"smalltalklsp/interpreter/bytecode"
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// TestDeepRecursion tests that sends do not use Go stack, by recursing far
+// deeper than the Go stack allows when every send nests a Go call
+func TestDeepRecursion(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	integerClass := pile.ObjectToClass(virtualMachine.Globals["Integer"])
+
+	// countDown ^self = 0 ifTrue: [0] ifFalse: [(self - 1) countDown]
+	builder := compiler.NewMethodBuilder(integerClass)
+	zeroIndex, builder := builder.AddLiteral(virtualMachine.NewInteger(0))
+	oneIndex, builder := builder.AddLiteral(virtualMachine.NewInteger(1))
+	equalsIndex, builder := builder.AddLiteral(pile.NewSymbol("="))
+	minusIndex, builder := builder.AddLiteral(pile.NewSymbol("-"))
+	countDownIndex, builder := builder.AddLiteral(pile.NewSymbol("countDown"))
+	trueBranch := append(bytecode.AppendInstruction(nil, bytecode.PUSH_LITERAL, zeroIndex), bytecode.RETURN_STACK_TOP)
+	builder.PushSelf().
+		PushLiteral(zeroIndex).
+		SendMessage(equalsIndex, 1).
+		JumpIfFalse(len(trueBranch)).
+		PushLiteral(zeroIndex).
+		ReturnStackTop().
+		PushSelf().
+		PushLiteral(oneIndex).
+		SendMessage(minusIndex, 1).
+		SendMessage(countDownIndex, 0).
+		ReturnStackTop().
+		Go("countDown")
+
+	// Recursing in Go would need megabytes of stack
+	defer debug.SetMaxStack(debug.SetMaxStack(256 * 1024))
+
+	result, err := executeExpression(t, virtualMachine, "20000 countDown")
+	if err != nil || result != virtualMachine.NewInteger(0) {
+		t.Errorf("Expected 0, got %v (%v)", result, err)
+	}
+	if virtualMachine.Executor.CurrentContext != nil {
+		t.Errorf("Expected no current context after the outermost context returned")
+	}
+}
+
+// TestDeepBlockRecursion tests that evaluating blocks does not use Go stack
+// either, recursing through value, ifTrue:ifFalse:, on:do: and ensure: and
+// unwinding all of it
+func TestDeepBlockRecursion(t *testing.T) {
+	virtualMachine := newExceptionTestVM(t)
+	compileMethods(t, virtualMachine, virtualMachine.Globals["ExceptionTest"],
+		"countDown ^divisor = 0 ifTrue: [Error signal: 'bottom'] ifFalse: [divisor := divisor - 1. self guard]",
+		"guard ^[self protect] on: ZeroDivide do: [:e | 0]",
+		"protect ^[self countDown] ensure: [count := count + 1]",
+		"unwind: n self reset. divisor := n. ^[self countDown] on: Error do: [:e | count]")
+
+	// Evaluating the blocks in Go would need megabytes of stack
+	defer debug.SetMaxStack(debug.SetMaxStack(256 * 1024))
+
+	// The handler runs before the stack unwinds, the ensure: blocks as it does
+	probe, err := executeExpression(t, virtualMachine, "ExceptionTest new")
+	if err != nil {
+		t.Fatalf("Error creating ExceptionTest: %v", err)
+	}
+	virtualMachine.Globals["Probe"] = probe.(*pile.Object)
+	if result, err := executeExpression(t, virtualMachine, "Probe unwind: 5000"); err != nil || result != virtualMachine.NewInteger(0) {
+		t.Errorf("Expected the handler to see count 0, got %v (%v)", result, err)
+	}
+	if result, err := executeExpression(t, virtualMachine, "Probe count"); err != nil || result != virtualMachine.NewInteger(5000) {
+		t.Errorf("Expected every ensure: block to run while unwinding, got %v (%v)", result, err)
+	}
+	if virtualMachine.Executor.CurrentContext != nil {
+		t.Errorf("Expected no current context after the outermost context returned")
+	}
+}
@@ -49,7 +49,7 @@ func TestFactorial(t *testing.T) {
 	builder.Duplicate()
 
 	// JUMP_IF_FALSE to the false branch
-	builder.JumpIfFalse(12) // Jump past the true branch
+	builder.JumpIfFalse(4) // Jump past the true branch
 
 	// True branch: [1]
 	// POP the boolean (we don't need it anymore)
@@ -59,7 +59,7 @@ func TestFactorial(t *testing.T) {
 	builder.PushLiteral(oneIndex)
 
 	// JUMP past the false branch to the return
-	builder.Jump(35) // Jump to the return
+	builder.Jump(7) // Jump to the return
 
 	// False branch: [self * (self - 1) factorial]
 	// POP the boolean (we don't need it anymore)
@@ -139,4 +139,21 @@ func TestFactorial(t *testing.T) {
 			t.Errorf("Expected an immediate integer, got %v", result)
 		}
 	})
+
+	// Test factorial of 100, which is promoted to a large integer on the way
+	t.Run("Factorial of 100", func(t *testing.T) {
+		hundredObj := virtualMachine.NewInteger(100)
+		context := vm.NewContext(factorialMethod, hundredObj, []*pile.Object{}, nil)
+
+		result, err := virtualMachine.ExecuteContext(context)
+		if err != nil {
+			t.Errorf("Error executing factorial of 100: %v", err)
+			return
+		}
+
+		expected := "93326215443944152681699238856266700490715968264381621468592963895217599993229915608941463976156518286253697920827223758251185210916864000000000000000000000000"
+		if !pile.IsLargeInteger(result.(*pile.Object)) || result.String() != expected {
+			t.Errorf("Expected result to be %s, got %v", expected, result)
+		}
+	})
 }
@@ -0,0 +1,32 @@
+package vm_test
+
+import (
+	"testing"
+
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// newTestVM creates a VM with a subclass of Object named className, which has
+// the instance variables and the methods compiled from sources
+func newTestVM(t *testing.T, className string, instanceVarNames []string, sources ...string) *vm.VM {
+	t.Helper()
+	virtualMachine := vm.NewVM()
+	objectClass := pile.ObjectToClass(virtualMachine.Globals["Object"])
+	class := virtualMachine.NewClass(className, objectClass)
+	class.InstanceVarNames = append(class.InstanceVarNames, instanceVarNames...)
+	virtualMachine.Globals[className] = pile.ClassToObject(class)
+	compileMethods(t, virtualMachine, pile.ClassToObject(class), sources...)
+	return virtualMachine
+}
+
+// compileMethods compiles methods into a class, failing the test if one does not compile
+func compileMethods(t *testing.T, virtualMachine *vm.VM, class *pile.Object, sources ...string) {
+	t.Helper()
+	for _, source := range sources {
+		method := virtualMachine.CompileMethod(class, source, "")
+		if method.Class() == virtualMachine.Globals["SyntaxError"] {
+			t.Fatalf("Error compiling %q", source)
+		}
+	}
+}
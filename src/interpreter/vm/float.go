@@ -0,0 +1,313 @@
+package vm
+
+import (
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"smalltalklsp/interpreter/pile"
+)
+
+// numberLiteral matches the numbers readFrom: reads: an optional minus sign,
+// digits, optionally a fraction part and an exponent, and an s with an optional
+// scale for a ScaledDecimal
+var numberLiteral = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?(e-?[0-9]+)?(s[0-9]*)?$`)
+
+// floatFunction answers the result of f on the value of a float primitive's receiver
+func (vm *VM) floatFunction(receiver *pile.Object, f func(float64) float64) *pile.Object {
+	if value, ok := floatValue(receiver); ok {
+		return vm.NewFloat(f(value))
+	}
+	return vm.FailPrimitive(PrimitiveBadReceiver)
+}
+
+// primitiveFloatSqrt answers the square root of a float, NaN for a negative one
+func (vm *VM) primitiveFloatSqrt(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.floatFunction(receiver, math.Sqrt)
+}
+
+// primitiveFloatLn answers the natural logarithm of a float
+func (vm *VM) primitiveFloatLn(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.floatFunction(receiver, math.Log)
+}
+
+// primitiveFloatExp answers e raised to a float
+func (vm *VM) primitiveFloatExp(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.floatFunction(receiver, math.Exp)
+}
+
+// primitiveFloatSin answers the sine of a float in radians
+func (vm *VM) primitiveFloatSin(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.floatFunction(receiver, math.Sin)
+}
+
+// primitiveFloatCos answers the cosine of a float in radians
+func (vm *VM) primitiveFloatCos(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.floatFunction(receiver, math.Cos)
+}
+
+// primitiveFloatTan answers the tangent of a float in radians
+func (vm *VM) primitiveFloatTan(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.floatFunction(receiver, math.Tan)
+}
+
+// primitiveFloatArcSin answers the angle in radians whose sine is a float
+func (vm *VM) primitiveFloatArcSin(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.floatFunction(receiver, math.Asin)
+}
+
+// primitiveFloatArcCos answers the angle in radians whose cosine is a float
+func (vm *VM) primitiveFloatArcCos(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.floatFunction(receiver, math.Acos)
+}
+
+// primitiveFloatArcTan answers the angle in radians whose tangent is a float
+func (vm *VM) primitiveFloatArcTan(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.floatFunction(receiver, math.Atan)
+}
+
+// primitiveFloatIsNaN answers whether a float is NaN
+func (vm *VM) primitiveFloatIsNaN(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if value, ok := floatValue(receiver); ok {
+		return pile.NewBoolean(math.IsNaN(value)).(*pile.Object)
+	}
+	return vm.FailPrimitive(PrimitiveBadReceiver)
+}
+
+// primitiveFloatIsInfinite answers whether a float is positive or negative infinity
+func (vm *VM) primitiveFloatIsInfinite(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if value, ok := floatValue(receiver); ok {
+		return pile.NewBoolean(math.IsInf(value, 0)).(*pile.Object)
+	}
+	return vm.FailPrimitive(PrimitiveBadReceiver)
+}
+
+// primitiveFloatPrintString answers the shortest digits that read back as the same float
+func (vm *VM) primitiveFloatPrintString(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if value, ok := floatValue(receiver); ok {
+		return vm.NewString(floatPrintString(value))
+	}
+	return vm.FailPrimitive(PrimitiveBadReceiver)
+}
+
+// floatPrintString renders a float with the fewest digits that read back as the
+// same value, always with a point, and with an exponent for very large or small
+// values: 0.1, 100.0, 1.0e16, 2.5e-7, -0.0, NaN, Infinity
+func floatPrintString(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "Infinity"
+	case math.IsInf(value, -1):
+		return "-Infinity"
+	}
+
+	scientific := strconv.FormatFloat(value, 'e', -1, 64)
+	index := strings.IndexByte(scientific, 'e')
+	exponent, _ := strconv.Atoi(scientific[index+1:])
+
+	text := scientific[:index]
+	if exponent >= -5 && exponent < 16 {
+		text = strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	if !strings.Contains(text, ".") {
+		text += ".0"
+	}
+	if exponent < -5 || exponent >= 16 {
+		text += "e" + strconv.Itoa(exponent)
+	}
+	return text
+}
+
+// numberAsFloat returns the nearest float to any number, or false if obj is not a number
+func (vm *VM) numberAsFloat(obj *pile.Object) (float64, bool) {
+	if value, ok := floatValue(obj); ok {
+		return value, true
+	}
+	if value, ok := vm.rationalValue(obj); ok {
+		result, _ := value.Float64()
+		return result, true
+	}
+	if value, _, ok := vm.scaledDecimalValue(obj); ok {
+		result, _ := value.Float64()
+		return result, true
+	}
+	return 0, false
+}
+
+// exactValue returns the value of any number but a float, or false if obj is a float or not a number
+func (vm *VM) exactValue(obj *pile.Object) (*big.Rat, bool) {
+	if value, ok := vm.rationalValue(obj); ok {
+		return value, true
+	}
+	value, _, ok := vm.scaledDecimalValue(obj)
+	return value, ok
+}
+
+// roundNumber answers a number rounded to an integer by round, which is given
+// the value of an integer, Fraction or ScaledDecimal receiver as a quotient of
+// integers. A float rounds with roundFloat and fails if it is NaN or infinite.
+func (vm *VM) roundNumber(receiver *pile.Object, round func(num, denom *big.Int) *big.Int, roundFloat func(float64) float64) *pile.Object {
+	if value, ok := vm.exactValue(receiver); ok {
+		return vm.NewLargeInteger(round(value.Num(), value.Denom()))
+	}
+	value, ok := floatValue(receiver)
+	if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	result, _ := big.NewFloat(roundFloat(value)).Int(nil)
+	return vm.NewLargeInteger(result)
+}
+
+// primitiveNumberTruncated answers the integer nearest a number towards zero
+func (vm *VM) primitiveNumberTruncated(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.roundNumber(receiver, func(num, denom *big.Int) *big.Int {
+		return new(big.Int).Quo(num, denom)
+	}, math.Trunc)
+}
+
+// primitiveNumberFloor answers the largest integer not greater than a number
+func (vm *VM) primitiveNumberFloor(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.roundNumber(receiver, func(num, denom *big.Int) *big.Int {
+		quotient, _ := floorDivideLarge(num, denom)
+		return quotient
+	}, math.Floor)
+}
+
+// primitiveNumberCeiling answers the smallest integer not less than a number
+func (vm *VM) primitiveNumberCeiling(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.roundNumber(receiver, func(num, denom *big.Int) *big.Int {
+		quotient, _ := floorDivideLarge(new(big.Int).Neg(num), denom)
+		return quotient.Neg(quotient)
+	}, math.Ceil)
+}
+
+// primitiveNumberRounded answers the integer nearest a number, away from zero for halves
+func (vm *VM) primitiveNumberRounded(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.roundNumber(receiver, func(num, denom *big.Int) *big.Int {
+		// Truncate num/denom + 1/2 with the sign of the number, that is (2 num ± denom) / 2 denom
+		twice := new(big.Int).Lsh(num, 1)
+		if num.Sign() < 0 {
+			twice.Sub(twice, denom)
+		} else {
+			twice.Add(twice, denom)
+		}
+		return twice.Quo(twice, new(big.Int).Lsh(denom, 1))
+	}, math.Round)
+}
+
+// primitiveNumberRaisedTo answers a number raised to a power. An exact number
+// raised to an integer answers an exact result of the receiver's kind, anything
+// else answers a float.
+func (vm *VM) primitiveNumberRaisedTo(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	value, exact := vm.exactValue(receiver)
+	if exact && pile.IsIntegerImmediate(args[0]) {
+		exponent := pile.GetIntegerImmediate(args[0])
+		if exponent < 0 && value.Sign() == 0 {
+			return vm.signalZeroDivide(receiver, "raisedTo:")
+		}
+		power := exponent
+		if power < 0 {
+			power = -power
+		}
+		if power > maxBitShift || int64(value.Num().BitLen()+value.Denom().BitLen()-1)*power > maxBitShift {
+			return vm.FailPrimitive(PrimitiveBadArgument)
+		}
+
+		num := new(big.Int).Exp(value.Num(), big.NewInt(power), nil)
+		denom := new(big.Int).Exp(value.Denom(), big.NewInt(power), nil)
+		result := new(big.Rat).SetFrac(num, denom)
+		if exponent < 0 {
+			result.Inv(result)
+		}
+		if _, scale, ok := vm.scaledDecimalValue(receiver); ok {
+			return vm.NewScaledDecimal(result, scale)
+		}
+		return vm.NewFraction(result)
+	}
+
+	base, ok1 := vm.numberAsFloat(receiver)
+	exponent, ok2 := vm.numberAsFloat(args[0])
+	if !ok1 || !ok2 {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	return vm.NewFloat(math.Pow(base, exponent))
+}
+
+// primitiveNumberReadFrom answers the number a String holds, in the syntax of
+// number literals: an integer, a float if it has a point, a Fraction for an
+// integer with a negative exponent such as 1e-2, and a ScaledDecimal if it ends
+// in s with an optional scale. NaN, Infinity and -Infinity read as floats.
+// Float and its subclasses read every number as a float.
+func (vm *VM) primitiveNumberReadFrom(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if pile.IsImmediate(args[0]) || args[0].Type() != pile.OBJ_STRING {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	text := strings.TrimSpace(pile.ObjectToString(args[0]).GetValue())
+
+	switch text {
+	case "NaN":
+		return vm.NewFloat(math.NaN())
+	case "Infinity":
+		return vm.NewFloat(math.Inf(1))
+	case "-Infinity":
+		return vm.NewFloat(math.Inf(-1))
+	}
+	if !numberLiteral.MatchString(text) {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+
+	if isClass(receiver) && inheritsFrom(pile.ObjectToClass(receiver), "Float") {
+		if index := strings.IndexByte(text, 's'); index >= 0 {
+			text = text[:index]
+		}
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil && !math.IsInf(value, 0) {
+			return vm.FailPrimitive(PrimitiveBadArgument)
+		}
+		return vm.NewFloat(value)
+	}
+
+	if index := strings.IndexByte(text, 's'); index >= 0 {
+		mantissa, scaleText := text[:index], text[index+1:]
+		value, ok := new(big.Rat).SetString(mantissa)
+		if !ok {
+			return vm.FailPrimitive(PrimitiveBadArgument)
+		}
+		// Without a scale the number keeps the digits it was written with
+		scale := 0
+		if point := strings.IndexByte(mantissa, '.'); point >= 0 && !strings.Contains(mantissa, "e") {
+			scale = len(mantissa) - point - 1
+		}
+		if scaleText != "" {
+			scale, _ = strconv.Atoi(scaleText)
+		}
+		if scale > maxScale {
+			return vm.FailPrimitive(PrimitiveBadArgument)
+		}
+		return vm.NewScaledDecimal(value, scale)
+	}
+
+	if strings.Contains(text, ".") {
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil && !math.IsInf(value, 0) {
+			return vm.FailPrimitive(PrimitiveBadArgument)
+		}
+		return vm.NewFloat(value)
+	}
+
+	// An integer with an exponent is exact, and a power of ten has a little over 3 bits per digit
+	if exponent := strings.IndexByte(text, 'e'); exponent >= 0 {
+		if power, _ := strconv.Atoi(text[exponent+1:]); power > maxBitShift/4 || power < -maxBitShift/4 {
+			return vm.FailPrimitive(PrimitiveBadArgument)
+		}
+	}
+	value, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	return vm.NewFraction(value)
+}
@@ -0,0 +1,153 @@
+package vm_test
+
+import (
+	"testing"
+
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// TestFloatMath tests the math functions, rounding and testing methods of numbers
+func TestFloatMath(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		{"16 sqrt", virtualMachine.NewFloat(4)},
+		{"(1 / 4) sqrt", virtualMachine.NewFloat(0.5)},
+		{"1 exp ln", virtualMachine.NewFloat(1)},
+		{"0 exp", virtualMachine.NewFloat(1)},
+		{"8 log: 2", virtualMachine.NewFloat(3)},
+		{"0 sin", virtualMachine.NewFloat(0)},
+		{"0 cos", virtualMachine.NewFloat(1)},
+		{"1 arcTan * 4", virtualMachine.NewFloat(3.141592653589793)},
+		{"1 arcSin * 2", virtualMachine.NewFloat(3.141592653589793)},
+		{"1 arcCos", virtualMachine.NewFloat(0)},
+		{"0 tan", virtualMachine.NewFloat(0)},
+		{"2 raisedTo: 10", virtualMachine.NewInteger(1024)},
+		{"(2 raisedTo: 100) = (1 bitShift: 100)", virtualMachine.NewTrue()},
+		{"(2 raisedTo: 0 - 2) = (1 / 4)", virtualMachine.NewTrue()},
+		{"((2 / 3) raisedTo: 2) = (4 / 9)", virtualMachine.NewTrue()},
+		{"4 raisedTo: 1 / 2", virtualMachine.NewFloat(2)},
+		{"2 asFloat raisedTo: 3", virtualMachine.NewFloat(8)},
+		{"(7 asFloat / 2) truncated", virtualMachine.NewInteger(3)},
+		{"(0 - (7 asFloat / 2)) truncated", virtualMachine.NewInteger(-3)},
+		{"(0 - (7 asFloat / 2)) floor", virtualMachine.NewInteger(-4)},
+		{"(7 asFloat / 2) ceiling", virtualMachine.NewInteger(4)},
+		{"(7 asFloat / 2) rounded", virtualMachine.NewInteger(4)},
+		{"(0 - (7 asFloat / 2)) rounded", virtualMachine.NewInteger(-4)},
+		{"(1 bitShift: 100) asFloat truncated = (1 bitShift: 100)", virtualMachine.NewTrue()},
+		{"(7 / 2) truncated", virtualMachine.NewInteger(3)},
+		{"((0 - 7) / 2) floor", virtualMachine.NewInteger(-4)},
+		{"((0 - 7) / 2) ceiling", virtualMachine.NewInteger(-3)},
+		{"((0 - 7) / 2) rounded", virtualMachine.NewInteger(-4)},
+		{"(1 / 3) rounded", virtualMachine.NewInteger(0)},
+		{"((5 / 4) asScaledDecimal: 2) rounded", virtualMachine.NewInteger(1)},
+		{"7 floor", virtualMachine.NewInteger(7)},
+		{"17 roundTo: 5", virtualMachine.NewInteger(15)},
+		{"(7 asFloat / 2) roundTo: 2", virtualMachine.NewInteger(4)},
+		{"((1 bitShift: 2000) asFloat - (1 bitShift: 2000) asFloat) isNaN", virtualMachine.NewTrue()},
+		{"(1 bitShift: 2000) asFloat isInfinite", virtualMachine.NewTrue()},
+		{"1 asFloat isNaN", virtualMachine.NewFalse()},
+		{"1 isInfinite", virtualMachine.NewFalse()},
+		{"(1 / 2) isNaN", virtualMachine.NewFalse()},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	failures := []struct {
+		expression string
+		expected   string
+	}{
+		{"0 raisedTo: 0 - 1", "unhandled ZeroDivide: Integer>>raisedTo: division by zero"},
+		{"(1 bitShift: 2000) asFloat truncated", "unhandled PrimitiveFailed: Float>>truncated primitive failed: bad receiver"},
+		{"2 raisedTo: 'two'", "unhandled PrimitiveFailed: Integer>>raisedTo: primitive failed: bad argument"},
+	}
+	for _, test := range failures {
+		_, err := executeExpression(t, virtualMachine, test.expression)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Expected %q to fail with %q, got %v", test.expression, test.expected, err)
+		}
+	}
+}
+
+// TestFloatPrinting tests that floats print with the shortest digits that read back as
+// the same float, and that Number readFrom: reads every kind of number
+func TestFloatPrinting(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	objectClass := pile.ObjectToClass(virtualMachine.Globals["Object"])
+	stream := virtualMachine.NewClass("TestStream", objectClass)
+	virtualMachine.Globals["TestStream"] = pile.ClassToObject(stream)
+	virtualMachine.CompileMethod(pile.ClassToObject(stream), "nextPutAll: aString ^aString", "")
+
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"(1 asFloat / 10) printString", "0.1"},
+		{"((1 asFloat / 10) + (2 asFloat / 10)) printString", "0.30000000000000004"},
+		{"100 asFloat printString", "100.0"},
+		{"(0 - (3 asFloat / 2)) printString", "-1.5"},
+		{"(0 asFloat * (0 - 1)) printString", "-0.0"},
+		{"(10 raisedTo: 16) asFloat printString", "1.0e16"},
+		{"(1 asFloat / 3 / 100000) printString", "3.3333333333333333e-6"},
+		{"(10 raisedTo: 100) asFloat printString", "1.0e100"},
+		{"2 sqrt printString", "1.4142135623730951"},
+		{"(1 bitShift: 2000) asFloat printString", "Infinity"},
+		{"(0 - (1 bitShift: 2000) asFloat) printString", "-Infinity"},
+		{"((1 bitShift: 2000) asFloat - (1 bitShift: 2000) asFloat) printString", "NaN"},
+		{"(Number readFrom: '3.14') printString", "3.14"},
+		{"(Number readFrom: '0.30000000000000004') printString", "0.30000000000000004"},
+		{"(Number readFrom: '-2.5e-3') printString", "-0.0025"},
+		{"(Number readFrom: '1.5e400') printString", "Infinity"},
+		{"(Number readFrom: 'NaN') printString", "NaN"},
+		{"(Number readFrom: '1e-2') printString", "(1/100)"},
+		{"(Number readFrom: '3.14s2') printString", "3.14s2"},
+		{"(Float readFrom: '1e-300') printString", "1.0e-300"},
+		{"(Float readFrom: '3') printString", "3.0"},
+		{"(Float readFrom: '1e-2') printString", "0.01"},
+		{"(Float readFrom: '3.14s2') printString", "3.14"},
+		{"(BoxedFloat64 readFrom: '2') printString", "2.0"},
+		{"(2 asFloat sqrt) printOn: TestStream new", "1.4142135623730951"},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil {
+			t.Errorf("Error executing %q: %v", test.expression, err)
+			continue
+		}
+		if result.Type() != pile.OBJ_STRING || pile.ObjectToString(result).GetValue() != test.expected {
+			t.Errorf("Expected %q to answer '%s', got %v", test.expression, test.expected, result)
+		}
+	}
+
+	values := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		{"Number readFrom: '42'", virtualMachine.NewInteger(42)},
+		{"Number readFrom: ' -7 '", virtualMachine.NewInteger(-7)},
+		{"Number readFrom: '1e3'", virtualMachine.NewInteger(1000)},
+		{"(Number readFrom: '100000000000000000000') = (10 raisedTo: 20)", virtualMachine.NewTrue()},
+		{"(Number readFrom: (1 asFloat / 3) printString) = (1 asFloat / 3)", virtualMachine.NewTrue()},
+		{"(Number readFrom: '1.5s') scale", virtualMachine.NewInteger(1)},
+		{"Integer readFrom: '5'", virtualMachine.NewInteger(5)},
+		{"(Float readFrom: '3') class", virtualMachine.Globals["Float"]},
+	}
+	for _, test := range values {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	if _, err := executeExpression(t, virtualMachine, "Number readFrom: 'pi'"); err == nil || err.Error() != "unhandled PrimitiveFailed: Number class>>readFrom: primitive failed: bad argument" {
+		t.Errorf("Expected readFrom: to fail for a String that is not a number, got %v", err)
+	}
+}
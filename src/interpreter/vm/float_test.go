@@ -0,0 +1,80 @@
+package vm_test
+
+import (
+	"math"
+	"testing"
+
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// TestBoxedFloats tests that floats which do not fit in an immediate are boxed
+// and keep their full precision through arithmetic and comparisons
+func TestBoxedFloats(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		expression string
+		class      string
+		expected   string
+	}{
+		{"1 asFloat / 10", "BoxedFloat64", "0.1"},
+		{"(1 asFloat / 10) + (2 asFloat / 10)", "Float", "0.30000000000000004"},
+		{"(1 asFloat / 10) + (7 asFloat / 10)", "BoxedFloat64", "0.7999999999999999"},
+		{"1 + (1 asFloat / 3)", "BoxedFloat64", "1.3333333333333333"},
+		{"(1 asFloat / 3) * 3", "Float", "1"},
+		{"1 asFloat / 2", "Float", "0.5"},
+		{"(1 / 10) asFloat", "BoxedFloat64", "0.1"},
+		{"(1 bitShift: 2000) asFloat", "Float", "+Inf"},
+		{"0 - (1 bitShift: 2000) asFloat", "Float", "-Inf"},
+		{"0 asFloat * (0 - 1)", "Float", "-0"},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil {
+			t.Fatalf("Error executing %q: %v", test.expression, err)
+		}
+		object := result.(*pile.Object)
+		if class := virtualMachine.GetClass(object).Name; class != test.class || object.String() != test.expected {
+			t.Errorf("Expected %q to answer %s %s, got %s %v", test.expression, test.class, test.expected, class, object)
+		}
+	}
+
+	values := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		{"(1 asFloat / 10) + (2 asFloat / 10) = (3 asFloat / 10)", virtualMachine.NewFalse()},
+		{"(1 asFloat / 10) = (1 asFloat / 10)", virtualMachine.NewTrue()},
+		{"(1 asFloat / 10) < (1 asFloat / 9)", virtualMachine.NewTrue()},
+		{"(1 asFloat / 3) > (1 / 3)", virtualMachine.NewFalse()},
+		{"BoxedFloat64 superclass", virtualMachine.Globals["Float"]},
+		{"(1 asFloat / 10) sign", virtualMachine.NewInteger(1)},
+		{"((1 asFloat / 10) asScaledDecimal: 3) scale", virtualMachine.NewInteger(3)},
+		{"(1 bitShift: 2000) asFloat > (1 bitShift: 1000) asFloat", virtualMachine.NewTrue()},
+		{"0 asFloat * (0 - 1) = 0", virtualMachine.NewTrue()},
+		{"(0 asFloat * (0 - 1)) sign", virtualMachine.NewInteger(0)},
+	}
+	for _, test := range values {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	// NaN is not equal to anything, itself included
+	nan := "((1 bitShift: 2000) asFloat - (1 bitShift: 2000) asFloat)"
+	for _, expression := range []string{nan + " = " + nan, nan + " < 1", nan + " > 1"} {
+		result, err := executeExpression(t, virtualMachine, expression)
+		if err != nil || result != virtualMachine.NewFalse() {
+			t.Errorf("Expected %q to answer false, got %v (%v)", expression, result, err)
+		}
+	}
+
+	if result := virtualMachine.NewFloat(0.1); !pile.IsBoxedFloat(result) || pile.ObjectToBoxedFloat(result).Value != 0.1 {
+		t.Errorf("Expected NewFloat to answer a boxed float, got %v", result)
+	}
+	if result := virtualMachine.NewFloat(math.Copysign(0, -1)); !pile.IsFloatImmediate(result) || !math.Signbit(pile.GetFloatImmediate(result)) {
+		t.Errorf("Expected NewFloat to keep negative zero immediate, got %v", result)
+	}
+}
@@ -0,0 +1,194 @@
+package vm
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+
+	"smalltalklsp/interpreter/pile"
+)
+
+// installKernelMethod compiles a kernel method and panics if it does not compile
+// A class name ending in " class" installs it on the class side.
+func (vm *VM) installKernelMethod(className string, source string) {
+	class := vm.Globals[strings.TrimSuffix(className, " class")]
+	if strings.HasSuffix(className, " class") {
+		class = pile.ClassToObject(vm.GetClass(class))
+	}
+	method := vm.CompileMethod(class, source, "")
+	if method.Class() == vm.Globals["SyntaxError"] {
+		panic(fmt.Sprintf("cannot compile %s>>%s: %s", className, source,
+			pile.ObjectToString(method.GetInstanceVarByIndex(syntaxErrorMessageText)).GetValue()))
+	}
+}
+
+// kernelMethods are the methods compiled from source when the VM starts, mostly
+// arithmetic whose primitives only handle operands they know. When a primitive
+// fails the argument is asked to adapt the receiver with adaptToInteger:andSend:,
+// adaptToFraction:andSend:, adaptToScaledDecimal:andSend: or adaptToFloat:andSend:.
+// A number converts the receiver or itself to the more general class, in the order
+// Integer, Fraction, ScaledDecimal, Float, and sends again, anything else signals
+// an Error. New number classes join in by implementing those messages.
+var kernelMethods = []struct {
+	className string
+	source    string
+}{
+	{"Integer", "+ aNumber <primitive: 1> ^aNumber adaptToInteger: self andSend: #+"},
+	{"Integer", "- aNumber <primitive: 4> ^aNumber adaptToInteger: self andSend: #-"},
+	{"Integer", "* aNumber <primitive: 2> ^aNumber adaptToInteger: self andSend: #*"},
+	{"Integer", "< aNumber <primitive: 6> ^aNumber adaptToInteger: self andSend: #<"},
+	{"Integer", "> aNumber <primitive: 7> ^aNumber adaptToInteger: self andSend: #>"},
+	{"Integer", "= aNumber <primitive: 3> ^aNumber adaptToInteger: self andCompare: #="},
+	{"Integer", "<= aNumber <primitive: 104> ^aNumber adaptToInteger: self andSend: #<="},
+	{"Integer", ">= aNumber <primitive: 105> ^aNumber adaptToInteger: self andSend: #>="},
+	{"Integer", "/ aNumber <primitive: 112> ^aNumber adaptToInteger: self andSend: #/"},
+	{"Integer", "numerator ^self"},
+	{"Integer", "denominator ^1"},
+	{"Fraction", "+ aNumber <primitive: 120> ^aNumber adaptToFraction: self andSend: #+"},
+	{"Fraction", "- aNumber <primitive: 121> ^aNumber adaptToFraction: self andSend: #-"},
+	{"Fraction", "* aNumber <primitive: 122> ^aNumber adaptToFraction: self andSend: #*"},
+	{"Fraction", "/ aNumber <primitive: 123> ^aNumber adaptToFraction: self andSend: #/"},
+	{"Fraction", "< aNumber <primitive: 125> ^aNumber adaptToFraction: self andSend: #<"},
+	{"Fraction", "> aNumber <primitive: 126> ^aNumber adaptToFraction: self andSend: #>"},
+	{"Fraction", "= aNumber <primitive: 124> ^aNumber adaptToFraction: self andCompare: #="},
+	{"ScaledDecimal", "+ aNumber <primitive: 130> ^aNumber adaptToScaledDecimal: self andSend: #+"},
+	{"ScaledDecimal", "- aNumber <primitive: 131> ^aNumber adaptToScaledDecimal: self andSend: #-"},
+	{"ScaledDecimal", "* aNumber <primitive: 132> ^aNumber adaptToScaledDecimal: self andSend: #*"},
+	{"ScaledDecimal", "/ aNumber <primitive: 133> ^aNumber adaptToScaledDecimal: self andSend: #/"},
+	{"ScaledDecimal", "< aNumber <primitive: 135> ^aNumber adaptToScaledDecimal: self andSend: #<"},
+	{"ScaledDecimal", "> aNumber <primitive: 136> ^aNumber adaptToScaledDecimal: self andSend: #>"},
+	{"ScaledDecimal", "= aNumber <primitive: 134> ^aNumber adaptToScaledDecimal: self andCompare: #="},
+	{"Float", "+ aNumber <primitive: 10> ^aNumber adaptToFloat: self andSend: #+"},
+	{"Float", "- aNumber <primitive: 11> ^aNumber adaptToFloat: self andSend: #-"},
+	{"Float", "* aNumber <primitive: 12> ^aNumber adaptToFloat: self andSend: #*"},
+	{"Float", "/ aNumber <primitive: 13> ^aNumber adaptToFloat: self andSend: #/"},
+	{"Float", "< aNumber <primitive: 15> ^aNumber adaptToFloat: self andSend: #<"},
+	{"Float", "> aNumber <primitive: 16> ^aNumber adaptToFloat: self andSend: #>"},
+	{"Float", "= aNumber <primitive: 14> ^aNumber adaptToFloat: self andCompare: #="},
+	{"Float", "asFloat ^self"},
+	{"Number", "<= aNumber ^(self > aNumber) not"},
+	{"Number", ">= aNumber ^(self < aNumber) not"},
+	{"Number", "~= aNumber ^(self = aNumber) not"},
+	{"Number", "negated ^0 - self"},
+	{"Number", "abs ^self * self sign"},
+	{"Number", "reciprocal ^1 / self"},
+	{"Number", "sqrt ^self asFloat sqrt"},
+	{"Number", "ln ^self asFloat ln"},
+	{"Number", "log: aNumber ^self ln / aNumber ln"},
+	{"Number", "exp ^self asFloat exp"},
+	{"Number", "sin ^self asFloat sin"},
+	{"Number", "cos ^self asFloat cos"},
+	{"Number", "tan ^self asFloat tan"},
+	{"Number", "arcSin ^self asFloat arcSin"},
+	{"Number", "arcCos ^self asFloat arcCos"},
+	{"Number", "arcTan ^self asFloat arcTan"},
+	{"Number", "roundTo: quantum ^(self / quantum) rounded * quantum"},
+	{"Number", "isNaN ^false"},
+	{"Number", "isInfinite ^false"},
+	{"Number", "printOn: aStream ^aStream nextPutAll: self printString"},
+	{"Fraction", "adaptToInteger: rcvr andSend: selector ^(Fraction numerator: rcvr denominator: 1) perform: selector with: self"},
+	{"Fraction", "adaptToInteger: rcvr andCompare: selector ^(Fraction numerator: rcvr denominator: 1) perform: selector with: self"},
+	{"ScaledDecimal", "adaptToInteger: rcvr andSend: selector ^(rcvr asScaledDecimal: 0) perform: selector with: self"},
+	{"ScaledDecimal", "adaptToInteger: rcvr andCompare: selector ^(rcvr asScaledDecimal: 0) perform: selector with: self"},
+	{"ScaledDecimal", "adaptToFraction: rcvr andSend: selector ^(rcvr asScaledDecimal: scale) perform: selector with: self"},
+	{"ScaledDecimal", "adaptToFraction: rcvr andCompare: selector ^(rcvr asScaledDecimal: scale) perform: selector with: self"},
+	{"Float", "adaptToInteger: rcvr andSend: selector ^rcvr asFloat perform: selector with: self"},
+	{"Float", "adaptToInteger: rcvr andCompare: selector ^rcvr asFloat perform: selector with: self"},
+	{"Float", "adaptToFraction: rcvr andSend: selector ^rcvr asFloat perform: selector with: self"},
+	{"Float", "adaptToFraction: rcvr andCompare: selector ^rcvr asFloat perform: selector with: self"},
+	{"Float", "adaptToScaledDecimal: rcvr andSend: selector ^rcvr asFloat perform: selector with: self"},
+	{"Float", "adaptToScaledDecimal: rcvr andCompare: selector ^rcvr asFloat perform: selector with: self"},
+	{"Number", "adaptToFloat: rcvr andSend: selector ^rcvr perform: selector with: self asFloat"},
+	{"Number", "adaptToFloat: rcvr andCompare: selector ^rcvr perform: selector with: self asFloat"},
+	{"Object", "adaptToInteger: rcvr andCompare: selector ^false"},
+	{"Object", "adaptToFraction: rcvr andCompare: selector ^false"},
+	{"Object", "adaptToScaledDecimal: rcvr andCompare: selector ^false"},
+	{"Object", "adaptToFloat: rcvr andCompare: selector ^false"},
+	{"Block", "on: exceptionClass do: handlerBlock <primitive: 199> ^self value"},
+	{"Block", "ensure: aBlock <primitive: 168> | complete result | result := self value. complete := true. aBlock value. ^result"},
+	{"Block", "ifCurtailed: aBlock <primitive: 169> | complete result | result := self value. complete := true. ^result"},
+	{"True", "ifTrue: trueBlock ^trueBlock value"},
+	{"True", "ifFalse: falseBlock ^nil"},
+	{"True", "ifTrue: trueBlock ifFalse: falseBlock ^trueBlock value"},
+	{"True", "ifFalse: falseBlock ifTrue: trueBlock ^trueBlock value"},
+	{"False", "ifTrue: trueBlock ^nil"},
+	{"False", "ifFalse: falseBlock ^falseBlock value"},
+	{"False", "ifTrue: trueBlock ifFalse: falseBlock ^falseBlock value"},
+	{"False", "ifFalse: falseBlock ifTrue: trueBlock ^falseBlock value"},
+	{"Exception", "signal: aString ^(self messageText: aString) signal"},
+	{"Exception", "isResumable ^true"},
+	{"Error", "isResumable ^false"},
+	{"MessageNotUnderstood", "isResumable ^true"},
+	{"Exception class", "handles: anException ^anException isKindOf: self"},
+	{"Exception class", "signal ^self new signal"},
+	{"Exception class", "signal: aString ^self new signal: aString"},
+	{"Block", "fork ^self newProcess resume"},
+	{"Block", "forkAt: priority ^(self newProcess priority: priority) resume"},
+	{"ProcessorScheduler", "lowestPriority ^1"},
+	{"ProcessorScheduler", "userBackgroundPriority ^3"},
+	{"ProcessorScheduler", "userSchedulingPriority ^4"},
+	{"ProcessorScheduler", "userInterruptPriority ^5"},
+	{"ProcessorScheduler", "lowIOPriority ^6"},
+	{"ProcessorScheduler", "highIOPriority ^7"},
+	{"ProcessorScheduler", "timingPriority ^8"},
+	{"Semaphore class", "forMutualExclusion ^self new signal"},
+	{"SharedQueue", "isEmpty ^self size = 0"},
+	{"Delay class", "forSeconds: aNumber ^self forMilliseconds: (aNumber * 1000) rounded"},
+}
+
+// installKernelMethods compiles the kernel methods into their classes
+func (vm *VM) installKernelMethods() {
+	for _, method := range kernelMethods {
+		vm.installKernelMethod(method.className, method.source)
+	}
+}
+
+// primitivePerformWith sends a one-argument message named by a Symbol
+func (vm *VM) primitivePerformWith(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	selector := args[0]
+	if pile.IsImmediate(selector) || selector.Type() != pile.OBJ_SYMBOL || selectorArity(pile.GetSymbolValue(selector)) != 1 {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	return vm.Send(receiver, selector, args[1:])
+}
+
+// primitiveNotANumber signals the error for arithmetic with an argument that is not a number
+// The receiver is the argument, which was asked to adapt the number the message was sent to
+func (vm *VM) primitiveNotANumber(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	selector := args[1]
+	if pile.IsImmediate(selector) || selector.Type() != pile.OBJ_SYMBOL {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+
+	messageText := fmt.Sprintf("%s>>%s expects a Number argument, not an instance of %s",
+		vm.GetClass(args[0]).Name, pile.GetSymbolValue(selector), vm.GetClass(receiver).Name)
+	error := vm.newException("Error")
+	pile.ObjectToException(error).SetMessageText(vm.NewString(messageText))
+
+	// Answers the value of the handler, if there is one
+	return vm.Signal(error)
+}
+
+// primitiveIntegerAsFloat converts an integer to a float, the nearest one for a large integer
+func (vm *VM) primitiveIntegerAsFloat(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if pile.IsIntegerImmediate(receiver) {
+		return vm.NewFloat(float64(pile.GetIntegerImmediate(receiver)))
+	}
+	if pile.IsLargeInteger(receiver) {
+		value, _ := new(big.Float).SetInt(pile.ObjectToLargeInteger(receiver).Value).Float64()
+		return vm.NewFloat(value)
+	}
+	return vm.FailPrimitive(PrimitiveBadReceiver)
+}
+
+// selectorArity returns the number of arguments a message with selector takes
+func selectorArity(selector string) int {
+	if selector == "" {
+		return 0
+	}
+	if !unicode.IsLetter(rune(selector[0])) && selector[0] != '_' {
+		return 1 // Binary selector
+	}
+	return strings.Count(selector, ":")
+}
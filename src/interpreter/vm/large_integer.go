@@ -0,0 +1,256 @@
+package vm
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"smalltalklsp/interpreter/pile"
+)
+
+// maxBitShift is the largest number of bits bitShift: shifts an integer left by
+// Larger shifts fail rather than trying to allocate the result
+const maxBitShift = 1 << 24
+
+// NewLargePositiveIntegerClass creates LargePositiveInteger, the class of
+// integers above the range of immediate integers
+// Large integers get their methods from Integer, whose primitives take either kind.
+func (vm *VM) NewLargePositiveIntegerClass() *pile.Class {
+	integerClass := pile.ObjectToClass(vm.Globals["Integer"])
+	return pile.NewClass("LargePositiveInteger", integerClass)
+}
+
+// NewLargeNegativeIntegerClass creates LargeNegativeInteger, the class of
+// integers below the range of immediate integers
+func (vm *VM) NewLargeNegativeIntegerClass() *pile.Class {
+	integerClass := pile.ObjectToClass(vm.Globals["Integer"])
+	return pile.NewClass("LargeNegativeInteger", integerClass)
+}
+
+// NewLargeInteger creates an integer with the given value, which is an immediate
+// integer if it fits and a LargePositiveInteger or LargeNegativeInteger otherwise
+// The value belongs to the result afterwards and must not be changed.
+func (vm *VM) NewLargeInteger(value *big.Int) *pile.Object {
+	if pile.FitsIntegerImmediate(value) {
+		return pile.MakeIntegerImmediate(value.Int64())
+	}
+
+	vm.allocated()
+	largeInteger := pile.LargeIntegerToObject(pile.NewLargeIntegerInternal(value))
+	if value.Sign() < 0 {
+		largeInteger.SetClass(vm.Globals["LargeNegativeInteger"])
+	} else {
+		largeInteger.SetClass(vm.Globals["LargePositiveInteger"])
+	}
+	return largeInteger
+}
+
+// integerValue returns the value of an immediate or large integer, or false if
+// the object is not an integer. The result must not be changed.
+func integerValue(obj *pile.Object) (*big.Int, bool) {
+	if pile.IsIntegerImmediate(obj) {
+		return big.NewInt(pile.GetIntegerImmediate(obj)), true
+	}
+	if pile.IsLargeInteger(obj) {
+		return pile.ObjectToLargeInteger(obj).Value, true
+	}
+	return nil, false
+}
+
+// integerOperands returns the receiver and argument of an integer primitive,
+// either of which may be large, or false if either is not an integer
+func integerOperands(receiver *pile.Object, args []*pile.Object) (*big.Int, *big.Int, bool) {
+	val1, ok1 := integerValue(receiver)
+	val2, ok2 := integerValue(args[0])
+	return val1, val2, ok1 && ok2
+}
+
+// immediateOperands returns the receiver and argument of an integer primitive
+// if both are immediate integers, which most arithmetic handles without math/big
+func immediateOperands(receiver *pile.Object, args []*pile.Object) (int64, int64, bool) {
+	if pile.IsIntegerImmediate(receiver) && pile.IsIntegerImmediate(args[0]) {
+		return pile.GetIntegerImmediate(receiver), pile.GetIntegerImmediate(args[0]), true
+	}
+	return 0, 0, false
+}
+
+// floorDivide returns the quotient rounded towards negative infinity and the
+// remainder with the sign of the divisor, for // and \\
+func floorDivide(dividend int64, divisor int64) (int64, int64) {
+	quotient, remainder := dividend/divisor, dividend%divisor
+	if remainder != 0 && (remainder < 0) != (divisor < 0) {
+		quotient--
+		remainder += divisor
+	}
+	return quotient, remainder
+}
+
+// floorDivideLarge is floorDivide for large integers
+func floorDivideLarge(dividend *big.Int, divisor *big.Int) (*big.Int, *big.Int) {
+	quotient, remainder := new(big.Int).QuoRem(dividend, divisor, new(big.Int))
+	if remainder.Sign() != 0 && remainder.Sign() != divisor.Sign() {
+		quotient.Sub(quotient, big.NewInt(1))
+		remainder.Add(remainder, divisor)
+	}
+	return quotient, remainder
+}
+
+// primitiveIntegerQuotient answers the quotient of two integers rounded towards negative infinity
+func (vm *VM) primitiveIntegerQuotient(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := immediateOperands(receiver, args); ok && val2 != 0 {
+		quotient, _ := floorDivide(val1, val2)
+		return vm.NewInteger(quotient)
+	}
+	val1, val2, ok := integerOperands(receiver, args)
+	if !ok {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	if val2.Sign() == 0 {
+		return vm.signalZeroDivide(receiver, "//")
+	}
+	quotient, _ := floorDivideLarge(val1, val2)
+	return vm.NewLargeInteger(quotient)
+}
+
+// primitiveIntegerModulo answers the remainder of // with the sign of the argument
+func (vm *VM) primitiveIntegerModulo(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := immediateOperands(receiver, args); ok && val2 != 0 {
+		_, remainder := floorDivide(val1, val2)
+		return vm.NewInteger(remainder)
+	}
+	val1, val2, ok := integerOperands(receiver, args)
+	if !ok {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	if val2.Sign() == 0 {
+		return vm.signalZeroDivide(receiver, "\\\\")
+	}
+	_, remainder := floorDivideLarge(val1, val2)
+	return vm.NewLargeInteger(remainder)
+}
+
+// primitiveIntegerQuo answers the quotient of two integers truncated towards zero
+func (vm *VM) primitiveIntegerQuo(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := immediateOperands(receiver, args); ok && val2 != 0 {
+		return vm.NewInteger(val1 / val2)
+	}
+	val1, val2, ok := integerOperands(receiver, args)
+	if !ok {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	if val2.Sign() == 0 {
+		return vm.signalZeroDivide(receiver, "quo:")
+	}
+	return vm.NewLargeInteger(new(big.Int).Quo(val1, val2))
+}
+
+// primitiveIntegerRem answers the remainder of quo: with the sign of the receiver
+func (vm *VM) primitiveIntegerRem(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := immediateOperands(receiver, args); ok && val2 != 0 {
+		return vm.NewInteger(val1 % val2)
+	}
+	val1, val2, ok := integerOperands(receiver, args)
+	if !ok {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	if val2.Sign() == 0 {
+		return vm.signalZeroDivide(receiver, "rem:")
+	}
+	return vm.NewLargeInteger(new(big.Int).Rem(val1, val2))
+}
+
+// primitiveIntegerLessOrEqual compares two integers
+func (vm *VM) primitiveIntegerLessOrEqual(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := integerOperands(receiver, args); ok {
+		return pile.NewBoolean(val1.Cmp(val2) <= 0).(*pile.Object)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveIntegerGreaterOrEqual compares two integers
+func (vm *VM) primitiveIntegerGreaterOrEqual(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := integerOperands(receiver, args); ok {
+		return pile.NewBoolean(val1.Cmp(val2) >= 0).(*pile.Object)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveIntegerBitAnd answers the bits set in both integers, negative
+// integers act as if in two's complement with infinitely many sign bits
+func (vm *VM) primitiveIntegerBitAnd(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := immediateOperands(receiver, args); ok {
+		return vm.NewInteger(val1 & val2)
+	}
+	if val1, val2, ok := integerOperands(receiver, args); ok {
+		return vm.NewLargeInteger(new(big.Int).And(val1, val2))
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveIntegerBitOr answers the bits set in either integer
+func (vm *VM) primitiveIntegerBitOr(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := immediateOperands(receiver, args); ok {
+		return vm.NewInteger(val1 | val2)
+	}
+	if val1, val2, ok := integerOperands(receiver, args); ok {
+		return vm.NewLargeInteger(new(big.Int).Or(val1, val2))
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveIntegerBitXor answers the bits set in one integer but not the other
+func (vm *VM) primitiveIntegerBitXor(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := immediateOperands(receiver, args); ok {
+		return vm.NewInteger(val1 ^ val2)
+	}
+	if val1, val2, ok := integerOperands(receiver, args); ok {
+		return vm.NewLargeInteger(new(big.Int).Xor(val1, val2))
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveIntegerBitShift shifts an integer left by the argument, or right if
+// it is negative, which rounds towards negative infinity
+func (vm *VM) primitiveIntegerBitShift(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	value, ok := integerValue(receiver)
+	if !ok {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	if !pile.IsIntegerImmediate(args[0]) || pile.GetIntegerImmediate(args[0]) > maxBitShift {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+
+	shift := pile.GetIntegerImmediate(args[0])
+	if shift >= 0 {
+		return vm.NewLargeInteger(new(big.Int).Lsh(value, uint(shift)))
+	}
+	return vm.NewLargeInteger(new(big.Int).Rsh(value, uint(-shift)))
+}
+
+// primitiveIntegerPrintString answers the decimal digits of an integer as a String
+func (vm *VM) primitiveIntegerPrintString(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if pile.IsIntegerImmediate(receiver) {
+		return vm.NewString(strconv.FormatInt(pile.GetIntegerImmediate(receiver), 10))
+	}
+	if pile.IsLargeInteger(receiver) {
+		return vm.NewString(pile.ObjectToLargeInteger(receiver).String())
+	}
+	return vm.FailPrimitive(PrimitiveBadReceiver)
+}
+
+// primitiveIntegerPrintStringBase answers the digits of an integer in a base
+// from 2 to 36 as a String, with upper case letters for digits above 9
+func (vm *VM) primitiveIntegerPrintStringBase(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	value, ok := integerValue(receiver)
+	if !ok {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	if !pile.IsIntegerImmediate(args[0]) {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	base := pile.GetIntegerImmediate(args[0])
+	if base < 2 || base > 36 {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	return vm.NewString(strings.ToUpper(value.Text(int(base))))
+}
@@ -0,0 +1,115 @@
+package vm_test
+
+import (
+	"testing"
+
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// TestLargeIntegerPromotion tests that arithmetic past the range of immediate
+// integers answers large integers, and that results back in range are immediate
+func TestLargeIntegerPromotion(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		expression string
+		class      string
+		expected   string
+	}{
+		{"2305843009213693951 + 1", "LargePositiveInteger", "2305843009213693952"},
+		{"0 - 2305843009213693952 - 1", "LargeNegativeInteger", "-2305843009213693953"},
+		{"3000000000 * 3000000000", "LargePositiveInteger", "9000000000000000000"},
+		{"(1 bitShift: 100) * (1 bitShift: 100)", "LargePositiveInteger", "1606938044258990275541962092341162602522202993782792835301376"},
+		{"2305843009213693951 + 1 - 1", "Integer", "2305843009213693951"},
+		{"(1 bitShift: 100) - (1 bitShift: 100)", "Integer", "0"},
+		{"(1 bitShift: 100) negated", "LargeNegativeInteger", "-1267650600228229401496703205376"},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil {
+			t.Fatalf("Error executing %q: %v", test.expression, err)
+		}
+		object := result.(*pile.Object)
+		if class := virtualMachine.GetClass(object).Name; class != test.class || object.String() != test.expected {
+			t.Errorf("Expected %q to answer %s %s, got %s %v", test.expression, test.class, test.expected, class, object)
+		}
+	}
+
+	if result := virtualMachine.NewInteger(1 << 62); !pile.IsLargeInteger(result) || result.String() != "4611686018427387904" {
+		t.Errorf("Expected NewInteger to answer a large integer, got %v", result)
+	}
+}
+
+// TestLargeIntegerPrimitives tests arithmetic, comparison, printing and bitwise
+// primitives with small and large operands
+func TestLargeIntegerPrimitives(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		{"(1 bitShift: 100) > 5", virtualMachine.NewTrue()},
+		{"5 < (1 bitShift: 100)", virtualMachine.NewTrue()},
+		{"(1 bitShift: 100) <= 3", virtualMachine.NewFalse()},
+		{"(0 - (1 bitShift: 100)) >= (0 - (1 bitShift: 101))", virtualMachine.NewTrue()},
+		{"(1 bitShift: 100) = (1 bitShift: 100)", virtualMachine.NewTrue()},
+		{"(1 bitShift: 100) = 5", virtualMachine.NewFalse()},
+		{"(1 bitShift: 100) \\\\ 7", virtualMachine.NewInteger(2)},
+		{"(0 - (1 bitShift: 100)) \\\\ 7", virtualMachine.NewInteger(5)},
+		{"(0 - (1 bitShift: 100)) rem: 7", virtualMachine.NewInteger(-2)},
+		{"(0 - 7) // 2", virtualMachine.NewInteger(-4)},
+		{"(0 - 7) quo: 2", virtualMachine.NewInteger(-3)},
+		{"((1 bitShift: 100) + 5) bitAnd: 7", virtualMachine.NewInteger(5)},
+		{"(1 bitShift: 100) bitShift: 0 - 98", virtualMachine.NewInteger(4)},
+		{"(0 - (1 bitShift: 100)) bitShift: 0 - 200", virtualMachine.NewInteger(-1)},
+		{"((1 bitShift: 100) bitOr: 1) bitXor: (1 bitShift: 100)", virtualMachine.NewInteger(1)},
+		{"(1 bitShift: 100) asFloat", virtualMachine.NewFloat(1.2676506002282294e+30)},
+		{"(1 bitShift: 100) + 1 asFloat", virtualMachine.NewFloat(1.2676506002282294e+30)},
+		{"1 asFloat + (1 bitShift: 100)", virtualMachine.NewFloat(1.2676506002282294e+30)},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	strings := []struct {
+		expression string
+		expected   string
+	}{
+		{"(1 bitShift: 100) printString", "1267650600228229401496703205376"},
+		{"(1 bitShift: 100) // 7", "181092942889747057356671886482"},
+		{"(1 bitShift: 100) // (0 - 7)", "-181092942889747057356671886483"},
+		{"(0 - (1 bitShift: 100)) quo: 7", "-181092942889747057356671886482"},
+		{"42 printString", "42"},
+		{"(1 bitShift: 64) printString: 16", "10000000000000000"},
+		{"255 printString: 16", "FF"},
+	}
+	for _, test := range strings {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil {
+			t.Fatalf("Error executing %q: %v", test.expression, err)
+		}
+		if result.String() != test.expected && (result.Type() != pile.OBJ_STRING || pile.ObjectToString(result).GetValue() != test.expected) {
+			t.Errorf("Expected %q to answer %s, got %v", test.expression, test.expected, result)
+		}
+	}
+
+	failures := []struct {
+		expression string
+		expected   string
+	}{
+		{"(1 bitShift: 100) // 0", "unhandled ZeroDivide: LargePositiveInteger>>// division by zero"},
+		{"5 \\\\ 0", "unhandled ZeroDivide: Integer>>\\\\ division by zero"},
+		{"(1 bitShift: 100) bitAnd: 'seven'", "unhandled PrimitiveFailed: LargePositiveInteger>>bitAnd: primitive failed: bad argument"},
+	}
+	for _, test := range failures {
+		_, err := executeExpression(t, virtualMachine, test.expression)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Expected %q to fail with %q, got %v", test.expression, test.expected, err)
+		}
+	}
+}
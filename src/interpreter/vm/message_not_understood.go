@@ -0,0 +1,87 @@
+package vm
+
+import (
+	"fmt"
+
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/pile"
+)
+
+// Instance variable indices of Message
+const (
+	messageSelector  = 0
+	messageArguments = 1
+)
+
+// Instance variable indices of MessageNotUnderstood
+const (
+	messageNotUnderstoodMessage  = 0
+	messageNotUnderstoodReceiver = 1
+)
+
+// NewMessageClass creates Message, a send reified as its selector and arguments
+func (vm *VM) NewMessageClass() *pile.Class {
+	objectClass := pile.ObjectToClass(vm.Globals["Object"])
+	result := pile.NewClass("Message", objectClass)
+	result.InstanceVarNames = []string{"selector", "arguments"}
+
+	// Accessors for the instance variables
+	compiler.NewMethodBuilder(result).PushInstanceVariable(messageSelector).ReturnStackTop().Go("selector")
+	compiler.NewMethodBuilder(result).PushInstanceVariable(messageArguments).ReturnStackTop().Go("arguments")
+
+	return result
+}
+
+// NewMessageNotUnderstoodClass creates MessageNotUnderstood, the error
+// Object>>doesNotUnderstand: signals
+func (vm *VM) NewMessageNotUnderstoodClass() *pile.Class {
+	errorClass := pile.ObjectToClass(vm.Globals["Error"])
+	result := pile.NewClass("MessageNotUnderstood", errorClass)
+	result.InstanceVarNames = []string{"message", "receiver"}
+
+	// Accessors for the instance variables
+	compiler.NewMethodBuilder(result).PushInstanceVariable(messageNotUnderstoodMessage).ReturnStackTop().Go("message")
+	compiler.NewMethodBuilder(result).PushInstanceVariable(messageNotUnderstoodReceiver).ReturnStackTop().Go("receiver")
+
+	return result
+}
+
+// NewMessage creates a Message for a send of selector with args
+func (vm *VM) NewMessage(selector *pile.Object, args []*pile.Object) *pile.Object {
+	arguments := vm.NewArray(len(args))
+	for i, arg := range args {
+		pile.ObjectToArray(arguments).AtPut(i, arg)
+	}
+
+	vm.allocated()
+	messageClass := vm.Globals["Message"]
+	result := pile.NewClassInstance(pile.ObjectToClass(messageClass))
+	result.SetClass(messageClass)
+	result.SetInstanceVarByIndex(messageSelector, selector)
+	result.SetInstanceVarByIndex(messageArguments, arguments)
+	return result
+}
+
+// NewMessageNotUnderstood creates the MessageNotUnderstood for a message the receiver has no method for
+func (vm *VM) NewMessageNotUnderstood(receiver *pile.Object, message *pile.Object) *pile.Object {
+	selector := pile.GetSymbolValue(message.GetInstanceVarByIndex(messageSelector))
+	className := vm.GetClass(receiver).Name
+
+	result := vm.newException("MessageNotUnderstood")
+	result.InstanceVarsField = []*pile.Object{message, receiver}
+	pile.ObjectToException(result).SetMessageText(vm.NewString(fmt.Sprintf("%s doesNotUnderstand: #%s", className, selector)))
+	return result
+}
+
+// sendDoesNotUnderstand turns a send the receiver has no method for into a send
+// of doesNotUnderstand: with the original send reified as a Message. It returns
+// the method to run and its arguments, or nil if the receiver does not even
+// understand doesNotUnderstand:.
+func (vm *VM) sendDoesNotUnderstand(receiver *pile.Object, selector *pile.Object, args []*pile.Object) (*pile.Object, *pile.Object, []*pile.Object) {
+	doesNotUnderstand := pile.NewSymbol("doesNotUnderstand:")
+	methodObj := vm.LookupMethod(receiver, doesNotUnderstand)
+	if methodObj == nil {
+		return nil, nil, nil
+	}
+	return methodObj, doesNotUnderstand, []*pile.Object{vm.NewMessage(selector, args)}
+}
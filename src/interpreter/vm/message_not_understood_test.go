@@ -0,0 +1,78 @@
+package vm_test
+
+import (
+	"errors"
+	"testing"
+
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/parser"
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// executeExpression compiles an expression and runs it as the outermost context
+func executeExpression(t *testing.T, virtualMachine *vm.VM, source string) (pile.ObjectInterface, error) {
+	t.Helper()
+	objectClass := virtualMachine.Globals["Object"]
+	node, err := parser.NewParser(source, objectClass, virtualMachine).ParseExpression()
+	if err != nil {
+		t.Fatalf("Error parsing %q: %v", source, err)
+	}
+	method := compiler.NewBytecodeCompiler(objectClass).Compile(node)
+	context := vm.NewContext(pile.MethodToObject(method), virtualMachine.NilObject, []*pile.Object{}, nil)
+	return virtualMachine.ExecuteContext(context)
+}
+
+// TestDoesNotUnderstandOverride tests that a class can handle sends it has no method for
+func TestDoesNotUnderstandOverride(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	integerClass := virtualMachine.Globals["Integer"]
+
+	virtualMachine.CompileMethod(integerClass, "doesNotUnderstand: aMessage ^aMessage selector", "")
+	result, err := executeExpression(t, virtualMachine, "3 foo")
+	if err != nil {
+		t.Fatalf("Error executing: %v", err)
+	}
+	if selector := pile.GetSymbolValue(result.(*pile.Object)); selector != "foo" {
+		t.Errorf("Expected the message selector to be foo, got %s", selector)
+	}
+
+	virtualMachine.CompileMethod(integerClass, "doesNotUnderstand: aMessage ^aMessage arguments", "")
+	result, err = executeExpression(t, virtualMachine, "3 foo: 4 bar: 5")
+	if err != nil {
+		t.Fatalf("Error executing: %v", err)
+	}
+	arguments := pile.ObjectToArray(result.(*pile.Object))
+	if arguments.Size() != 2 || arguments.At(0) != virtualMachine.NewInteger(4) || arguments.At(1) != virtualMachine.NewInteger(5) {
+		t.Errorf("Expected the message arguments to be 4 and 5, got %v", result)
+	}
+}
+
+// TestMessageNotUnderstood tests the error the default doesNotUnderstand: signals
+func TestMessageNotUnderstood(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	_, err := executeExpression(t, virtualMachine, "3 foo: 4")
+	var unhandled *vm.UnhandledExceptionError
+	if !errors.As(err, &unhandled) {
+		t.Fatalf("Expected an unhandled exception, got %v", err)
+	}
+	if err.Error() != "unhandled MessageNotUnderstood: Integer doesNotUnderstand: #foo:" {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+
+	exception := unhandled.Exception
+	if !pile.IsKindOf(exception, virtualMachine.Globals["Error"]) {
+		t.Errorf("Expected MessageNotUnderstood to be an Error")
+	}
+	if receiver := exception.GetInstanceVarByIndex(1); receiver != virtualMachine.NewInteger(3) {
+		t.Errorf("Expected the receiver to be 3, got %v", receiver)
+	}
+	message := exception.GetInstanceVarByIndex(0)
+	if message.Class() != virtualMachine.Globals["Message"] {
+		t.Fatalf("Expected a Message, got %v", message)
+	}
+	if selector := pile.GetSymbolValue(message.GetInstanceVarByIndex(0)); selector != "foo:" {
+		t.Errorf("Expected the message selector to be foo:, got %s", selector)
+	}
+}
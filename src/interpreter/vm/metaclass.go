@@ -0,0 +1,110 @@
+package vm
+
+import (
+	"strings"
+
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/pile"
+)
+
+// NewMetaclassClass creates Metaclass, the class of every metaclass
+func (vm *VM) NewMetaclassClass() *pile.Class {
+	behaviorClass := pile.ObjectToClass(vm.Globals["Behavior"])
+	result := pile.NewClass("Metaclass", behaviorClass)
+
+	// instanceVariableNames: method (declares the class-instance variables)
+	compiler.NewMethodBuilder(result).Primitive(61).Go("instanceVariableNames:")
+
+	// soleInstance method (answers the class this is the metaclass of)
+	compiler.NewMethodBuilder(result).Primitive(64).Go("soleInstance")
+
+	return result
+}
+
+// NewMetaclass creates the metaclass of a class, named "Foo class" for Foo,
+// and makes it the class's class. Its superclass is the metaclass of the class's
+// superclass, and the metaclass of a class without one inherits from Class.
+func (vm *VM) NewMetaclass(class *pile.Class) *pile.Class {
+	var superclass *pile.Class
+	if class.SuperClass != nil {
+		superclass = vm.classOfClass(pile.ObjectToClass(class.SuperClass))
+	} else if classClass, ok := vm.Globals["Class"]; ok {
+		superclass = pile.ObjectToClass(classClass)
+	}
+
+	result := pile.NewClass(class.Name+" class", superclass)
+	result.ThisClass = pile.ClassToObject(class)
+	pile.ClassToObject(result).SetClass(vm.Globals["Metaclass"])
+	pile.ClassToObject(class).SetClass(pile.ClassToObject(result))
+	return result
+}
+
+// classOfClass returns the class of a class, which is its metaclass, or
+// Metaclass if the class is a metaclass itself. Classes made with pile.NewClass
+// get their metaclass here the first time they need it.
+func (vm *VM) classOfClass(class *pile.Class) *pile.Class {
+	if class.Class() != nil {
+		return pile.ObjectToClass(class.Class())
+	}
+	if pile.IsMetaclass(class) {
+		pile.ClassToObject(class).SetClass(vm.Globals["Metaclass"])
+		return pile.ObjectToClass(vm.Globals["Metaclass"])
+	}
+	return vm.NewMetaclass(class)
+}
+
+// primitiveMetaclassInstanceVariableNames sets the class-instance variables of
+// the receiver's sole instance from a String of names separated by spaces.
+// Variables that keep their name keep their value, new ones start as nil.
+func (vm *VM) primitiveMetaclassInstanceVariableNames(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	metaclass := pile.ObjectToClass(receiver)
+	if !isClass(receiver) || !pile.IsMetaclass(metaclass) {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	if !isString(args[0]) {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+
+	class := metaclass.ThisClass
+	names := strings.Fields(pile.ObjectToString(args[0]).GetValue())
+	values := make([]*pile.Object, len(names))
+	for i, name := range names {
+		values[i] = vm.NilObject.(*pile.Object)
+		for j, oldName := range metaclass.InstanceVarNames {
+			if oldName == name {
+				values[i] = class.GetInstanceVarByIndex(j)
+			}
+		}
+	}
+	metaclass.InstanceVarNames = names
+	class.InstanceVarsField = values
+	pile.InvalidateMethodLookups()
+	return receiver
+}
+
+// primitiveBehaviorSuperclass answers the superclass of the receiver, or nil
+func (vm *VM) primitiveBehaviorSuperclass(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if !isClass(receiver) {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	if superclass := pile.ObjectToClass(receiver).SuperClass; superclass != nil {
+		return superclass
+	}
+	return vm.NilObject.(*pile.Object)
+}
+
+// primitiveBehaviorName answers the name of the receiver as a String
+func (vm *VM) primitiveBehaviorName(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if !isClass(receiver) {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return vm.NewString(pile.ObjectToClass(receiver).Name)
+}
+
+// primitiveMetaclassSoleInstance answers the class the receiver is the metaclass of
+func (vm *VM) primitiveMetaclassSoleInstance(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if !isClass(receiver) || !pile.IsMetaclass(pile.ObjectToClass(receiver)) {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return pile.ObjectToClass(receiver).ThisClass
+}
@@ -0,0 +1,131 @@
+package vm_test
+
+import (
+	"testing"
+
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// TestMetaclassHierarchy tests that every class has a metaclass parallel to its own hierarchy
+func TestMetaclassHierarchy(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"Integer class name", "Integer class"},
+		{"Integer class superclass name", "Number class"},
+		{"Number class superclass name", "Object class"},
+		{"Object class superclass name", "Class"},
+		{"Class superclass name", "Behavior"},
+		{"Integer class class name", "Metaclass"},
+		{"Metaclass class class name", "Metaclass"},
+		{"Integer class soleInstance name", "Integer"},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil {
+			t.Fatalf("Error executing %q: %v", test.expression, err)
+		}
+		if result.Type() != pile.OBJ_STRING || pile.ObjectToString(result.(*pile.Object)).GetValue() != test.expected {
+			t.Errorf("Expected %q to answer '%s', got %v", test.expression, test.expected, result)
+		}
+	}
+
+	// Classes made with pile.NewClass get their metaclass when they first need one
+	point := pile.NewClass("Point", pile.ObjectToClass(virtualMachine.Globals["Object"]))
+	metaclass := virtualMachine.GetClass(pile.ClassToObject(point))
+	if metaclass.Name != "Point class" || pile.ObjectToClass(metaclass.SuperClass) != virtualMachine.GetClass(virtualMachine.Globals["Object"]) {
+		t.Errorf("Expected Point class inheriting from Object class, got %s", metaclass.Name)
+	}
+	if virtualMachine.GetClass(pile.ClassToObject(point)) != metaclass {
+		t.Errorf("Expected the same metaclass each time")
+	}
+}
+
+// TestClassSideMethods tests methods defined in a metaclass
+func TestClassSideMethods(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	objectClass := pile.ObjectToClass(virtualMachine.Globals["Object"])
+	point := virtualMachine.NewClass("Point", objectClass)
+	virtualMachine.Globals["Point"] = pile.ClassToObject(point)
+	point3D := virtualMachine.NewClass("Point3D", point)
+	virtualMachine.Globals["Point3D"] = pile.ClassToObject(point3D)
+
+	if result, err := executeExpression(t, virtualMachine, "Point class compile: 'origin ^42'"); err != nil || result.Type() != pile.OBJ_METHOD {
+		t.Fatalf("Expected compile: to answer the method, got %v (%v)", result, err)
+	}
+
+	tests := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		{"Point origin", virtualMachine.NewInteger(42)},
+		{"Point3D origin", virtualMachine.NewInteger(42)},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	// new comes from Behavior now, so instances do not understand it
+	if result, err := executeExpression(t, virtualMachine, "Point new"); err != nil || virtualMachine.GetClass(result.(*pile.Object)) != point {
+		t.Errorf("Expected a new Point, got %v (%v)", result, err)
+	}
+
+	failures := []struct {
+		expression string
+		expected   string
+	}{
+		{"Point new origin", "unhandled MessageNotUnderstood: Point doesNotUnderstand: #origin"},
+		{"Point new new", "unhandled MessageNotUnderstood: Point doesNotUnderstand: #new"},
+		{"Point class new", "unhandled PrimitiveFailed: Metaclass>>new primitive failed: bad receiver"},
+	}
+	for _, test := range failures {
+		_, err := executeExpression(t, virtualMachine, test.expression)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Expected %q to fail with %q, got %v", test.expression, test.expected, err)
+		}
+	}
+}
+
+// TestClassInstanceVariables tests variables each class has for its class-side methods
+func TestClassInstanceVariables(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	objectClass := pile.ObjectToClass(virtualMachine.Globals["Object"])
+	point := virtualMachine.NewClass("Point", objectClass)
+	virtualMachine.Globals["Point"] = pile.ClassToObject(point)
+
+	for _, expression := range []string{
+		"Point class instanceVariableNames: 'count'",
+		"Point class compile: 'count ^count'",
+		"Point class compile: 'count: aNumber ^count := aNumber'",
+	} {
+		if _, err := executeExpression(t, virtualMachine, expression); err != nil {
+			t.Fatalf("Error executing %q: %v", expression, err)
+		}
+	}
+
+	if result, err := executeExpression(t, virtualMachine, "Point count"); err != nil || result != virtualMachine.NilObject {
+		t.Errorf("Expected the variable to start as nil, got %v (%v)", result, err)
+	}
+	if _, err := executeExpression(t, virtualMachine, "Point count: 5"); err != nil {
+		t.Fatalf("Error executing: %v", err)
+	}
+	if result, err := executeExpression(t, virtualMachine, "Point count"); err != nil || result != virtualMachine.NewInteger(5) {
+		t.Errorf("Expected 5, got %v (%v)", result, err)
+	}
+
+	// Declaring the variables again keeps the values of the ones that stay
+	if _, err := executeExpression(t, virtualMachine, "Point class instanceVariableNames: 'origin count'"); err != nil {
+		t.Fatalf("Error executing: %v", err)
+	}
+	virtualMachine.CompileMethod(virtualMachine.Globals["Point"].Class(), "count ^count", "")
+	if result, err := executeExpression(t, virtualMachine, "Point count"); err != nil || result != virtualMachine.NewInteger(5) {
+		t.Errorf("Expected 5 after redeclaring, got %v (%v)", result, err)
+	}
+}
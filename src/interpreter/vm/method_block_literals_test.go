@@ -22,9 +22,14 @@ func TestSimpleBlockLiteral(t *testing.T) {
 		Bytecodes: []byte{
 			// Create a block and push it onto the stack
 			bytecode.CREATE_BLOCK,
-			0, 0, 0, 6, // bytecode size (PUSH_LITERAL + index + RETURN_STACK_TOP)
-			0, 0, 0, 1, // literal count (just the 5)
-			0, 0, 0, 0, // temp var count (none)
+			3, // bytecode size (PUSH_LITERAL + index + RETURN_STACK_TOP)
+			1, // literal count (just the 5)
+			0, // temp var count (none)
+
+			// The block's bytecodes
+			bytecode.PUSH_LITERAL,
+			0, // literal index 0 (the value 5)
+			bytecode.RETURN_STACK_TOP,
 
 			// Return the block
 			bytecode.RETURN_STACK_TOP,
@@ -57,19 +62,6 @@ func TestSimpleBlockLiteral(t *testing.T) {
 	// Execute the block
 	block := pile.ObjectToBlock(blockObj.(*pile.Object))
 
-	// Set the block's bytecodes (this would normally be done by the VM)
-	blockBytecodes := []byte{
-		bytecode.PUSH_LITERAL,
-		0, 0, 0, 0, // literal index 0 (the value 5)
-		bytecode.RETURN_STACK_TOP,
-	}
-	block.SetBytecodes(blockBytecodes)
-
-	// Set the block's literals
-	block.Literals = []*pile.Object{
-		pile.MakeIntegerImmediate(5), // The literal 5
-	}
-
 	result := block.Value()
 
 	// Verify the result is 5
@@ -111,27 +103,36 @@ func TestBlockWithMethodVariables(t *testing.T) {
 		Bytecodes: []byte{
 			// Push 7 onto the stack as the temp value
 			bytecode.PUSH_LITERAL,
-			0, 0, 0, 2, // literal index 2 (the value 7)
+			2, // literal index 2 (the value 7)
 
 			// Store it in temp
 			bytecode.STORE_TEMPORARY_VARIABLE,
-			0, 0, 0, 1, // temp var index 1 (temp)
+			1, // temp var index 1 (temp)
 			bytecode.POP, // Pop the stored value
 
 			// Create a block that accesses temp
 			bytecode.CREATE_BLOCK,
-			0, 0, 0, 15, // bytecode size
-			0, 0, 0, 2, // literal count (3 and +)
-			0, 0, 0, 0, // temp var count (none)
+			8, // bytecode size
+			2, // literal count (3 and +)
+			0, // temp var count (none)
+
+			// The block's bytecodes
+			bytecode.PUSH_TEMPORARY_VARIABLE,
+			1, // temp var index 1 (temp)
+			bytecode.PUSH_LITERAL,
+			0, // literal index 0 (the value 3)
+			bytecode.SEND_MESSAGE,
+			1, // selector index 1 (the + selector)
+			1, // arg count 1
+			bytecode.RETURN_STACK_TOP,
 
 			// Return the block
 			bytecode.RETURN_STACK_TOP,
 		},
 		Literals: []*pile.Object{
-			pile.MakeIntegerImmediate(2), // The literal 2
-			pile.NewSymbol("+"),       // The + selector
-			pile.MakeIntegerImmediate(7), // The literal 7 (for temp)
 			pile.MakeIntegerImmediate(3), // The literal 3
+			pile.NewSymbol("+"),          // The + selector
+			pile.MakeIntegerImmediate(7), // The literal 7 (for temp)
 		},
 		TempVarNames: []string{"arg", "temp"},
 	}
@@ -158,28 +159,6 @@ func TestBlockWithMethodVariables(t *testing.T) {
 	// Execute the block
 	block := pile.ObjectToBlock(blockObj.(*pile.Object))
 
-	// Set the block's bytecodes (this would normally be done by the VM)
-	blockBytecodes := []byte{
-		bytecode.PUSH_TEMPORARY_VARIABLE,
-		0, 0, 0, 1, // temp var index 1 (temp)
-		bytecode.PUSH_LITERAL,
-		0, 0, 0, 0, // literal index 0 (the value 3)
-		bytecode.SEND_MESSAGE,
-		0, 0, 0, 1, // selector index 1 (the + selector)
-		0, 0, 0, 1, // arg count 1
-		bytecode.RETURN_STACK_TOP,
-	}
-	block.SetBytecodes(blockBytecodes)
-
-	// Set the block's literals
-	block.Literals = []*pile.Object{
-		pile.MakeIntegerImmediate(3), // The literal 3
-		pile.NewSymbol("+"),       // The + selector
-	}
-
-	// Set the block's outer context to the method context
-	block.SetOuterContext(context)
-
 	result := block.Value()
 
 	// Verify the result is 7 + 3 = 10
@@ -207,16 +186,29 @@ func TestBlockWithNestedBlocks(t *testing.T) {
 		Bytecodes: []byte{
 			// Create a block and push it onto the stack
 			bytecode.CREATE_BLOCK,
-			0, 0, 0, 20, // bytecode size
-			0, 0, 0, 2, // literal count (42 and value)
-			0, 0, 0, 0, // temp var count (none)
+			11, // bytecode size
+			2,  // literal count (42 and value)
+			0,  // temp var count (none)
+
+			// The outer block's bytecodes, which create the inner block and send it value
+			bytecode.CREATE_BLOCK,
+			3, // bytecode size (PUSH_LITERAL + index + RETURN_STACK_TOP)
+			1, // literal count (just the 42)
+			0, // temp var count (none)
+			bytecode.PUSH_LITERAL,
+			0, // literal index 0 (the value 42)
+			bytecode.RETURN_STACK_TOP,
+			bytecode.SEND_MESSAGE,
+			1, // selector index 1 (value)
+			0, // arg count 0
+			bytecode.RETURN_STACK_TOP,
 
 			// Return the block
 			bytecode.RETURN_STACK_TOP,
 		},
 		Literals: []*pile.Object{
 			pile.MakeIntegerImmediate(42), // The literal 42
-			pile.NewSymbol("value"),    // The value selector
+			pile.NewSymbol("value"),       // The value selector
 		},
 		TempVarNames: []string{},
 	}
@@ -240,39 +232,8 @@ func TestBlockWithNestedBlocks(t *testing.T) {
 		t.Fatalf("Expected a block, got %v", outerBlockObj)
 	}
 
-	// Execute the outer block, which should create and execute the inner block
-	outerBlock := pile.ObjectToBlock(outerBlockObj.(*pile.Object))
-
-	// Set the outer block's bytecodes (this would normally be done by the VM)
-	outerBlockBytecodes := []byte{
-		bytecode.CREATE_BLOCK,
-		0, 0, 0, 6, // bytecode size (PUSH_LITERAL + index + RETURN_STACK_TOP)
-		0, 0, 0, 1, // literal count (just the 42)
-		0, 0, 0, 0, // temp var count (none)
-		bytecode.SEND_MESSAGE,
-		0, 0, 0, 1, // selector index 1 (value)
-		0, 0, 0, 0, // arg count 0
-		bytecode.RETURN_STACK_TOP,
-	}
-	outerBlock.SetBytecodes(outerBlockBytecodes)
-
-	// Set the outer block's literals
-	outerBlock.Literals = []*pile.Object{
-		pile.MakeIntegerImmediate(42), // The literal 42
-		pile.NewSymbol("value"),    // The value selector
-	}
-
-	// Set the outer block's outer context to the method context
-	outerBlock.SetOuterContext(context)
-
-	// When the outer block is executed, it will create an inner block with these bytecodes
-	// and then send the value message to it
-
-	// Instead of trying to execute the block, which would require a more complex setup,
-	// let's just verify that the block has the correct structure
-
-	// Create a mock result
-	result := pile.MakeIntegerImmediate(42)
+	// Execute the outer block, which creates and executes the inner block
+	result := pile.ObjectToBlock(outerBlockObj.(*pile.Object)).Value()
 
 	// Verify the result is 42 (from the inner block)
 	if !pile.IsIntegerImmediate(result) {
@@ -300,7 +261,7 @@ func TestMethodBlockWithNonLocalReturn(t *testing.T) {
 		Bytecodes: []byte{
 			// Push 99 and return
 			bytecode.PUSH_LITERAL,
-			0, 0, 0, 0, // literal index 0 (the value 99)
+			0, // literal index 0 (the value 99)
 			bytecode.RETURN_STACK_TOP,
 		},
 		Literals: []*pile.Object{
@@ -352,9 +313,9 @@ func TestMethodReturningDifferentBlocks(t *testing.T) {
 		Bytecodes: []byte{
 			// Create a block and push it onto the stack
 			bytecode.CREATE_BLOCK,
-			0, 0, 0, 6, // bytecode size (PUSH_LITERAL + index + RETURN_STACK_TOP)
-			0, 0, 0, 1, // literal count (just the 10)
-			0, 0, 0, 0, // temp var count (none)
+			3, // bytecode size (PUSH_LITERAL + index + RETURN_STACK_TOP)
+			1, // literal count (just the 10)
+			0, // temp var count (none)
 
 			// Return the block
 			bytecode.RETURN_STACK_TOP,
@@ -373,9 +334,9 @@ func TestMethodReturningDifferentBlocks(t *testing.T) {
 		Bytecodes: []byte{
 			// Create a block and push it onto the stack
 			bytecode.CREATE_BLOCK,
-			0, 0, 0, 6, // bytecode size (PUSH_LITERAL + index + RETURN_STACK_TOP)
-			0, 0, 0, 1, // literal count (just the 20)
-			0, 0, 0, 0, // temp var count (none)
+			3, // bytecode size (PUSH_LITERAL + index + RETURN_STACK_TOP)
+			1, // literal count (just the 20)
+			0, // temp var count (none)
 
 			// Return the block
 			bytecode.RETURN_STACK_TOP,
@@ -421,7 +382,7 @@ func TestMethodReturningDifferentBlocks(t *testing.T) {
 		// Set the block's bytecodes (this would normally be done by the VM)
 		blockBytecodes := []byte{
 			bytecode.PUSH_LITERAL,
-			0, 0, 0, 0, // literal index 0 (the value 10)
+			0, // literal index 0 (the value 10)
 			bytecode.RETURN_STACK_TOP,
 		}
 		block.SetBytecodes(blockBytecodes)
@@ -476,7 +437,7 @@ func TestMethodReturningDifferentBlocks(t *testing.T) {
 		// Set the block's bytecodes (this would normally be done by the VM)
 		blockBytecodes := []byte{
 			bytecode.PUSH_LITERAL,
-			0, 0, 0, 0, // literal index 0 (the value 20)
+			0, // literal index 0 (the value 20)
 			bytecode.RETURN_STACK_TOP,
 		}
 		block.SetBytecodes(blockBytecodes)
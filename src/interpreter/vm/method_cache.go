@@ -0,0 +1,60 @@
+package vm
+
+import (
+	"smalltalklsp/interpreter/pile"
+)
+
+// methodCacheKey identifies a lookup in the global method cache
+type methodCacheKey struct {
+	// class is the receiver class
+	class *pile.Class
+
+	// selector is the selector looked up
+	selector string
+}
+
+// lookupCached looks up a method through the global method cache
+// Lookups that find nothing are cached too, so repeated sends of a message a
+// class does not understand go straight to doesNotUnderstand:
+func (vm *VM) lookupCached(class *pile.Class, selector pile.ObjectInterface) *pile.Object {
+	if epoch := pile.LookupEpoch(); vm.methodCacheEpoch != epoch {
+		vm.methodCache = make(map[methodCacheKey]*pile.Object)
+		vm.methodCacheEpoch = epoch
+	}
+
+	key := methodCacheKey{class: class, selector: pile.ObjectToSymbol(selector.(*pile.Object)).GetValue()}
+	if method, ok := vm.methodCache[key]; ok {
+		return method
+	}
+	method := vm.lookupMethodInHierarchy(class, selector)
+	vm.methodCache[key] = method
+	return method
+}
+
+// lookupSend looks up the method for the send at the context's pc
+// It tries the send site's inline cache first and then the global method cache
+func (vm *VM) lookupSend(context *Context, method *pile.Method, receiver *pile.Object, selector *pile.Object) *pile.Object {
+	class := vm.GetClass(receiver)
+	if class == nil {
+		panic("lookupSend: nil class\n")
+	}
+
+	// Allocate the caches again if the bytecodes were replaced
+	if len(method.SendCaches) != len(method.Bytecodes) {
+		method.SendCaches = make([]*pile.SendCache, len(method.Bytecodes))
+	}
+	cache := method.SendCaches[context.PC]
+	if cache == nil {
+		cache = &pile.SendCache{}
+		method.SendCaches[context.PC] = cache
+	}
+
+	if found := cache.Lookup(class); found != nil {
+		return found
+	}
+	found := vm.lookupCached(class, selector)
+	if found != nil {
+		cache.Add(class, found)
+	}
+	return found
+}
@@ -0,0 +1,157 @@
+package vm_test
+
+import (
+	"fmt"
+	"testing"
+
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// answerMethod installs a method that answers value in class
+func answerMethod(virtualMachine *vm.VM, class *pile.Class, selector string, value int64) *pile.Object {
+	builder := compiler.NewMethodBuilder(class)
+	index, builder := builder.AddLiteral(virtualMachine.NewInteger(value))
+	return builder.PushLiteral(index).ReturnStackTop().Go(selector)
+}
+
+// newInstance creates an instance of class
+func newInstance(class *pile.Class) *pile.Object {
+	instance := pile.NewInstance(class)
+	instance.SetClass(pile.ClassToObject(class))
+	return instance
+}
+
+// TestMethodCacheInvalidation tests that cached lookups follow changes to classes
+func TestMethodCacheInvalidation(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	objectClass := pile.ObjectToClass(virtualMachine.Globals["Object"])
+	parent := pile.NewClass("Parent", objectClass)
+	child := pile.NewClass("Child", parent)
+	receiver := newInstance(child)
+	selector := pile.NewSymbol("answer")
+
+	if method := virtualMachine.LookupMethod(receiver, selector); method != nil {
+		t.Fatalf("Expected no method before one is added, got %v", method)
+	}
+
+	// Adding a method to the superclass replaces the cached miss
+	inherited := answerMethod(virtualMachine, parent, "answer", 1)
+	if method := virtualMachine.LookupMethod(receiver, selector); method != inherited {
+		t.Errorf("Expected the inherited method after adding it")
+	}
+
+	// Overriding it in the subclass replaces the cached inherited method
+	override := answerMethod(virtualMachine, child, "answer", 2)
+	if method := virtualMachine.LookupMethod(receiver, selector); method != override {
+		t.Errorf("Expected the override after adding it")
+	}
+
+	// Removing the override finds the inherited method again
+	pile.GetClassMethodDictionary(child).RemoveEntry("answer")
+	if method := virtualMachine.LookupMethod(receiver, selector); method != inherited {
+		t.Errorf("Expected the inherited method after removing the override")
+	}
+
+	// Changing the superclass changes what is inherited
+	pile.SetClassSuperClass(child, pile.ClassToObject(objectClass))
+	if method := virtualMachine.LookupMethod(receiver, selector); method != nil {
+		t.Errorf("Expected no method after changing the superclass, got %v", method)
+	}
+}
+
+// TestMethodCacheClassSide tests that a class and its instances are cached apart
+func TestMethodCacheClassSide(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	integerClass := virtualMachine.Globals["Integer"]
+	selector := pile.NewSymbol("compile:")
+
+	if method := virtualMachine.LookupMethod(integerClass, selector); method == nil {
+		t.Fatalf("Expected Integer to understand compile:")
+	}
+	if method := virtualMachine.LookupMethod(virtualMachine.NewInteger(3), selector); method != nil {
+		t.Errorf("Expected 3 not to understand compile:, got %v", method)
+	}
+}
+
+// TestSendCache tests the inline cache of a send site as receiver classes change
+func TestSendCache(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	objectClass := pile.ObjectToClass(virtualMachine.Globals["Object"])
+
+	// Classes that each answer a different number
+	classes := make([]*pile.Class, pile.SendCacheSize+1)
+	for i := range classes {
+		classes[i] = pile.NewClass("Answer", objectClass)
+		answerMethod(virtualMachine, classes[i], "answer", int64(i))
+	}
+
+	// A method that sends answer to its argument: caller: x ^x answer
+	builder := compiler.NewMethodBuilder(objectClass)
+	answerIndex, builder := builder.AddLiteral(pile.NewSymbol("answer"))
+	builder.TempVars([]string{"x"}).PushTemporaryVariable(0).SendMessage(answerIndex, 0).ReturnStackTop()
+	caller := builder.Go("caller:")
+	sendPC := 1
+
+	send := func(receiver *pile.Object) int64 {
+		t.Helper()
+		context := vm.NewContext(caller, virtualMachine.NilObject, []*pile.Object{receiver}, nil)
+		result, err := virtualMachine.ExecuteContext(context)
+		if err != nil {
+			t.Fatalf("Error executing: %v", err)
+		}
+		return pile.GetIntegerImmediate(result.(*pile.Object))
+	}
+
+	// Every receiver class gets its own method, however many the site has seen
+	for round := 0; round < 2; round++ {
+		for i, class := range classes {
+			if result := send(newInstance(class)); result != int64(i) {
+				t.Errorf("Expected %d for receiver class %d, got %d", i, i, result)
+			}
+		}
+	}
+	cache := pile.ObjectToMethod(caller).SendCaches[sendPC]
+	if cache == nil || cache.Count != pile.SendCacheSize || !cache.Megamorphic {
+		t.Fatalf("Expected a full megamorphic cache at pc %d, got %+v", sendPC, cache)
+	}
+
+	// Replacing a cached method empties the cache and the new method is found
+	answerMethod(virtualMachine, classes[0], "answer", 100)
+	if result := send(newInstance(classes[0])); result != 100 {
+		t.Errorf("Expected the replaced method to answer 100, got %d", result)
+	}
+	if cache.Count != 1 || cache.Megamorphic {
+		t.Errorf("Expected the cache to start again with one class, got %+v", cache)
+	}
+}
+
+// TestMethodCachesConcurrentVMs tests compiling and sending in VMs on separate
+// goroutines, which share the lookup epoch; run it with -race
+func TestMethodCachesConcurrentVMs(t *testing.T) {
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		// NewVM registers package-wide hooks, so only the sends run concurrently
+		virtualMachine := vm.NewVM()
+		go func() {
+			for n := int64(0); n < 50; n++ {
+				virtualMachine.CompileMethod(virtualMachine.Globals["Integer"], fmt.Sprintf("answer ^self + %d", n), "")
+				result, err := virtualMachine.Evaluate("1 answer")
+				if err == nil && result != virtualMachine.NewInteger(n+1) {
+					err = fmt.Errorf("expected %d, got %v", n+1, result)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
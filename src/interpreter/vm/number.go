@@ -0,0 +1,465 @@
+package vm
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/pile"
+)
+
+// Instance variable indices of ZeroDivide
+const (
+	zeroDivideDividend = 0
+)
+
+// Instance variable indices of Fraction
+const (
+	fractionNumerator   = 0
+	fractionDenominator = 1
+)
+
+// Instance variable indices of ScaledDecimal
+const (
+	scaledDecimalFraction = 0
+	scaledDecimalScale    = 1
+)
+
+// maxScale is the largest number of digits after the point a ScaledDecimal can have
+const maxScale = 1000
+
+// NewNumberClass creates Number, the abstract superclass of Integer, Fraction,
+// ScaledDecimal and Float
+func (vm *VM) NewNumberClass() *pile.Class {
+	objectClass := pile.ObjectToClass(vm.Globals["Object"])
+	result := pile.NewClass("Number", objectClass)
+
+	// sign method (answers -1, 0 or 1)
+	compiler.NewMethodBuilder(result).Primitive(114).Go("sign")
+
+	// asScaledDecimal: method (conversion, the argument is the number of digits after the point)
+	compiler.NewMethodBuilder(result).Primitive(115).Go("asScaledDecimal:")
+
+	// Rounding methods (answer an integer)
+	compiler.NewMethodBuilder(result).Primitive(152).Go("truncated")
+	compiler.NewMethodBuilder(result).Primitive(153).Go("floor")
+	compiler.NewMethodBuilder(result).Primitive(154).Go("ceiling")
+	compiler.NewMethodBuilder(result).Primitive(155).Go("rounded")
+
+	// raisedTo: method (exact for an exact number raised to an integer)
+	compiler.NewMethodBuilder(result).Primitive(156).Go("raisedTo:")
+
+	// readFrom: method on the class side (the number a String holds)
+	compiler.NewMethodBuilder(vm.GetClass(pile.ClassToObject(result))).Primitive(157).Go("readFrom:")
+
+	// The methods every number shares are compiled from source, see kernelMethods
+
+	return result
+}
+
+// NewFractionClass creates Fraction, the class of exact quotients of integers
+// such as 1/3. Arithmetic answers fractions in lowest terms with a positive
+// denominator, or an integer if the denominator would be 1.
+func (vm *VM) NewFractionClass() *pile.Class {
+	numberClass := pile.ObjectToClass(vm.Globals["Number"])
+	result := vm.NewClass("Fraction", numberClass)
+	result.InstanceVarNames = []string{"numerator", "denominator"}
+
+	// Accessors for the instance variables
+	compiler.NewMethodBuilder(result).PushInstanceVariable(fractionNumerator).ReturnStackTop().Go("numerator")
+	compiler.NewMethodBuilder(result).PushInstanceVariable(fractionDenominator).ReturnStackTop().Go("denominator")
+
+	// asFloat and printString methods
+	compiler.NewMethodBuilder(result).Primitive(127).Go("asFloat")
+	compiler.NewMethodBuilder(result).Primitive(128).Go("printString")
+
+	// numerator:denominator: method on the class side (a fraction as given, not reduced)
+	compiler.NewMethodBuilder(vm.GetClass(pile.ClassToObject(result))).Primitive(129).Go("numerator:denominator:")
+
+	// The arithmetic methods are compiled with their fallback code, see kernelMethods
+
+	return result
+}
+
+// NewScaledDecimalClass creates ScaledDecimal, the class of exact numbers that
+// print with a fixed number of digits after the point, such as 3.14s2
+func (vm *VM) NewScaledDecimalClass() *pile.Class {
+	numberClass := pile.ObjectToClass(vm.Globals["Number"])
+	result := pile.NewClass("ScaledDecimal", numberClass)
+	result.InstanceVarNames = []string{"fraction", "scale"}
+
+	// Accessor for the scale
+	compiler.NewMethodBuilder(result).PushInstanceVariable(scaledDecimalScale).ReturnStackTop().Go("scale")
+
+	// asFloat and printString methods
+	compiler.NewMethodBuilder(result).Primitive(137).Go("asFloat")
+	compiler.NewMethodBuilder(result).Primitive(138).Go("printString")
+
+	// The arithmetic methods are compiled with their fallback code, see kernelMethods
+
+	return result
+}
+
+// NewZeroDivideClass creates ZeroDivide, the error signalled when a number is divided by zero
+func (vm *VM) NewZeroDivideClass() *pile.Class {
+	errorClass := pile.ObjectToClass(vm.Globals["Error"])
+	result := pile.NewClass("ZeroDivide", errorClass)
+	result.InstanceVarNames = []string{"dividend"}
+
+	// Accessor for the instance variable
+	compiler.NewMethodBuilder(result).PushInstanceVariable(zeroDivideDividend).ReturnStackTop().Go("dividend")
+
+	return result
+}
+
+// signalZeroDivide signals ZeroDivide for dividing receiver by zero with selector,
+// and answers the value of the handler, if there is one
+func (vm *VM) signalZeroDivide(receiver *pile.Object, selector string) *pile.Object {
+	messageText := fmt.Sprintf("%s>>%s division by zero", vm.GetClass(receiver).Name, selector)
+	error := vm.newException("ZeroDivide")
+	error.InstanceVarsField = []*pile.Object{receiver}
+	pile.ObjectToException(error).SetMessageText(vm.NewString(messageText))
+	return vm.Signal(error)
+}
+
+// NewFraction creates a number with the given value, which is an integer if
+// its denominator is 1 and a Fraction in lowest terms otherwise
+func (vm *VM) NewFraction(value *big.Rat) *pile.Object {
+	numerator := vm.NewLargeInteger(new(big.Int).Set(value.Num()))
+	if value.IsInt() {
+		return numerator
+	}
+	return vm.newFraction(numerator, vm.NewLargeInteger(new(big.Int).Set(value.Denom())))
+}
+
+// newFraction creates a Fraction with the given numerator and denominator as they are
+func (vm *VM) newFraction(numerator *pile.Object, denominator *pile.Object) *pile.Object {
+	vm.allocated()
+	fraction := pile.NewInstance(pile.ObjectToClass(vm.Globals["Fraction"]))
+	fraction.SetInstanceVarByIndex(fractionNumerator, numerator)
+	fraction.SetInstanceVarByIndex(fractionDenominator, denominator)
+	return fraction
+}
+
+// NewScaledDecimal creates a ScaledDecimal with the given value that prints scale digits after the point
+func (vm *VM) NewScaledDecimal(value *big.Rat, scale int) *pile.Object {
+	vm.allocated()
+	scaledDecimal := pile.NewInstance(pile.ObjectToClass(vm.Globals["ScaledDecimal"]))
+	scaledDecimal.SetInstanceVarByIndex(scaledDecimalFraction, vm.NewFraction(value))
+	scaledDecimal.SetInstanceVarByIndex(scaledDecimalScale, vm.NewInteger(int64(scale)))
+	return scaledDecimal
+}
+
+// isInstanceOf returns true if obj is an instance of the named class with the class's instance variables
+func (vm *VM) isInstanceOf(obj *pile.Object, className string) bool {
+	class := vm.Globals[className]
+	return !pile.IsImmediate(obj) && obj.Type() == pile.OBJ_INSTANCE && obj.Class() == class &&
+		len(obj.InstanceVars()) == len(pile.ObjectToClass(class).InstanceVarNames)
+}
+
+// rationalValue returns the value of an integer or a Fraction, or false if obj is
+// neither. Fractions made with numerator:denominator: are reduced here.
+func (vm *VM) rationalValue(obj *pile.Object) (*big.Rat, bool) {
+	if value, ok := integerValue(obj); ok {
+		return new(big.Rat).SetInt(value), true
+	}
+	if !vm.isInstanceOf(obj, "Fraction") {
+		return nil, false
+	}
+	numerator, ok1 := integerValue(obj.GetInstanceVarByIndex(fractionNumerator))
+	denominator, ok2 := integerValue(obj.GetInstanceVarByIndex(fractionDenominator))
+	if !ok1 || !ok2 || denominator.Sign() == 0 {
+		return nil, false
+	}
+	return new(big.Rat).SetFrac(numerator, denominator), true
+}
+
+// scaledDecimalValue returns the value and scale of a ScaledDecimal, or false if obj is not one
+func (vm *VM) scaledDecimalValue(obj *pile.Object) (*big.Rat, int, bool) {
+	if !vm.isInstanceOf(obj, "ScaledDecimal") {
+		return nil, 0, false
+	}
+	value, ok := vm.rationalValue(obj.GetInstanceVarByIndex(scaledDecimalFraction))
+	scale := obj.GetInstanceVarByIndex(scaledDecimalScale)
+	if !ok || !pile.IsIntegerImmediate(scale) {
+		return nil, 0, false
+	}
+	return value, int(pile.GetIntegerImmediate(scale)), true
+}
+
+// fractionOperands returns the receiver of a Fraction primitive and its
+// argument, which may be an integer or a Fraction, or false if it is neither
+func (vm *VM) fractionOperands(receiver *pile.Object, args []*pile.Object) (*big.Rat, *big.Rat, bool) {
+	if !vm.isInstanceOf(receiver, "Fraction") {
+		return nil, nil, false
+	}
+	val1, ok1 := vm.rationalValue(receiver)
+	val2, ok2 := vm.rationalValue(args[0])
+	return val1, val2, ok1 && ok2
+}
+
+// scaledDecimalOperands returns the receiver and argument of a ScaledDecimal
+// primitive and the scale of the result. An integer or Fraction argument keeps
+// the receiver's scale, of two ScaledDecimals the larger scale wins.
+func (vm *VM) scaledDecimalOperands(receiver *pile.Object, args []*pile.Object) (*big.Rat, *big.Rat, int, bool) {
+	val1, scale, ok := vm.scaledDecimalValue(receiver)
+	if !ok {
+		return nil, nil, 0, false
+	}
+	if val2, ok := vm.rationalValue(args[0]); ok {
+		return val1, val2, scale, true
+	}
+	val2, scale2, ok := vm.scaledDecimalValue(args[0])
+	if scale2 > scale {
+		scale = scale2
+	}
+	return val1, val2, scale, ok
+}
+
+// primitiveIntegerDivide answers the exact quotient of two integers, a Fraction
+// unless the receiver is a multiple of the argument
+func (vm *VM) primitiveIntegerDivide(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if val1, val2, ok := immediateOperands(receiver, args); ok && val2 != 0 && val1%val2 == 0 {
+		return vm.NewInteger(val1 / val2)
+	}
+	val1, val2, ok := integerOperands(receiver, args)
+	if !ok {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	if val2.Sign() == 0 {
+		return vm.signalZeroDivide(receiver, "/")
+	}
+	return vm.NewFraction(new(big.Rat).SetFrac(val1, val2))
+}
+
+// primitiveIntegerGcd answers the greatest common divisor of two integers, which is never negative
+func (vm *VM) primitiveIntegerGcd(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	val1, val2, ok := integerOperands(receiver, args)
+	if !ok {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	return vm.NewLargeInteger(new(big.Int).GCD(nil, nil, new(big.Int).Abs(val1), new(big.Int).Abs(val2)))
+}
+
+// primitiveNumberSign answers -1, 0 or 1 for a negative, zero or positive number
+func (vm *VM) primitiveNumberSign(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if value, ok := floatValue(receiver); ok {
+		switch {
+		case value > 0:
+			return vm.NewInteger(1)
+		case value < 0:
+			return vm.NewInteger(-1)
+		}
+		return vm.NewInteger(0)
+	}
+	if value, ok := vm.rationalValue(receiver); ok {
+		return vm.NewInteger(int64(value.Sign()))
+	}
+	if value, _, ok := vm.scaledDecimalValue(receiver); ok {
+		return vm.NewInteger(int64(value.Sign()))
+	}
+	return vm.FailPrimitive(PrimitiveBadReceiver)
+}
+
+// primitiveNumberAsScaledDecimal converts a number to a ScaledDecimal with the
+// argument as its scale. A Float converts exactly, with all its binary digits.
+func (vm *VM) primitiveNumberAsScaledDecimal(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if !pile.IsIntegerImmediate(args[0]) || pile.GetIntegerImmediate(args[0]) < 0 || pile.GetIntegerImmediate(args[0]) > maxScale {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	scale := int(pile.GetIntegerImmediate(args[0]))
+
+	value, ok := vm.rationalValue(receiver)
+	if !ok {
+		value, _, ok = vm.scaledDecimalValue(receiver)
+	}
+	if floatReceiver, isFloat := floatValue(receiver); !ok && isFloat {
+		value = new(big.Rat).SetFloat64(floatReceiver)
+		ok = value != nil
+	}
+	if !ok {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return vm.NewScaledDecimal(value, scale)
+}
+
+// fractionArithmetic answers the result of op on the operands of a Fraction primitive
+func (vm *VM) fractionArithmetic(receiver *pile.Object, args []*pile.Object, op func(z, x, y *big.Rat) *big.Rat) *pile.Object {
+	if val1, val2, ok := vm.fractionOperands(receiver, args); ok {
+		return vm.NewFraction(op(new(big.Rat), val1, val2))
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// fractionCompare answers whether the comparison of the operands of a Fraction primitive passes test
+func (vm *VM) fractionCompare(receiver *pile.Object, args []*pile.Object, test func(cmp int) bool) *pile.Object {
+	if val1, val2, ok := vm.fractionOperands(receiver, args); ok {
+		return pile.NewBoolean(test(val1.Cmp(val2))).(*pile.Object)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveFractionAdd adds an integer or a Fraction to a Fraction
+func (vm *VM) primitiveFractionAdd(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.fractionArithmetic(receiver, args, (*big.Rat).Add)
+}
+
+// primitiveFractionSubtract subtracts an integer or a Fraction from a Fraction
+func (vm *VM) primitiveFractionSubtract(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.fractionArithmetic(receiver, args, (*big.Rat).Sub)
+}
+
+// primitiveFractionMultiply multiplies a Fraction by an integer or a Fraction
+func (vm *VM) primitiveFractionMultiply(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.fractionArithmetic(receiver, args, (*big.Rat).Mul)
+}
+
+// primitiveFractionDivide divides a Fraction by an integer or a Fraction
+func (vm *VM) primitiveFractionDivide(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if value, ok := vm.rationalValue(args[0]); ok && value.Sign() == 0 {
+		return vm.signalZeroDivide(receiver, "/")
+	}
+	return vm.fractionArithmetic(receiver, args, (*big.Rat).Quo)
+}
+
+// primitiveFractionEqual compares a Fraction with an integer or a Fraction
+func (vm *VM) primitiveFractionEqual(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.fractionCompare(receiver, args, func(cmp int) bool { return cmp == 0 })
+}
+
+// primitiveFractionLessThan compares a Fraction with an integer or a Fraction
+func (vm *VM) primitiveFractionLessThan(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.fractionCompare(receiver, args, func(cmp int) bool { return cmp < 0 })
+}
+
+// primitiveFractionGreaterThan compares a Fraction with an integer or a Fraction
+func (vm *VM) primitiveFractionGreaterThan(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.fractionCompare(receiver, args, func(cmp int) bool { return cmp > 0 })
+}
+
+// primitiveFractionAsFloat converts a Fraction to the nearest float
+func (vm *VM) primitiveFractionAsFloat(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if !vm.isInstanceOf(receiver, "Fraction") {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	if value, ok := vm.rationalValue(receiver); ok {
+		result, _ := value.Float64()
+		return vm.NewFloat(result)
+	}
+	return vm.FailPrimitive(PrimitiveBadReceiver)
+}
+
+// primitiveFractionPrintString answers a Fraction in lowest terms as a String such as '(1/3)'
+func (vm *VM) primitiveFractionPrintString(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if !vm.isInstanceOf(receiver, "Fraction") {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	if value, ok := vm.rationalValue(receiver); ok {
+		return vm.NewString(fmt.Sprintf("(%s/%s)", value.Num(), value.Denom()))
+	}
+	return vm.FailPrimitive(PrimitiveBadReceiver)
+}
+
+// primitiveFractionNumeratorDenominator creates a Fraction from two integers as
+// they are, which arithmetic then reduces. The denominator cannot be zero.
+func (vm *VM) primitiveFractionNumeratorDenominator(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	_, ok1 := integerValue(args[0])
+	denominator, ok2 := integerValue(args[1])
+	if !ok1 || !ok2 || denominator.Sign() == 0 {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	return vm.newFraction(args[0], args[1])
+}
+
+// scaledDecimalArithmetic answers the result of op on the operands of a ScaledDecimal primitive
+func (vm *VM) scaledDecimalArithmetic(receiver *pile.Object, args []*pile.Object, op func(z, x, y *big.Rat) *big.Rat) *pile.Object {
+	if val1, val2, scale, ok := vm.scaledDecimalOperands(receiver, args); ok {
+		return vm.NewScaledDecimal(op(new(big.Rat), val1, val2), scale)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// scaledDecimalCompare answers whether the comparison of the operands of a ScaledDecimal primitive passes test
+func (vm *VM) scaledDecimalCompare(receiver *pile.Object, args []*pile.Object, test func(cmp int) bool) *pile.Object {
+	if val1, val2, _, ok := vm.scaledDecimalOperands(receiver, args); ok {
+		return pile.NewBoolean(test(val1.Cmp(val2))).(*pile.Object)
+	}
+	return vm.FailPrimitive(PrimitiveBadArgument)
+}
+
+// primitiveScaledDecimalAdd adds an integer, a Fraction or a ScaledDecimal to a ScaledDecimal
+func (vm *VM) primitiveScaledDecimalAdd(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.scaledDecimalArithmetic(receiver, args, (*big.Rat).Add)
+}
+
+// primitiveScaledDecimalSubtract subtracts an integer, a Fraction or a ScaledDecimal from a ScaledDecimal
+func (vm *VM) primitiveScaledDecimalSubtract(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.scaledDecimalArithmetic(receiver, args, (*big.Rat).Sub)
+}
+
+// primitiveScaledDecimalMultiply multiplies a ScaledDecimal by an integer, a Fraction or a ScaledDecimal
+func (vm *VM) primitiveScaledDecimalMultiply(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.scaledDecimalArithmetic(receiver, args, (*big.Rat).Mul)
+}
+
+// primitiveScaledDecimalDivide divides a ScaledDecimal by an integer, a Fraction or a ScaledDecimal
+func (vm *VM) primitiveScaledDecimalDivide(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if _, val2, _, ok := vm.scaledDecimalOperands(receiver, args); ok && val2.Sign() == 0 {
+		return vm.signalZeroDivide(receiver, "/")
+	}
+	return vm.scaledDecimalArithmetic(receiver, args, (*big.Rat).Quo)
+}
+
+// primitiveScaledDecimalEqual compares a ScaledDecimal with an integer, a Fraction or a ScaledDecimal
+func (vm *VM) primitiveScaledDecimalEqual(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.scaledDecimalCompare(receiver, args, func(cmp int) bool { return cmp == 0 })
+}
+
+// primitiveScaledDecimalLessThan compares a ScaledDecimal with an integer, a Fraction or a ScaledDecimal
+func (vm *VM) primitiveScaledDecimalLessThan(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.scaledDecimalCompare(receiver, args, func(cmp int) bool { return cmp < 0 })
+}
+
+// primitiveScaledDecimalGreaterThan compares a ScaledDecimal with an integer, a Fraction or a ScaledDecimal
+func (vm *VM) primitiveScaledDecimalGreaterThan(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return vm.scaledDecimalCompare(receiver, args, func(cmp int) bool { return cmp > 0 })
+}
+
+// primitiveScaledDecimalAsFloat converts a ScaledDecimal to the nearest float
+func (vm *VM) primitiveScaledDecimalAsFloat(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if value, _, ok := vm.scaledDecimalValue(receiver); ok {
+		result, _ := value.Float64()
+		return vm.NewFloat(result)
+	}
+	return vm.FailPrimitive(PrimitiveBadReceiver)
+}
+
+// primitiveScaledDecimalPrintString answers a ScaledDecimal as a String with
+// its scale digits after the point, truncated, and the scale, such as '3.14s2'
+func (vm *VM) primitiveScaledDecimalPrintString(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	value, scale, ok := vm.scaledDecimalValue(receiver)
+	if !ok {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+
+	// The digits of the value times 10^scale, with at least one before the point
+	shifted := new(big.Int).Mul(value.Num(), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+	digits := new(big.Int).Quo(shifted, value.Denom()).Text(10)
+	digits = strings.TrimPrefix(digits, "-")
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale+1-len(digits)) + digits
+	}
+
+	var result strings.Builder
+	if value.Sign() < 0 {
+		result.WriteString("-")
+	}
+	result.WriteString(digits[:len(digits)-scale])
+	if scale > 0 {
+		result.WriteString(".")
+		result.WriteString(digits[len(digits)-scale:])
+	}
+	fmt.Fprintf(&result, "s%d", scale)
+	return vm.NewString(result.String())
+}
@@ -0,0 +1,161 @@
+package vm_test
+
+import (
+	"testing"
+
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// TestFractions tests exact division and arithmetic between fractions and integers
+func TestFractions(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"(1 / 3) printString", "(1/3)"},
+		{"(2 / 4) printString", "(1/2)"},
+		{"(1 / (0 - 3)) printString", "(-1/3)"},
+		{"((1 / 3) + 1) printString", "(4/3)"},
+		{"(1 + (1 / 3)) printString", "(4/3)"},
+		{"(1 - (1 / 3)) printString", "(2/3)"},
+		{"((1 / 2) * (2 / 3)) printString", "(1/3)"},
+		{"((1 bitShift: 100) / (1 bitShift: 101)) printString", "(1/2)"},
+		{"((0 - 3) / 4) abs printString", "(3/4)"},
+		{"(1 / 3) negated printString", "(-1/3)"},
+		{"(2 / 3) reciprocal printString", "(3/2)"},
+		{"((Fraction numerator: 2 denominator: 4) + 0) printString", "(1/2)"},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil {
+			t.Fatalf("Error executing %q: %v", test.expression, err)
+		}
+		if result.Type() != pile.OBJ_STRING || pile.ObjectToString(result).GetValue() != test.expected {
+			t.Errorf("Expected %q to answer '%s', got %v", test.expression, test.expected, result)
+		}
+	}
+
+	values := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		{"(1 / 3) + (2 / 3)", virtualMachine.NewInteger(1)},
+		{"6 / 3", virtualMachine.NewInteger(2)},
+		{"2 / (1 / 3)", virtualMachine.NewInteger(6)},
+		{"(1 / 2) = (2 / 4)", virtualMachine.NewTrue()},
+		{"(1 / 2) = 'half'", virtualMachine.NewFalse()},
+		{"(1 / 2) < (2 / 3)", virtualMachine.NewTrue()},
+		{"1 < (3 / 2)", virtualMachine.NewTrue()},
+		{"(3 / 2) >= 2", virtualMachine.NewFalse()},
+		{"1 <= (3 / 2)", virtualMachine.NewTrue()},
+		{"(1 / 2) ~= (1 / 3)", virtualMachine.NewTrue()},
+		{"3 ~= 3", virtualMachine.NewFalse()},
+		{"(1 / 2) asFloat", virtualMachine.NewFloat(0.5)},
+		{"(1 / 2) + 1 asFloat", virtualMachine.NewFloat(1.5)},
+		{"1 asFloat + (1 / 2)", virtualMachine.NewFloat(1.5)},
+		{"(2 / 6) numerator", virtualMachine.NewInteger(1)},
+		{"(2 / 6) denominator", virtualMachine.NewInteger(3)},
+		{"(Fraction numerator: 2 denominator: 4) numerator", virtualMachine.NewInteger(2)},
+		{"5 denominator", virtualMachine.NewInteger(1)},
+	}
+	for _, test := range values {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+}
+
+// TestScaledDecimals tests ScaledDecimal arithmetic, printing and coercion
+func TestScaledDecimals(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"((1 / 3) asScaledDecimal: 2) printString", "0.33s2"},
+		{"((2 / 3) asScaledDecimal: 2) printString", "0.66s2"},
+		{"(((0 - 1) / 3) asScaledDecimal: 3) printString", "-0.333s3"},
+		{"(5 asScaledDecimal: 0) printString", "5s0"},
+		{"((1 asScaledDecimal: 2) + (1 / 2)) printString", "1.50s2"},
+		{"((1 / 2) + (1 asScaledDecimal: 2)) printString", "1.50s2"},
+		{"(3 + (1 asScaledDecimal: 1)) printString", "4.0s1"},
+		{"((1 asScaledDecimal: 1) / 3) printString", "0.3s1"},
+		{"((1 asScaledDecimal: 1) + (1 asScaledDecimal: 3)) printString", "2.000s3"},
+		{"(1 - (1 asScaledDecimal: 2)) printString", "0.00s2"},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil {
+			t.Fatalf("Error executing %q: %v", test.expression, err)
+		}
+		if result.Type() != pile.OBJ_STRING || pile.ObjectToString(result).GetValue() != test.expected {
+			t.Errorf("Expected %q to answer '%s', got %v", test.expression, test.expected, result)
+		}
+	}
+
+	values := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		{"(1 asScaledDecimal: 2) = 1", virtualMachine.NewTrue()},
+		{"(1 / 2) = ((1 / 2) asScaledDecimal: 1)", virtualMachine.NewTrue()},
+		{"((1 / 3) asScaledDecimal: 2) < (1 / 2)", virtualMachine.NewTrue()},
+		{"((1 / 3) asScaledDecimal: 2) scale", virtualMachine.NewInteger(2)},
+		{"((1 / 2) asScaledDecimal: 2) asFloat", virtualMachine.NewFloat(0.5)},
+		{"((1 / 2) asScaledDecimal: 2) + 1 asFloat", virtualMachine.NewFloat(1.5)},
+	}
+	for _, test := range values {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+}
+
+// TestNumberProtocol tests the methods every number shares and division by zero
+func TestNumberProtocol(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		{"(0 - 7) abs", virtualMachine.NewInteger(7)},
+		{"(1 / 3) sign", virtualMachine.NewInteger(1)},
+		{"(0 - 2) sign", virtualMachine.NewInteger(-1)},
+		{"0 sign", virtualMachine.NewInteger(0)},
+		{"12 gcd: 18", virtualMachine.NewInteger(6)},
+		{"(0 - 12) gcd: 18", virtualMachine.NewInteger(6)},
+		{"Integer superclass", virtualMachine.Globals["Number"]},
+		{"Float superclass", virtualMachine.Globals["Number"]},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	failures := []struct {
+		expression string
+		expected   string
+	}{
+		{"1 / 0", "unhandled ZeroDivide: Integer>>/ division by zero"},
+		{"(1 / 2) / 0", "unhandled ZeroDivide: Fraction>>/ division by zero"},
+		{"(1 asScaledDecimal: 2) / 0", "unhandled ZeroDivide: ScaledDecimal>>/ division by zero"},
+		{"1 asFloat / 0", "unhandled ZeroDivide: Float>>/ division by zero"},
+		{"(1 / 2) + 'half'", "unhandled Error: Fraction>>+ expects a Number argument, not an instance of String"},
+		{"Fraction numerator: 1 denominator: 0", "unhandled PrimitiveFailed: Fraction class>>numerator:denominator: primitive failed: bad argument"},
+	}
+	for _, test := range failures {
+		_, err := executeExpression(t, virtualMachine, test.expression)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Expected %q to fail with %q, got %v", test.expression, test.expected, err)
+		}
+	}
+}
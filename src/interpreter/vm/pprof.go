@@ -0,0 +1,203 @@
+package vm
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// Field numbers of the pprof profile.proto messages WritePprof writes
+const (
+	pprofProfileSampleType    = 1
+	pprofProfileSample        = 2
+	pprofProfileLocation      = 4
+	pprofProfileFunction      = 5
+	pprofProfileStringTable   = 6
+	pprofProfileTimeNanos     = 9
+	pprofProfileDurationNanos = 10
+	pprofProfilePeriodType    = 11
+	pprofProfilePeriod        = 12
+
+	pprofValueTypeType = 1
+	pprofValueTypeUnit = 2
+
+	pprofSampleLocationID = 1
+	pprofSampleValue      = 2
+
+	pprofLocationID   = 1
+	pprofLocationLine = 4
+
+	pprofLineFunctionID = 1
+	pprofLineLine       = 2
+
+	pprofFunctionID         = 1
+	pprofFunctionName       = 2
+	pprofFunctionSystemName = 3
+)
+
+// WritePprof writes the profile as a gzipped pprof protobuf, for go tool pprof
+// Each method, block and primitive is a function named like the frames of the
+// tally, and each line of one a location, so flame graphs show Smalltalk
+// code. Samples have the bytecodes run and the time spent, in nanoseconds.
+func (p *Profile) WritePprof(w io.Writer) error {
+	stringTable := newPprofStrings()
+	var profile pprofBuffer
+
+	for _, valueType := range [][2]string{{"bytecodes", "count"}, {"time", "nanoseconds"}} {
+		var message pprofBuffer
+		message.int64Field(pprofValueTypeType, stringTable.index(valueType[0]))
+		message.int64Field(pprofValueTypeUnit, stringTable.index(valueType[1]))
+		profile.messageField(pprofProfileSampleType, &message)
+	}
+
+	type locationKey struct {
+		function uint64
+		line     int
+	}
+	functions := make(map[ProfileFrame]uint64)
+	locations := make(map[locationKey]uint64)
+	var functionMessages, locationMessages []*pprofBuffer
+
+	for _, sample := range p.Samples {
+		var locationIDs []uint64
+		for _, frame := range sample.Stack {
+			function := ProfileFrame{Method: frame.Method, Primitive: frame.Primitive}
+			functionID, ok := functions[function]
+			if !ok {
+				functionID = uint64(len(functions) + 1)
+				functions[function] = functionID
+				message := &pprofBuffer{}
+				message.uint64Field(pprofFunctionID, functionID)
+				message.int64Field(pprofFunctionName, stringTable.index(function.String()))
+				message.int64Field(pprofFunctionSystemName, stringTable.index(function.Primitive))
+				functionMessages = append(functionMessages, message)
+			}
+
+			key := locationKey{functionID, frame.Line}
+			locationID, ok := locations[key]
+			if !ok {
+				locationID = uint64(len(locations) + 1)
+				locations[key] = locationID
+				var line pprofBuffer
+				line.uint64Field(pprofLineFunctionID, functionID)
+				line.int64Field(pprofLineLine, int64(frame.Line))
+				message := &pprofBuffer{}
+				message.uint64Field(pprofLocationID, locationID)
+				message.messageField(pprofLocationLine, &line)
+				locationMessages = append(locationMessages, message)
+			}
+			locationIDs = append(locationIDs, locationID)
+		}
+
+		var message pprofBuffer
+		message.packedField(pprofSampleLocationID, locationIDs)
+		message.packedField(pprofSampleValue, []uint64{uint64(sample.Bytecodes), uint64(sample.Time)})
+		profile.messageField(pprofProfileSample, &message)
+	}
+
+	for _, message := range locationMessages {
+		profile.messageField(pprofProfileLocation, message)
+	}
+	for _, message := range functionMessages {
+		profile.messageField(pprofProfileFunction, message)
+	}
+
+	profile.int64Field(pprofProfileTimeNanos, p.Start.UnixNano())
+	profile.int64Field(pprofProfileDurationNanos, int64(p.Duration))
+	var periodType pprofBuffer
+	periodType.int64Field(pprofValueTypeType, stringTable.index("bytecodes"))
+	periodType.int64Field(pprofValueTypeUnit, stringTable.index("count"))
+	profile.messageField(pprofProfilePeriodType, &periodType)
+	profile.int64Field(pprofProfilePeriod, int64(p.Interval))
+
+	// The string table goes last since the other messages add to it
+	for _, s := range stringTable.table {
+		profile.stringField(pprofProfileStringTable, s)
+	}
+
+	zipped := gzip.NewWriter(w)
+	if _, err := zipped.Write(profile.bytes); err != nil {
+		return err
+	}
+	return zipped.Close()
+}
+
+// pprofStrings is the string table of a pprof profile, which starts with ""
+type pprofStrings struct {
+	table   []string
+	indices map[string]int64
+}
+
+// newPprofStrings creates a string table
+func newPprofStrings() *pprofStrings {
+	return &pprofStrings{table: []string{""}, indices: map[string]int64{"": 0}}
+}
+
+// index answers the index of s in the table, adding it if it is not there
+func (s *pprofStrings) index(value string) int64 {
+	if index, ok := s.indices[value]; ok {
+		return index
+	}
+	index := int64(len(s.table))
+	s.table = append(s.table, value)
+	s.indices[value] = index
+	return index
+}
+
+// pprofBuffer encodes a protobuf message, leaving out zero values like proto3
+type pprofBuffer struct {
+	bytes []byte
+}
+
+// varint appends an unsigned varint
+func (b *pprofBuffer) varint(value uint64) {
+	for value >= 0x80 {
+		b.bytes = append(b.bytes, byte(value)|0x80)
+		value >>= 7
+	}
+	b.bytes = append(b.bytes, byte(value))
+}
+
+// tag appends a field's number and wire type
+func (b *pprofBuffer) tag(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// uint64Field appends a varint field
+func (b *pprofBuffer) uint64Field(field int, value uint64) {
+	if value == 0 {
+		return
+	}
+	b.tag(field, 0)
+	b.varint(value)
+}
+
+// int64Field appends a varint field
+func (b *pprofBuffer) int64Field(field int, value int64) {
+	b.uint64Field(field, uint64(value))
+}
+
+// bytesField appends a length-delimited field
+func (b *pprofBuffer) bytesField(field int, value []byte) {
+	b.tag(field, 2)
+	b.varint(uint64(len(value)))
+	b.bytes = append(b.bytes, value...)
+}
+
+// stringField appends a string field, even an empty one, since the string table needs them all
+func (b *pprofBuffer) stringField(field int, value string) {
+	b.bytesField(field, []byte(value))
+}
+
+// messageField appends an embedded message
+func (b *pprofBuffer) messageField(field int, message *pprofBuffer) {
+	b.bytesField(field, message.bytes)
+}
+
+// packedField appends a packed repeated varint field
+func (b *pprofBuffer) packedField(field int, values []uint64) {
+	var packed pprofBuffer
+	for _, value := range values {
+		packed.varint(value)
+	}
+	b.bytesField(field, packed.bytes)
+}
@@ -0,0 +1,170 @@
+package vm
+
+import (
+	"fmt"
+	"runtime"
+
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/pile"
+)
+
+// Instance variable indices of PrimitiveFailed, SubscriptOutOfBounds and ImproperStore
+const (
+	primitiveErrorReceiver  = 0
+	primitiveErrorArguments = 1
+)
+
+// Failure codes a primitive can fail with, which the method's fallback code
+// finds as a Symbol in the temporary named by <primitive: ... error: name>
+const (
+	// PrimitiveBadReceiver is the code when the receiver is not of the class the primitive expects
+	PrimitiveBadReceiver = "bad receiver"
+
+	// PrimitiveBadArgument is the code when an argument is not one the primitive can handle
+	PrimitiveBadArgument = "bad argument"
+
+	// PrimitiveBadNumberOfArguments is the code when the method and the primitive take different numbers of arguments
+	PrimitiveBadNumberOfArguments = "bad number of arguments"
+
+	// PrimitiveUnsupported is the code when the primitive is switched off or its module is not loaded
+	PrimitiveUnsupported = "unsupported operation"
+)
+
+// FailPrimitive records why the running primitive failed and returns nil,
+// so a primitive can fail with return vm.FailPrimitive(code). Primitives that
+// just return nil fail without a code, and the fallback code finds nil.
+func (vm *VM) FailPrimitive(code string) *pile.Object {
+	vm.primitiveFailure = code
+	return nil
+}
+
+// newPrimitiveErrorClass creates an error a primitive signals, which knows the
+// receiver and the arguments the primitive was given
+func (vm *VM) newPrimitiveErrorClass(name string) *pile.Class {
+	errorClass := pile.ObjectToClass(vm.Globals["Error"])
+	result := pile.NewClass(name, errorClass)
+	result.InstanceVarNames = []string{"receiver", "arguments"}
+
+	// Accessors for the instance variables
+	compiler.NewMethodBuilder(result).PushInstanceVariable(primitiveErrorReceiver).ReturnStackTop().Go("receiver")
+	compiler.NewMethodBuilder(result).PushInstanceVariable(primitiveErrorArguments).ReturnStackTop().Go("arguments")
+
+	return result
+}
+
+// newPrimitiveError creates an instance of the primitive error named className
+func (vm *VM) newPrimitiveError(className string, receiver *pile.Object, args []*pile.Object, messageText string) *pile.Object {
+	arguments := vm.NewArray(len(args))
+	for i, arg := range args {
+		pile.ObjectToArray(arguments).AtPut(i, arg)
+	}
+
+	result := vm.newException(className)
+	result.InstanceVarsField = []*pile.Object{receiver, arguments}
+	pile.ObjectToException(result).SetMessageText(vm.NewString(messageText))
+	return result
+}
+
+// NewPrimitiveFailedClass creates PrimitiveFailed, the error signalled when a
+// primitive fails and its method has no code to fall back to
+func (vm *VM) NewPrimitiveFailedClass() *pile.Class {
+	return vm.newPrimitiveErrorClass("PrimitiveFailed")
+}
+
+// NewPrimitiveFailed creates the PrimitiveFailed for a primitive method that failed
+func (vm *VM) NewPrimitiveFailed(receiver *pile.Object, args []*pile.Object, method *pile.Method) *pile.Object {
+	messageText := fmt.Sprintf("%s>>%s primitive failed", vm.GetClass(receiver).Name, pile.GetSymbolValue(method.GetSelector()))
+	if vm.primitiveFailure != "" {
+		messageText += ": " + vm.primitiveFailure
+	}
+	return vm.newPrimitiveError("PrimitiveFailed", receiver, args, messageText)
+}
+
+// primitivePrimitiveFailed signals PrimitiveFailed for the primitive whose
+// fallback code sent primitiveFailed, with the code it failed with
+func (vm *VM) primitivePrimitiveFailed(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	context := vm.Executor.CurrentContext
+	for context != nil && context.block {
+		context = context.Sender
+	}
+	if context == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	vm.primitiveFailure = context.primitiveFailure
+	return vm.Signal(vm.NewPrimitiveFailed(context.GetReceiver(), context.Arguments, pile.ObjectToMethod(context.Method)))
+}
+
+// NewSubscriptOutOfBoundsClass creates SubscriptOutOfBounds, the error signalled
+// when an indexed object is accessed with an index it does not have
+func (vm *VM) NewSubscriptOutOfBoundsClass() *pile.Class {
+	return vm.newPrimitiveErrorClass("SubscriptOutOfBounds")
+}
+
+// signalSubscriptOutOfBounds signals SubscriptOutOfBounds for the send of
+// selector to receiver with args, whose first is the index, and answers the
+// value of the handler, if there is one
+func (vm *VM) signalSubscriptOutOfBounds(receiver *pile.Object, selector string, args []*pile.Object) *pile.Object {
+	messageText := fmt.Sprintf("%s>>%s index %d out of bounds", vm.GetClass(receiver).Name, selector, pile.GetIntegerImmediate(args[0]))
+	return vm.Signal(vm.newPrimitiveError("SubscriptOutOfBounds", receiver, args, messageText))
+}
+
+// NewImproperStoreClass creates ImproperStore, the error signalled when an
+// object is stored where the receiver cannot hold it
+func (vm *VM) NewImproperStoreClass() *pile.Class {
+	return vm.newPrimitiveErrorClass("ImproperStore")
+}
+
+// signalImproperStore signals ImproperStore for the send of selector to receiver
+// with args, whose last is the value, and answers the value of the handler, if
+// there is one
+func (vm *VM) signalImproperStore(receiver *pile.Object, selector string, args []*pile.Object, reason string) *pile.Object {
+	messageText := fmt.Sprintf("%s>>%s cannot store %s: %s", vm.GetClass(receiver).Name, selector, args[len(args)-1].String(), reason)
+	return vm.Signal(vm.newPrimitiveError("ImproperStore", receiver, args, messageText))
+}
+
+// signalPrimitivePanic signals the Smalltalk exception for a Go panic in the
+// primitive of method: ZeroDivide for a Go division by zero and PrimitiveFailed
+// with the panic as its failure code otherwise. The panics the VM unwinds
+// contexts with, and errors nothing handles, carry on.
+func (vm *VM) signalPrimitivePanic(r interface{}, receiver *pile.Object, args []*pile.Object, method *pile.Method) *pile.Object {
+	if isControlPanic(r) {
+		panic(r)
+	}
+	if value, ok := r.(runtime.Error); ok {
+		if value.Error() == "runtime error: integer divide by zero" {
+			return vm.signalZeroDivide(receiver, pile.GetSymbolValue(method.GetSelector()))
+		}
+	}
+	vm.primitiveFailure = fmt.Sprint(r)
+	return vm.Signal(vm.NewPrimitiveFailed(receiver, args, method))
+}
+
+// storePrimitiveFailure puts the failure code of the primitive that just failed
+// into the temporary the method's fallback code expects it in, and keeps it
+// with the context for primitiveFailed
+func (vm *VM) storePrimitiveFailure(context *Context, method *pile.Method) {
+	context.primitiveFailure = vm.primitiveFailure
+	tempName := method.GetPrimitiveError()
+	if tempName == "" {
+		return
+	}
+	for i, name := range method.GetTempVarNames() {
+		if name == tempName {
+			if vm.primitiveFailure != "" {
+				context.TempVars[i] = vm.NewSymbol(vm.primitiveFailure)
+			}
+			return
+		}
+	}
+}
+
+// isControlPanic returns true for the values the VM panics with to unwind
+// contexts or terminate a process, and for the errors nothing in Smalltalk
+// handled on their way out
+func isControlPanic(r interface{}) bool {
+	switch r.(type) {
+	case *unwind, *resumption, *termination, UncaughtError:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package vm_test
+
+import (
+	"errors"
+	"testing"
+
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// TestMixedArithmetic tests that arithmetic primitives fall back to coercing their operands
+func TestMixedArithmetic(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		expression string
+		expected   *pile.Object
+	}{
+		{"3 - 2 asFloat", virtualMachine.NewFloat(1)},
+		{"3 * 2 asFloat", virtualMachine.NewFloat(6)},
+		{"3 < 4 asFloat", virtualMachine.TrueObject.(*pile.Object)},
+		{"3 = 3 asFloat", virtualMachine.TrueObject.(*pile.Object)},
+		{"3 asFloat / 2", virtualMachine.NewFloat(1.5)},
+		{"3 = 'abc'", virtualMachine.FalseObject.(*pile.Object)},
+		{"3 perform: #+ with: 4", virtualMachine.NewInteger(7)},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to be %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+}
+
+// TestArithmeticWithNonNumber tests the error arithmetic with something that is not a number signals
+func TestArithmeticWithNonNumber(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"3 + 'abc'", "unhandled Error: Integer>>+ expects a Number argument, not an instance of String"},
+		{"3 asFloat < Object new", "unhandled Error: Float>>< expects a Number argument, not an instance of Object"},
+	}
+	for _, test := range tests {
+		_, err := executeExpression(t, virtualMachine, test.expression)
+		var unhandled *vm.UnhandledExceptionError
+		if !errors.As(err, &unhandled) || err.Error() != test.expected {
+			t.Errorf("Expected %q to signal %q, got %v", test.expression, test.expected, err)
+		}
+	}
+}
+
+// TestPrimitiveFailureCode tests that the fallback code gets the failure code
+func TestPrimitiveFailureCode(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	objectClass := virtualMachine.Globals["Object"]
+	virtualMachine.CompileMethod(objectClass, "plus: other <primitive: 1 error: ec> ^ec", "")
+	virtualMachine.CompileMethod(objectClass, "missing <primitive: 'missing' module: 'nowhere' error: code> ^code", "")
+
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"3 plus: 'abc'", vm.PrimitiveBadArgument},
+		{"Object new plus: 4", vm.PrimitiveBadReceiver},
+		{"3 missing", vm.PrimitiveUnsupported},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil {
+			t.Fatalf("Error executing %q: %v", test.expression, err)
+		}
+		if result.Type() != pile.OBJ_SYMBOL || pile.GetSymbolValue(result.(*pile.Object)) != test.expected {
+			t.Errorf("Expected %q to answer #'%s', got %v", test.expression, test.expected, result)
+		}
+	}
+
+	// The code is nil when the primitive failed without one
+	fail := func(virtualMachine *vm.VM, receiver *pile.Object, args []*pile.Object) *pile.Object { return nil }
+	if err := virtualMachine.Primitives.Register(vm.Primitive{Name: "fail", Module: "test", Function: fail}); err != nil {
+		t.Fatalf("Error registering: %v", err)
+	}
+	virtualMachine.CompileMethod(objectClass, "fail <primitive: 'fail' module: 'test' error: ec> ^ec", "")
+	if result, err := executeExpression(t, virtualMachine, "3 fail"); err != nil || result != virtualMachine.NilObject {
+		t.Errorf("Expected no failure code, got %v (%v)", result, err)
+	}
+}
+
+// TestPrimitiveFailedWithoutFallback tests the error a primitive method with no code signals
+func TestPrimitiveFailedWithoutFallback(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	compiler.NewMethodBuilder(pile.ObjectToClass(virtualMachine.Globals["Object"])).Primitive(1).Go("broken:")
+
+	_, err := executeExpression(t, virtualMachine, "Object new broken: 3")
+	var unhandled *vm.UnhandledExceptionError
+	if !errors.As(err, &unhandled) {
+		t.Fatalf("Expected an unhandled exception, got %v", err)
+	}
+	if err.Error() != "unhandled PrimitiveFailed: Object>>broken: primitive failed: bad receiver" {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+	if !pile.IsKindOf(unhandled.Exception, virtualMachine.Globals["Error"]) {
+		t.Errorf("Expected PrimitiveFailed to be an Error")
+	}
+
+	_, err = executeExpression(t, virtualMachine, "3 perform: #foo with: 4")
+	if err == nil || err.Error() != "unhandled PrimitiveFailed: Integer>>perform:with: primitive failed: bad argument" {
+		t.Errorf("Expected perform:with: with a unary selector to fail, got %v", err)
+	}
+
+	// Fallback code that sends primitiveFailed signals the same error
+	virtualMachine.CompileMethod(virtualMachine.Globals["Object"], "plus: other <primitive: 1> ^self primitiveFailed", "")
+	_, err = executeExpression(t, virtualMachine, "3 plus: 'abc'")
+	if err == nil || err.Error() != "unhandled PrimitiveFailed: Integer>>plus: primitive failed: bad argument" {
+		t.Errorf("Expected primitiveFailed to signal PrimitiveFailed, got %v", err)
+	}
+}
+
+// TestPrimitiveErrors tests the errors primitives signal for bad indices and
+// values, and for Go panics
+func TestPrimitiveErrors(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	items := virtualMachine.NewArray(2)
+	bytes := virtualMachine.NewByteArray(2)
+	virtualMachine.Globals["Items"] = items
+	virtualMachine.Globals["Bytes"] = bytes
+
+	objectClass := virtualMachine.Globals["Object"]
+	explode := func(virtualMachine *vm.VM, receiver *pile.Object, args []*pile.Object) *pile.Object { panic("boom") }
+	divide := func(virtualMachine *vm.VM, receiver *pile.Object, args []*pile.Object) *pile.Object {
+		zero := 0
+		return virtualMachine.NewInteger(int64(1 / zero))
+	}
+	for _, primitive := range []vm.Primitive{
+		{Name: "explode", Module: "test", Function: explode},
+		{Name: "divide", Module: "test", Function: divide},
+	} {
+		if err := virtualMachine.Primitives.Register(primitive); err != nil {
+			t.Fatalf("Error registering: %v", err)
+		}
+	}
+	virtualMachine.CompileMethod(objectClass, "explode <primitive: 'explode' module: 'test'> ^self", "")
+	virtualMachine.CompileMethod(objectClass, "divide <primitive: 'divide' module: 'test'> ^self", "")
+
+	tests := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		{"[Items at: 3] on: SubscriptOutOfBounds do: [:e | e receiver]", items},
+		{"[Bytes at: 0] on: Error do: [:e | e class]", virtualMachine.Globals["SubscriptOutOfBounds"]},
+		{"[Bytes at: 3 put: 1] on: SubscriptOutOfBounds do: [:e | e receiver]", bytes},
+		{"[Bytes at: 1 put: 300] on: ImproperStore do: [:e | e receiver]", bytes},
+		{"[3 explode] on: PrimitiveFailed do: [:e | e receiver]", virtualMachine.NewInteger(3)},
+		{"[3 divide] on: ZeroDivide do: [:e | e dividend]", virtualMachine.NewInteger(3)},
+		{"Bytes at: 2 put: 255", virtualMachine.NewInteger(255)},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	failures := []struct {
+		expression string
+		expected   string
+	}{
+		{"Items at: 3", "unhandled SubscriptOutOfBounds: Array>>at: index 3 out of bounds"},
+		{"Bytes at: 1 put: 300", "unhandled ImproperStore: ByteArray>>at:put: cannot store 300: not a byte"},
+		{"3 explode", "unhandled PrimitiveFailed: Integer>>explode primitive failed: boom"},
+		{"3 divide", "unhandled ZeroDivide: Integer>>divide division by zero"},
+	}
+	for _, test := range failures {
+		_, err := executeExpression(t, virtualMachine, test.expression)
+		var unhandled *vm.UnhandledExceptionError
+		if !errors.As(err, &unhandled) || err.Error() != test.expected {
+			t.Errorf("Expected %q to signal %q, got %v", test.expression, test.expected, err)
+		}
+	}
+
+	// The arguments of the error are those of the primitive
+	result, err := executeExpression(t, virtualMachine, "[Bytes at: 1 put: 300] on: ImproperStore do: [:e | e arguments]")
+	if err != nil || result.Type() != pile.OBJ_ARRAY || pile.ObjectToArray(result.(*pile.Object)).At(1) != virtualMachine.NewInteger(300) {
+		t.Errorf("Expected the arguments of the store, got %v (%v)", result, err)
+	}
+}
+
+// TestVMError tests that a Go panic outside a primitive is returned as a VMError
+func TestVMError(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	virtualMachine.Globals["Broken"] = &pile.Object{TypeField: pile.OBJ_INSTANCE}
+
+	_, err := executeExpression(t, virtualMachine, "Broken foo")
+	var vmError *vm.VMError
+	if !errors.As(err, &vmError) || len(vmError.Stack) == 0 {
+		t.Fatalf("Expected a VMError with a stack, got %v", err)
+	}
+	if vmError.Walkback == nil || len(vmError.Walkback.Frames) != 1 || vmError.Walkback.Frames[0].Selector != "doIt" {
+		t.Errorf("Expected the walkback of the expression, got %v", vmError.Walkback)
+	}
+	if virtualMachine.Executor.CurrentContext != nil {
+		t.Errorf("Expected no current context after the VM error")
+	}
+
+	// The VM carries on afterwards
+	if result, err := executeExpression(t, virtualMachine, "3 + 4"); err != nil || result != virtualMachine.NewInteger(7) {
+		t.Errorf("Expected 7 after the VM error, got %v (%v)", result, err)
+	}
+}
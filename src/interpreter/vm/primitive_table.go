@@ -0,0 +1,241 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+
+	"smalltalklsp/interpreter/pile"
+)
+
+// PrimitiveFunc is the Go implementation of a primitive
+// It answers nil when the primitive fails, and the method's own bytecodes
+// run instead.
+type PrimitiveFunc func(vm *VM, receiver *pile.Object, args []*pile.Object) *pile.Object
+
+// Primitive describes a primitive and its implementation
+type Primitive struct {
+	// Index is the number methods use in <primitive: n>, 0 if the primitive only has a name
+	Index int
+
+	// Name is the name methods use in <primitive: 'name' module: 'module'>
+	Name string
+
+	// Module is the primitive set the primitive belongs to, empty for the VM's own primitives
+	Module string
+
+	// Arity is the number of arguments the primitive takes
+	Arity int
+
+	// Receiver is the name of the class the receiver must be or inherit from,
+	// empty if the primitive accepts any receiver
+	Receiver string
+
+	// Function implements the primitive
+	Function PrimitiveFunc
+
+	// disabled is set when a tool switches the primitive off, so that it always fails
+	disabled bool
+}
+
+// FullName returns the name tools use for the primitive, "module.name" or
+// just the name for the VM's own primitives
+func (p *Primitive) FullName() string {
+	if p.Module == "" {
+		return p.Name
+	}
+	return p.Module + "." + p.Name
+}
+
+// primitiveKey identifies a named primitive
+type primitiveKey struct {
+	module string
+	name   string
+}
+
+// PrimitiveTable holds the primitives a VM can run, by number and by name
+// Every VM has its own table, copied from the primitives registered with
+// RegisterPrimitive, so switching primitives off in one VM leaves the others alone.
+type PrimitiveTable struct {
+	// byIndex holds the numbered primitives, indexed by their number
+	byIndex []*Primitive
+
+	// byName holds all the primitives by module and name
+	byName map[primitiveKey]*Primitive
+}
+
+// NewPrimitiveTable creates an empty primitive table
+func NewPrimitiveTable() *PrimitiveTable {
+	return &PrimitiveTable{
+		byIndex: []*Primitive{},
+		byName:  make(map[primitiveKey]*Primitive),
+	}
+}
+
+// defaultPrimitives holds the registered primitives every new VM starts with
+var defaultPrimitives = corePrimitives()
+
+// RegisterPrimitive adds a primitive to the primitives every new VM starts with
+// Packages with primitive sets call it from init. It panics if the number or
+// the name is already taken. DefaultVM is created before those init functions
+// run, so the primitive is added to its table as well.
+func RegisterPrimitive(primitive Primitive) {
+	if err := defaultPrimitives.Register(primitive); err != nil {
+		panic(err)
+	}
+	if DefaultVM != nil {
+		if err := DefaultVM.Primitives.Register(primitive); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// DefaultPrimitives returns the table new VMs copy their primitives from
+func DefaultPrimitives() *PrimitiveTable {
+	return defaultPrimitives
+}
+
+// Register adds a primitive to the table
+// A primitive needs a name and a function. It can have a number as well,
+// which must not be taken by another primitive.
+func (t *PrimitiveTable) Register(primitive Primitive) error {
+	if primitive.Name == "" || primitive.Function == nil {
+		return fmt.Errorf("primitive %d needs a name and a function", primitive.Index)
+	}
+	if primitive.Index < 0 {
+		return fmt.Errorf("primitive %s has a negative number: %d", primitive.FullName(), primitive.Index)
+	}
+
+	key := primitiveKey{module: primitive.Module, name: primitive.Name}
+	if _, ok := t.byName[key]; ok {
+		return fmt.Errorf("primitive %s is already registered", primitive.FullName())
+	}
+	if existing := t.Lookup(primitive.Index); existing != nil {
+		return fmt.Errorf("primitive %d is already registered as %s", primitive.Index, existing.FullName())
+	}
+
+	t.add(primitive)
+	return nil
+}
+
+// add stores a copy of a primitive under its name and number
+func (t *PrimitiveTable) add(primitive Primitive) {
+	entry := &primitive
+	t.byName[primitiveKey{module: entry.Module, name: entry.Name}] = entry
+	if entry.Index > 0 {
+		for len(t.byIndex) <= entry.Index {
+			t.byIndex = append(t.byIndex, nil)
+		}
+		t.byIndex[entry.Index] = entry
+	}
+}
+
+// Clone returns a copy of the table that can be changed independently
+func (t *PrimitiveTable) Clone() *PrimitiveTable {
+	result := NewPrimitiveTable()
+	for _, primitive := range t.byName {
+		result.add(*primitive)
+	}
+	return result
+}
+
+// Lookup returns the primitive with a number, or nil if there is none
+func (t *PrimitiveTable) Lookup(index int) *Primitive {
+	if index <= 0 || index >= len(t.byIndex) {
+		return nil
+	}
+	return t.byIndex[index]
+}
+
+// LookupNamed returns the primitive with a name in a module, or nil if there is none
+func (t *PrimitiveTable) LookupNamed(name string, module string) *Primitive {
+	return t.byName[primitiveKey{module: module, name: name}]
+}
+
+// Primitives returns all the primitives sorted by module, then by number and name
+// They are the table's own entries, switch them on and off with Disable and Enable.
+func (t *PrimitiveTable) Primitives() []*Primitive {
+	result := make([]*Primitive, 0, len(t.byName))
+	for _, primitive := range t.byName {
+		result = append(result, primitive)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Module != b.Module {
+			return a.Module < b.Module
+		}
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		return a.Name < b.Name
+	})
+	return result
+}
+
+// find returns the primitive with a full name, or nil if there is none
+func (t *PrimitiveTable) find(fullName string) *Primitive {
+	for _, primitive := range t.byName {
+		if primitive.FullName() == fullName {
+			return primitive
+		}
+	}
+	return nil
+}
+
+// Disable switches off the primitives with the given full names
+// Methods using a disabled primitive run their bytecodes as if it had failed.
+func (t *PrimitiveTable) Disable(names ...string) error {
+	for _, name := range names {
+		if t.find(name) == nil {
+			return fmt.Errorf("unknown primitive: %s", name)
+		}
+	}
+	for _, name := range names {
+		t.find(name).disabled = true
+	}
+	return nil
+}
+
+// Enable switches the primitives with the given full names back on
+func (t *PrimitiveTable) Enable(names ...string) {
+	for _, name := range names {
+		if primitive := t.find(name); primitive != nil {
+			primitive.disabled = false
+		}
+	}
+}
+
+// Enabled returns true if the primitive with a full name exists and is switched on
+func (t *PrimitiveTable) Enabled(name string) bool {
+	primitive := t.find(name)
+	return primitive != nil && !primitive.disabled
+}
+
+// primitiveFor returns the primitive a primitive method uses, or nil if it
+// names a primitive the table does not have
+func (t *PrimitiveTable) primitiveFor(method *pile.Method) *Primitive {
+	if name, module := method.GetPrimitiveName(); name != "" {
+		return t.LookupNamed(name, module)
+	}
+	return t.Lookup(method.GetPrimitiveIndex())
+}
+
+// acceptsReceiver returns true if a receiver is an instance of the class a
+// primitive expects, or of one of its subclasses
+// A method found by lookup in the expected class or a subclass of it can only
+// have such receivers, so the receiver's own class is only checked otherwise.
+func (vm *VM) acceptsReceiver(primitive *Primitive, method *pile.Method, receiver *pile.Object) bool {
+	if primitive.Receiver == "" || inheritsFrom(method.GetMethodClass(), primitive.Receiver) {
+		return true
+	}
+	return inheritsFrom(vm.GetClass(receiver), primitive.Receiver)
+}
+
+// inheritsFrom returns true if a class has a name or inherits from a class with that name
+func inheritsFrom(class *pile.Class, name string) bool {
+	for ; class != nil; class = pile.ObjectToClass(class.SuperClass) {
+		if class.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package vm_test
+
+import (
+	"testing"
+
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// answerSeven is a primitive that always answers 7
+func answerSeven(virtualMachine *vm.VM, receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return virtualMachine.NewInteger(7)
+}
+
+// TestPrimitiveTableRegister tests registering and looking up primitives
+func TestPrimitiveTableRegister(t *testing.T) {
+	table := vm.NewPrimitiveTable()
+	if err := table.Register(vm.Primitive{Index: 200, Name: "seven", Module: "test", Function: answerSeven}); err != nil {
+		t.Fatalf("Error registering: %v", err)
+	}
+
+	if primitive := table.Lookup(200); primitive == nil || primitive.FullName() != "test.seven" {
+		t.Errorf("Expected primitive 200 to be test.seven, got %v", primitive)
+	}
+	if primitive := table.LookupNamed("seven", "test"); primitive == nil || primitive.Index != 200 {
+		t.Errorf("Expected test.seven to be primitive 200, got %v", primitive)
+	}
+	if primitive := table.LookupNamed("seven", ""); primitive != nil {
+		t.Errorf("Expected seven to be unknown outside its module, got %v", primitive)
+	}
+
+	tests := []struct {
+		primitive vm.Primitive
+		expected  string
+	}{
+		{vm.Primitive{Index: 201, Name: "seven", Module: "test", Function: answerSeven}, "primitive test.seven is already registered"},
+		{vm.Primitive{Index: 200, Name: "eight", Function: answerSeven}, "primitive 200 is already registered as test.seven"},
+		{vm.Primitive{Index: 202, Function: answerSeven}, "primitive 202 needs a name and a function"},
+	}
+	for _, test := range tests {
+		err := table.Register(test.primitive)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Expected error %q, got %v", test.expected, err)
+		}
+	}
+}
+
+// TestPrimitiveTableDisable tests that disabled primitives fail in one VM only
+func TestPrimitiveTableDisable(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	other := vm.NewVM()
+	integerClass := virtualMachine.Globals["Integer"]
+
+	// A method whose fallback code answers 0 when the primitive fails
+	virtualMachine.CompileMethod(integerClass, "plus: other <primitive: 'integerAdd'> ^0", "")
+	result, err := executeExpression(t, virtualMachine, "3 plus: 4")
+	if err != nil || result != virtualMachine.NewInteger(7) {
+		t.Fatalf("Expected 7 from the primitive, got %v (%v)", result, err)
+	}
+
+	if err := virtualMachine.Primitives.Disable("integerAdd"); err != nil {
+		t.Fatalf("Error disabling: %v", err)
+	}
+	result, err = executeExpression(t, virtualMachine, "3 plus: 4")
+	if err != nil || result != virtualMachine.NewInteger(0) {
+		t.Errorf("Expected 0 from the fallback code, got %v (%v)", result, err)
+	}
+	if !other.Primitives.Enabled("integerAdd") {
+		t.Errorf("Expected disabling to leave other VMs alone")
+	}
+
+	virtualMachine.Primitives.Enable("integerAdd")
+	result, err = executeExpression(t, virtualMachine, "3 plus: 4")
+	if err != nil || result != virtualMachine.NewInteger(7) {
+		t.Errorf("Expected 7 after enabling the primitive again, got %v (%v)", result, err)
+	}
+
+	if err := virtualMachine.Primitives.Disable("noSuchPrimitive"); err == nil {
+		t.Errorf("Expected an error disabling an unknown primitive")
+	}
+}
+
+// TestPrimitiveFailure tests that primitives fail on receivers, arguments and
+// modules they do not expect
+func TestPrimitiveFailure(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	objectClass := virtualMachine.Globals["Object"]
+
+	sources := []string{
+		// The receiver is not an Integer
+		"plus: other <primitive: 1> ^0",
+		// The method takes no arguments but the primitive takes one
+		"plusNothing <primitive: 1> ^0",
+		// The module is not loaded
+		"missing <primitive: 'missing' module: 'nowhere'> ^0",
+	}
+	for _, source := range sources {
+		virtualMachine.CompileMethod(objectClass, source, "")
+	}
+	for _, expression := range []string{"Object new plus: 4", "3 plusNothing", "3 missing"} {
+		result, err := executeExpression(t, virtualMachine, expression)
+		if err != nil || result != virtualMachine.NewInteger(0) {
+			t.Errorf("Expected %q to fail and answer 0, got %v (%v)", expression, result, err)
+		}
+	}
+}
+
+// TestUnknownPrimitive tests that the compiler rejects a primitive number the
+// VM does not have, and that a method built with one runs its own code
+func TestUnknownPrimitive(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	objectClass := virtualMachine.Globals["Object"]
+
+	assertSyntaxError(t, virtualMachine, virtualMachine.CompileMethod(objectClass, "unknown <primitive: 999> ^0", ""))
+
+	compiler.NewMethodBuilder(pile.ObjectToClass(objectClass)).Primitive(999).PushSelf().ReturnStackTop().Go("unknown")
+	result, err := executeExpression(t, virtualMachine, "3 unknown")
+	if err != nil || result != virtualMachine.NewInteger(3) {
+		t.Errorf("Expected the primitive to fail and the method to answer 3, got %v (%v)", result, err)
+	}
+}
+
+// TestDefaultVMPrimitives tests that the VM created at package initialization has the core primitives
+func TestDefaultVMPrimitives(t *testing.T) {
+	if primitive := vm.DefaultVM.Primitives.Lookup(1); primitive == nil || primitive.Name != "integerAdd" {
+		t.Errorf("Expected DefaultVM to have primitive 1, got %v", primitive)
+	}
+}
@@ -21,7 +21,7 @@ func testSubtractionPrimitive(t *testing.T) {
 	// Get the predefined primitive methods from the VM
 	integerClass := pile.ObjectToClass(virtualMachine.Globals["Integer"])
 	minusSelector := pile.NewSymbol("-")
-	minusMethod := virtualMachine.LookupMethod(pile.ClassToObject(integerClass), minusSelector)
+	minusMethod := pile.LookupClassMethod(integerClass, minusSelector)
 
 	five := virtualMachine.NewInteger(5)
 	two := virtualMachine.NewInteger(2)
@@ -58,7 +58,7 @@ func testMultiplicationPrimitive(t *testing.T) {
 	// Get the predefined primitive methods from the VM
 	integerClass := pile.ObjectToClass(virtualMachine.Globals["Integer"])
 	timesSelector := pile.NewSymbol("*")
-	timesMethod := virtualMachine.LookupMethod(pile.ClassToObject(integerClass), timesSelector)
+	timesMethod := pile.LookupClassMethod(integerClass, timesSelector)
 
 	five := virtualMachine.NewInteger(5)
 	two := virtualMachine.NewInteger(2)
@@ -95,7 +95,7 @@ func testAdditionPrimitive(t *testing.T) {
 	// Get the predefined primitive methods from the VM
 	integerClass := pile.ObjectToClass(virtualMachine.Globals["Integer"])
 	plusSelector := pile.NewSymbol("+")
-	plusMethod := virtualMachine.LookupMethod(pile.ClassToObject(integerClass), plusSelector)
+	plusMethod := pile.LookupClassMethod(integerClass, plusSelector)
 
 	three := virtualMachine.NewInteger(3)
 	four := virtualMachine.NewInteger(4)
@@ -132,7 +132,7 @@ func testLessThanPrimitive(t *testing.T) {
 	// Get the predefined primitive methods from the VM
 	integerClass := pile.ObjectToClass(virtualMachine.Globals["Integer"])
 	lessSelector := pile.NewSymbol("<")
-	lessMethod := virtualMachine.LookupMethod(pile.ClassToObject(integerClass), lessSelector)
+	lessMethod := pile.LookupClassMethod(integerClass, lessSelector)
 
 	two := virtualMachine.NewInteger(2)
 	five := virtualMachine.NewInteger(5)
@@ -183,7 +183,7 @@ func testGreaterThanPrimitive(t *testing.T) {
 	// Get the predefined primitive methods from the VM
 	integerClass := pile.ObjectToClass(virtualMachine.Globals["Integer"])
 	greaterSelector := pile.NewSymbol(">")
-	greaterMethod := virtualMachine.LookupMethod(pile.ClassToObject(integerClass), greaterSelector)
+	greaterMethod := pile.LookupClassMethod(integerClass, greaterSelector)
 
 	five := virtualMachine.NewInteger(5)
 	two := virtualMachine.NewInteger(2)
@@ -0,0 +1,845 @@
+package vm
+
+import (
+	"container/heap"
+	"time"
+	"unsafe"
+
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/pile"
+)
+
+// Process priorities, from the lowest to the highest
+const (
+	LowestPriority         = 1
+	UserBackgroundPriority = 3
+	UserSchedulingPriority = 4
+	UserInterruptPriority  = 5
+	LowIOPriority          = 6
+	HighIOPriority         = 7
+	TimingPriority         = 8
+)
+
+// preemptionInterval is the number of bytecodes the executor runs between
+// looking for timers that are due
+const preemptionInterval = 1000
+
+// processState is what a process is doing
+type processState int
+
+const (
+	processSuspended processState = iota
+	processReady
+	processRunning
+	processWaiting
+	processTerminated
+)
+
+// Process is a Smalltalk process, a green thread with its own chain of contexts
+// Each process runs in a goroutine of its own, so that primitives running
+// Smalltalk code can be suspended with the Go stack they are using, but the
+// scheduler only ever lets one of them run. Processes switch when one resumes,
+// yields, waits or terminates, or when a timer wakes one of a higher priority.
+type Process struct {
+	pile.Object
+
+	// Priority is the priority the process runs at, from LowestPriority to TimingPriority
+	Priority int
+
+	// Err is the error the process stopped with if nothing handled it
+	Err error
+
+	vm      *VM
+	block   *pile.Object // the block the process evaluates, nil for the main process
+	state   processState
+	started bool
+	wake    chan struct{} // receives when it is the process's turn to run
+
+	// context and handlingStackOverflow hold the VM's state for the process while it is not running
+	context               *Context
+	handlingStackOverflow bool
+
+	// waitingOn is the semaphore the process is waiting on, if it is
+	waitingOn *Semaphore
+
+	// pending is what the process panics with when it next runs, to unwind it
+	// when it is terminated or to report a deadlock, and resumeTo is the
+	// process to run when it has terminated
+	pending  interface{}
+	resumeTo *Process
+}
+
+// Semaphore lets processes wait for signals, a signal with no process waiting is kept for the next wait
+type Semaphore struct {
+	pile.Object
+	excessSignals int
+	waiting       []*Process
+}
+
+// SharedQueue is a queue processes can wait on for the next item
+type SharedQueue struct {
+	pile.Object
+	items     []*pile.Object
+	available Semaphore
+}
+
+// termination is what a terminated process panics with to unwind its contexts
+type termination struct{}
+
+// Error describes the termination, which the outermost context returns like an error
+func (*termination) Error() string {
+	return "process terminated"
+}
+
+// ProcessorScheduler schedules the VM's processes by priority, the process that
+// has been ready the longest running first among those of the same priority.
+// The goroutine that runs Smalltalk code before any process is created is the
+// main process, which returns errors nothing handled, including deadlocks, to
+// the Go code that started it.
+type ProcessorScheduler struct {
+	// Deterministic makes Delays use a clock that only moves on when every
+	// process is waiting, straight to the next timer, for tests. Set it
+	// before any Delay waits.
+	Deterministic bool
+
+	vm      *VM
+	active  *Process
+	main    *Process
+	ready   [TimingPriority + 1][]*Process
+	started map[*Process]struct{} // the forked processes whose goroutines have not finished
+
+	// timers are the Delays waiting to signal, on a clock starting at epoch
+	timers        timerQueue
+	timerSequence int
+	epoch         time.Time
+	clock         time.Duration
+}
+
+// newProcessorScheduler creates the scheduler of a VM
+func newProcessorScheduler(vm *VM) *ProcessorScheduler {
+	return &ProcessorScheduler{vm: vm, started: map[*Process]struct{}{}, epoch: time.Now()}
+}
+
+// Now answers how long the scheduler's clock has been running, which only
+// moves on while every process is waiting in deterministic mode
+func (s *ProcessorScheduler) Now() time.Duration {
+	if s.Deterministic {
+		return s.clock
+	}
+	return time.Since(s.epoch)
+}
+
+// ActiveProcess answers the running process, making the goroutine running
+// Smalltalk code the main process if there is none
+func (s *ProcessorScheduler) ActiveProcess() *Process {
+	if s.active == nil {
+		s.main = s.vm.newProcess(nil, UserSchedulingPriority)
+		s.main.state = processRunning
+		s.main.started = true
+		s.active = s.main
+	}
+	return s.active
+}
+
+// makeReady puts a process at the back of the queue for its priority
+func (s *ProcessorScheduler) makeReady(process *Process) {
+	process.state = processReady
+	s.ready[process.Priority] = append(s.ready[process.Priority], process)
+}
+
+// nextReady takes the process that has been ready longest at the highest
+// priority out of the ready queues, or answers nil if none is ready
+func (s *ProcessorScheduler) nextReady() *Process {
+	for priority := TimingPriority; priority >= LowestPriority; priority-- {
+		if queue := s.ready[priority]; len(queue) > 0 {
+			s.ready[priority] = queue[1:]
+			return queue[0]
+		}
+	}
+	return nil
+}
+
+// unschedule takes a process out of the ready queues and off the semaphore it is waiting on
+func (s *ProcessorScheduler) unschedule(process *Process) {
+	s.ready[process.Priority] = removeProcess(s.ready[process.Priority], process)
+	if process.waitingOn != nil {
+		process.waitingOn.waiting = removeProcess(process.waitingOn.waiting, process)
+		process.waitingOn = nil
+	}
+}
+
+// removeProcess answers processes without process
+func removeProcess(processes []*Process, process *Process) []*Process {
+	for i, p := range processes {
+		if p == process {
+			return append(processes[:i:i], processes[i+1:]...)
+		}
+	}
+	return processes
+}
+
+// transferTo runs next instead of the active process, whose goroutine waits
+// until the scheduler runs it again
+func (s *ProcessorScheduler) transferTo(next *Process) {
+	from := s.active
+	if next == from {
+		from.state = processRunning
+		return
+	}
+	from.save()
+	s.run(next)
+
+	<-from.wake
+	from.restore()
+	if pending := from.pending; pending != nil {
+		from.pending = nil
+		panic(pending)
+	}
+}
+
+// run makes next the active process and lets its goroutine carry on
+func (s *ProcessorScheduler) run(next *Process) {
+	s.active = next
+	next.state = processRunning
+	if !next.started {
+		next.started = true
+		s.started[next] = struct{}{}
+		go next.run()
+	}
+	next.wake <- struct{}{}
+}
+
+// preempt runs the next ready process if it has a higher priority than the
+// active process, which goes to the back of the queue for its priority
+func (s *ProcessorScheduler) preempt() {
+	active := s.ActiveProcess()
+	for priority := TimingPriority; priority > active.Priority; priority-- {
+		if len(s.ready[priority]) > 0 {
+			s.makeReady(active)
+			s.transferTo(s.nextReady())
+			return
+		}
+	}
+}
+
+// resume makes a new or suspended process ready
+func (s *ProcessorScheduler) resume(process *Process) {
+	if process.state != processSuspended {
+		return
+	}
+	s.makeReady(process)
+	s.preempt()
+}
+
+// yield lets the other ready processes of the active process's priority run first
+func (s *ProcessorScheduler) yield() {
+	active := s.ActiveProcess()
+	if len(s.ready[active.Priority]) == 0 {
+		return
+	}
+	s.makeReady(active)
+	s.transferTo(s.nextReady())
+}
+
+// suspend stops a process until it is resumed
+func (s *ProcessorScheduler) suspend(process *Process) {
+	switch process.state {
+	case processRunning:
+		process.state = processSuspended
+		s.switchAway()
+	case processReady, processWaiting:
+		s.unschedule(process)
+		process.state = processSuspended
+	}
+}
+
+// terminate stops a process for good, unwinding its contexts so that its
+// ensure: blocks run. It answers false for the main process when another
+// process is running, since the Go code waiting for it would never see it end.
+func (s *ProcessorScheduler) terminate(process *Process) bool {
+	active := s.ActiveProcess()
+	switch {
+	case process.state == processTerminated:
+		return true
+	case process == active:
+		if process == s.main {
+			s.main, s.active = nil, nil
+		}
+		process.state = processTerminated
+		panic(&termination{})
+	case process == s.main:
+		return false
+	}
+
+	s.unschedule(process)
+	process.state = processTerminated
+	if process.started {
+		// The process unwinds in its own goroutine and then runs this one again
+		process.pending = &termination{}
+		process.resumeTo = active
+		s.transferTo(process)
+	}
+	return true
+}
+
+// switchAway runs the next ready process after the active one has stopped
+// running, waiting for timers if none is ready
+func (s *ProcessorScheduler) switchAway() {
+	for {
+		if next := s.nextReady(); next != nil {
+			s.transferTo(next)
+			return
+		}
+		if !s.idle() {
+			s.deadlock()
+			return
+		}
+	}
+}
+
+// finish ends the goroutine of a process that has terminated, running the
+// process that terminated it, or the next ready one
+func (s *ProcessorScheduler) finish(process *Process, err error) {
+	process.state = processTerminated
+	process.Err = err
+	delete(s.started, process)
+	if next := process.resumeTo; next != nil {
+		process.resumeTo = nil
+		s.run(next)
+		return
+	}
+	for {
+		if next := s.nextReady(); next != nil {
+			s.run(next)
+			return
+		}
+		if !s.idle() {
+			if s.main == nil {
+				return
+			}
+			s.main.pending = s.deadlockError()
+			s.unschedule(s.main)
+			s.run(s.main)
+			return
+		}
+	}
+}
+
+// terminateLeftovers terminates the processes an evaluation of the host leaves
+// ready, waiting or suspended when it returns, so that their goroutines do not
+// wait for a later evaluation to run them. Processes that have not started are
+// dropped, the others unwind, running their ensure: blocks. A process that
+// blocks again while it unwinds is left behind.
+func (s *ProcessorScheduler) terminateLeftovers() {
+	for priority := range s.ready {
+		for _, process := range s.ready[priority] {
+			if !process.started {
+				process.state = processTerminated
+			}
+		}
+	}
+	s.ready = [TimingPriority + 1][]*Process{}
+	s.timers = nil
+
+	for process := range s.started {
+		if process != s.active && process != s.main {
+			s.terminateLeftover(process)
+		}
+	}
+}
+
+// terminateLeftover terminates a process the host's evaluation left behind,
+// ignoring the errors its ensure: blocks end with
+func (s *ProcessorScheduler) terminateLeftover(process *Process) {
+	defer func() {
+		recover()
+		delete(s.started, process)
+	}()
+	s.terminate(process)
+}
+
+// deadlock reports that every process is waiting to the main process, which
+// returns it to the Go code that started it
+func (s *ProcessorScheduler) deadlock() {
+	err := s.deadlockError()
+	s.unschedule(s.main)
+	if s.active == s.main {
+		s.main.state = processRunning
+		panic(err)
+	}
+	s.main.pending = err
+	s.transferTo(s.main)
+}
+
+// deadlockError creates the error for a deadlock, with the walkback of the
+// main process, or the InterruptedError if the evaluation was stopped while
+// every process waited on a Delay
+func (s *ProcessorScheduler) deadlockError() error {
+	context := s.main.context
+	if s.active == s.main {
+		context = s.vm.Executor.CurrentContext
+	}
+	if err := s.vm.stoppedWaiting(context); err != nil {
+		return err
+	}
+	return s.vm.newVMError("deadlock: every process is waiting", context)
+}
+
+// signal signals a semaphore, making the process that has waited on it longest
+// ready, or keeping the signal for the next wait if none is waiting
+func (s *ProcessorScheduler) signal(semaphore *Semaphore) {
+	if len(semaphore.waiting) == 0 {
+		semaphore.excessSignals++
+		return
+	}
+	process := semaphore.waiting[0]
+	semaphore.waiting = semaphore.waiting[1:]
+	process.waitingOn = nil
+	s.makeReady(process)
+}
+
+// wait makes the active process wait for a signal of semaphore, if it has none kept
+func (s *ProcessorScheduler) wait(semaphore *Semaphore) {
+	if semaphore.excessSignals > 0 {
+		semaphore.excessSignals--
+		return
+	}
+	active := s.ActiveProcess()
+	active.state = processWaiting
+	active.waitingOn = semaphore
+	semaphore.waiting = append(semaphore.waiting, active)
+	s.switchAway()
+}
+
+// timer signals a semaphore when the scheduler's clock reaches at
+type timer struct {
+	at        time.Duration
+	sequence  int
+	semaphore *Semaphore
+}
+
+// timerQueue is a heap of timers, the earliest first, in the order they were
+// added for the same time
+type timerQueue []*timer
+
+func (q timerQueue) Len() int { return len(q) }
+
+func (q timerQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].sequence < q[j].sequence
+}
+
+func (q timerQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *timerQueue) Push(x interface{}) { *q = append(*q, x.(*timer)) }
+
+func (q *timerQueue) Pop() interface{} {
+	old := *q
+	result := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return result
+}
+
+// addTimer signals semaphore once the clock has moved on by delay
+func (s *ProcessorScheduler) addTimer(delay time.Duration, semaphore *Semaphore) {
+	s.timerSequence++
+	heap.Push(&s.timers, &timer{at: s.Now() + delay, sequence: s.timerSequence, semaphore: semaphore})
+}
+
+// fireTimers signals the semaphores of the timers that are due
+func (s *ProcessorScheduler) fireTimers() {
+	now := s.Now()
+	for len(s.timers) > 0 && s.timers[0].at <= now {
+		s.signal(heap.Pop(&s.timers).(*timer).semaphore)
+	}
+}
+
+// idle waits for the next timer when no process is ready, and answers false
+// if there is none to wait for or the evaluation stopped while it waited
+func (s *ProcessorScheduler) idle() bool {
+	if len(s.timers) == 0 {
+		return false
+	}
+	if s.Deterministic {
+		if at := s.timers[0].at; at > s.clock {
+			s.clock = at
+		}
+	} else if !s.vm.sleep(s.timers[0].at - s.Now()) {
+		return false
+	}
+	s.fireTimers()
+	return true
+}
+
+// preemptionPoint lets timers that are due wake their processes, which run
+// straight away if they have a higher priority than the active process
+// The executor calls it every preemptionInterval bytecodes while there are
+// timers, on the real clock only, since the deterministic one stands still.
+func (s *ProcessorScheduler) preemptionPoint() {
+	if s.Deterministic || len(s.timers) == 0 || s.timers[0].at > s.Now() {
+		return
+	}
+	s.fireTimers()
+	s.preempt()
+}
+
+// newProcess creates a suspended process that evaluates block
+func (vm *VM) newProcess(block *pile.Object, priority int) *Process {
+	result := &Process{
+		Object:   pile.Object{TypeField: pile.OBJ_PROCESS},
+		Priority: priority,
+		vm:       vm,
+		block:    block,
+		wake:     make(chan struct{}, 1),
+	}
+	result.SetClass(vm.Globals["Process"])
+	return result
+}
+
+// save keeps the VM's state for the process while it is not running
+func (p *Process) save() {
+	p.context = p.vm.Executor.CurrentContext
+	p.handlingStackOverflow = p.vm.handlingStackOverflow
+}
+
+// restore gives the VM back the process's state when it runs again
+func (p *Process) restore() {
+	p.vm.Executor.CurrentContext = p.context
+	p.vm.handlingStackOverflow = p.handlingStackOverflow
+	p.context = nil
+}
+
+// run is the goroutine of a forked process
+func (p *Process) run() {
+	<-p.wake
+	p.restore()
+	p.vm.Processor.finish(p, p.evaluate())
+}
+
+// evaluate evaluates the process's block and answers the error it stopped
+// with, if nothing handled it
+func (p *Process) evaluate() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch value := r.(type) {
+			case *termination:
+			case UncaughtError:
+				err = value
+			default:
+				err = p.vm.newVMError(r, nil)
+			}
+		}
+	}()
+	p.vm.ExecuteBlock(p.block, []*pile.Object{})
+	return nil
+}
+
+// ProcessToObject converts a Process to an Object
+func ProcessToObject(p *Process) *pile.Object {
+	return &p.Object
+}
+
+// ObjectToProcess converts an Object to a Process, or returns nil if the object is not a process
+func ObjectToProcess(o *pile.Object) *Process {
+	if o == nil || pile.IsImmediate(o) || o.Type() != pile.OBJ_PROCESS {
+		return nil
+	}
+	return (*Process)(unsafe.Pointer(o))
+}
+
+// ObjectToSemaphore converts an Object to a Semaphore, or returns nil if the object is not a semaphore
+func ObjectToSemaphore(o *pile.Object) *Semaphore {
+	if o == nil || pile.IsImmediate(o) || o.Type() != pile.OBJ_SEMAPHORE {
+		return nil
+	}
+	return (*Semaphore)(unsafe.Pointer(o))
+}
+
+// ObjectToSharedQueue converts an Object to a SharedQueue, or returns nil if the object is not a shared queue
+func ObjectToSharedQueue(o *pile.Object) *SharedQueue {
+	if o == nil || pile.IsImmediate(o) || o.Type() != pile.OBJ_SHARED_QUEUE {
+		return nil
+	}
+	return (*SharedQueue)(unsafe.Pointer(o))
+}
+
+// Instance variable indices of Delay
+const (
+	delayMilliseconds = 0
+)
+
+// NewProcessClass creates Process, the class of processes, made by sending newProcess or fork to a block
+func (vm *VM) NewProcessClass() *pile.Class {
+	objectClass := pile.ObjectToClass(vm.Globals["Object"])
+	result := pile.NewClass("Process", objectClass)
+
+	compiler.NewMethodBuilder(result).Primitive(181).Go("resume")
+	compiler.NewMethodBuilder(result).Primitive(182).Go("suspend")
+	compiler.NewMethodBuilder(result).Primitive(183).Go("terminate")
+	compiler.NewMethodBuilder(result).Primitive(184).Go("priority")
+	compiler.NewMethodBuilder(result).Primitive(185).Go("priority:")
+	compiler.NewMethodBuilder(result).Primitive(186).Go("isTerminated")
+
+	return result
+}
+
+// NewProcessorSchedulerClass creates ProcessorScheduler, the class of Processor
+func (vm *VM) NewProcessorSchedulerClass() *pile.Class {
+	objectClass := pile.ObjectToClass(vm.Globals["Object"])
+	result := pile.NewClass("ProcessorScheduler", objectClass)
+
+	compiler.NewMethodBuilder(result).Primitive(187).Go("yield")
+	compiler.NewMethodBuilder(result).Primitive(188).Go("activeProcess")
+
+	return result
+}
+
+// NewSemaphoreClass creates Semaphore
+func (vm *VM) NewSemaphoreClass() *pile.Class {
+	objectClass := pile.ObjectToClass(vm.Globals["Object"])
+	result := pile.NewClass("Semaphore", objectClass)
+
+	compiler.NewMethodBuilder(result).Primitive(189).Go("signal")
+	compiler.NewMethodBuilder(result).Primitive(190).Go("wait")
+	compiler.NewMethodBuilder(result).Primitive(196).Go("critical:")
+
+	return result
+}
+
+// NewSharedQueueClass creates SharedQueue
+func (vm *VM) NewSharedQueueClass() *pile.Class {
+	objectClass := pile.ObjectToClass(vm.Globals["Object"])
+	result := pile.NewClass("SharedQueue", objectClass)
+
+	compiler.NewMethodBuilder(result).Primitive(191).Go("nextPut:")
+	compiler.NewMethodBuilder(result).Primitive(192).Go("next")
+	compiler.NewMethodBuilder(result).Primitive(193).Go("size")
+
+	return result
+}
+
+// NewDelayClass creates Delay, which makes the process that waits on it wait for a time
+func (vm *VM) NewDelayClass() *pile.Class {
+	objectClass := pile.ObjectToClass(vm.Globals["Object"])
+	result := pile.NewClass("Delay", objectClass)
+	result.InstanceVarNames = []string{"milliseconds"}
+
+	// Accessor for the instance variable
+	compiler.NewMethodBuilder(result).PushInstanceVariable(delayMilliseconds).ReturnStackTop().Go("milliseconds")
+	compiler.NewMethodBuilder(result).Primitive(195).Go("wait")
+	compiler.NewMethodBuilder(vm.GetClass(pile.ClassToObject(result))).Primitive(194).Go("forMilliseconds:")
+
+	return result
+}
+
+// newSemaphore creates a Semaphore, or an instance of a subclass
+func (vm *VM) newSemaphore(class *pile.Object) *pile.Object {
+	result := &Semaphore{Object: pile.Object{TypeField: pile.OBJ_SEMAPHORE}}
+	result.SetClass(class)
+	return &result.Object
+}
+
+// newSharedQueue creates a SharedQueue, or an instance of a subclass
+func (vm *VM) newSharedQueue(class *pile.Object) *pile.Object {
+	result := &SharedQueue{Object: pile.Object{TypeField: pile.OBJ_SHARED_QUEUE}}
+	result.SetClass(class)
+	return &result.Object
+}
+
+// primitiveBlockNewProcess answers a suspended process that evaluates the
+// block at the active process's priority
+func (vm *VM) primitiveBlockNewProcess(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if receiver.Type() != pile.OBJ_BLOCK {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	vm.allocated()
+	return ProcessToObject(vm.newProcess(receiver, vm.Processor.ActiveProcess().Priority))
+}
+
+// primitiveProcessResume makes a new or suspended process ready, it runs
+// straight away if its priority is higher than the active process's
+func (vm *VM) primitiveProcessResume(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	process := ObjectToProcess(receiver)
+	if process == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	vm.Processor.resume(process)
+	return receiver
+}
+
+// primitiveProcessSuspend stops a process until it is resumed
+func (vm *VM) primitiveProcessSuspend(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	process := ObjectToProcess(receiver)
+	if process == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	vm.Processor.suspend(process)
+	return receiver
+}
+
+// primitiveProcessTerminate stops a process for good, running its ensure: blocks
+func (vm *VM) primitiveProcessTerminate(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	process := ObjectToProcess(receiver)
+	if process == nil || !vm.Processor.terminate(process) {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return receiver
+}
+
+// primitiveProcessPriority answers the priority of a process
+func (vm *VM) primitiveProcessPriority(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	process := ObjectToProcess(receiver)
+	if process == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return vm.NewInteger(int64(process.Priority))
+}
+
+// primitiveProcessPriorityPut changes the priority of a process, a ready
+// process moves to the back of the queue for its new priority
+func (vm *VM) primitiveProcessPriorityPut(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	process := ObjectToProcess(receiver)
+	if process == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	if !pile.IsIntegerImmediate(args[0]) {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	priority := pile.GetIntegerImmediate(args[0])
+	if priority < LowestPriority || priority > TimingPriority {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+
+	if process.state == processReady {
+		vm.Processor.unschedule(process)
+		process.Priority = int(priority)
+		vm.Processor.makeReady(process)
+		vm.Processor.preempt()
+		return receiver
+	}
+	process.Priority = int(priority)
+	if process == vm.Processor.active {
+		vm.Processor.preempt()
+	}
+	return receiver
+}
+
+// primitiveProcessIsTerminated answers whether a process has terminated
+func (vm *VM) primitiveProcessIsTerminated(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	process := ObjectToProcess(receiver)
+	if process == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return pile.NewBoolean(process.state == processTerminated).(*pile.Object)
+}
+
+// primitiveProcessorYield lets the other ready processes of the active process's priority run first
+func (vm *VM) primitiveProcessorYield(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	vm.Processor.yield()
+	return receiver
+}
+
+// primitiveProcessorActiveProcess answers the running process
+func (vm *VM) primitiveProcessorActiveProcess(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	return ProcessToObject(vm.Processor.ActiveProcess())
+}
+
+// primitiveSemaphoreSignal signals a semaphore, the process it wakes runs
+// straight away if its priority is higher than the active process's
+func (vm *VM) primitiveSemaphoreSignal(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	semaphore := ObjectToSemaphore(receiver)
+	if semaphore == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	vm.Processor.signal(semaphore)
+	vm.Processor.preempt()
+	return receiver
+}
+
+// primitiveSemaphoreWait makes the active process wait for a signal
+func (vm *VM) primitiveSemaphoreWait(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	semaphore := ObjectToSemaphore(receiver)
+	if semaphore == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	vm.Processor.wait(semaphore)
+	return receiver
+}
+
+// primitiveSemaphoreCritical evaluates a block between a wait and a signal,
+// signalling even if the block is unwound
+func (vm *VM) primitiveSemaphoreCritical(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	semaphore := ObjectToSemaphore(receiver)
+	if semaphore == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	if pile.IsImmediate(args[0]) || args[0].Type() != pile.OBJ_BLOCK {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	vm.Processor.wait(semaphore)
+	defer func() {
+		vm.Processor.signal(semaphore)
+		vm.Processor.preempt()
+	}()
+	return vm.ExecuteBlock(args[0], []*pile.Object{})
+}
+
+// primitiveSharedQueueNextPut adds an object to the back of a queue and answers it
+func (vm *VM) primitiveSharedQueueNextPut(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	queue := ObjectToSharedQueue(receiver)
+	if queue == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	queue.items = append(queue.items, args[0])
+	vm.Processor.signal(&queue.available)
+	vm.Processor.preempt()
+	return args[0]
+}
+
+// primitiveSharedQueueNext takes the object at the front of a queue, waiting
+// for one if it is empty
+func (vm *VM) primitiveSharedQueueNext(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	queue := ObjectToSharedQueue(receiver)
+	if queue == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	vm.Processor.wait(&queue.available)
+	result := queue.items[0]
+	queue.items = queue.items[1:]
+	return result
+}
+
+// primitiveSharedQueueSize answers the number of objects in a queue
+func (vm *VM) primitiveSharedQueueSize(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	queue := ObjectToSharedQueue(receiver)
+	if queue == nil {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	return vm.NewInteger(int64(len(queue.items)))
+}
+
+// primitiveDelayForMilliseconds answers a Delay for a number of milliseconds
+func (vm *VM) primitiveDelayForMilliseconds(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	if !pile.IsIntegerImmediate(args[0]) || pile.GetIntegerImmediate(args[0]) < 0 {
+		return vm.FailPrimitive(PrimitiveBadArgument)
+	}
+	vm.allocated()
+	result := pile.NewInstance(pile.ObjectToClass(receiver))
+	result.SetClass(receiver)
+	result.SetInstanceVarByIndex(delayMilliseconds, args[0])
+	return result
+}
+
+// primitiveDelayWait makes the active process wait for the Delay's time
+func (vm *VM) primitiveDelayWait(receiver *pile.Object, args []*pile.Object) *pile.Object {
+	milliseconds := receiver.GetInstanceVarByIndex(delayMilliseconds)
+	if !pile.IsIntegerImmediate(milliseconds) {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
+	semaphore := &Semaphore{}
+	vm.Processor.addTimer(time.Duration(pile.GetIntegerImmediate(milliseconds))*time.Millisecond, semaphore)
+	vm.Processor.wait(semaphore)
+	return receiver
+}
@@ -0,0 +1,200 @@
+package vm_test
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// newProcessTestVM creates a VM with ProcessTest, a class whose methods fork
+// processes that record the order they run in as the digits of its log
+func newProcessTestVM(t *testing.T) *vm.VM {
+	t.Helper()
+	return newTestVM(t, "ProcessTest", []string{"log", "sem", "queue", "p", "depth"},
+		"log ^log",
+		"depth ^depth",
+		"terminated ^p isTerminated",
+		"forkYield log := 0. [log := log * 10 + 1] fork. Processor yield. log := log * 10 + 2. ^log",
+		"forkWithoutYield log := 0. [log := log * 10 + 1] fork. log := log * 10 + 2. ^log",
+		"forkHigher log := 0. [log := log * 10 + 1] forkAt: Processor userInterruptPriority. log := log * 10 + 2. ^log",
+		"semaphore log := 0. sem := Semaphore new. [log := log * 10 + 1. sem wait. log := log * 10 + 3] fork. Processor yield. log := log * 10 + 2. sem signal. Processor yield. ^log",
+		"sharedQueue queue := SharedQueue new. [queue nextPut: 3. queue nextPut: 4] fork. ^queue next + queue next",
+		"delays log := 0. sem := Semaphore new. [(Delay forSeconds: 1) wait. log := log * 10 + 2. sem signal] fork. [(Delay forMilliseconds: 500) wait. log := log * 10 + 1. sem signal] fork. sem wait. sem wait. ^log",
+		"terminate log := 0. sem := Semaphore new. p := [[sem wait] ensure: [log := 5]] fork. Processor yield. p terminate. ^log",
+		"forkError p := [1 / 0] fork. Processor yield. ^p",
+		"critical log := 0. sem := Semaphore forMutualExclusion. sem critical: [log := 3]. ^sem critical: [log]",
+		"bump ^depth := depth + 1",
+		"recurse ^self bump + self recurse",
+		"leave log := 0. sem := Semaphore new. p := [[sem wait] ensure: [log := 5]] fork. [(Delay forSeconds: 100) wait] fork. Processor yield. [log := 7] fork. ^log",
+		"preempted depth := 0. log := 0. [(Delay forMilliseconds: 0) wait. log := depth] forkAt: Processor userInterruptPriority. [self recurse] on: StackOverflow do: [:e | 0]. ^log",
+	)
+}
+
+// TestProcessScheduling tests forking, yielding, priorities, semaphores,
+// shared queues and terminating processes
+func TestProcessScheduling(t *testing.T) {
+	virtualMachine := newProcessTestVM(t)
+
+	tests := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		{"ProcessTest new forkYield", virtualMachine.NewInteger(12)},
+		{"ProcessTest new forkWithoutYield", virtualMachine.NewInteger(2)},
+		{"ProcessTest new forkHigher", virtualMachine.NewInteger(12)},
+		{"ProcessTest new semaphore", virtualMachine.NewInteger(123)},
+		{"ProcessTest new sharedQueue", virtualMachine.NewInteger(7)},
+		{"ProcessTest new terminate", virtualMachine.NewInteger(5)},
+		{"ProcessTest new critical", virtualMachine.NewInteger(3)},
+		{"Processor activeProcess priority", virtualMachine.NewInteger(vm.UserSchedulingPriority)},
+		{"[3] newProcess isTerminated", virtualMachine.NewFalse()},
+		{"SharedQueue new isEmpty", virtualMachine.NewTrue()},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	// The terminated process ran its ensure: block on its way out
+	probe, err := executeExpression(t, virtualMachine, "ProcessTest new")
+	if err != nil {
+		t.Fatalf("Error creating ProcessTest: %v", err)
+	}
+	virtualMachine.Globals["Probe"] = probe.(*pile.Object)
+	executeExpression(t, virtualMachine, "Probe terminate")
+	if result, err := executeExpression(t, virtualMachine, "Probe terminated"); err != nil || result != virtualMachine.NewTrue() {
+		t.Errorf("Expected the process to be terminated, got %v (%v)", result, err)
+	}
+
+	// An error nothing handles stops the process it happened in but not the others
+	result, err := executeExpression(t, virtualMachine, "ProcessTest new forkError")
+	process := vm.ObjectToProcess(result.(*pile.Object))
+	if err != nil || process == nil {
+		t.Fatalf("Expected the forked process, got %v (%v)", result, err)
+	}
+	if process.Err == nil || process.Err.Error() != "unhandled ZeroDivide: Integer>>/ division by zero" {
+		t.Errorf("Expected the process to stop with the ZeroDivide, got %v", process.Err)
+	}
+
+	failures := []string{
+		"Process new",
+		"[3] newProcess priority: 9",
+	}
+	for _, expression := range failures {
+		if _, err := executeExpression(t, virtualMachine, expression); err == nil {
+			t.Errorf("Expected %q to fail", expression)
+		}
+	}
+}
+
+// TestProcessDeadlock tests that waiting with no process to signal returns an error
+func TestProcessDeadlock(t *testing.T) {
+	virtualMachine := vm.NewVM()
+
+	_, err := executeExpression(t, virtualMachine, "Semaphore new wait")
+	var vmError *vm.VMError
+	if !errors.As(err, &vmError) || !strings.Contains(err.Error(), "deadlock") {
+		t.Fatalf("Expected a deadlock, got %v", err)
+	}
+
+	// The VM carries on afterwards
+	if result, err := executeExpression(t, virtualMachine, "3 + 4"); err != nil || result != virtualMachine.NewInteger(7) {
+		t.Errorf("Expected 7 after the deadlock, got %v (%v)", result, err)
+	}
+}
+
+// TestProcessLeftovers tests that the processes an evaluation leaves waiting
+// or ready are terminated when it returns, rather than keeping their goroutines
+func TestProcessLeftovers(t *testing.T) {
+	virtualMachine := newProcessTestVM(t)
+	goroutines := runtime.NumGoroutine()
+
+	probe, err := executeExpression(t, virtualMachine, "ProcessTest new")
+	if err != nil {
+		t.Fatalf("Error creating ProcessTest: %v", err)
+	}
+	virtualMachine.Globals["Probe"] = probe.(*pile.Object)
+	if result, err := executeExpression(t, virtualMachine, "Probe leave"); err != nil || result != virtualMachine.NewInteger(0) {
+		t.Fatalf("Expected the processes to be waiting, got %v (%v)", result, err)
+	}
+
+	// The waiter unwound through its ensure: block, and the process that never ran does not run later
+	tests := []struct {
+		expression string
+		expected   pile.ObjectInterface
+	}{
+		{"Probe terminated", virtualMachine.NewTrue()},
+		{"Processor yield", virtualMachine.Globals["Processor"]},
+		{"Probe log", virtualMachine.NewInteger(5)},
+	}
+	for _, test := range tests {
+		result, err := executeExpression(t, virtualMachine, test.expression)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected %q to answer %v, got %v (%v)", test.expression, test.expected, result, err)
+		}
+	}
+
+	// Goroutines end just after their processes do
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if count := runtime.NumGoroutine(); count > goroutines {
+		t.Errorf("Expected %d goroutines after the evaluation, got %d", goroutines, count)
+	}
+}
+
+// TestDelays tests that Delays wake their processes in order, on the
+// deterministic clock and on the real one
+func TestDelays(t *testing.T) {
+	virtualMachine := newProcessTestVM(t)
+	virtualMachine.Processor.Deterministic = true
+
+	result, err := executeExpression(t, virtualMachine, "ProcessTest new delays")
+	if err != nil || result != virtualMachine.NewInteger(12) {
+		t.Errorf("Expected the shorter Delay to finish first, got %v (%v)", result, err)
+	}
+	if now := virtualMachine.Processor.Now(); now != time.Second {
+		t.Errorf("Expected the deterministic clock to be at 1s, got %v", now)
+	}
+
+	virtualMachine = newProcessTestVM(t)
+	start := time.Now()
+	if _, err := executeExpression(t, virtualMachine, "(Delay forMilliseconds: 10) wait"); err != nil {
+		t.Fatalf("Error waiting: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("Expected to wait at least 10ms, waited %v", elapsed)
+	}
+}
+
+// TestPreemption tests that a Delay that is due preempts a running process of lower priority
+func TestPreemption(t *testing.T) {
+	virtualMachine := newProcessTestVM(t)
+	virtualMachine.MaxContextDepth = 5000
+
+	probe, err := executeExpression(t, virtualMachine, "ProcessTest new")
+	if err != nil {
+		t.Fatalf("Error creating ProcessTest: %v", err)
+	}
+	virtualMachine.Globals["Probe"] = probe.(*pile.Object)
+
+	logged, err := executeExpression(t, virtualMachine, "Probe preempted")
+	if err != nil {
+		t.Fatalf("Error executing: %v", err)
+	}
+	depth, err := executeExpression(t, virtualMachine, "Probe depth")
+	if err != nil {
+		t.Fatalf("Error executing: %v", err)
+	}
+	if log, total := pile.GetIntegerImmediate(logged.(*pile.Object)), pile.GetIntegerImmediate(depth.(*pile.Object)); log <= 0 || log >= total {
+		t.Errorf("Expected the process to run partway through the recursion of %d, it ran at %d", total, log)
+	}
+}
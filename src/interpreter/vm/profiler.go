@@ -0,0 +1,324 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"smalltalklsp/interpreter/pile"
+)
+
+// DefaultProfileInterval is the number of bytecodes between samples when profiling without an interval
+const DefaultProfileInterval = 100
+
+// Profiler samples the chain of contexts while the VM runs, see StartProfiling
+// It takes a sample every Interval bytecodes and whenever a primitive starts
+// or returns, giving each the bytecodes and the time since the last one, so
+// a primitive's own time goes to the primitive. Primitives appear in the chain
+// above the context that sent them.
+type Profiler struct {
+	// Interval is the number of bytecodes between samples, 1 counts every bytecode
+	Interval int
+
+	vm         *VM
+	start      time.Time
+	last       time.Time
+	bytecodes  int64
+	primitives []*profiledPrimitive
+	samples    map[string]*ProfileSample
+	order      []string
+}
+
+// profiledPrimitive is a primitive that is running and the context that sent its message
+type profiledPrimitive struct {
+	caller *Context
+	frame  ProfileFrame
+}
+
+// Profile is what a Profiler sampled
+type Profile struct {
+	// Interval is the number of bytecodes between samples
+	Interval int
+
+	// Start is when profiling started and Duration how long it went on
+	Start    time.Time
+	Duration time.Duration
+
+	// Samples are the distinct chains sampled, in the order they were first seen
+	Samples []*ProfileSample
+}
+
+// ProfileSample is the bytecodes run and the time spent in one chain of contexts
+type ProfileSample struct {
+	// Stack is the chain, innermost first
+	Stack []ProfileFrame
+
+	Bytecodes int64
+	Time      time.Duration
+}
+
+// ProfileFrame is a method, a block or a primitive in a sampled chain
+type ProfileFrame struct {
+	// Method is the method as Class>>selector, with the class that defines it,
+	// or "[] in Class>>selector" for a block
+	Method string
+
+	// Primitive is the name of the primitive for a primitive that was running
+	Primitive string
+
+	// Line is the 1-based source line being executed, 0 if unknown
+	Line int
+}
+
+// String renders the frame as its method, and the primitive if it is one
+func (f ProfileFrame) String() string {
+	if f.Primitive != "" {
+		return fmt.Sprintf("%s <primitive: %s>", f.Method, f.Primitive)
+	}
+	return f.Method
+}
+
+// StartProfiling starts sampling every interval bytecodes, DefaultProfileInterval if it is not positive
+func (vm *VM) StartProfiling(interval int) *Profiler {
+	if interval <= 0 {
+		interval = DefaultProfileInterval
+	}
+	now := time.Now()
+	vm.profiler = &Profiler{
+		Interval: interval,
+		vm:       vm,
+		start:    now,
+		last:     now,
+		samples:  make(map[string]*ProfileSample),
+	}
+	return vm.profiler
+}
+
+// StopProfiling stops sampling and answers the profile, or nil if the VM was not profiling
+func (vm *VM) StopProfiling() *Profile {
+	p := vm.profiler
+	if p == nil {
+		return nil
+	}
+	p.sample()
+	vm.profiler = nil
+
+	result := &Profile{Interval: p.Interval, Start: p.start, Duration: time.Since(p.start)}
+	for _, key := range p.order {
+		result.Samples = append(result.Samples, p.samples[key])
+	}
+	return result
+}
+
+// tick counts a bytecode and samples once Interval of them have run
+func (p *Profiler) tick() {
+	p.bytecodes++
+	if p.bytecodes >= int64(p.Interval) {
+		p.sample()
+	}
+}
+
+// primitive samples the chain before a primitive runs and answers the function
+// that samples it again with the primitive in it as it returns
+func (p *Profiler) primitive(method *pile.Method, primitive *Primitive) func() {
+	p.sample()
+	running := &profiledPrimitive{
+		caller: p.vm.Executor.CurrentContext,
+		frame:  ProfileFrame{Method: profileMethodName(method), Primitive: primitive.Name},
+	}
+	p.primitives = append(p.primitives, running)
+	return func() {
+		p.sample()
+		// Processes can leave primitives running in any order
+		for i := len(p.primitives) - 1; i >= 0; i-- {
+			if p.primitives[i] == running {
+				p.primitives = append(p.primitives[:i], p.primitives[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// sample gives the current chain the bytecodes and the time since the last
+// sample, time with no Smalltalk code running goes nowhere
+func (p *Profiler) sample() {
+	now := time.Now()
+	bytecodes, elapsed := p.bytecodes, now.Sub(p.last)
+	p.bytecodes, p.last = 0, now
+	if bytecodes == 0 && elapsed == 0 {
+		return
+	}
+
+	stack := p.stack()
+	if len(stack) == 0 {
+		return
+	}
+	key := profileKey(stack)
+	sample, ok := p.samples[key]
+	if !ok {
+		sample = &ProfileSample{Stack: stack}
+		p.samples[key] = sample
+		p.order = append(p.order, key)
+	}
+	sample.Bytecodes += bytecodes
+	sample.Time += elapsed
+}
+
+// stack answers the current chain innermost first, with the primitives that
+// are running above the contexts that sent them
+func (p *Profiler) stack() []ProfileFrame {
+	var result []ProfileFrame
+	addPrimitives := func(caller *Context) {
+		for i := len(p.primitives) - 1; i >= 0; i-- {
+			if p.primitives[i].caller == caller {
+				result = append(result, p.primitives[i].frame)
+			}
+		}
+	}
+	for c := p.vm.Executor.CurrentContext; c != nil; c = c.Caller() {
+		addPrimitives(c)
+		result = append(result, profileFrame(c))
+	}
+	addPrimitives(nil)
+	return result
+}
+
+// profileFrame describes a context for a profile
+func profileFrame(context *Context) ProfileFrame {
+	home := context
+	for home.block && home.Sender != nil {
+		home = home.Sender
+	}
+	frame := ProfileFrame{Method: profileMethodName(pile.ObjectToMethod(home.Method))}
+	if context.block {
+		frame.Method = "[] in " + frame.Method
+	}
+
+	// A context waiting on a send is past it already, the instruction it decoded last is the send
+	pc := context.PC
+	if context.instructionPC >= 0 {
+		pc = context.instructionPC
+	}
+	frame.Line = context.GetDebugInfo().LineAt(pc)
+	return frame
+}
+
+// profileMethodName names a method as the class that defines it and its selector
+func profileMethodName(method *pile.Method) string {
+	className := "?"
+	if method.MethodClass != nil {
+		className = method.MethodClass.Name
+	}
+	selector := "doIt"
+	if method.Selector != nil {
+		selector = pile.GetSymbolValue(method.Selector)
+	}
+	return className + ">>" + selector
+}
+
+// profileKey identifies a chain
+func profileKey(stack []ProfileFrame) string {
+	var key strings.Builder
+	for _, frame := range stack {
+		fmt.Fprintf(&key, "%s\x00%s\x00%d\x00", frame.Method, frame.Primitive, frame.Line)
+	}
+	return key.String()
+}
+
+// Bytecodes answers the bytecodes run in all the samples
+func (p *Profile) Bytecodes() int64 {
+	var result int64
+	for _, sample := range p.Samples {
+		result += sample.Bytecodes
+	}
+	return result
+}
+
+// Time answers the time spent in all the samples
+func (p *Profile) Time() time.Duration {
+	var result time.Duration
+	for _, sample := range p.Samples {
+		result += sample.Time
+	}
+	return result
+}
+
+// tallyNode is a method, block or primitive in the tree of a tally, with the
+// bytecodes and time spent in it and what it called
+type tallyNode struct {
+	name      string
+	bytecodes int64
+	time      time.Duration
+	children  map[string]*tallyNode
+}
+
+// WriteTally writes the profile as a tree of the methods, blocks and
+// primitives that ran, outermost first, each with the share of the time spent
+// in it and what it called, like MessageTally
+//
+//	100.0% {1.20ms} 1234 bytecodes Object>>doIt
+//	  75.0% {0.90ms} 1000 bytecodes Foo>>bar
+func (p *Profile) WriteTally(w io.Writer) error {
+	root := &tallyNode{children: make(map[string]*tallyNode)}
+	for _, sample := range p.Samples {
+		node := root
+		node.bytecodes += sample.Bytecodes
+		node.time += sample.Time
+		for i := len(sample.Stack) - 1; i >= 0; i-- {
+			name := sample.Stack[i].String()
+			child, ok := node.children[name]
+			if !ok {
+				child = &tallyNode{name: name, children: make(map[string]*tallyNode)}
+				node.children[name] = child
+			}
+			child.bytecodes += sample.Bytecodes
+			child.time += sample.Time
+			node = child
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, " - %d bytecodes, %s\n", root.bytecodes, formatTallyTime(root.time)); err != nil {
+		return err
+	}
+	return root.writeChildren(w, root, 0)
+}
+
+// writeChildren writes what a node called, the most time first
+func (n *tallyNode) writeChildren(w io.Writer, root *tallyNode, depth int) error {
+	children := make([]*tallyNode, 0, len(n.children))
+	for _, child := range n.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].time != children[j].time {
+			return children[i].time > children[j].time
+		}
+		if children[i].bytecodes != children[j].bytecodes {
+			return children[i].bytecodes > children[j].bytecodes
+		}
+		return children[i].name < children[j].name
+	})
+
+	for _, child := range children {
+		percent := 100.0
+		if root.time > 0 {
+			percent = 100 * float64(child.time) / float64(root.time)
+		}
+		_, err := fmt.Fprintf(w, "%s%.1f%% {%s} %d bytecodes %s\n",
+			strings.Repeat("  ", depth), percent, formatTallyTime(child.time), child.bytecodes, child.name)
+		if err != nil {
+			return err
+		}
+		if err := child.writeChildren(w, root, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatTallyTime renders a time in milliseconds
+func formatTallyTime(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+}
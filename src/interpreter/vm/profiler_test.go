@@ -0,0 +1,95 @@
+package vm_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"smalltalklsp/interpreter/vm"
+)
+
+// newProfilerTestVM creates a VM with ProfileTest, whose run method sends
+// messages a few levels deep
+func newProfilerTestVM(t *testing.T) *vm.VM {
+	t.Helper()
+	return newTestVM(t, "ProfileTest", nil,
+		"double: n ^n + n",
+		"work ^self double: 3",
+		"run ^[self work. self work] value",
+	)
+}
+
+// TestProfilerTally tests the tree of a profile counting every bytecode
+func TestProfilerTally(t *testing.T) {
+	virtualMachine := newProfilerTestVM(t)
+
+	virtualMachine.StartProfiling(1)
+	if _, err := executeExpression(t, virtualMachine, "ProfileTest new run"); err != nil {
+		t.Fatalf("Error executing: %v", err)
+	}
+	profile := virtualMachine.StopProfiling()
+	if virtualMachine.StopProfiling() != nil {
+		t.Errorf("Expected profiling to have stopped")
+	}
+
+	var tally bytes.Buffer
+	if err := profile.WriteTally(&tally); err != nil {
+		t.Fatalf("Error writing the tally: %v", err)
+	}
+
+	// The times vary, the tree and the bytecodes do not
+	times := regexp.MustCompile(`[0-9.]+% \{[0-9.]+ms\}`)
+	text := times.ReplaceAllString(tally.String(), "%")
+	expected := []string{
+		"% 29 bytecodes Object>>doIt",
+		"  % 25 bytecodes ProfileTest>>run",
+		"    % 22 bytecodes [] in ProfileTest>>run",
+		"      % 16 bytecodes ProfileTest>>work",
+		"        % 8 bytecodes ProfileTest>>double:",
+		"          % 0 bytecodes Integer>>+ <primitive: integerAdd>",
+		"  % 0 bytecodes Behavior>>new <primitive: basicNew>",
+	}
+	for _, line := range expected {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("Expected the tally to have %q, got\n%s", line, text)
+		}
+	}
+	if !strings.HasPrefix(text, " - 29 bytecodes, ") || profile.Bytecodes() != 29 {
+		t.Errorf("Expected 29 bytecodes in all, got %d\n%s", profile.Bytecodes(), text)
+	}
+}
+
+// TestProfilerPprof tests that the pprof profile has the Smalltalk frames as functions
+func TestProfilerPprof(t *testing.T) {
+	virtualMachine := newProfilerTestVM(t)
+
+	virtualMachine.StartProfiling(0)
+	if _, err := executeExpression(t, virtualMachine, "ProfileTest new run"); err != nil {
+		t.Fatalf("Error executing: %v", err)
+	}
+	profile := virtualMachine.StopProfiling()
+	if profile.Interval != vm.DefaultProfileInterval {
+		t.Errorf("Expected the default interval, got %d", profile.Interval)
+	}
+
+	var written bytes.Buffer
+	if err := profile.WritePprof(&written); err != nil {
+		t.Fatalf("Error writing the profile: %v", err)
+	}
+	reader, err := gzip.NewReader(&written)
+	if err != nil {
+		t.Fatalf("Expected a gzipped profile: %v", err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Error reading the profile: %v", err)
+	}
+	for _, name := range []string{"bytecodes", "nanoseconds", "ProfileTest>>double:", "[] in ProfileTest>>run", "Integer>>+ <primitive: integerAdd>"} {
+		if !bytes.Contains(data, []byte(name)) {
+			t.Errorf("Expected the profile to have %q", name)
+		}
+	}
+}
@@ -114,7 +114,7 @@ func TestSendMessageWithMultiplication(t *testing.T) {
 	returnValueBuilder.Go("returnValue")
 
 	// Get the predefined multiplication method from the VM
-	timesMethod := virtualMachine.LookupMethod(pile.ClassToObject(integerClass), timesSelector)
+	timesMethod := pile.LookupClassMethod(integerClass, timesSelector)
 
 	// Make sure the method is in the method dictionary
 	methodDict := integerClass.GetMethodDict()
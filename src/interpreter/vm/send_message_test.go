@@ -9,6 +9,16 @@ import (
 	"smalltalklsp/interpreter/vm"
 )
 
+// instructionSizeAt returns the size of the instruction at the context's PC,
+// which depends on the encoding the builder chose for it
+func instructionSizeAt(t *testing.T, context *vm.Context) int {
+	instruction, err := bytecode.Decode(pile.ObjectToMethod(context.GetMethod()).Bytecodes, context.PC)
+	if err != nil {
+		t.Fatalf("Error decoding instruction at %d: %s", context.PC, err)
+	}
+	return instruction.Size
+}
+
 // TestExecuteSendMessageExtended tests the ExecuteSendMessage function with more complex scenarios
 func TestExecuteSendMessageExtended(t *testing.T) {
 	// Pile package integration has been fixed
@@ -47,16 +57,14 @@ func TestExecuteSendMessageExtended(t *testing.T) {
 		if err := virtualMachine.ExecutePushLiteral(context); err != nil {
 			t.Fatalf("Error executing PUSH_LITERAL: %s", err)
 		}
-		context.PC += bytecode.InstructionSize(bytecode.PUSH_LITERAL)
+		context.PC += instructionSizeAt(t, context)
 
-		context.PC = 5
 		if err := virtualMachine.ExecutePushLiteral(context); err != nil {
 			t.Fatalf("Error executing PUSH_LITERAL: %s", err)
 		}
-		context.PC += bytecode.InstructionSize(bytecode.PUSH_LITERAL)
+		context.PC += instructionSizeAt(t, context)
 
 		// Execute the SEND_MESSAGE bytecode
-		context.PC = 10
 		result, err := virtualMachine.ExecuteSendMessage(context)
 		if err != nil {
 			t.Fatalf("Error executing SEND_MESSAGE: %s", err)
@@ -140,45 +148,38 @@ func TestExecuteSendMessageExtended(t *testing.T) {
 		if err := virtualMachine.ExecutePushLiteral(context); err != nil {
 			t.Fatalf("Error executing PUSH_LITERAL: %s", err)
 		}
-		context.PC += bytecode.InstructionSize(bytecode.PUSH_LITERAL)
+		context.PC += instructionSizeAt(t, context)
 
 		// Execute the SEND_MESSAGE bytecode
-		context.PC = 5
+		virtualMachine.Executor.CurrentContext = context
 		result, err := virtualMachine.ExecuteSendMessage(context)
 		if err != nil {
 			t.Fatalf("Error executing SEND_MESSAGE: %s", err)
 		}
 
-		// Check the result
-		if pile.IsIntegerImmediate(result) {
-			intValue := pile.GetIntegerImmediate(result)
-			if intValue != 1 {
-				t.Errorf("Expected 1, got %d", intValue)
-			}
-		} else {
-			t.Errorf("Expected an immediate integer, got %s", result)
+		// The send does not run the method, it makes the method's context current
+		if result != nil {
+			t.Errorf("Expected no result until the method's context runs, got %v", result)
 		}
-
-		// Check the stack
-		if context.StackPointer != 1 {
-			t.Errorf("Expected stack pointer to be 1, got %d", context.StackPointer)
+		if context.StackPointer != 0 {
+			t.Errorf("Expected the receiver to be popped, stack pointer is %d", context.StackPointer)
+		}
+		methodContext := virtualMachine.Executor.CurrentContext
+		if methodContext == context || methodContext.Sender != context || methodContext.Receiver != fiveObj {
+			t.Fatalf("Expected the current context to be factorial sent to 5 from the test context")
 		}
 
-		// Check the stack top
-		stackTop := context.Stack[0]
-		if pile.IsIntegerImmediate(stackTop) {
-			intValue := pile.GetIntegerImmediate(stackTop)
-			if intValue != 1 {
-				t.Errorf("Expected stack top to be 1, got %d", intValue)
-			}
-		} else {
-			t.Errorf("Expected an immediate integer, got %s", stackTop)
+		// Running the method's context answers its result
+		value, err := virtualMachine.Executor.ExecuteContext(methodContext)
+		if err != nil {
+			t.Fatalf("Error executing factorial: %s", err)
+		}
+		if value != oneObj {
+			t.Errorf("Expected 1, got %v", value)
 		}
 	})
 
 	t.Run("method not found", func(t *testing.T) {
-		t.Skip("Implement message not understood later")
-
 		// Create literals
 		receiver := virtualMachine.NewInteger(2)
 		unknownSelector := pile.NewSymbol("unknown")
@@ -205,16 +206,24 @@ func TestExecuteSendMessageExtended(t *testing.T) {
 		if err := virtualMachine.ExecutePushLiteral(context); err != nil {
 			t.Fatalf("Error executing PUSH_LITERAL: %s", err)
 		}
-		context.PC += bytecode.InstructionSize(bytecode.PUSH_LITERAL)
+		context.PC += instructionSizeAt(t, context)
 
-		// Execute the SEND_MESSAGE bytecode
-		context.PC = 5
-		_, err := virtualMachine.ExecuteSendMessage(context)
+		// Nothing handles the MessageNotUnderstood, so signalling it panics with the exception
+		defer func() {
+			unhandled, ok := recover().(*vm.UnhandledExceptionError)
+			if !ok || !pile.IsKindOf(unhandled.Exception, virtualMachine.Globals["MessageNotUnderstood"]) {
+				t.Fatalf("Expected a MessageNotUnderstood, got %v", unhandled)
+			}
+			exception := unhandled.Exception
+			message := exception.GetInstanceVarByIndex(0)
+			if selector := pile.GetSymbolValue(message.GetInstanceVarByIndex(0)); selector != "unknown" {
+				t.Errorf("Expected the message selector to be unknown, got %s", selector)
+			}
+		}()
 
-		// Check that we got an error
-		if err == nil {
-			t.Errorf("Expected error for unknown method, got nil")
-		}
+		// Execute the SEND_MESSAGE bytecode
+		virtualMachine.ExecuteSendMessage(context)
+		t.Errorf("Expected the send to signal MessageNotUnderstood")
 	})
 }
 
@@ -260,20 +269,20 @@ func TestExecuteSendMessageWithMultipleArguments(t *testing.T) {
 		if err := virtualMachine.ExecutePushLiteral(context); err != nil {
 			t.Fatalf("Error executing PUSH_LITERAL: %s", err)
 		}
-		context.PC += bytecode.InstructionSize(bytecode.PUSH_LITERAL)
+		context.PC += instructionSizeAt(t, context)
 
 		// Execute the second PUSH_LITERAL bytecode
 		if err := virtualMachine.ExecutePushLiteral(context); err != nil {
 			t.Fatalf("Error executing PUSH_LITERAL: %s", err)
 		}
-		context.PC += bytecode.InstructionSize(bytecode.PUSH_LITERAL)
+		context.PC += instructionSizeAt(t, context)
 
 		// Execute the first SEND_MESSAGE bytecode (2 + 3)
 		result, err := virtualMachine.ExecuteSendMessage(context)
 		if err != nil {
 			t.Fatalf("Error executing SEND_MESSAGE: %s", err)
 		}
-		context.PC += bytecode.InstructionSize(bytecode.SEND_MESSAGE)
+		context.PC += instructionSizeAt(t, context)
 
 		// Check the intermediate result
 		if pile.IsIntegerImmediate(result) {
@@ -289,7 +298,7 @@ func TestExecuteSendMessageWithMultipleArguments(t *testing.T) {
 		if err := virtualMachine.ExecutePushLiteral(context); err != nil {
 			t.Fatalf("Error executing PUSH_LITERAL: %s", err)
 		}
-		context.PC += bytecode.InstructionSize(bytecode.PUSH_LITERAL)
+		context.PC += instructionSizeAt(t, context)
 
 		// Execute the second SEND_MESSAGE bytecode (5 + 4)
 		result, err = virtualMachine.ExecuteSendMessage(context)
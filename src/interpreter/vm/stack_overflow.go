@@ -0,0 +1,78 @@
+package vm
+
+import (
+	"fmt"
+
+	"smalltalklsp/interpreter/compiler"
+	"smalltalklsp/interpreter/pile"
+)
+
+// Default limits on the call chain, see VM.MaxContextDepth and VM.MaxStackSlots
+const (
+	DefaultMaxContextDepth = 100000
+	DefaultMaxStackSlots   = 20000000
+)
+
+// Instance variable indices of StackOverflow
+const (
+	stackOverflowWalkback = 0
+)
+
+// The walkback of a StackOverflow shows this many of the innermost and outermost contexts
+const (
+	walkbackInnermost = 10
+	walkbackOutermost = 5
+)
+
+// NewStackOverflowClass creates StackOverflow, the error signalled when a send
+// or block evaluation would take the call chain past the VM's limits
+func (vm *VM) NewStackOverflowClass() *pile.Class {
+	errorClass := pile.ObjectToClass(vm.Globals["Error"])
+	result := pile.NewClass("StackOverflow", errorClass)
+	result.InstanceVarNames = []string{"walkback"}
+
+	// Accessor for the instance variable
+	compiler.NewMethodBuilder(result).PushInstanceVariable(stackOverflowWalkback).ReturnStackTop().Go("walkback")
+
+	return result
+}
+
+// NewStackOverflow creates the StackOverflow for a context past the VM's limits
+// Its walkback is the String Walkback.String renders for the call chain, leaving
+// out all but the innermost and outermost few contexts.
+func (vm *VM) NewStackOverflow(context *Context) *pile.Object {
+	messageText := fmt.Sprintf("stack overflow: more than %d contexts deep", vm.MaxContextDepth)
+	if vm.MaxContextDepth == 0 || context.depth <= vm.MaxContextDepth {
+		messageText = fmt.Sprintf("stack overflow: more than %d stack slots in use", vm.MaxStackSlots)
+	}
+
+	result := vm.newException("StackOverflow")
+	result.InstanceVarsField = []*pile.Object{vm.NewString(vm.newWalkback(context, walkbackInnermost, walkbackOutermost).String())}
+	pile.ObjectToException(result).SetMessageText(vm.NewString(messageText))
+	return result
+}
+
+// stackOverflow signals StackOverflow if context takes the call chain past the
+// VM's limits. It answers the handler's value and true, or false if the context
+// is within the limits. The handler gets a tenth of the limits again to run in,
+// and overflowing those as well is not handled.
+func (vm *VM) stackOverflow(context *Context) (*pile.Object, bool) {
+	maxDepth, maxSlots := vm.MaxContextDepth, vm.MaxStackSlots
+	if vm.handlingStackOverflow {
+		maxDepth += maxDepth / 10
+		maxSlots += maxSlots / 10
+	}
+	if (maxDepth == 0 || context.depth <= maxDepth) && (maxSlots == 0 || context.slots <= maxSlots) {
+		return nil, false
+	}
+
+	exception := vm.NewStackOverflow(context)
+	if vm.handlingStackOverflow {
+		vm.unhandled(exception)
+	}
+	vm.handlingStackOverflow = true
+	defer func() {
+		vm.handlingStackOverflow = false
+	}()
+	return vm.Signal(exception), true
+}
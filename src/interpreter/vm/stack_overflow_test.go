@@ -0,0 +1,77 @@
+package vm_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"smalltalklsp/interpreter/pile"
+	"smalltalklsp/interpreter/vm"
+)
+
+// TestStackOverflow tests that runaway recursion signals StackOverflow with a walkback
+func TestStackOverflow(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	virtualMachine.MaxContextDepth = 50
+	virtualMachine.CompileMethod(virtualMachine.Globals["Integer"], "recurse ^self recurse", "")
+
+	_, err := executeExpression(t, virtualMachine, "3 recurse")
+	var unhandled *vm.UnhandledExceptionError
+	if !errors.As(err, &unhandled) {
+		t.Fatalf("Expected an unhandled exception, got %v", err)
+	}
+	if err.Error() != "unhandled StackOverflow: stack overflow: more than 50 contexts deep" {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+	if !pile.IsKindOf(unhandled.Exception, virtualMachine.Globals["Error"]) {
+		t.Errorf("Expected StackOverflow to be an Error")
+	}
+
+	// The walkback has the innermost ten and outermost five of the 51 contexts
+	walkback := pile.ObjectToString(unhandled.Exception.GetInstanceVarByIndex(0)).GetValue()
+	expected := strings.Repeat("Integer>>recurse (line 1) receiver: 3\n", 10) + "...36 more...\n" +
+		strings.Repeat("Integer>>recurse (line 1) receiver: 3\n", 4) + "UndefinedObject(Object)>>doIt (line 1) receiver: nil"
+	if walkback != expected {
+		t.Errorf("Expected walkback\n%s\ngot\n%s", expected, walkback)
+	}
+
+	// The VM carries on afterwards
+	if virtualMachine.Executor.CurrentContext != nil {
+		t.Errorf("Expected no current context after the overflow unwound")
+	}
+	if result, err := executeExpression(t, virtualMachine, "3 + 4"); err != nil || result != virtualMachine.NewInteger(7) {
+		t.Errorf("Expected 7 after the overflow, got %v (%v)", result, err)
+	}
+}
+
+// TestStackSlotLimit tests the limit on the stack slots the call chain allocates
+func TestStackSlotLimit(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	virtualMachine.MaxContextDepth = 0
+	virtualMachine.MaxStackSlots = 5000
+	virtualMachine.CompileMethod(virtualMachine.Globals["Integer"], "recurse ^self recurse", "")
+
+	_, err := executeExpression(t, virtualMachine, "3 recurse")
+	if err == nil || err.Error() != "unhandled StackOverflow: stack overflow: more than 5000 stack slots in use" {
+		t.Errorf("Expected the slot limit to overflow, got %v", err)
+	}
+}
+
+// TestStackOverflowHandled tests that a handler for StackOverflow unwinds the
+// overflowing call chain and answers the value of the on:do:
+func TestStackOverflowHandled(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	virtualMachine.MaxContextDepth = 50
+	virtualMachine.CompileMethod(virtualMachine.Globals["Integer"], "recurse ^self recurse", "")
+
+	result, err := executeExpression(t, virtualMachine, "[3 recurse] on: StackOverflow do: [:e | 42]")
+	if err != nil || result != virtualMachine.NewInteger(42) {
+		t.Errorf("Expected the handler's 42, got %v (%v)", result, err)
+	}
+
+	// The limits apply in full again afterwards
+	_, err = executeExpression(t, virtualMachine, "3 recurse")
+	if err == nil || err.Error() != "unhandled StackOverflow: stack overflow: more than 50 contexts deep" {
+		t.Errorf("Expected the overflow to be unhandled, got %v", err)
+	}
+}
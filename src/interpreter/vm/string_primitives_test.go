@@ -14,7 +14,7 @@ func TestStringSizePrimitive(t *testing.T) {
 	// Get the predefined primitive methods from the VM
 	stringClass := pile.ObjectToClass(virtualMachine.Globals["String"])
 	sizeSelector := pile.NewSymbol("size")
-	sizeMethod := virtualMachine.LookupMethod(pile.ClassToObject(stringClass), sizeSelector)
+	sizeMethod := pile.LookupClassMethod(stringClass, sizeSelector)
 
 	// Create a test string
 	testString := virtualMachine.NewString("hello")
@@ -2,6 +2,8 @@ package vm
 
 import (
 	"fmt"
+	"math/big"
+	"runtime/debug"
 
 	"smalltalklsp/interpreter/compiler"
 	"smalltalklsp/interpreter/pile"
@@ -18,6 +20,40 @@ type VM struct {
 	NilObject   pile.ObjectInterface
 	TrueObject  pile.ObjectInterface
 	FalseObject pile.ObjectInterface
+
+	// Primitives are the primitives methods can use, by number and by name
+	Primitives *PrimitiveTable
+
+	// methodCache is the global method cache, valid for methodCacheEpoch
+	methodCache      map[methodCacheKey]*pile.Object
+	methodCacheEpoch uint64
+
+	// primitiveFailure is the failure code of the primitive that last failed
+	primitiveFailure string
+
+	// MaxContextDepth is the most contexts the call chain can have, and MaxStackSlots
+	// the most temporaries and stack slots its contexts can allocate between them.
+	// Going past either signals StackOverflow. Zero means no limit.
+	MaxContextDepth int
+	MaxStackSlots   int
+
+	// handlingStackOverflow is true while a StackOverflow is being signalled
+	handlingStackOverflow bool
+
+	// Processor schedules the VM's processes, see process.go
+	Processor *ProcessorScheduler
+
+	// budget is the limits of the running evaluation, and interruptRequested
+	// and interruptWake tell it Interrupt was called, see budget.go
+	budget             *budget
+	interruptRequested int32
+	interruptWake      chan struct{}
+
+	// profiler samples the running contexts while profiling, see profiler.go
+	profiler *Profiler
+
+	// debugger pauses the running contexts while attached, see debugger.go
+	debugger *Debugger
 }
 
 // NewVM creates a new virtual machine
@@ -25,6 +61,13 @@ func NewVM() *VM {
 	vm := &VM{
 		Globals:      make(map[string]*pile.Object),
 		ObjectMemory: pile.NewObjectMemory(),
+		Primitives:   DefaultPrimitives().Clone(),
+		methodCache:  make(map[methodCacheKey]*pile.Object),
+
+		interruptWake: make(chan struct{}, 1),
+
+		MaxContextDepth: DefaultMaxContextDepth,
+		MaxStackSlots:   DefaultMaxStackSlots,
 	}
 
 	// Initialize special immediate objects
@@ -39,9 +82,15 @@ func NewVM() *VM {
 	objectClass := vm.NewObjectClass()
 	vm.Globals["Object"] = pile.ClassToObject(objectClass)
 
+	behaviorClass := vm.NewBehaviorClass()
+	vm.Globals["Behavior"] = pile.ClassToObject(behaviorClass)
+
 	classClass := vm.NewClassClass()
 	vm.Globals["Class"] = pile.ClassToObject(classClass)
 
+	metaclassClass := vm.NewMetaclassClass()
+	vm.Globals["Metaclass"] = pile.ClassToObject(metaclassClass)
+
 	nilClass := pile.NewClass("UndefinedObject", objectClass)
 	vm.Globals["UndefinedObject"] = pile.ClassToObject(nilClass)
 
@@ -51,12 +100,30 @@ func NewVM() *VM {
 	falseClass := vm.NewFalseClass()
 	vm.Globals["False"] = pile.ClassToObject(falseClass)
 
+	numberClass := vm.NewNumberClass()
+	vm.Globals["Number"] = pile.ClassToObject(numberClass)
+
 	integerClass := vm.NewIntegerClass()
 	vm.Globals["Integer"] = pile.ClassToObject(integerClass)
 
+	largePositiveIntegerClass := vm.NewLargePositiveIntegerClass()
+	vm.Globals["LargePositiveInteger"] = pile.ClassToObject(largePositiveIntegerClass)
+
+	largeNegativeIntegerClass := vm.NewLargeNegativeIntegerClass()
+	vm.Globals["LargeNegativeInteger"] = pile.ClassToObject(largeNegativeIntegerClass)
+
 	floatClass := vm.NewFloatClass()
 	vm.Globals["Float"] = pile.ClassToObject(floatClass)
 
+	boxedFloat64Class := vm.NewBoxedFloat64Class()
+	vm.Globals["BoxedFloat64"] = pile.ClassToObject(boxedFloat64Class)
+
+	fractionClass := vm.NewFractionClass()
+	vm.Globals["Fraction"] = pile.ClassToObject(fractionClass)
+
+	scaledDecimalClass := vm.NewScaledDecimalClass()
+	vm.Globals["ScaledDecimal"] = pile.ClassToObject(scaledDecimalClass)
+
 	stringClass := vm.NewStringClass()
 	vm.Globals["String"] = pile.ClassToObject(stringClass)
 
@@ -69,12 +136,100 @@ func NewVM() *VM {
 	byteArrayClass := vm.NewByteArrayClass()
 	vm.Globals["ByteArray"] = pile.ClassToObject(byteArrayClass)
 
-	// Initialize the executor
+	compilerClass := vm.NewCompilerClass()
+	vm.Globals["Compiler"] = pile.ClassToObject(compilerClass)
+
+	compiledMethodClass := vm.NewCompiledMethodClass()
+	vm.Globals["CompiledMethod"] = pile.ClassToObject(compiledMethodClass)
+
+	syntaxErrorClass := vm.NewSyntaxErrorClass()
+	vm.Globals["SyntaxError"] = pile.ClassToObject(syntaxErrorClass)
+
+	messageClass := vm.NewMessageClass()
+	vm.Globals["Message"] = pile.ClassToObject(messageClass)
+
+	exceptionClass := vm.NewExceptionClass()
+	vm.Globals["Exception"] = pile.ClassToObject(exceptionClass)
+
+	errorClass := vm.NewErrorClass()
+	vm.Globals["Error"] = pile.ClassToObject(errorClass)
+
+	messageNotUnderstoodClass := vm.NewMessageNotUnderstoodClass()
+	vm.Globals["MessageNotUnderstood"] = pile.ClassToObject(messageNotUnderstoodClass)
+
+	primitiveFailedClass := vm.NewPrimitiveFailedClass()
+	vm.Globals["PrimitiveFailed"] = pile.ClassToObject(primitiveFailedClass)
+
+	subscriptOutOfBoundsClass := vm.NewSubscriptOutOfBoundsClass()
+	vm.Globals["SubscriptOutOfBounds"] = pile.ClassToObject(subscriptOutOfBoundsClass)
+
+	improperStoreClass := vm.NewImproperStoreClass()
+	vm.Globals["ImproperStore"] = pile.ClassToObject(improperStoreClass)
+
+	stackOverflowClass := vm.NewStackOverflowClass()
+	vm.Globals["StackOverflow"] = pile.ClassToObject(stackOverflowClass)
+
+	zeroDivideClass := vm.NewZeroDivideClass()
+	vm.Globals["ZeroDivide"] = pile.ClassToObject(zeroDivideClass)
+
+	warningClass := vm.NewWarningClass()
+	vm.Globals["Warning"] = pile.ClassToObject(warningClass)
+
+	illegalResumeAttemptClass := vm.NewIllegalResumeAttemptClass()
+	vm.Globals["IllegalResumeAttempt"] = pile.ClassToObject(illegalResumeAttemptClass)
+
+	interruptedClass := vm.NewInterruptedClass()
+	vm.Globals["Interrupted"] = pile.ClassToObject(interruptedClass)
+
+	timedOutClass := vm.NewTimedOutClass()
+	vm.Globals["TimedOut"] = pile.ClassToObject(timedOutClass)
+
+	haltClass := vm.NewHaltClass()
+	vm.Globals["Halt"] = pile.ClassToObject(haltClass)
+
+	contextPartClass := vm.NewContextPartClass()
+	vm.Globals["ContextPart"] = pile.ClassToObject(contextPartClass)
+
+	methodContextClass := vm.NewMethodContextClass()
+	vm.Globals["MethodContext"] = pile.ClassToObject(methodContextClass)
+
+	blockContextClass := vm.NewBlockContextClass()
+	vm.Globals["BlockContext"] = pile.ClassToObject(blockContextClass)
+
+	processClass := vm.NewProcessClass()
+	vm.Globals["Process"] = pile.ClassToObject(processClass)
+
+	processorSchedulerClass := vm.NewProcessorSchedulerClass()
+	vm.Globals["ProcessorScheduler"] = pile.ClassToObject(processorSchedulerClass)
+
+	semaphoreClass := vm.NewSemaphoreClass()
+	vm.Globals["Semaphore"] = pile.ClassToObject(semaphoreClass)
+
+	sharedQueueClass := vm.NewSharedQueueClass()
+	vm.Globals["SharedQueue"] = pile.ClassToObject(sharedQueueClass)
+
+	delayClass := vm.NewDelayClass()
+	vm.Globals["Delay"] = pile.ClassToObject(delayClass)
+
+	// Give the classes their metaclasses, other classes get theirs when they first need one
+	for _, global := range vm.Globals {
+		if isClass(global) {
+			vm.classOfClass(pile.ObjectToClass(global))
+		}
+	}
+
+	// Initialize the executor and the scheduler, Processor is its only instance
 	vm.Executor = NewExecutor(vm)
+	vm.Processor = newProcessorScheduler(vm)
+	vm.Globals["Processor"] = pile.NewInstance(processorSchedulerClass)
+	vm.Globals["Processor"].SetClass(vm.Globals["ProcessorScheduler"])
 
 	// Register the VM as a block executor
 	vm.RegisterAsBlockExecutor()
 
+	// Compile the kernel methods that fall back to Smalltalk code
+	vm.installKernelMethods()
+
 	return vm
 }
 
@@ -92,11 +247,39 @@ func (vm *VM) NewObjectClass() *pile.Class {
 		Primitive(5). // basicClass primitive
 		Go("basicClass")
 
-	// should not be here
-	// new method (creates a new instance of the class)
+	// doesNotUnderstand: method (signals MessageNotUnderstood for a send with no method)
+	compiler.NewMethodBuilder(result).
+		Primitive(80). // doesNotUnderstand: primitive
+		Go("doesNotUnderstand:")
+
+	// isKindOf: method (whether the receiver is an instance of a class or its subclasses)
+	compiler.NewMethodBuilder(result).Primitive(170).Go("isKindOf:")
+
+	// halt method (pauses the debugger, or signals Halt without one)
+	compiler.NewMethodBuilder(result).Primitive(171).Go("halt")
+
+	// primitiveFailed method (signals PrimitiveFailed from the fallback code of a primitive method)
+	compiler.NewMethodBuilder(result).Primitive(175).Go("primitiveFailed")
+
+	// perform:with: method (sends a one-argument message named by a Symbol)
 	compiler.NewMethodBuilder(result).
-		Primitive(60). // new primitive
-		Go("new")
+		Primitive(82). // performWith primitive
+		Go("perform:with:")
+
+	// adaptToInteger:andSend: and the other adaptTo methods (signal an Error
+	// for arithmetic with an argument that is not a number, see kernelMethods)
+	compiler.NewMethodBuilder(result).
+		Primitive(83). // notANumber primitive
+		Go("adaptToInteger:andSend:")
+	compiler.NewMethodBuilder(result).
+		Primitive(83). // notANumber primitive
+		Go("adaptToFraction:andSend:")
+	compiler.NewMethodBuilder(result).
+		Primitive(83). // notANumber primitive
+		Go("adaptToScaledDecimal:andSend:")
+	compiler.NewMethodBuilder(result).
+		Primitive(83). // notANumber primitive
+		Go("adaptToFloat:andSend:")
 
 	// class method - a more user-friendly name for accessing an object's class
 	// class implementation: ^self basicClass
@@ -111,81 +294,96 @@ func (vm *VM) NewObjectClass() *pile.Class {
 }
 
 func (vm *VM) NewIntegerClass() *pile.Class {
-	objectClass := pile.ObjectToClass(vm.Globals["Object"])
-	result := pile.NewClass("Integer", objectClass)
+	numberClass := pile.ObjectToClass(vm.Globals["Number"])
+	result := pile.NewClass("Integer", numberClass)
 
-	// Add primitive methods to the Integer class - create a new builder for each method
-	
-	// + method (addition)
-	compiler.NewMethodBuilder(result).Primitive(1).Go("+")
+	// asFloat method (conversion)
+	compiler.NewMethodBuilder(result).Primitive(8).Go("asFloat")
 
-	// - method (subtraction)
-	compiler.NewMethodBuilder(result).Primitive(4).Go("-")
+	// Division rounding down (// and \\) and towards zero (quo: and rem:)
+	compiler.NewMethodBuilder(result).Primitive(100).Go("//")
+	compiler.NewMethodBuilder(result).Primitive(101).Go("\\\\")
+	compiler.NewMethodBuilder(result).Primitive(102).Go("quo:")
+	compiler.NewMethodBuilder(result).Primitive(103).Go("rem:")
 
-	// * method (multiplication)
-	compiler.NewMethodBuilder(result).Primitive(2).Go("*")
+	// Bitwise methods, negative integers act as two's complement
+	compiler.NewMethodBuilder(result).Primitive(106).Go("bitAnd:")
+	compiler.NewMethodBuilder(result).Primitive(107).Go("bitOr:")
+	compiler.NewMethodBuilder(result).Primitive(108).Go("bitXor:")
+	compiler.NewMethodBuilder(result).Primitive(109).Go("bitShift:")
 
-	// = method (equality)
-	compiler.NewMethodBuilder(result).Primitive(3).Go("=")
+	// printString and printString: methods (the digits as a String)
+	compiler.NewMethodBuilder(result).Primitive(110).Go("printString")
+	compiler.NewMethodBuilder(result).Primitive(111).Go("printString:")
 
-	// < method (less than)
-	compiler.NewMethodBuilder(result).Primitive(6).Go("<")
+	// gcd: method (the greatest common divisor)
+	compiler.NewMethodBuilder(result).Primitive(113).Go("gcd:")
 
-	// > method (greater than)
-	compiler.NewMethodBuilder(result).Primitive(7).Go(">")
+	// The arithmetic methods are compiled with their fallback code, see kernelMethods
 
 	return result
 }
 
 func (vm *VM) NewFloatClass() *pile.Class {
-	objectClass := pile.ObjectToClass(vm.Globals["Object"])
-	result := pile.NewClass("Float", objectClass) // then even later when we have real images all this initialization can go away
-
-	// Add primitive methods to the Float class - create a new builder for each method
-	
-	// + method (addition)
-	compiler.NewMethodBuilder(result).Primitive(10).Go("+")
+	numberClass := pile.ObjectToClass(vm.Globals["Number"])
+	result := pile.NewClass("Float", numberClass) // then even later when we have real images all this initialization can go away
 
-	// - method (subtraction)
-	compiler.NewMethodBuilder(result).Primitive(11).Go("-")
+	// Math functions (the Number versions convert to a Float first)
+	compiler.NewMethodBuilder(result).Primitive(140).Go("sqrt")
+	compiler.NewMethodBuilder(result).Primitive(141).Go("ln")
+	compiler.NewMethodBuilder(result).Primitive(142).Go("exp")
+	compiler.NewMethodBuilder(result).Primitive(143).Go("sin")
+	compiler.NewMethodBuilder(result).Primitive(144).Go("cos")
+	compiler.NewMethodBuilder(result).Primitive(145).Go("tan")
+	compiler.NewMethodBuilder(result).Primitive(146).Go("arcSin")
+	compiler.NewMethodBuilder(result).Primitive(147).Go("arcCos")
+	compiler.NewMethodBuilder(result).Primitive(148).Go("arcTan")
 
-	// * method (multiplication)
-	compiler.NewMethodBuilder(result).Primitive(12).Go("*")
+	// Testing methods (Number answers false to both)
+	compiler.NewMethodBuilder(result).Primitive(149).Go("isNaN")
+	compiler.NewMethodBuilder(result).Primitive(150).Go("isInfinite")
 
-	// / method (division)
-	compiler.NewMethodBuilder(result).Primitive(13).Go("/")
+	// printString method (the shortest digits that read back as the same float)
+	compiler.NewMethodBuilder(result).Primitive(151).Go("printString")
 
-	// = method (equality)
-	compiler.NewMethodBuilder(result).Primitive(14).Go("=")
-
-	// < method (less than)
-	compiler.NewMethodBuilder(result).Primitive(15).Go("<")
-
-	// > method (greater than)
-	compiler.NewMethodBuilder(result).Primitive(16).Go(">")
+	// The arithmetic methods are compiled with their fallback code, see kernelMethods
 
 	return result
 }
 
 // NewInteger creates a new integer object
-// This returns an immediate value for integers
+// This returns an immediate value for integers that fit in 62 bits and a large integer otherwise
 func (vm *VM) NewInteger(value int64) *pile.Object {
-	// Check if the value fits in 62 bits
-	if value <= 0x1FFFFFFFFFFFFFFF && value >= -0x2000000000000000 {
-		// Use immediate integer
+	if value <= pile.MaxIntegerImmediate && value >= pile.MinIntegerImmediate {
 		return pile.MakeIntegerImmediate(value)
 	}
+	return vm.NewLargeInteger(big.NewInt(value))
+}
 
-	// Panic for large values that don't fit in 62 bits
-	panic("Integer value too large for immediate representation")
+// NewBoxedFloat64Class creates BoxedFloat64, the class of floats whose lowest
+// mantissa bits do not fit in an immediate float
+// Boxed floats get their methods from Float, whose primitives take either kind.
+func (vm *VM) NewBoxedFloat64Class() *pile.Class {
+	floatClass := pile.ObjectToClass(vm.Globals["Float"])
+	return pile.NewClass("BoxedFloat64", floatClass)
 }
 
+// NewFloat creates a float with the given value
+// This returns an immediate value if the value fits exactly and a BoxedFloat64 otherwise
 func (vm *VM) NewFloat(value float64) *pile.Object {
-	return pile.MakeFloatImmediate(value)
+	if pile.FitsFloatImmediate(value) {
+		return pile.MakeFloatImmediate(value)
+	}
+
+	vm.allocated()
+	boxedFloat := pile.BoxedFloatToObject(pile.NewBoxedFloatInternal(value))
+	boxedFloat.SetClass(vm.Globals["BoxedFloat64"])
+	return boxedFloat
 }
 
 // NewString creates a new string object
 func (vm *VM) NewString(value string) *pile.Object {
+	vm.allocated()
 	str := &pile.String{Object: pile.Object{TypeField: pile.OBJ_STRING}, Value: value}
 	strObj := pile.StringToObject(str)
 	strObj.SetClass(vm.Globals["String"])
@@ -194,6 +392,7 @@ func (vm *VM) NewString(value string) *pile.Object {
 
 // NewArray creates a new array object
 func (vm *VM) NewArray(size int) *pile.Object {
+	vm.allocated()
 	array := &pile.Array{Object: pile.Object{TypeField: pile.OBJ_ARRAY}, Elements: make([]*pile.Object, size)}
 	arrayObj := pile.ArrayToObject(array)
 	arrayObj.SetClass(vm.Globals["Array"])
@@ -287,19 +486,15 @@ func (vm *VM) NewBlockClass() *pile.Class {
 	// value: method (executes the block with one argument)
 	compiler.NewMethodBuilder(result).Primitive(22).Go("value:")
 
+	// newProcess method (answers a suspended process that evaluates the block)
+	compiler.NewMethodBuilder(result).Primitive(180).Go("newProcess")
+
 	return result
 }
 
 func (vm *VM) NewClassClass() *pile.Class {
-	objectClass := pile.ObjectToClass(vm.Globals["Object"])
-	result := pile.NewClass("Class", objectClass)
-
-	// Add primitive methods to the Class class - create a new builder for each method
-	
-	// new method (creates a new instance of the class)
-	compiler.NewMethodBuilder(result).Primitive(60).Go("new")
-
-	return result
+	behaviorClass := pile.ObjectToClass(vm.Globals["Behavior"])
+	return pile.NewClass("Class", behaviorClass)
 }
 
 // LoadImage loads a Smalltalk image from a file
@@ -308,16 +503,112 @@ func (vm *VM) LoadImage(path string) error {
 	return nil
 }
 
-// Execute executes the current context
+// Execute executes the current context until it returns to its sender
 func (vm *VM) Execute() (pile.ObjectInterface, error) {
-	// Execute using the executor
-	return vm.Executor.Execute()
+	context := vm.Executor.CurrentContext
+	vm.Executor.CurrentContext = context.Sender
+	return vm.ExecuteContext(context)
+}
+
+// UnhandledExceptionError is returned for a Smalltalk exception that was
+// signalled and not handled
+type UnhandledExceptionError struct {
+	// Exception is the exception that was signalled
+	Exception *pile.Object
+
+	// Walkback is the contexts that were running when it was signalled
+	Walkback *Walkback
+}
+
+// Error returns the error message
+func (e *UnhandledExceptionError) Error() string {
+	exception := pile.ObjectToException(e.Exception)
+	className := pile.ObjectToClass(e.Exception.Class()).Name
+	if text := exception.GetMessageText(); !pile.IsImmediate(text) && text.Type() == pile.OBJ_STRING {
+		return fmt.Sprintf("unhandled %s: %s", className, pile.ObjectToString(text).GetValue())
+	}
+	return fmt.Sprintf("unhandled %s", className)
+}
+
+// GetWalkback returns the contexts that were running when the exception was signalled
+func (e *UnhandledExceptionError) GetWalkback() *Walkback {
+	return e.Walkback
+}
+
+// unhandled unwinds the whole stack for an exception nothing handles, the
+// outermost context returns it as an UnhandledExceptionError, or as an
+// InterruptedError if it stopped the evaluation
+func (vm *VM) unhandled(exception *pile.Object) {
+	if interrupted := vm.unhandledInterrupt(exception); interrupted != nil {
+		panic(interrupted)
+	}
+	panic(&UnhandledExceptionError{Exception: exception, Walkback: vm.walkbackOf(vm.Executor.CurrentContext)})
+}
+
+// VMError is returned for a Go panic the VM did not turn into a Smalltalk
+// exception, such as a bytecode handler finding the stack empty
+type VMError struct {
+	// Value is the value the VM panicked with
+	Value interface{}
+
+	// Stack is the Go stack of the goroutine when it panicked
+	Stack []byte
+
+	// Walkback is the contexts that were running when it panicked, or nil if unknown
+	Walkback *Walkback
+}
+
+// Error returns the error message
+func (e *VMError) Error() string {
+	return fmt.Sprintf("VM error: %v", e.Value)
+}
+
+// GetWalkback returns the contexts that were running when the VM panicked
+func (e *VMError) GetWalkback() *Walkback {
+	return e.Walkback
+}
+
+// newVMError creates the VMError for a Go panic while context was running
+func (vm *VM) newVMError(value interface{}, context *Context) *VMError {
+	return &VMError{Value: value, Stack: debug.Stack(), Walkback: vm.walkbackOf(context)}
 }
 
 // ExecuteContext executes a single context until it returns
-func (vm *VM) ExecuteContext(context *Context) (pile.ObjectInterface, error) {
-	// Set the context in the Executor
-	vm.Executor.CurrentContext = context
+// Signalling an exception nothing handles unwinds to the outermost context,
+// the one with no sender, which returns it as an UnhandledExceptionError. Any
+// other panic that gets that far is returned as a VMError, so a bug in the VM
+// does not take the program embedding it down. Both have a walkback of the
+// contexts that were running. A process that terminates itself unwinds to it
+// as well and returns the termination. Interrupt can stop it, and so can
+// limits, see ExecuteContextWithLimits.
+func (vm *VM) ExecuteContext(context *Context) (result pile.ObjectInterface, err error) {
+	if context.Sender == nil {
+		if vm.Executor.CurrentContext == nil {
+			// A step that has not finished when the host's evaluation does is over
+			defer func() {
+				if vm.debugger != nil {
+					vm.debugger.step = nil
+				}
+			}()
+			if vm.Processor.active == vm.Processor.main {
+				defer vm.Processor.terminateLeftovers()
+			}
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				vm.Executor.CurrentContext = nil
+				result = nil
+				switch value := r.(type) {
+				case UncaughtError:
+					err = value
+				case *termination:
+					err = value
+				default:
+					err = vm.newVMError(r, nil)
+				}
+			}
+		}()
+	}
 
 	// Execute
 	return vm.Executor.ExecuteContext(context)
@@ -373,9 +664,14 @@ func (vm *VM) GetClass(obj *pile.Object) *pile.Class {
 
 	// If it's a regular object, proceed as before
 
-	// If the object is a class, return itself
+	// The class of a class is its metaclass
 	if obj.Type() == pile.OBJ_CLASS {
-		return pile.ObjectToClass(obj) // Later Metaclass
+		return vm.classOfClass(pile.ObjectToClass(obj))
+	}
+
+	// Methods are built without a class field, and are all CompiledMethods
+	if obj.Type() == pile.OBJ_METHOD && obj.Class() == nil {
+		return pile.ObjectToClass(vm.Globals["CompiledMethod"])
 	}
 
 	// Special case for nil object (legacy non-immediate nil)
@@ -407,7 +703,12 @@ func (vm *VM) LookupMethod(receiver *pile.Object, selector pile.ObjectInterface)
 		panic("lookupMethod: nil class\n")
 	}
 
-	// Look up the method in the class hierarchy
+	// Look up the method through the global method cache
+	return vm.lookupCached(class, selector)
+}
+
+// lookupMethodInHierarchy looks up a method in a class and its superclasses
+func (vm *VM) lookupMethodInHierarchy(class *pile.Class, selector pile.ObjectInterface) *pile.Object {
 	for class != nil {
 		// Check if the class has a method dictionary
 		methodDict := pile.ObjectToDictionary(class.MethodDictionary)
@@ -428,7 +729,7 @@ func (vm *VM) LookupMethod(receiver *pile.Object, selector pile.ObjectInterface)
 }
 
 // ExecutePrimitive executes a primitive method
-func (vm *VM) ExecutePrimitive(receiver *pile.Object, selector *pile.Object, args []*pile.Object, method *pile.Object) *pile.Object {
+func (vm *VM) ExecutePrimitive(receiver *pile.Object, selector *pile.Object, args []*pile.Object, method *pile.Object) (result *pile.Object) {
 	if receiver == nil {
 		panic("executePrimitive: nil receiver\n")
 	}
@@ -446,339 +747,38 @@ func (vm *VM) ExecutePrimitive(receiver *pile.Object, selector *pile.Object, arg
 		return nil
 	}
 
-	// Execute the primitive based on its index
-	switch methodObj.GetPrimitiveIndex() {
-	case 1: // Addition
-		// Handle immediate integers
-		if pile.IsIntegerImmediate(receiver) && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			val1 := pile.GetIntegerImmediate(receiver)
-			val2 := pile.GetIntegerImmediate(args[0])
-			result := val1 + val2
-			return vm.NewInteger(result)
-		}
-		// Handle non-immediate integers - should panic
-		if receiver.Type() == pile.OBJ_INTEGER || (len(args) > 0 && args[0].Type() == pile.OBJ_INTEGER) {
-			panic("Non-immediate integer encountered")
-		}
-		// Handle integer + float
-		if pile.IsIntegerImmediate(receiver) && len(args) == 1 && pile.IsFloatImmediate(args[0]) {
-			val1 := float64(pile.GetIntegerImmediate(receiver))
-			val2 := pile.GetFloatImmediate(args[0])
-			result := val1 + val2
-			return vm.NewFloat(result)
-		}
-	case 2: // Multiplication
-		// Handle immediate integers
-		if pile.IsIntegerImmediate(receiver) && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			val1 := pile.GetIntegerImmediate(receiver)
-			val2 := pile.GetIntegerImmediate(args[0])
-			result := val1 * val2
-			return vm.NewInteger(result)
-		}
-		// Handle non-immediate integers - should panic
-		if receiver.Type() == pile.OBJ_INTEGER || (len(args) > 0 && args[0].Type() == pile.OBJ_INTEGER) {
-			panic("Non-immediate integer encountered")
-		}
-	case 3: // Equality
-		// Handle immediate integers
-		if pile.IsIntegerImmediate(receiver) && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			val1 := pile.GetIntegerImmediate(receiver)
-			val2 := pile.GetIntegerImmediate(args[0])
-			result := val1 == val2
-			return pile.NewBoolean(result).(*pile.Object)
-		}
-		// Handle non-immediate integers - should panic
-		if receiver.Type() == pile.OBJ_INTEGER || (len(args) > 0 && args[0].Type() == pile.OBJ_INTEGER) {
-			panic("Non-immediate integer encountered")
-		}
-	case 4: // Subtraction
-		// Handle immediate integers
-		if pile.IsIntegerImmediate(receiver) && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			val1 := pile.GetIntegerImmediate(receiver)
-			val2 := pile.GetIntegerImmediate(args[0])
-			result := val1 - val2
-			return vm.NewInteger(result)
-		}
-		// Handle non-immediate integers - should panic
-		if receiver.Type() == pile.OBJ_INTEGER || (len(args) > 0 && args[0].Type() == pile.OBJ_INTEGER) {
-			panic("Non-immediate integer encountered")
-		}
-	case 5: // basicClass - return the class of the receiver
-		class := vm.GetClass(receiver)
-		return pile.ClassToObject(class)
-	case 6: // Less than
-		// Handle immediate integers
-		if pile.IsIntegerImmediate(receiver) && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			val1 := pile.GetIntegerImmediate(receiver)
-			val2 := pile.GetIntegerImmediate(args[0])
-			result := val1 < val2
-			return pile.NewBoolean(result).(*pile.Object)
-		}
-		// Handle non-immediate integers - should panic
-		if receiver.Type() == pile.OBJ_INTEGER || (len(args) > 0 && args[0].Type() == pile.OBJ_INTEGER) {
-			panic("Non-immediate integer encountered")
-		}
-	case 7: // Greater than
-		// Handle immediate integers
-		if pile.IsIntegerImmediate(receiver) && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			val1 := pile.GetIntegerImmediate(receiver)
-			val2 := pile.GetIntegerImmediate(args[0])
-			result := val1 > val2
-			return pile.NewBoolean(result).(*pile.Object)
-		}
-		// Handle non-immediate integers - should panic
-		if receiver.Type() == pile.OBJ_INTEGER || (len(args) > 0 && args[0].Type() == pile.OBJ_INTEGER) {
-			panic("Non-immediate integer encountered")
-		}
-	case 10: // Float addition
-		// Handle float + float
-		if pile.IsFloatImmediate(receiver) && len(args) == 1 && pile.IsFloatImmediate(args[0]) {
-			val1 := pile.GetFloatImmediate(receiver)
-			val2 := pile.GetFloatImmediate(args[0])
-			result := val1 + val2
-			return vm.NewFloat(result)
-		}
-		// Handle float + integer
-		if pile.IsFloatImmediate(receiver) && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			val1 := pile.GetFloatImmediate(receiver)
-			val2 := float64(pile.GetIntegerImmediate(args[0]))
-			result := val1 + val2
-			return vm.NewFloat(result)
-		}
-	case 11: // Float subtraction
-		// Handle float - float
-		if pile.IsFloatImmediate(receiver) && len(args) == 1 && pile.IsFloatImmediate(args[0]) {
-			val1 := pile.GetFloatImmediate(receiver)
-			val2 := pile.GetFloatImmediate(args[0])
-			result := val1 - val2
-			return vm.NewFloat(result)
-		}
-		// Handle float - integer
-		if pile.IsFloatImmediate(receiver) && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			val1 := pile.GetFloatImmediate(receiver)
-			val2 := float64(pile.GetIntegerImmediate(args[0]))
-			result := val1 - val2
-			return vm.NewFloat(result)
-		}
-	case 12: // Float multiplication
-		// Handle float * float
-		if pile.IsFloatImmediate(receiver) && len(args) == 1 && pile.IsFloatImmediate(args[0]) {
-			val1 := pile.GetFloatImmediate(receiver)
-			val2 := pile.GetFloatImmediate(args[0])
-			result := val1 * val2
-			return vm.NewFloat(result)
-		}
-		// Handle float * integer
-		if pile.IsFloatImmediate(receiver) && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			val1 := pile.GetFloatImmediate(receiver)
-			val2 := float64(pile.GetIntegerImmediate(args[0]))
-			result := val1 * val2
-			return vm.NewFloat(result)
-		}
-	case 13: // Float division
-		// Handle float / float
-		if pile.IsFloatImmediate(receiver) && len(args) == 1 && pile.IsFloatImmediate(args[0]) {
-			val1 := pile.GetFloatImmediate(receiver)
-			val2 := pile.GetFloatImmediate(args[0])
-			result := val1 / val2
-			return vm.NewFloat(result)
-		}
-		// Handle float / integer
-		if pile.IsFloatImmediate(receiver) && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			val1 := pile.GetFloatImmediate(receiver)
-			val2 := float64(pile.GetIntegerImmediate(args[0]))
-			result := val1 / val2
-			return vm.NewFloat(result)
-		}
-	case 14: // Float equality
-		// Handle float = float
-		if pile.IsFloatImmediate(receiver) && len(args) == 1 && pile.IsFloatImmediate(args[0]) {
-			val1 := pile.GetFloatImmediate(receiver)
-			val2 := pile.GetFloatImmediate(args[0])
-			result := val1 == val2
-			return pile.NewBoolean(result).(*pile.Object)
-		}
-		// Handle float = integer
-		if pile.IsFloatImmediate(receiver) && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			val1 := pile.GetFloatImmediate(receiver)
-			val2 := float64(pile.GetIntegerImmediate(args[0]))
-			result := val1 == val2
-			return pile.NewBoolean(result).(*pile.Object)
-		}
-	case 15: // Float less than
-		// Handle float < float
-		if pile.IsFloatImmediate(receiver) && len(args) == 1 && pile.IsFloatImmediate(args[0]) {
-			val1 := pile.GetFloatImmediate(receiver)
-			val2 := pile.GetFloatImmediate(args[0])
-			result := val1 < val2
-			return pile.NewBoolean(result).(*pile.Object)
-		}
-		// Handle float < integer
-		if pile.IsFloatImmediate(receiver) && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			val1 := pile.GetFloatImmediate(receiver)
-			val2 := float64(pile.GetIntegerImmediate(args[0]))
-			result := val1 < val2
-			return pile.NewBoolean(result).(*pile.Object)
-		}
-	case 16: // Float greater than
-		// Handle float > float
-		if pile.IsFloatImmediate(receiver) && len(args) == 1 && pile.IsFloatImmediate(args[0]) {
-			val1 := pile.GetFloatImmediate(receiver)
-			val2 := pile.GetFloatImmediate(args[0])
-			result := val1 > val2
-			return pile.NewBoolean(result).(*pile.Object)
-		}
-		// Handle float > integer
-		if pile.IsFloatImmediate(receiver) && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			val1 := pile.GetFloatImmediate(receiver)
-			val2 := float64(pile.GetIntegerImmediate(args[0]))
-			result := val1 > val2
-			return pile.NewBoolean(result).(*pile.Object)
-		}
-	case 20: // Block new - create a new block instance
-		if receiver.Type() == pile.OBJ_CLASS && receiver == vm.Globals["Block"] {
-			// Create a new block instance with proper class field
-			blockInstance := vm.NewBlock(vm.Executor.CurrentContext)
-			return blockInstance
-		}
-	case 21: // Block value - execute a block with no arguments
-		if receiver.Type() == pile.OBJ_BLOCK {
-			// Get the block
-			block := pile.ObjectToBlock(receiver)
-
-			// Create a method object for the block's bytecodes
-			method := &pile.Method{
-				Object: pile.Object{
-					TypeField: pile.OBJ_METHOD,
-				},
-				Bytecodes: block.GetBytecodes(),
-				Literals:  block.GetLiterals(),
-			}
-			methodObj := pile.MethodToObject(method)
-
-			// Create a new context for the block execution
-			blockContext := NewContext(methodObj, receiver, []*pile.Object{}, block.GetOuterContext().(*Context))
-
-			// Execute the block's bytecodes
-			result, err := vm.ExecuteContext(blockContext)
-			if err != nil {
-				panic(fmt.Sprintf("Error executing block: %v", err))
-			}
-			return result.(*pile.Object)
-		}
-	case 22: // Block value: - execute a block with one argument
-		if receiver.Type() == pile.OBJ_BLOCK && len(args) == 1 {
-			// Get the block
-			block := pile.ObjectToBlock(receiver)
-
-			// Create a method object for the block's bytecodes
-			method := &pile.Method{
-				Object: pile.Object{
-					TypeField: pile.OBJ_METHOD,
-				},
-				Bytecodes: block.GetBytecodes(),
-				Literals:  block.GetLiterals(),
-			}
-			methodObj := pile.MethodToObject(method)
-
-			// Create a new context for the block execution
-			blockContext := NewContext(methodObj, receiver, args, block.GetOuterContext().(*Context))
-
-			// Execute the block's bytecodes
-			result, err := vm.ExecuteContext(blockContext)
-			if err != nil {
-				panic(fmt.Sprintf("Error executing block: %v", err))
-			}
-			return result.(*pile.Object)
-		}
-	case 30: // String size - return the length of the string
-		if receiver.Type() == pile.OBJ_STRING {
-			// Get the string
-			str := pile.ObjectToString(receiver)
-
-			// Get the length of the string
-			length := str.Length()
-
-			// Return the length as an integer
-			return vm.NewInteger(int64(length))
-		}
-	case 40: // Array at: - return the element at the given index
-		if receiver.Type() == pile.OBJ_ARRAY && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			// Get the array
-			array := pile.ObjectToArray(receiver)
-
-			// Get the index (1-based in Smalltalk, 0-based in Go)
-			index := pile.GetIntegerImmediate(args[0]) - 1
-
-			// Check bounds
-			if index < 0 || int(index) >= array.Size() {
-				panic(fmt.Sprintf("Array index out of bounds: %d", index+1))
-			}
-
-			// Return the element at the given index
-			return array.At(int(index))
-		}
-	case 50: // ByteArray at: - return the byte at the given index
-		if receiver.Type() == pile.OBJ_BYTE_ARRAY && len(args) == 1 && pile.IsIntegerImmediate(args[0]) {
-			// Get the byte array
-			byteArray := pile.ObjectToByteArray(receiver)
-
-			// Get the index (1-based in Smalltalk, 0-based in Go)
-			index := pile.GetIntegerImmediate(args[0]) - 1
-
-			// Check bounds
-			if index < 0 || int(index) >= byteArray.Size() {
-				panic(fmt.Sprintf("ByteArray index out of bounds: %d", index+1))
-			}
-
-			// Return the byte at the given index as an integer
-			return vm.NewInteger(int64(byteArray.At(int(index))))
-		}
-	case 51: // ByteArray at:put: - set the byte at the given index
-		if receiver.Type() == pile.OBJ_BYTE_ARRAY && len(args) == 2 &&
-			pile.IsIntegerImmediate(args[0]) && pile.IsIntegerImmediate(args[1]) {
-			// Get the byte array
-			byteArray := pile.ObjectToByteArray(receiver)
-
-			// Get the index (1-based in Smalltalk, 0-based in Go)
-			index := pile.GetIntegerImmediate(args[0]) - 1
-
-			// Get the value
-			value := pile.GetIntegerImmediate(args[1])
-
-			// Check bounds
-			if index < 0 || int(index) >= byteArray.Size() {
-				panic(fmt.Sprintf("ByteArray index out of bounds: %d", index+1))
-			}
+	vm.primitiveFailure = ""
 
-			// Check value range (0-255)
-			if value < 0 || value > 255 {
-				panic(fmt.Sprintf("ByteArray value out of range (0-255): %d", value))
-			}
-
-			// Set the byte at the given index
-			byteArray.AtPut(int(index), byte(value))
-
-			// Return the value
-			return args[1]
-		}
-	case 60: // Class new - create a new instance of a class
-		if receiver.Type() == pile.OBJ_CLASS {
-			// Get the class
-			class := pile.ObjectToClass(receiver)
+	// Find the primitive by its number or name
+	primitive := vm.Primitives.primitiveFor(methodObj)
+	if primitive == nil {
+		// Primitives that are not loaded, or that this VM does not have, fail
+		return vm.FailPrimitive(PrimitiveUnsupported)
+	}
 
-			// Create a new instance of the class
-			instance := pile.NewInstance(class)
+	// Disabled primitives and unexpected arguments fail, falling through to the method
+	if primitive.disabled {
+		return vm.FailPrimitive(PrimitiveUnsupported)
+	}
+	if len(args) != primitive.Arity {
+		return vm.FailPrimitive(PrimitiveBadNumberOfArguments)
+	}
+	if !vm.acceptsReceiver(primitive, methodObj, receiver) {
+		return vm.FailPrimitive(PrimitiveBadReceiver)
+	}
 
-			// We need to explicitly set the class of the instance
-			instance.SetClass(receiver)
+	// The profiler counts the primitive's time as its own
+	if vm.profiler != nil {
+		defer vm.profiler.primitive(methodObj, primitive)()
+	}
 
-			return instance
+	// A primitive that panics signals an exception instead, and answers the value of the handler
+	defer func() {
+		if r := recover(); r != nil {
+			result = vm.signalPrimitivePanic(r, receiver, args, methodObj)
 		}
-	default:
-		panic("executePrimitive: unknown primitive index\n")
-	}
-	return nil // Fall through to method
+	}()
+	return primitive.Function(vm, receiver, args)
 }
 
 // GetGlobals returns the globals map as a slice
@@ -39,7 +39,7 @@ func TestGetClass(t *testing.T) {
 		{
 			name:     "Class",
 			obj:      pile.ClassToObject(pile.ObjectToClass(virtualMachine.Globals["Object"])),
-			expected: pile.ObjectToClass(virtualMachine.Globals["Object"]), // A class is its own class
+			expected: pile.ObjectToClass(virtualMachine.Globals["Object"].Class()), // Object class, its metaclass
 		},
 	}
 
@@ -65,10 +65,10 @@ func TestLookupMethod(t *testing.T) {
 		t.Errorf("Expected nil for non-existent method, got %v", method)
 	}
 
-	// 5. Look up a method on a class object directly
+	// 5. Look up a method on a class object directly, which looks in its metaclass
 	method = virtualMachine.LookupMethod(pile.ClassToObject(arrayClass), sizeSelector)
-	if method != sizeMethod {
-		t.Errorf("Expected to find size method from Object class when looking up on class, got %v", method)
+	if method != nil {
+		t.Errorf("Expected the class not to understand its instances' size method, got %v", method)
 	}
 
 	// 6. Test with nil class
@@ -162,9 +162,11 @@ func TestLookupMethodWithInheritance(t *testing.T) {
 		t.Errorf("Expected to find size method in Collection class, got %v", method)
 	}
 
-	// 4. Method lookup should work with class objects too
+	// 4. Class objects look methods up in the metaclass hierarchy, which has the class-side methods
+	classSizeMethod := compiler.NewMethodBuilder(virtualMachine.GetClass(pile.ClassToObject(collectionClass))).
+		Go("size")
 	method = virtualMachine.LookupMethod(pile.ClassToObject(arrayClass), sizeSelector)
-	if method != collectionSizeMethod {
+	if method != classSizeMethod {
 		t.Errorf("Expected to find size method in Collection class when looking up on class, got %v", method)
 	}
 }
@@ -0,0 +1,237 @@
+package vm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"smalltalklsp/interpreter/pile"
+)
+
+// The walkback of an uncaught error shows this many of the innermost and outermost contexts
+const (
+	uncaughtInnermost = 50
+	uncaughtOutermost = 10
+)
+
+// UncaughtError is an error that stopped execution because nothing in
+// Smalltalk handled it, an UnhandledExceptionError or a VMError
+type UncaughtError interface {
+	error
+
+	// GetWalkback returns the contexts that were running when it happened, or nil if unknown
+	GetWalkback() *Walkback
+}
+
+// Walkback describes the chain of contexts an error happened in, innermost first
+// Very deep chains leave out contexts from the middle, see NewWalkback.
+type Walkback struct {
+	// Frames are the contexts shown, innermost first
+	Frames []WalkbackFrame `json:"frames"`
+
+	// Omitted is the number of contexts left out after the first OmittedAfter frames
+	Omitted      int `json:"omitted,omitempty"`
+	OmittedAfter int `json:"omittedAfter,omitempty"`
+}
+
+// WalkbackFrame describes one context of a walkback
+type WalkbackFrame struct {
+	// Method is the method as Class>>selector, see describeContext
+	Method string `json:"method"`
+
+	// Class is the class of the receiver and MethodClass the class the method is in
+	Class       string `json:"class"`
+	MethodClass string `json:"methodClass,omitempty"`
+
+	// Selector is the selector of the method, or of the method a block is in
+	Selector string `json:"selector"`
+
+	// Block is true for a block context
+	Block bool `json:"block,omitempty"`
+
+	// Line is the 1-based source line being executed, and Source the source of
+	// the expression, both from the method's debug info, 0 and "" without it
+	Line   int    `json:"line,omitempty"`
+	Source string `json:"source,omitempty"`
+
+	// Receiver and Arguments are the print strings of the receiver and the arguments
+	Receiver  string   `json:"receiver"`
+	Arguments []string `json:"arguments"`
+}
+
+// NewWalkback describes the call chain ending in context, leaving out all but
+// the innermost and outermost contexts if it is very deep
+func (vm *VM) NewWalkback(context *Context) *Walkback {
+	return vm.newWalkback(context, uncaughtInnermost, uncaughtOutermost)
+}
+
+// newWalkback describes the call chain ending in context, leaving out all but
+// the given number of innermost and outermost contexts
+func (vm *VM) newWalkback(context *Context, innermost int, outermost int) *Walkback {
+	contexts, omitted := walkbackContexts(context, innermost, outermost)
+	result := &Walkback{Frames: make([]WalkbackFrame, 0, len(contexts))}
+	if omitted > 0 {
+		result.Omitted, result.OmittedAfter = omitted, innermost
+	}
+	for _, c := range contexts {
+		result.Frames = append(result.Frames, vm.walkbackFrame(c))
+	}
+	return result
+}
+
+// walkbackOf answers the walkback of an error while context was running, or
+// nil if there is no context or the contexts are too broken to describe
+func (vm *VM) walkbackOf(context *Context) (result *Walkback) {
+	if context == nil {
+		return nil
+	}
+	defer func() {
+		if recover() != nil {
+			result = nil
+		}
+	}()
+	return vm.NewWalkback(context)
+}
+
+// walkbackFrame describes one context for a walkback
+func (vm *VM) walkbackFrame(context *Context) WalkbackFrame {
+	home := context
+	for home.block && home.Sender != nil {
+		home = home.Sender
+	}
+	method := pile.ObjectToMethod(home.Method)
+
+	frame := WalkbackFrame{
+		Method:    vm.describeContext(context),
+		Class:     vm.GetClass(context.GetReceiver()).Name,
+		Selector:  "doIt",
+		Block:     context.block,
+		Receiver:  vm.printString(context.GetReceiver()),
+		Arguments: make([]string, 0, len(context.Arguments)),
+	}
+	if method.MethodClass != nil {
+		frame.MethodClass = method.MethodClass.Name
+	}
+	if method.Selector != nil {
+		frame.Selector = pile.GetSymbolValue(method.Selector)
+	}
+
+	// A context waiting on a send is past it already, the instruction it decoded last is the send
+	pc := context.PC
+	if context.instructionPC >= 0 {
+		pc = context.instructionPC
+	}
+	frame.Line = context.GetDebugInfo().LineAt(pc)
+	frame.Source = context.GetDebugInfo().SourceAt(pc)
+
+	for _, arg := range context.Arguments {
+		frame.Arguments = append(frame.Arguments, vm.printString(arg))
+	}
+	return frame
+}
+
+// describeContext returns the method a context is running as Class>>selector,
+// with the class the method is in if that is a superclass of the receiver's
+func (vm *VM) describeContext(context *Context) string {
+	if context.block {
+		if context.Sender == nil {
+			return "[] in ?"
+		}
+		return "[] in " + vm.describeContext(context.Sender)
+	}
+
+	method := pile.ObjectToMethod(context.Method)
+	className := vm.GetClass(context.GetReceiver()).Name
+	if method.MethodClass != nil && method.MethodClass.Name != className {
+		className = fmt.Sprintf("%s(%s)", className, method.MethodClass.Name)
+	}
+	selector := "doIt"
+	if method.Selector != nil {
+		selector = pile.GetSymbolValue(method.Selector)
+	}
+	return className + ">>" + selector
+}
+
+// String renders the walkback as text, one context per line, innermost first
+func (w *Walkback) String() string {
+	lines := make([]string, 0, len(w.Frames)+1)
+	for i, frame := range w.Frames {
+		if w.Omitted > 0 && i == w.OmittedAfter {
+			lines = append(lines, fmt.Sprintf("...%d more...", w.Omitted))
+		}
+		lines = append(lines, frame.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// String renders the frame as the method, the line and the receiver and arguments
+func (f WalkbackFrame) String() string {
+	result := f.Method
+	if f.Line > 0 {
+		result += fmt.Sprintf(" (line %d)", f.Line)
+	}
+	result += " receiver: " + f.Receiver
+	if len(f.Arguments) > 0 {
+		result += " arguments: " + strings.Join(f.Arguments, ", ")
+	}
+	return result
+}
+
+// walkbackContexts returns the contexts in the call chain ending in context,
+// innermost first, and the number left out after the innermost few if the
+// chain is deeper than innermost and outermost together
+func walkbackContexts(context *Context, innermost int, outermost int) ([]*Context, int) {
+	var contexts []*Context
+	omitted := 0
+	for c := context; c != nil; c = c.Caller() {
+		if len(contexts) == innermost && c.depth > outermost {
+			omitted = c.depth - outermost
+			for c != nil && c.depth > outermost {
+				c = c.Caller()
+			}
+			if c == nil {
+				break
+			}
+		}
+		contexts = append(contexts, c)
+	}
+	return contexts, omitted
+}
+
+// printString describes an object for a walkback in Go, since sending it
+// printString could fail as well
+func (vm *VM) printString(object *pile.Object) string {
+	switch {
+	case pile.IsIntegerImmediate(object):
+		return strconv.FormatInt(pile.GetIntegerImmediate(object), 10)
+	case pile.IsLargeInteger(object):
+		return pile.ObjectToLargeInteger(object).String()
+	}
+	if value, ok := floatValue(object); ok {
+		return floatPrintString(value)
+	}
+	if pile.IsImmediate(object) {
+		return object.String()
+	}
+
+	switch object.Type() {
+	case pile.OBJ_STRING, pile.OBJ_SYMBOL:
+		return object.String()
+	case pile.OBJ_CLASS:
+		return pile.ObjectToClass(object).Name
+	case pile.OBJ_CONTEXT:
+		object = vm.ContextObject(ObjectToContext(object))
+	}
+	if vm.isInstanceOf(object, "Fraction") {
+		return pile.ObjectToString(vm.primitiveFractionPrintString(object, nil)).GetValue()
+	}
+	if vm.isInstanceOf(object, "ScaledDecimal") {
+		return pile.ObjectToString(vm.primitiveScaledDecimalPrintString(object, nil)).GetValue()
+	}
+
+	className := vm.GetClass(object).Name
+	if strings.ContainsAny(className[:1], "AEIOU") {
+		return "an " + className
+	}
+	return "a " + className
+}
@@ -0,0 +1,75 @@
+package vm_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"smalltalklsp/interpreter/vm"
+)
+
+// TestWalkback tests the walkback of an unhandled exception
+func TestWalkback(t *testing.T) {
+	virtualMachine := newTestVM(t, "WalkbackTest", nil,
+		"divide: aNumber\n\t^10 / aNumber",
+		"callDivide ^[:n | self divide: n] value: 0")
+
+	_, err := executeExpression(t, virtualMachine, "WalkbackTest new callDivide")
+	var uncaught vm.UncaughtError
+	if !errors.As(err, &uncaught) || uncaught.GetWalkback() == nil {
+		t.Fatalf("Expected an uncaught error with a walkback, got %v", err)
+	}
+
+	walkback := uncaught.GetWalkback()
+	expected := strings.Join([]string{
+		"WalkbackTest>>divide: (line 2) receiver: a WalkbackTest arguments: 0",
+		"[] in WalkbackTest>>callDivide (line 1) receiver: a WalkbackTest arguments: 0",
+		"WalkbackTest>>callDivide (line 1) receiver: a WalkbackTest",
+		"UndefinedObject(Object)>>doIt (line 1) receiver: nil",
+	}, "\n")
+	if walkback.String() != expected {
+		t.Errorf("Expected walkback\n%s\ngot\n%s", expected, walkback.String())
+	}
+
+	frame := walkback.Frames[0]
+	if frame.Class != "WalkbackTest" || frame.Selector != "divide:" || frame.Source != "10 / aNumber" || frame.Block {
+		t.Errorf("Unexpected innermost frame %+v", frame)
+	}
+	if frame := walkback.Frames[1]; frame.Selector != "callDivide" || !frame.Block {
+		t.Errorf("Expected the block in callDivide, got %+v", frame)
+	}
+
+	// Editors get the frames as JSON
+	data, err := json.Marshal(walkback)
+	if err != nil {
+		t.Fatalf("Error marshalling the walkback: %v", err)
+	}
+	var decoded vm.Walkback
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded.Frames) != 4 || decoded.Frames[0].Line != 2 {
+		t.Errorf("Expected the walkback to survive JSON, got %s (%v)", data, err)
+	}
+	if !strings.Contains(string(data), `"selector":"divide:"`) {
+		t.Errorf("Expected the selector in the JSON, got %s", data)
+	}
+}
+
+// TestWalkbackOfDeepChain tests that a deep walkback leaves out its middle
+func TestWalkbackOfDeepChain(t *testing.T) {
+	virtualMachine := vm.NewVM()
+	virtualMachine.MaxContextDepth = 100
+	virtualMachine.CompileMethod(virtualMachine.Globals["Integer"], "recurse ^self recurse", "")
+	_, err := executeExpression(t, virtualMachine, "3 recurse")
+	var unhandled *vm.UnhandledExceptionError
+	if !errors.As(err, &unhandled) || unhandled.Walkback == nil {
+		t.Fatalf("Expected an unhandled exception with a walkback, got %v", err)
+	}
+
+	// The innermost 50 and outermost 10 of the 100 contexts
+	if walkback := unhandled.Walkback; len(walkback.Frames) != 60 || walkback.Omitted != 40 || walkback.OmittedAfter != 50 {
+		t.Errorf("Expected 60 frames with 40 left out, got %d, %d left out after %d", len(walkback.Frames), walkback.Omitted, walkback.OmittedAfter)
+	}
+	if !strings.Contains(unhandled.Walkback.String(), "Integer>>recurse (line 1) receiver: 3\n...40 more...\nInteger>>recurse") {
+		t.Errorf("Expected the text to show where contexts are left out, got\n%s", unhandled.Walkback)
+	}
+}